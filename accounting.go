@@ -0,0 +1,149 @@
+package kubegrpc
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Metric names of the RPC accounting, see WithRPCAccounting
+const (
+	// MetricEndpointRequests - Counter of the RPCs per endpoint by service, endpoint labels (see
+	// SetEndpointMetricLabels, default pod) and status code
+	MetricEndpointRequests = "kubegrpc_endpoint_requests"
+	// MetricEndpointLatency - Histogram of the RPC latency in seconds per endpoint by service and endpoint labels
+	MetricEndpointLatency = "kubegrpc_endpoint_latency_seconds"
+)
+
+// latencyBounds - Upper bounds of the latency histogram buckets, the last bucket holds everything above
+var latencyBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// LatencyBucket - Bucket of the latency histogram of an endpoint
+type LatencyBucket struct {
+	UpperBound time.Duration // 0 for the last bucket, which holds all latencies above the previous bound
+	Count      uint64
+}
+
+// RPCStats - RPC accounting of an endpoint since the connection was created, see WithRPCAccounting. Unary RPCs are
+// counted with their latency, streams are counted when set up.
+type RPCStats struct {
+	Requests uint64
+	Errors   uint64                // RPCs which did not end with OK
+	Codes    map[codes.Code]uint64 // RPCs by status code
+	Latency  []LatencyBucket       // Latency histogram of the unary RPCs
+}
+
+// Quantile - Upper bound of the latency bucket holding the quantile q (0-1] of the unary RPCs. 0 without RPCs, and
+// for quantiles in the last bucket the largest bound.
+func (s *RPCStats) Quantile(q float64) time.Duration {
+	var total uint64
+	for _, b := range s.Latency {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(total))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for _, b := range s.Latency {
+		seen += b.Count
+		if seen >= rank {
+			if b.UpperBound == 0 {
+				break
+			}
+			return b.UpperBound
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// WithRPCAccounting - Records per endpoint request counts, status codes and latency histograms. They are reported
+// to the metrics sink (MetricEndpointRequests, MetricEndpointLatency) and in the RPC field of the endpoint statistics,
+// so scorers can pick by load or latency.
+func WithRPCAccounting() PoolOption {
+	return func(c *poolConfig) {
+		c.rpcAccounting = true
+	}
+}
+
+// rpcAccount - RPC accounting of a connection. A nil *rpcAccount records nothing.
+type rpcAccount struct {
+	mutex    sync.Mutex
+	requests uint64
+	errors   uint64
+	codes    map[codes.Code]uint64
+	buckets  []uint64 // len(latencyBounds)+1
+}
+
+func newRPCAccount(enabled bool) *rpcAccount {
+	if !enabled {
+		return nil
+	}
+	return &rpcAccount{codes: make(map[codes.Code]uint64), buckets: make([]uint64, len(latencyBounds)+1)}
+}
+
+// record - Accounts an RPC of the connection. A negative latency counts the RPC without latency (stream setup).
+func (c *GrpcConnection) record(err error, latency time.Duration) {
+	a := c.rpcAccount
+	if a == nil {
+		return
+	}
+	code := status.Code(err)
+	a.mutex.Lock()
+	a.requests++
+	if code != codes.OK {
+		a.errors++
+	}
+	a.codes[code]++
+	if latency >= 0 {
+		a.buckets[latencyBucket(latency)]++
+	}
+	a.mutex.Unlock()
+	m := getMetrics()
+	m.Counter(MetricEndpointRequests, c.metricLabels(map[string]string{"service": c.serviceName,
+		"code": code.String()}), 1)
+	if latency >= 0 {
+		m.Histogram(MetricEndpointLatency, c.metricLabels(map[string]string{"service": c.serviceName}),
+			latency.Seconds())
+	}
+}
+
+// latencyBucket - Index of the bucket of the latency
+func latencyBucket(latency time.Duration) int {
+	for i, bound := range latencyBounds {
+		if latency <= bound {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// rpcStats - Copy of the accounting, nil without WithRPCAccounting
+func (a *rpcAccount) rpcStats() *RPCStats {
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	s := &RPCStats{Requests: a.requests, Errors: a.errors, Codes: make(map[codes.Code]uint64, len(a.codes)),
+		Latency: make([]LatencyBucket, len(a.buckets))}
+	for code, n := range a.codes {
+		s.Codes[code] = n
+	}
+	for i, n := range a.buckets {
+		s.Latency[i].Count = n
+		if i < len(latencyBounds) {
+			s.Latency[i].UpperBound = latencyBounds[i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recordingMetrics - Metrics sink keeping the counter totals and histogram observations by metric name
+type recordingMetrics struct {
+	noMetrics
+	mutex      sync.Mutex
+	counters   map[string]float64
+	histograms map[string][]float64
+}
+
+func (m *recordingMetrics) Counter(name string, labels map[string]string, delta float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters[name+"/"+labels["code"]] += delta
+}
+
+func (m *recordingMetrics) Histogram(name string, labels map[string]string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.histograms[name] = append(m.histograms[name], value)
+}
+
+// useMetrics - Installs a recording metrics sink for the test
+func useMetrics(t *testing.T) *recordingMetrics {
+	m := &recordingMetrics{counters: make(map[string]float64), histograms: make(map[string][]float64)}
+	SetMetrics(m)
+	t.Cleanup(func() { SetMetrics(nil) })
+	return m
+}
+
+func TestRPCAccounting(t *testing.T) {
+	m := useMetrics(t)
+	p := testPool(t, 1, WithRPCAccounting())
+	gc := p.grpcConnection[0]
+	calls := 0
+	inv := &recordingInvoker{answer: func(ctx context.Context, target string, reply interface{}) error {
+		calls++
+		if calls == 3 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		time.Sleep(3 * time.Millisecond)
+		return nil
+	}}
+	for i := 0; i < 3; i++ {
+		gc.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, gc.conn, inv.invoke)
+	}
+	s := gc.Stats().RPC
+	if s == nil {
+		t.Fatal("Stats().RPC = nil with WithRPCAccounting")
+	}
+	if s.Requests != 3 || s.Errors != 1 || s.Codes[codes.OK] != 2 || s.Codes[codes.Unavailable] != 1 {
+		t.Errorf("RPC stats = %+v, want 3 requests, 2 OK and 1 Unavailable", s)
+	}
+	if q := s.Quantile(1); q < 5*time.Millisecond {
+		t.Errorf("Quantile(1) = %v, want at least the 5ms bucket", q)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.counters[MetricEndpointRequests+"/OK"] != 2 || m.counters[MetricEndpointRequests+"/Unavailable"] != 1 {
+		t.Errorf("request counters = %v", m.counters)
+	}
+	if len(m.histograms[MetricEndpointLatency]) != 3 {
+		t.Errorf("latency observations = %v, want 3", m.histograms[MetricEndpointLatency])
+	}
+}
+
+func TestRPCAccountingDisabled(t *testing.T) {
+	p := testPool(t, 1)
+	gc := p.grpcConnection[0]
+	gc.record(nil, time.Millisecond)
+	if s := gc.Stats().RPC; s != nil {
+		t.Errorf("Stats().RPC = %+v without WithRPCAccounting, want nil", s)
+	}
+}
+
+func TestLatencyQuantile(t *testing.T) {
+	a := newRPCAccount(true)
+	for _, d := range []time.Duration{time.Millisecond, 20 * time.Millisecond, time.Minute, time.Minute} {
+		a.buckets[latencyBucket(d)]++
+	}
+	s := a.rpcStats()
+	for q, want := range map[float64]time.Duration{0.25: time.Millisecond, 0.5: 25 * time.Millisecond,
+		1: 10 * time.Second} {
+		if got := s.Quantile(q); got != want {
+			t.Errorf("Quantile(%v) = %v, want %v", q, got, want)
+		}
+	}
+	if got := (&RPCStats{}).Quantile(0.5); got != 0 {
+		t.Errorf("Quantile() without RPCs = %v, want 0", got)
+	}
+}
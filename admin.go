@@ -0,0 +1,140 @@
+package kubegrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AdminPool - A pool as rendered by AdminHandler
+type AdminPool struct {
+	Service   string          `json:"service"`
+	Degraded  bool            `json:"degraded"`
+	Version   uint64          `json:"version"`
+	Picks     uint64          `json:"picks"`
+	Endpoints []AdminEndpoint `json:"endpoints"`
+}
+
+// AdminEndpoint - An endpoint of a pool as rendered by AdminHandler
+type AdminEndpoint struct {
+	Pod          string    `json:"pod"`
+	IP           string    `json:"ip"`
+	Node         string    `json:"node,omitempty"`
+	Zone         string    `json:"zone,omitempty"`
+	State        string    `json:"state"`
+	Connectivity string    `json:"connectivity"`
+	Picks        uint64    `json:"picks"`
+	PickShare    float64   `json:"pickShare"` // Fraction [0-1] of the picks of the pool
+	InFlight     int64     `json:"inFlight"`
+	PingFailures uint64    `json:"pingFailures"`
+	LastPing     string    `json:"lastPing"`
+	Weight       float64   `json:"weight"`
+	LastError    string    `json:"lastError,omitempty"`
+	LastErrorAt  time.Time `json:"lastErrorAt"`
+}
+
+// AdminHandler - HTTP handler for live inspection of the pools, to be mounted on an existing mux of the application,
+// e.g. mux.Handle("/debug/kubegrpc", kubegrpc.AdminHandler()). Renders the pools with their endpoints, health states,
+// last errors and pick distribution as HTML page, or as JSON for `?format=json` or `Accept: application/json`.
+// `?pool=<service name>` restricts the output to one pool. The handler exposes pod names and IPs, so it belongs
+// on an internal port.
+func AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var filter []string
+		if pool := r.URL.Query().Get("pool"); pool != "" {
+			filter = []string{pool}
+		}
+		pools := adminPools(filter)
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(pools); err != nil {
+				log.Printf("ERROR: AdminHandler(): Unable to write the pools: %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := adminPage.Execute(w, pools); err != nil {
+			log.Printf("ERROR: AdminHandler(): Unable to render the pools: %v", err)
+		}
+	})
+}
+
+// adminPools - The pools ordered by service name, with their endpoints ordered by pod name and ip
+func adminPools(filter []string) []AdminPool {
+	mutex.RLock()
+	pools := make([]AdminPool, 0, len(connectionCache))
+	for _, serviceName := range snapshotPools(filter) {
+		c := connectionCache[serviceName]
+		if c == nil {
+			continue
+		}
+		p := AdminPool{Service: serviceName, Degraded: c.degraded, Version: atomic.LoadUint64(&c.version),
+			Endpoints: make([]AdminEndpoint, 0, len(c.grpcConnection))}
+		for _, gc := range c.grpcConnection {
+			stats := gc.Stats()
+			p.Picks += stats.Picks
+			p.Endpoints = append(p.Endpoints, AdminEndpoint{Pod: gc.podName, IP: gc.connectionIP, Node: gc.nodeName,
+				Zone: gc.zone, State: stats.State().String(), Connectivity: stats.Connectivity.String(),
+				Picks: stats.Picks, InFlight: stats.InFlight,
+				PingFailures: stats.PingFailures, LastPing: stats.LastPing.String(), Weight: stats.Weight,
+				LastError: stats.LastError, LastErrorAt: stats.LastErrorAt})
+		}
+		pools = append(pools, p)
+	}
+	mutex.RUnlock()
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Service < pools[j].Service })
+	for i := range pools {
+		p := &pools[i]
+		sort.Slice(p.Endpoints, func(i, j int) bool {
+			a, b := p.Endpoints[i], p.Endpoints[j]
+			if a.Pod != b.Pod {
+				return a.Pod < b.Pod
+			}
+			return a.IP < b.IP
+		})
+		if p.Picks == 0 {
+			continue
+		}
+		for j := range p.Endpoints {
+			p.Endpoints[j].PickShare = float64(p.Endpoints[j].Picks) / float64(p.Picks)
+		}
+	}
+	return pools
+}
+
+var adminPage = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>kubegrpc pools</title>
+<style>
+body { font-family: sans-serif; } table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; } .Ejected, .Draining { color: #b00; }
+.Recovering { color: #b60; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Service}}{{if .Degraded}} (degraded){{end}}</h2>
+<p>Version {{.Version}}, {{.Picks}} picks</p>
+<table>
+<tr><th>Pod</th><th>IP</th><th>Node</th><th>Zone</th><th>State</th><th>Connectivity</th><th>Picks</th><th>Share</th><th>In flight</th>
+<th>Ping failures</th><th>Last ping</th><th>Weight</th><th>Last error</th></tr>
+{{range .Endpoints}}<tr><td>{{.Pod}}</td><td>{{.IP}}</td><td>{{.Node}}</td><td>{{.Zone}}</td><td class="{{.State}}">{{.State}}</td><td>{{.Connectivity}}</td>
+<td>{{.Picks}}</td><td>{{percent .PickShare}}</td><td>{{.InFlight}}</td><td>{{.PingFailures}}</td><td>{{.LastPing}}</td>
+<td>{{.Weight}}</td><td>{{if .LastError}}{{.LastError}} ({{.LastErrorAt.Format "2006-01-02 15:04:05"}}){{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>No pools</p>
+{{end}}</body>
+</html>
+`))
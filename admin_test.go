@@ -0,0 +1,64 @@
+package kubegrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminHandlerJSON(t *testing.T) {
+	p := testPool(t, 2)
+	cachePool(t, p)
+	atomic.StoreUint64(&p.grpcConnection[0].picks, 3)
+	atomic.StoreUint64(&p.grpcConnection[1].picks, 1)
+	p.grpcConnection[1].observe(status.Error(codes.Unavailable, "connection reset"))
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?format=json&pool=svc.ns:1000", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var pools []AdminPool
+	if err := json.NewDecoder(rec.Body).Decode(&pools); err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 || pools[0].Service != "svc.ns:1000" || pools[0].Picks != 4 || len(pools[0].Endpoints) != 2 {
+		t.Fatalf("pools = %+v", pools)
+	}
+	first, second := pools[0].Endpoints[0], pools[0].Endpoints[1]
+	if first.Pod != "svc-1" || first.PickShare != 0.75 || first.State != "Healthy" || first.LastError != "" {
+		t.Errorf("first endpoint = %+v", first)
+	}
+	if second.Pod != "svc-2" || second.PickShare != 0.25 || second.LastError == "" || second.LastErrorAt.IsZero() {
+		t.Errorf("second endpoint = %+v", second)
+	}
+}
+
+func TestAdminHandlerHTML(t *testing.T) {
+	p := testPool(t, 1)
+	cachePool(t, p)
+	p.grpcConnection[0].observe(status.Error(codes.Unavailable, "<script>"))
+
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+	if !strings.Contains(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, "svc.ns:1000") ||
+		!strings.Contains(body, "10.0.0.1") {
+		t.Fatalf("page does not show the pool: %s", body)
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("last error not escaped")
+	}
+
+	rec = httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package kubegrpc
+
+import (
+	"container/list"
+	"time"
+)
+
+// defaultAffinitySize - Number of affinity keys remembered per pool when WithAffinity gets no size
+const defaultAffinitySize = 10000
+
+// WithAffinity - Enables sticky picks: ConnectWithKey picks the same endpoint for the same key until the key was not
+// used for ttl, or the endpoint left the pool, is draining or is ejected by its circuit breaker. At most size keys
+// (default 10000) are remembered per pool, the least recently used are forgotten first.
+func WithAffinity(ttl time.Duration, size int) PoolOption {
+	return func(c *poolConfig) {
+		c.affinityTTL = ttl
+		c.affinitySize = size
+	}
+}
+
+// ConnectWithKey - Connect, picking by affinity key when the pool was created with WithAffinity. Calls with the same
+// key, eg a user or session id, get the same endpoint while it stays healthy. The key is handed to the picker of the
+// pool as well, see CallInfo; BalancerHash picks by key even without affinity.
+func ConnectWithKey(serviceName, key string, f GrpcKubeBalancer, opts ...PoolOption) (interface{}, error) {
+	_, grpcConn, err := pool(serviceName, key, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	return grpcConn, nil
+}
+
+// affinityEntry - Endpoint pinned for a key
+type affinityEntry struct {
+	key     string
+	conn    *GrpcConnection
+	expires time.Time
+}
+
+// affinityCache - LRU of pinned endpoints by key. Protected by mutex.
+type affinityCache struct {
+	ttl     time.Duration
+	size    int
+	now     func() time.Time
+	order   *list.List // Front is most recently used
+	entries map[string]*list.Element
+}
+
+func newAffinityCache(ttl time.Duration, size int) *affinityCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = defaultAffinitySize
+	}
+	return &affinityCache{ttl: ttl, size: size, now: time.Now, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get - The endpoint pinned for the key, nil if none or expired
+func (a *affinityCache) get(key string) *GrpcConnection {
+	e, found := a.entries[key]
+	if !found {
+		return nil
+	}
+	entry := e.Value.(*affinityEntry)
+	if !a.now().Before(entry.expires) {
+		a.order.Remove(e)
+		delete(a.entries, key)
+		return nil
+	}
+	a.order.MoveToFront(e)
+	return entry.conn
+}
+
+// pin - Pins the endpoint for the key for another ttl
+func (a *affinityCache) pin(key string, gc *GrpcConnection) {
+	expires := a.now().Add(a.ttl)
+	if e, found := a.entries[key]; found {
+		entry := e.Value.(*affinityEntry)
+		entry.conn = gc
+		entry.expires = expires
+		a.order.MoveToFront(e)
+		return
+	}
+	a.entries[key] = a.order.PushFront(&affinityEntry{key: key, conn: gc, expires: expires})
+	for a.order.Len() > a.size {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.entries, oldest.Value.(*affinityEntry).key)
+	}
+}
+
+// pick - Picks a connection of the pool, sticking to the pinned endpoint of the key while it is usable. Caller must
+// hold mutex.
+func (c *connection) pick(serviceName, key string) *GrpcConnection {
+	call := CallInfo{ServiceName: serviceName, Key: key}
+	if key == "" || c.affinity == nil {
+		return pickConnectionFor(call, c.grpcConnection)
+	}
+	gc := c.affinity.get(key)
+	if gc == nil || gc.isDraining() || gc.weight() == 0 || !containsConnection(c.grpcConnection, gc) {
+		gc = pickConnectionFor(call, c.grpcConnection)
+	}
+	c.affinity.pin(key, gc)
+	return gc
+}
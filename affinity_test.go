@@ -0,0 +1,57 @@
+package kubegrpc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAffinitySticks(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	p := testPool(t, 5, WithAffinity(time.Minute, 0))
+	p.affinity.now = clock.Now
+	mutex.Lock()
+	defer mutex.Unlock()
+	first := p.pick("svc.ns:1000", "user-1")
+	for i := 0; i < 20; i++ {
+		if gc := p.pick("svc.ns:1000", "user-1"); gc != first {
+			t.Fatalf("pick %d = %s, want pinned %s", i, gc.podName, first.podName)
+		}
+		clock.Advance(50 * time.Second)
+	}
+	atomic.StoreInt32(&first.draining, 1)
+	if gc := p.pick("svc.ns:1000", "user-1"); gc == first {
+		t.Error("pinned draining endpoint picked")
+	}
+}
+
+func TestAffinityExpires(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	a := newAffinityCache(time.Minute, 2)
+	a.now = clock.Now
+	gc := &GrpcConnection{}
+	a.pin("a", gc)
+	clock.Advance(time.Minute)
+	if a.get("a") != nil {
+		t.Error("pin not expired after ttl")
+	}
+	a.pin("a", gc)
+	a.pin("b", gc)
+	a.get("a")
+	a.pin("c", gc)
+	if a.get("b") != nil || a.get("a") != gc || a.get("c") != gc {
+		t.Error("least recently used key not evicted")
+	}
+	if newAffinityCache(0, 10) != nil {
+		t.Error("affinity cache without ttl")
+	}
+}
+
+func TestAffinityDisabled(t *testing.T) {
+	p := testPool(t, 2)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if p.pick("svc.ns:1000", "user-1") == nil {
+		t.Error("pick() = nil")
+	}
+}
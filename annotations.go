@@ -0,0 +1,153 @@
+package kubegrpc
+
+import (
+	"crypto/tls"
+	"log"
+	"strconv"
+
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Service annotations configuring the pools of all consumers of the service. Options of the consumer take precedence.
+const (
+	// portAnnotation - Port number or container port name to dial when the service name has no port
+	portAnnotation = "kube-grpc/port"
+	// maxConnsAnnotation - Maximum number of connections per pool, see WithMaxConnections
+	maxConnsAnnotation = "kube-grpc/max-conns"
+	// balancerAnnotation - Balancer of the picks, BalancerRandom, BalancerLeastRequests or a registered picker
+	balancerAnnotation = "kube-grpc/balancer"
+)
+
+// Balancers selectable with the service annotation `kube-grpc/balancer`
+const (
+	BalancerRandom        = "random"         // Uniform random picks, the default
+	BalancerLeastRequests = "least-requests" // Picks weighted towards the endpoints with the fewest RPCs in flight
+)
+
+// serviceConfig - Pool configuration from the annotations of the service
+type serviceConfig struct {
+	port           string                           // Port number or container port name, empty for the default
+	tlsCredentials credentials.TransportCredentials // nil: TLS not requested by the service
+	maxConnections int                              // 0: not set
+	balancer       Scorer                           // nil: random picks
+	picker         string                           // Registered picker, empty for the default selection
+	ports          []corev1.ServicePort             // Ports of the service, resolve port names and the default port
+}
+
+// serviceScorer - Balancer of the service annotation as stored for the picks without locking
+type serviceScorer struct {
+	Scorer        // nil: random picks
+	picker string // Registered picker, see RegisterPicker
+}
+
+// setService - Applies the configuration from the annotations of the service. Caller must hold mutex.
+func (c *connection) setService(service serviceConfig) {
+	c.service = service
+	c.balancer.Store(serviceScorer{Scorer: service.balancer, picker: service.picker})
+}
+
+// serviceBalancer - The balancer of the service annotation, nil for random picks
+func (c *connection) serviceBalancer() Scorer {
+	if c == nil {
+		return nil
+	}
+	s, _ := c.balancer.Load().(serviceScorer)
+	return s.Scorer
+}
+
+// leastRequests - Scorer of BalancerLeastRequests
+var leastRequests = ScorerFunc(func(_ EndpointInfo, stats EndpointStats) float64 {
+	return 1 / float64(1+stats.InFlight)
+})
+
+// parseServiceConfig - Reads the annotations of the service, invalid values are logged and ignored
+func parseServiceConfig(serviceName string, svc *corev1.Service) serviceConfig {
+	cfg := serviceConfig{ports: svc.Spec.Ports}
+	a := svc.Annotations
+	if port, ok := a[portAnnotation]; ok && port != "" {
+		cfg.port = port
+	}
+	if v, ok := a[tlsAnnotation]; ok {
+		if enabled, err := strconv.ParseBool(v); err != nil {
+			log.Printf("WARNING: parseServiceConfig(): Ignoring %s=%q of %s: %v", tlsAnnotation, v, serviceName, err)
+		} else if enabled {
+			// Servers are verified against the system roots by the service DNS name
+			cfg.tlsCredentials = credentials.NewTLS(&tls.Config{ServerName: svc.Name + "." + svc.Namespace + ".svc"})
+		}
+	}
+	if v, ok := a[maxConnsAnnotation]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			log.Printf("WARNING: parseServiceConfig(): Ignoring %s=%q of %s", maxConnsAnnotation, v, serviceName)
+		} else {
+			cfg.maxConnections = n
+		}
+	}
+	switch v := a[balancerAnnotation]; v {
+	case "", BalancerRandom:
+	case BalancerLeastRequests:
+		cfg.balancer = leastRequests
+	default:
+		if LookupPicker(v) != nil {
+			cfg.picker = v
+			break
+		}
+		log.Printf("WARNING: parseServiceConfig(): Ignoring unknown %s=%q of %s", balancerAnnotation, v, serviceName)
+	}
+	return cfg
+}
+
+// annotatedPort - The port to dial on the pod: the port of the service name, or the port of the annotation. Port names
+// of the service are translated to the pod port they target; other names are left to podPort, the containerPort names.
+// Port numbers of the service with a named targetPort are translated to the containerPort of that name.
+// Pods without grpc containerPort default to the port of the service. The passthrough pod is dialed on the service
+// port.
+func (c *connection) annotatedPort(explicit string, pod *corev1.Pod) string {
+	if passthroughPod(pod) {
+		return explicit
+	}
+	port := explicit
+	if port == "" {
+		port = c.service.port
+	}
+	if port == "" {
+		_, grpcPort := namedContainerPort(pod, grpcPortNames...)
+		_, tlsPort := namedContainerPort(pod, tlsPortNames...)
+		if p, ok := defaultTargetPort(c.service.ports, pod); ok && !grpcPort && !tlsPort {
+			return p
+		}
+		return ""
+	}
+	if numericPort(port) {
+		if p, ok := numberedTargetPort(port, c.service.ports, pod); ok {
+			return p
+		}
+		return port
+	}
+	if p, ok := targetPort(port, c.service.ports, pod); ok {
+		return p
+	}
+	if p, ok := namedContainerPort(pod, port); ok {
+		return strconv.Itoa(int(p))
+	}
+	return explicit
+}
+
+// maxConnections - Connection limit of the pool: the option, the subset size, or the annotation of the service
+func (c *connection) maxConnections() int {
+	if c.config.maxConnections > 0 {
+		return c.config.maxConnections
+	}
+	if c.config.subsetSize > 0 {
+		return c.config.subsetSize * c.config.perEndpoint()
+	}
+	return c.service.maxConnections
+}
+
+// transportCredentials - Credentials of the TLS connections and whether all pods are dialed with TLS
+func (c *connection) transportCredentials() (credentials.TransportCredentials, bool) {
+	if c.config.tlsCredentials != nil {
+		return c.config.tlsCredentials, c.config.tlsRequired || c.service.tlsCredentials != nil
+	}
+	return c.service.tlsCredentials, c.service.tlsCredentials != nil
+}
@@ -0,0 +1,83 @@
+package kubegrpc
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseServiceConfig(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Annotations = map[string]string{portAnnotation: "grpc-admin", tlsAnnotation: "true", maxConnsAnnotation: "2",
+		balancerAnnotation: BalancerLeastRequests}
+	cfg := parseServiceConfig("svc.ns", svc)
+	if cfg.port != "grpc-admin" || cfg.tlsCredentials == nil || cfg.maxConnections != 2 || cfg.balancer == nil {
+		t.Errorf("parseServiceConfig() = %+v", cfg)
+	}
+	if info := cfg.tlsCredentials.Info(); info.ServerName != "svc.ns.svc" {
+		t.Errorf("TLS server name = %q, want the service DNS name", info.ServerName)
+	}
+
+	svc.Annotations = map[string]string{tlsAnnotation: "maybe", maxConnsAnnotation: "-1", balancerAnnotation: "magic"}
+	if cfg := parseServiceConfig("svc.ns", svc); cfg.tlsCredentials != nil || cfg.maxConnections != 0 ||
+		cfg.balancer != nil {
+		t.Errorf("parseServiceConfig() with invalid values = %+v, want them ignored", cfg)
+	}
+}
+
+func TestAnnotatedPool(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Annotations = map[string]string{portAnnotation: "grpc-admin", maxConnsAnnotation: "2"}
+	pods := make([]interface{}, 0, 4)
+	pods = append(pods, svc)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		pod := testPod("svc-"+ip, "ns", "svc", ip)
+		pod.Spec.Containers = []corev1.Container{{Name: "app", Ports: []corev1.ContainerPort{
+			{Name: "grpc", ContainerPort: 8080}, {Name: "grpc-admin", ContainerPort: 9090}}}}
+		pods = append(pods, pod)
+	}
+	useFakeClientset(t, pods...)
+	c := newConnection(okBalancer{}, newPoolConfig(nil))
+	mutex.Lock()
+	setPool("svc.ns", c)
+	mutex.Unlock()
+	defer ClosePool("svc.ns")
+
+	if err := updateConnectionPool("svc.ns", c, true); err != nil {
+		t.Fatal(err)
+	}
+	active := activeConnections(c)
+	if len(active) != 2 {
+		t.Fatalf("connections = %v, want 2 by the annotation", active)
+	}
+	for _, address := range active {
+		if address[len(address)-5:] != ":9090" {
+			t.Errorf("connection %s not on the annotated port", address)
+		}
+	}
+
+	// The option of the consumer wins
+	c2 := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithMaxConnections(3)}))
+	c2.setService(parseServiceConfig("svc.ns", svc))
+	if limit := c2.maxConnections(); limit != 3 {
+		t.Errorf("maxConnections() = %d, want the option", limit)
+	}
+}
+
+func TestLeastRequestsBalancer(t *testing.T) {
+	p := testPool(t, 2)
+	cachePool(t, p)
+	p.setService(serviceConfig{balancer: leastRequests})
+	p.grpcConnection[0].inFlight = 99
+	mutex.RLock()
+	defer mutex.RUnlock()
+	picks := 0
+	for i := 0; i < 1000; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection) == p.grpcConnection[1] {
+			picks++
+		}
+	}
+	if picks < 950 {
+		t.Errorf("%d of 1000 picks on the idle endpoint, want almost all", picks)
+	}
+}
@@ -0,0 +1,160 @@
+package kubegrpc
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoffBase = time.Second
+	defaultBackoffMax  = 5 * time.Minute
+)
+
+// backoffState - Dial failure history of a single endpoint
+type backoffState struct {
+	pod         string
+	failures    int
+	nextAttempt time.Time
+}
+
+// BackoffState - Backoff of an endpoint which failed to dial or its health check, see WithDialBackoff. A pod which
+// keeps failing with growing Failures is crash looping or unreachable; the pool dials it again from NextAttempt on.
+type BackoffState struct {
+	Pod         string
+	IP          string
+	Failures    int       // Consecutive failures, reset by the first successful health check
+	NextAttempt time.Time // The endpoint is not dialed before
+}
+
+// dialBackoff - Tracks dial failures per endpoint (pod ip) and applies exponential backoff with jitter before the
+// endpoint is dialed again, so crash-looping pods are not hammered on every scan. A nil *dialBackoff never backs off.
+type dialBackoff struct {
+	base   time.Duration
+	max    time.Duration
+	now    func() time.Time
+	random func() float64 // [0,1)
+	mutex  sync.Mutex
+	state  map[string]*backoffState
+}
+
+func newDialBackoff(base, max time.Duration) *dialBackoff {
+	return &dialBackoff{
+		base:   base,
+		max:    max,
+		now:    time.Now,
+		random: rand.Float64,
+		state:  make(map[string]*backoffState),
+	}
+}
+
+// allow - True if the endpoint may be dialed now
+func (b *dialBackoff) allow(key string) bool {
+	if b == nil {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := b.state[key]
+	return s == nil || !b.now().Before(s.nextAttempt)
+}
+
+// failure - Records a failed dial of the pod and schedules the next attempt. The delay doubles per consecutive failure
+// up to the cap; the actual delay is randomized between half and the full delay so failing endpoints do not retry in
+// lock step.
+func (b *dialBackoff) failure(key, pod string) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := b.state[key]
+	if s == nil {
+		s = &backoffState{}
+		b.state[key] = s
+	}
+	if pod != "" {
+		s.pod = pod
+	}
+	s.failures++
+	delay := b.max
+	// Shift limited to prevent overflow, the cap is reached long before
+	if s.failures < 32 {
+		if d := b.base << uint(s.failures-1); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	delay = delay/2 + time.Duration(b.random()*float64(delay/2))
+	s.nextAttempt = b.now().Add(delay)
+	return delay
+}
+
+// success - Resets the backoff of the endpoint
+func (b *dialBackoff) success(key string) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.state, key)
+}
+
+// get - The backoff of the endpoint, zero if it has not failed
+func (b *dialBackoff) get(key string) BackoffState {
+	if b == nil {
+		return BackoffState{}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := b.state[key]
+	if s == nil {
+		return BackoffState{}
+	}
+	return BackoffState{Pod: s.pod, IP: key, Failures: s.failures, NextAttempt: s.nextAttempt}
+}
+
+// snapshot - The backoffs of all failed endpoints, sorted by IP
+func (b *dialBackoff) snapshot() []BackoffState {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	states := make([]BackoffState, 0, len(b.state))
+	for key, s := range b.state {
+		states = append(states, BackoffState{Pod: s.pod, IP: key, Failures: s.failures, NextAttempt: s.nextAttempt})
+	}
+	b.mutex.Unlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].IP < states[j].IP })
+	return states
+}
+
+// emitBackoff - Emits EndpointBackingOff for the endpoint of the pool which failed to dial
+func emitBackoff(serviceName string, c *connection, endpoint EndpointInfo, reason string) {
+	state := c.backoff.get(endpoint.IP)
+	emit(PoolEvent{Type: EndpointBackingOff, ServiceName: serviceName, Endpoint: endpoint, Reason: reason,
+		Version: c.snapshotVersion(), Backoff: &state})
+}
+
+// prune - Forgets the endpoints which are no longer discovered
+func (b *dialBackoff) prune(keep map[string]bool) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for key := range b.state {
+		if !keep[key] {
+			delete(b.state, key)
+		}
+	}
+}
+
+// WithDialBackoff - Sets the initial and maximum delay before a pod which failed to dial is dialed again.
+// Defaults to 1 second and 5 minutes.
+func WithDialBackoff(base, max time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.backoffBase = base
+		c.backoffMax = max
+	}
+}
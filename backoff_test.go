@@ -0,0 +1,136 @@
+package kubegrpc
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// fakeClock - Manually advanced clock for tests
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBackoff(clock *fakeClock, random float64) *dialBackoff {
+	b := newDialBackoff(time.Second, 10*time.Second)
+	b.now = clock.Now
+	b.random = func() float64 { return random }
+	return b
+}
+
+func TestBackoffExponentialWithCap(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	// random 0.999.. gives the full delay
+	b := newTestBackoff(clock, 1-1e-12)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		got := b.failure("10.0.0.1", "").Round(time.Millisecond)
+		if got != w {
+			t.Errorf("failure %d: delay = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBackoff(clock, 0)
+	b.failure("10.0.0.1", "")
+	b.failure("10.0.0.1", "")
+	// Third failure: 4s, randomized between 2s and 4s, random 0 gives the lower bound
+	if got := b.failure("10.0.0.1", ""); got != 2*time.Second {
+		t.Errorf("delay = %v, want 2s", got)
+	}
+}
+
+func TestBackoffAllowAndReset(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBackoff(clock, 1-1e-12)
+	if !b.allow("10.0.0.1") {
+		t.Fatal("allow() = false before any failure")
+	}
+	b.failure("10.0.0.1", "")
+	b.failure("10.0.0.1", "") // ~2s
+	if b.allow("10.0.0.1") {
+		t.Error("allow() = true directly after failure")
+	}
+	if !b.allow("10.0.0.2") {
+		t.Error("allow() = false for another endpoint")
+	}
+	clock.Advance(1500 * time.Millisecond)
+	if b.allow("10.0.0.1") {
+		t.Error("allow() = true before the delay passed")
+	}
+	clock.Advance(time.Second)
+	if !b.allow("10.0.0.1") {
+		t.Error("allow() = false after the delay passed")
+	}
+	// Success resets: the next failure starts again at the base delay
+	b.success("10.0.0.1")
+	if got := b.failure("10.0.0.1", "").Round(time.Millisecond); got != time.Second {
+		t.Errorf("delay after reset = %v, want 1s", got)
+	}
+	b.prune(map[string]bool{})
+	if !b.allow("10.0.0.1") {
+		t.Error("allow() = false after prune")
+	}
+}
+
+func TestUpdateConnectionPoolBacksOffFailingPods(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	calls := 0
+	f := &countingBalancer{onNew: func() { calls++ }}
+	c := &connection{functions: f, backoff: newTestBackoff(clock, 0)}
+	updateConnectionPool("svc.ns:1000", c, false)
+	updateConnectionPool("svc.ns:1000", c, false)
+	if calls != 1 {
+		t.Fatalf("NewGrpcClient called %d times, want 1 while backing off", calls)
+	}
+	clock.Advance(time.Second)
+	updateConnectionPool("svc.ns:1000", c, false)
+	if calls != 2 {
+		t.Errorf("NewGrpcClient called %d times, want 2 after the delay", calls)
+	}
+}
+
+// countingBalancer - Failing GrpcKubeBalancer which reports every client creation
+type countingBalancer struct {
+	failingBalancer
+	onNew func()
+}
+
+func (b *countingBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) {
+	b.onNew()
+	return b.failingBalancer.NewGrpcClient(conn)
+}
+
+func TestBackoffInStatsAndEvents(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	c := &connection{functions: failingBalancer{}, backoff: newTestBackoff(clock, 0)}
+	cachePool(t, c)
+	events := Subscribe("svc.ns:1000")
+	defer Unsubscribe("svc.ns:1000", events)
+	for i := 1; i <= 2; i++ {
+		updateConnectionPool("svc.ns:1000", c, true)
+		e := <-events
+		if e.Type != EndpointBackingOff || e.Endpoint.PodName != "svc-0" || e.Backoff == nil || e.Backoff.Failures != i {
+			t.Fatalf("event %d = %v %+v, want EndpointBackingOff of svc-0 with %d failures", i, e.Type, e.Backoff, i)
+		}
+		clock.Advance(e.Backoff.NextAttempt.Sub(clock.Now()))
+	}
+	stats, err := Stats("svc.ns:1000")
+	if err != nil || len(stats.BackingOff) != 1 {
+		t.Fatalf("Stats() = %+v, %v, want the backing off pod", stats, err)
+	}
+	// Delays of 1s and 2s, halved by the jitter
+	want := BackoffState{Pod: "svc-0", IP: "10.0.0.1", Failures: 2, NextAttempt: time.Unix(0, 0).Add(1500 * time.Millisecond)}
+	if got := stats.BackingOff[0]; got != want {
+		t.Errorf("BackingOff = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OutlierDetection - Configures the per endpoint circuit breaker. RPC results are observed passively; an endpoint whose
+// RPCs fail too often is ejected from the picks for the ejection time, and then re-admitted gradually: its pick weight
+// ramps up over the recovery time. A failure during the recovery ejects it again, for a longer time.
+// Zero fields are set to their defaults.
+type OutlierDetection struct {
+	Window              time.Duration // Window in which the failure rate is measured, default 10s
+	MinRequests         int           // Minimum number of requests in the window before the failure rate applies, default 10
+	FailureRate         float64       // Failure rate (0-1] in the window which ejects the endpoint, default 0.5
+	ConsecutiveFailures int           // Number of consecutive failures which ejects the endpoint, default 5
+	EjectionTime        time.Duration // Base ejection time, multiplied by the number of consecutive ejections (max 10), default 30s
+	RecoveryTime        time.Duration // Duration of the ramp up after an ejection, default 30s
+}
+
+// failureCodes - Status codes which indicate a problem with the endpoint rather than with the request
+var failureCodes = map[codes.Code]bool{
+	codes.Unknown:          true,
+	codes.DeadlineExceeded: true,
+	codes.Internal:         true,
+	codes.Unavailable:      true,
+	codes.DataLoss:         true,
+}
+
+// minRecoveryWeight - Pick weight at the start of the recovery, so a recovering endpoint gets at least some traffic
+const minRecoveryWeight = 0.05
+
+// WithOutlierDetection - Enables the per endpoint circuit breaker for the pool
+func WithOutlierDetection(o OutlierDetection) PoolOption {
+	return func(c *poolConfig) {
+		if o.Window <= 0 {
+			o.Window = 10 * time.Second
+		}
+		if o.MinRequests <= 0 {
+			o.MinRequests = 10
+		}
+		if o.FailureRate <= 0 {
+			o.FailureRate = 0.5
+		}
+		if o.ConsecutiveFailures <= 0 {
+			o.ConsecutiveFailures = 5
+		}
+		if o.EjectionTime <= 0 {
+			o.EjectionTime = 30 * time.Second
+		}
+		if o.RecoveryTime <= 0 {
+			o.RecoveryTime = 30 * time.Second
+		}
+		c.outlierDetection = &o
+	}
+}
+
+// breaker - Circuit breaker of a single connection. A nil *breaker never ejects.
+type breaker struct {
+	cfg          OutlierDetection
+	name         string // For logging
+	now          func() time.Time
+	mutex        sync.Mutex
+	windowStart  time.Time
+	requests     int
+	failures     int
+	consecutive  int
+	ejections    int // Consecutive ejections, reset after a full recovery
+	ejectedUntil time.Time
+}
+
+func newBreaker(cfg *OutlierDetection, name string) *breaker {
+	if cfg == nil {
+		return nil
+	}
+	return &breaker{cfg: *cfg, name: name, now: time.Now}
+}
+
+// isFailure - True if the RPC error counts against the endpoint
+func isFailure(err error) bool {
+	return err != nil && failureCodes[status.Code(err)]
+}
+
+// record - Observes the result of an RPC. Returns true if the result ejected the endpoint.
+func (b *breaker) record(err error) bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	if now.Before(b.ejectedUntil) {
+		// In flight calls started before the ejection, no new information
+		return false
+	}
+	recovering := b.ejections > 0 && now.Before(b.ejectedUntil.Add(b.cfg.RecoveryTime))
+	if now.Sub(b.windowStart) > b.cfg.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+	b.requests++
+	if !isFailure(err) {
+		b.consecutive = 0
+		if b.ejections > 0 && !recovering {
+			b.ejections = 0
+		}
+		return false
+	}
+	b.failures++
+	b.consecutive++
+	if recovering || b.consecutive >= b.cfg.ConsecutiveFailures ||
+		(b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRate) {
+		b.eject(now)
+		return true
+	}
+	return false
+}
+
+// eject - Removes the endpoint from the picks. Caller must hold b.mutex.
+func (b *breaker) eject(now time.Time) {
+	if b.ejections < 10 {
+		b.ejections++
+	}
+	d := b.cfg.EjectionTime * time.Duration(b.ejections)
+	b.ejectedUntil = now.Add(d)
+	b.requests = 0
+	b.failures = 0
+	b.consecutive = 0
+	log.Printf("INFO: breaker.eject(): Ejected %s for %v after RPC failures", b.name, d)
+}
+
+// weight - Pick weight of the endpoint: 0 while ejected, ramping up to 1 during the recovery
+func (b *breaker) weight() float64 {
+	if b == nil {
+		return 1
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	if now.Before(b.ejectedUntil) {
+		return 0
+	}
+	if b.ejections == 0 {
+		return 1
+	}
+	elapsed := now.Sub(b.ejectedUntil)
+	if elapsed >= b.cfg.RecoveryTime {
+		return 1
+	}
+	w := float64(elapsed) / float64(b.cfg.RecoveryTime)
+	if w < minRecoveryWeight {
+		return minRecoveryWeight
+	}
+	return w
+}
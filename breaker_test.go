@@ -0,0 +1,134 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestBreaker(clock *fakeClock) *breaker {
+	var c poolConfig
+	WithOutlierDetection(OutlierDetection{
+		Window:              10 * time.Second,
+		MinRequests:         4,
+		FailureRate:         0.5,
+		ConsecutiveFailures: 3,
+		EjectionTime:        10 * time.Second,
+		RecoveryTime:        10 * time.Second,
+	})(&c)
+	b := newBreaker(c.outlierDetection, "test")
+	b.now = clock.Now
+	return b
+}
+
+var errUnavailable = status.Error(codes.Unavailable, "down")
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBreaker(clock)
+	b.record(errUnavailable)
+	b.record(errUnavailable)
+	if b.weight() != 1 {
+		t.Fatalf("weight() = %v after 2 failures, want 1", b.weight())
+	}
+	b.record(errUnavailable)
+	if b.weight() != 0 {
+		t.Fatalf("weight() = %v after 3 consecutive failures, want 0", b.weight())
+	}
+}
+
+func TestBreakerIgnoresRequestErrors(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBreaker(clock)
+	for i := 0; i < 10; i++ {
+		b.record(status.Error(codes.NotFound, "no such key"))
+		b.record(status.Error(codes.InvalidArgument, "bad request"))
+	}
+	if b.weight() != 1 {
+		t.Errorf("weight() = %v after request errors, want 1", b.weight())
+	}
+	if isFailure(nil) || !isFailure(errors.New("plain error counts as unknown")) {
+		t.Errorf("isFailure() classification wrong")
+	}
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBreaker(clock)
+	b.record(nil)
+	b.record(errUnavailable)
+	b.record(nil)
+	if b.weight() != 1 {
+		t.Fatalf("weight() = %v below the minimum requests, want 1", b.weight())
+	}
+	b.record(errUnavailable) // 2 of 4 failed
+	if b.weight() != 0 {
+		t.Fatalf("weight() = %v at 50%% failures, want 0", b.weight())
+	}
+}
+
+func TestBreakerWindowResets(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBreaker(clock)
+	b.record(errUnavailable)
+	b.record(nil)
+	b.record(nil)
+	clock.Advance(11 * time.Second)
+	b.record(errUnavailable)
+	if b.weight() != 1 {
+		t.Errorf("weight() = %v, failures of an old window must not count", b.weight())
+	}
+}
+
+func TestBreakerGradualRecoveryAndReejection(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := newTestBreaker(clock)
+	for i := 0; i < 3; i++ {
+		b.record(errUnavailable)
+	}
+	clock.Advance(10 * time.Second)
+	if w := b.weight(); w != minRecoveryWeight {
+		t.Errorf("weight() at start of recovery = %v, want %v", w, minRecoveryWeight)
+	}
+	clock.Advance(5 * time.Second)
+	if w := b.weight(); w != 0.5 {
+		t.Errorf("weight() halfway the recovery = %v, want 0.5", w)
+	}
+	// A single failure during the recovery ejects again, for twice the ejection time
+	b.record(errUnavailable)
+	clock.Advance(19 * time.Second)
+	if w := b.weight(); w != 0 {
+		t.Errorf("weight() = %v during second ejection, want 0", w)
+	}
+	clock.Advance(11*time.Second + 10*time.Second)
+	if w := b.weight(); w != 1 {
+		t.Errorf("weight() after recovery = %v, want 1", w)
+	}
+	if (*breaker)(nil).weight() != 1 {
+		t.Errorf("nil breaker weight != 1")
+	}
+}
+
+func TestPickConnectionSkipsEjected(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	ejected := newTestBreaker(clock)
+	for i := 0; i < 3; i++ {
+		ejected.record(errUnavailable)
+	}
+	conns := []*GrpcConnection{
+		{connectionIP: "10.0.0.1", breaker: ejected},
+		{connectionIP: "10.0.0.2", breaker: newTestBreaker(clock)},
+	}
+	for i := 0; i < 20; i++ {
+		if c := pickConnection("breaker-test", conns); c.connectionIP != "10.0.0.2" {
+			t.Fatalf("pickConnection() picked ejected %s", c.connectionIP)
+		}
+	}
+	// All ejected: still hand out a connection
+	if c := pickConnection("breaker-test", conns[:1]); c == nil {
+		t.Fatal("pickConnection() returned nil with all connections ejected")
+	}
+}
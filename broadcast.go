@@ -0,0 +1,120 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultForEachConcurrency - Calls in progress at once for ForEach
+const defaultForEachConcurrency = 16
+
+// ErrForEach - Errors of a ForEach, by pod name
+type ErrForEach struct {
+	Errors map[string]error
+}
+
+func (e *ErrForEach) Error() string {
+	pods := e.pods()
+	msgs := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		msgs = append(msgs, pod+": "+e.Errors[pod].Error())
+	}
+	return fmt.Sprintf("kubegrpc: %d of the calls failed: %s", len(pods), strings.Join(msgs, "; "))
+}
+
+// Is - Whether one of the underlying errors is target, for errors.Is
+func (e *ErrForEach) Is(target error) bool {
+	for _, pod := range e.pods() {
+		if errors.Is(e.Errors[pod], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As - Sets target to the first underlying error, by pod name, which matches it, for errors.As
+func (e *ErrForEach) As(target interface{}) bool {
+	for _, pod := range e.pods() {
+		if errors.As(e.Errors[pod], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// pods - The names of the pods of the failed calls, sorted
+func (e *ErrForEach) pods() []string {
+	pods := make([]string, 0, len(e.Errors))
+	for pod := range e.Errors {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	return pods
+}
+
+// ForEach - Calls fn once for every pod of the pool of the service, eg to invalidate a cache on every pod. Uses a
+// snapshot of the pool: one connection per pod, skipping draining and ejected connections. At most 16 calls run at once.
+// Returns ErrPoolNotFound if there is no pool, ErrNoHealthyEndpoints if there is no connection to call, and an
+// *ErrForEach holding the failed calls by pod name.
+func ForEach(serviceName string, fn func(client interface{}) error) error {
+	return ForEachWithConcurrency(serviceName, defaultForEachConcurrency, fn)
+}
+
+// ForEachWithConcurrency - ForEach with at most concurrency calls at once
+func ForEachWithConcurrency(serviceName string, concurrency int, fn func(client interface{}) error) error {
+	targets, err := broadcastTargets(serviceName)
+	if err != nil {
+		return err
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	var errsMutex sync.Mutex
+	errs := make(map[string]error)
+	slots := make(chan struct{}, concurrency)
+	for _, gc := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(gc *GrpcConnection) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := fn(gc.GrpcConnection); err != nil {
+				errsMutex.Lock()
+				errs[gc.podName] = err
+				errsMutex.Unlock()
+			}
+		}(gc)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return &ErrForEach{Errors: errs}
+	}
+	return nil
+}
+
+// broadcastTargets - One usable connection per pod of the pool
+func broadcastTargets(serviceName string) ([]*GrpcConnection, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	c := connectionCache[serviceName]
+	if c == nil {
+		return nil, ErrPoolNotFound
+	}
+	seen := make(map[string]bool, len(c.grpcConnection))
+	targets := make([]*GrpcConnection, 0, len(c.grpcConnection))
+	for _, gc := range c.grpcConnection {
+		if seen[gc.podName] || gc.isDraining() || gc.weight() == 0 {
+			continue
+		}
+		seen[gc.podName] = true
+		targets = append(targets, gc)
+	}
+	if len(targets) == 0 {
+		return nil, ErrNoHealthyEndpoints
+	}
+	return targets, nil
+}
@@ -0,0 +1,85 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachCallsEveryPod(t *testing.T) {
+	if err := ForEach("svc.ns:1000", func(interface{}) error { return nil }); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("ForEach() error = %v, want ErrPoolNotFound", err)
+	}
+	p := testPool(t, 3)
+	// A second connection to the first pod must not be called again
+	duplicate, dialErr := newGrpcConnection("svc.ns:1000", p, testPod("svc-1", "ns", "svc", "10.0.0.1"), "1000")
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+	p.grpcConnection = append(p.grpcConnection, duplicate)
+	atomic.StoreInt32(&p.grpcConnection[2].draining, 1)
+	cachePool(t, p)
+	var mutex sync.Mutex
+	called := make(map[interface{}]int)
+	err := ForEach("svc.ns:1000", func(client interface{}) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		called[client]++
+		return nil
+	})
+	if err != nil || len(called) != 2 || called[p.grpcConnection[0].GrpcConnection] != 1 ||
+		called[p.grpcConnection[1].GrpcConnection] != 1 {
+		t.Errorf("ForEach() = %v, called %v, want svc-1 and svc-2 once", err, called)
+	}
+}
+
+func TestForEachAggregatesErrors(t *testing.T) {
+	p := testPool(t, 3)
+	cachePool(t, p)
+	errFailed := errors.New("failed")
+	err := ForEach("svc.ns:1000", func(client interface{}) error {
+		switch client {
+		case p.grpcConnection[1].GrpcConnection:
+			return errFailed
+		case p.grpcConnection[2].GrpcConnection:
+			return fmt.Errorf("call: %w", &ErrDialFailed{Pod: "svc-3", Err: ErrNoHealthyEndpoints})
+		}
+		return nil
+	})
+	var fe *ErrForEach
+	if !errors.As(err, &fe) || len(fe.Errors) != 2 || fe.Errors["svc-2"] != errFailed || !errors.Is(err, errFailed) {
+		t.Errorf("ForEach() error = %v, want svc-2 failed", err)
+	}
+	// The underlying errors are matched through their own wrapping
+	var dialErr *ErrDialFailed
+	if !errors.Is(err, ErrNoHealthyEndpoints) || !errors.As(err, &dialErr) || dialErr.Pod != "svc-3" {
+		t.Errorf("ForEach() error = %v, want the dial error of svc-3 to match", err)
+	}
+	if errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("ForEach() error = %v matches an error none of the calls returned", err)
+	}
+}
+
+func TestForEachConcurrency(t *testing.T) {
+	p := testPool(t, 6)
+	cachePool(t, p)
+	var running, max int32
+	ForEachWithConcurrency("svc.ns:1000", 2, func(interface{}) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	if max != 2 {
+		t.Errorf("concurrent calls = %d, want 2", max)
+	}
+}
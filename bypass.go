@@ -0,0 +1,177 @@
+package kubegrpc
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// bypassEnv - Environment variable which enables the bypass at startup
+	bypassEnv = "KUBEGRPC_BYPASS"
+	// bypassConfigMapKey - Key in the bypass ConfigMap, parsed as bool
+	bypassConfigMapKey = "bypass"
+	// bypassPollInterval - Interval at which the bypass ConfigMap is read
+	bypassPollInterval = 10 * time.Second
+)
+
+var (
+	bypassed     int32 // atomic: 1 while the client side balancing is bypassed
+	bypassEnvRun sync.Once
+)
+
+// SetBypass - Kill switch for the client side balancing. While enabled, every pool hands out a single connection to the
+// service DNS name, so the traffic is balanced by kube-proxy as if kube-grpc was not used. The pools keep being
+// maintained in the background, disabling the bypass returns to the pool connections immediately. Pools of remote
+// clusters (see AddCluster) are not bypassed: the DNS name and kube-proxy are those of this cluster.
+// The bypass can also be enabled at startup with KUBEGRPC_BYPASS=true, or fleet wide with WatchBypassConfigMap.
+func SetBypass(enabled bool) {
+	// An explicit setting wins over the environment
+	bypassEnvRun.Do(func() {})
+	var v int32
+	if enabled {
+		v = 1
+	}
+	if atomic.SwapInt32(&bypassed, v) == v {
+		return
+	}
+	if enabled {
+		log.Printf("WARNING: SetBypass(): Client side balancing bypassed, dialing services through kube-proxy")
+		return
+	}
+	log.Printf("INFO: SetBypass(): Client side balancing restored")
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, c := range connectionCache {
+		c.closeBypass()
+	}
+}
+
+// Bypassed - True while the client side balancing is bypassed
+func Bypassed() bool {
+	bypassEnvRun.Do(func() {
+		if v, _ := strconv.ParseBool(os.Getenv(bypassEnv)); v {
+			atomic.StoreInt32(&bypassed, 1)
+			log.Printf("WARNING: Bypassed(): Client side balancing bypassed by %s", bypassEnv)
+		}
+	})
+	return atomic.LoadInt32(&bypassed) == 1
+}
+
+// WatchBypassConfigMap - Reads the key `bypass` of the ConfigMap every 10 seconds and enables or disables the bypass
+// when its value changes. Lets operators neutralize the client side balancing of a fleet without redeploying. A missing
+// ConfigMap or key counts as false; errors reading the ConfigMap leave the bypass unchanged. Runs until ctx is done.
+func WatchBypassConfigMap(ctx context.Context, namespace, name string) {
+	go func() {
+		last := false
+		for {
+			if enabled, ok := readBypassConfigMap(namespace, name); ok && enabled != last {
+				SetBypass(enabled)
+				last = enabled
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(bypassPollInterval):
+			}
+		}
+	}()
+}
+
+// readBypassConfigMap - Returns the bypass value of the ConfigMap, false if the ConfigMap or key is missing or not a
+// bool. ok is false if the ConfigMap could not be read.
+func readBypassConfigMap(namespace, name string) (enabled, ok bool) {
+	k8s, err := getClientset()
+	if err != nil {
+		return false, false
+	}
+	cm, err := k8s.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, true
+	}
+	if err != nil {
+		log.Printf("ERROR: readBypassConfigMap(): Can not read ConfigMap %s/%s. Error %v", namespace, name, err)
+		return false, false
+	}
+	enabled, _ = strconv.ParseBool(cm.Data[bypassConfigMapKey])
+	return enabled, true
+}
+
+// bypassedFor - True while the picks of the pool of the service are bypassed, see SetBypass
+func bypassedFor(serviceName string) bool {
+	if !Bypassed() {
+		return false
+	}
+	_, cluster := splitCluster(serviceName)
+	return cluster == ""
+}
+
+// bypassConnection - Returns the connection to the service DNS name, dialed on first use. Caller must hold mutex.
+func (c *connection) bypassConnection(serviceName string) (*GrpcConnection, error) {
+	if c.bypass != nil {
+		return c.bypass, nil
+	}
+	name, namespace, port, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	if !numericPort(port) {
+		// The default or a named port of the service
+		k8s, err := getClientset()
+		if err != nil {
+			return nil, &ErrDialFailed{Pod: name, Err: err}
+		}
+		svc, _, err := getService(serviceName, k8s.CoreV1())
+		if err != nil {
+			return nil, err
+		}
+		if port, err = servicePort(port, svc); err != nil {
+			return nil, &ErrDialFailed{Pod: name, Err: err}
+		}
+	}
+	host := name + "." + namespace + ".svc"
+	if pod := podTarget(serviceName); pod != "" {
+		// Pod DNS name of a headless service (StatefulSet)
+		host = pod + "." + host
+	}
+	// No pool back reference: retries, hedging and the circuit breaker need the individual endpoints
+	gc := &GrpcConnection{
+		connectionIP: host,
+		namespace:    namespace,
+		serviceName:  serviceName,
+		created:      time.Now(),
+		port:         port,
+	}
+	gc.markVerified(gc.created)
+	gc.conn, err = grpc.Dial(net.JoinHostPort(host, port), grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(gc.unaryInterceptor), grpc.WithStreamInterceptor(gc.streamInterceptor))
+	if err != nil {
+		return nil, &ErrDialFailed{Pod: name, IP: host, Err: err}
+	}
+	gc.GrpcConnection, err = c.newClient(gc)
+	if err != nil {
+		gc.conn.Close()
+		return nil, &ErrDialFailed{Pod: name, IP: host, Err: err}
+	}
+	log.Printf("INFO: bypassConnection(): Dialed %s through kube-proxy", net.JoinHostPort(host, port))
+	c.bypass = gc
+	return gc, nil
+}
+
+// closeBypass - Closes the bypass connection of the pool, if any. Caller must hold mutex.
+func (c *connection) closeBypass() {
+	if c.bypass == nil {
+		return
+	}
+	go c.bypass.conn.Close()
+	c.bypass = nil
+}
@@ -0,0 +1,79 @@
+package kubegrpc
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBypassDialsServiceDNS(t *testing.T) {
+	const svc = "bypassed.ns:1000"
+	useFakeClientset(t, testService("bypassed", "ns"), testPod("bypassed-0", "ns", "bypassed", "10.0.0.1"))
+	SetBypass(true)
+	defer SetBypass(false)
+	defer ClosePool(svc)
+	conns, _, err := Pool(svc, okBalancer{})
+	if err != nil {
+		t.Fatalf("Pool() error = %v", err)
+	}
+	if len(conns) != 1 || conns[0].conn.Target() != "bypassed.ns.svc:1000" {
+		t.Fatalf("Pool() = %v, want a single connection to the service DNS name", conns)
+	}
+	again, _, _ := Pool(svc, okBalancer{})
+	if again[0] != conns[0] {
+		t.Error("bypass connection dialed twice")
+	}
+	SetBypass(false)
+	mutex.RLock()
+	bypass := connectionCache[svc].bypass
+	mutex.RUnlock()
+	if bypass != nil {
+		t.Error("bypass connection kept after disabling the bypass")
+	}
+	conns, _, err = Pool(svc, okBalancer{})
+	if err != nil || len(conns) != 1 || conns[0].podName != "bypassed-0" {
+		t.Errorf("Pool() after bypass = %v, %v, want the pod connection", conns, err)
+	}
+}
+
+func TestBypassLocalClusterOnly(t *testing.T) {
+	const svc = "remote.ns:1000@dr"
+	useFakeClientset(t)
+	addFakeCluster(t, "dr", testService("remote", "ns"), testPod("remote-0", "ns", "remote", "10.1.0.1"))
+	SetBypass(true)
+	defer SetBypass(false)
+	defer ClosePool(svc)
+	// The DNS name and kube-proxy of this cluster do not reach the pods of the remote cluster
+	conns, _, err := Pool(svc, okBalancer{})
+	if err != nil || len(conns) != 1 || conns[0].podName != "remote-0" {
+		t.Errorf("Pool() = %v, %v, want the pod of the remote cluster", conns, err)
+	}
+}
+
+func TestBypassInfersServicePort(t *testing.T) {
+	const svc = "bypassed.ns"
+	service := testService("bypassed", "ns")
+	service.Spec.Ports = []corev1.ServicePort{{Name: "grpc", Port: 9000}}
+	useFakeClientset(t, service)
+	SetBypass(true)
+	defer SetBypass(false)
+	defer ClosePool(svc)
+	conns, _, err := Pool(svc, okBalancer{})
+	if err != nil || conns[0].conn.Target() != "bypassed.ns.svc:9000" {
+		t.Errorf("Pool() = %v, %v, want a connection to port 9000", conns, err)
+	}
+}
+
+func TestReadBypassConfigMap(t *testing.T) {
+	useFakeClientset(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-grpc", Namespace: "ops"},
+		Data:       map[string]string{"bypass": "true"},
+	})
+	if enabled, ok := readBypassConfigMap("ops", "kube-grpc"); !enabled || !ok {
+		t.Errorf("readBypassConfigMap() = %v, %v, want true, true", enabled, ok)
+	}
+	if enabled, ok := readBypassConfigMap("ops", "missing"); enabled || !ok {
+		t.Errorf("readBypassConfigMap(missing) = %v, %v, want false, true", enabled, ok)
+	}
+}
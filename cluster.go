@@ -0,0 +1,157 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ErrUnknownCluster - The service name refers to a cluster which was not added with AddCluster
+var ErrUnknownCluster = errors.New("kubegrpc: unknown cluster")
+
+// clusters - Clientsets of the remote clusters by name, protected by clientsetMutex. The local cluster uses clientset.
+var clusters = make(map[string]kubernetes.Interface)
+
+// AddCluster - Registers the clientset of a remote cluster. Pools of the cluster are addressed by appending `@name` to
+// the service name, eg `svc.ns:50051@dr`. The pod IPs of the cluster must be routable from this pod (flat or
+// peered pod networks).
+func AddCluster(name string, cs kubernetes.Interface) error {
+	if name == "" || strings.ContainsAny(name, "@/:") || cs == nil {
+		return fmt.Errorf("%w: invalid cluster %q", ErrUnknownCluster, name)
+	}
+	clientsetMutex.Lock()
+	defer clientsetMutex.Unlock()
+	clusters[name] = cs
+	log.Printf("INFO: AddCluster(): Added cluster %s", name)
+	return nil
+}
+
+// AddClusterFromKubeconfig - Registers a remote cluster from a context of a kubeconfig file. An empty context uses
+// the current context of the file.
+func AddClusterFromKubeconfig(name, kubeconfig, context string) error {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context}).ClientConfig()
+	if err != nil {
+		log.Printf("ERROR: AddClusterFromKubeconfig(): Could not load context %q of %s. Error: %v", context, kubeconfig, err)
+		return fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	return AddCluster(name, cs)
+}
+
+// splitCluster - Splits the `@cluster` suffix off the service name, the cluster is empty for the local cluster
+func splitCluster(serviceName string) (string, string) {
+	if i := strings.LastIndex(serviceName, "@"); i >= 0 {
+		return serviceName[:i], serviceName[i+1:]
+	}
+	return serviceName, ""
+}
+
+// clusterServiceName - The pool key of the service in the cluster
+func clusterServiceName(serviceName, cluster string) string {
+	if cluster == "" {
+		return serviceName
+	}
+	return serviceName + "@" + cluster
+}
+
+// clientsetFor - The clientset of the cluster the service name refers to
+func clientsetFor(serviceName string) (kubernetes.Interface, error) {
+	_, cluster := splitCluster(serviceName)
+	if cluster == "" {
+		k8s, err := getClientset()
+		if err != nil {
+			return nil, err
+		}
+		return withInformers(k8s), nil
+	}
+	clientsetMutex.Lock()
+	defer clientsetMutex.Unlock()
+	cs := clusters[cluster]
+	if cs == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, cluster)
+	}
+	return cs, nil
+}
+
+// Federation - Pools of the same service in several clusters, used in order of preference
+type Federation struct {
+	Clusters   []string // Clusters in order of preference, "" for the local cluster
+	MinHealthy int      // A cluster with fewer usable connections fails over to the next cluster, default 1
+}
+
+// activeClusters - Cluster currently used per federated service, to log failovers. Protected by mutex.
+var activeClusters = make(map[string]string)
+
+// healthyConnections - Number of connections of the pool which are picked: not draining and not ejected. Caller must
+// hold mutex.
+func healthyConnections(c *connection) int {
+	n := 0
+	for _, gc := range c.grpcConnection {
+		if !gc.isDraining() && gc.weight() > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// ConnectFederated - Like ConnectWithOptions for a service running in several clusters (see AddCluster): returns a
+// connection of the first cluster of the federation with at least MinHealthy usable connections. Without such a
+// cluster the cluster with the most usable connections is used. Pools of the less preferred clusters are only created
+// once they are needed, and are then maintained like any pool, so failing back is immediate. A change of the cluster
+// emits a PoolFailover event for the service name.
+func ConnectFederated(serviceName string, fed Federation, f GrpcKubeBalancer, opts ...PoolOption) (interface{}, error) {
+	if len(fed.Clusters) == 0 {
+		fed.Clusters = []string{""}
+	}
+	if fed.MinHealthy <= 0 {
+		fed.MinHealthy = 1
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	var best *connection
+	var bestCluster string
+	var lastErr error
+	bestHealthy := 0
+	for _, cluster := range fed.Clusters {
+		c, err := openPool(clusterServiceName(serviceName, cluster), f, opts)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		n := healthyConnections(c)
+		if n > bestHealthy {
+			best, bestCluster, bestHealthy = c, cluster, n
+		}
+		if n >= fed.MinHealthy {
+			break
+		}
+	}
+	if best == nil {
+		if lastErr == nil {
+			lastErr = ErrNoHealthyEndpoints
+		}
+		return nil, lastErr
+	}
+	if previous, found := activeClusters[serviceName]; !found || previous != bestCluster {
+		activeClusters[serviceName] = bestCluster
+		if found {
+			log.Printf("WARNING: ConnectFederated(): %s failed over from cluster %q to %q with %d usable connections",
+				serviceName, previous, bestCluster, bestHealthy)
+			emit(PoolEvent{Type: PoolFailover, ServiceName: serviceName, Connections: bestHealthy,
+				Reason: fmt.Sprintf("cluster %q to %q", previous, bestCluster), Version: best.snapshotVersion()})
+		}
+	}
+	gc := best.pick(clusterServiceName(serviceName, bestCluster), "")
+	atomic.AddUint64(&gc.picks, 1)
+	return gc.GrpcConnection, nil
+}
@@ -0,0 +1,94 @@
+package kubegrpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// addFakeCluster - Registers a fake remote cluster with the objects for the test
+func addFakeCluster(t *testing.T, name string, objects ...runtime.Object) {
+	t.Helper()
+	if err := AddCluster(name, fake.NewSimpleClientset(objects...)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		clientsetMutex.Lock()
+		delete(clusters, name)
+		clientsetMutex.Unlock()
+	})
+}
+
+func TestParseServiceNameCluster(t *testing.T) {
+	name, namespace, port, err := parseServiceName("abc.ns:1000@dr")
+	if err != nil || name != "abc" || namespace != "ns" || port != "1000" {
+		t.Errorf("parseServiceName() = %q, %q, %q, %v", name, namespace, port, err)
+	}
+	if pod := podTarget("abc.ns:1000/abc-0@dr"); pod != "abc-0" {
+		t.Errorf("podTarget() = %q, want abc-0", pod)
+	}
+	for _, s := range []string{"abc.ns:1000@", "abc.ns@a@b"} {
+		if _, _, _, err := parseServiceName(s); !errors.Is(err, ErrInvalidServiceName) {
+			t.Errorf("parseServiceName(%s) error = %v, want ErrInvalidServiceName", s, err)
+		}
+	}
+}
+
+func TestAddClusterInvalid(t *testing.T) {
+	for _, name := range []string{"", "a@b", "a:b"} {
+		if err := AddCluster(name, fake.NewSimpleClientset()); !errors.Is(err, ErrUnknownCluster) {
+			t.Errorf("AddCluster(%q) error = %v, want ErrUnknownCluster", name, err)
+		}
+	}
+	if _, err := clientsetFor("abc.ns:1000@missing"); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("clientsetFor() error = %v, want ErrUnknownCluster", err)
+	}
+}
+
+func TestConnectFederatedFailover(t *testing.T) {
+	useFakeClientset(t, testService("fed", "ns"), testPod("fed-0", "ns", "fed", "10.0.0.1"))
+	addFakeCluster(t, "dr", testService("fed", "ns"), testPod("fed-0", "ns", "fed", "10.1.0.1"))
+	defer ClosePool("fed.ns:1000")
+	defer ClosePool("fed.ns:1000@dr")
+	defer func() {
+		mutex.Lock()
+		delete(activeClusters, "fed.ns:1000")
+		mutex.Unlock()
+	}()
+	fed := Federation{Clusters: []string{"", "dr"}}
+	client, err := ConnectFederated("fed.ns:1000", fed, okBalancer{})
+	if err != nil || client.(*grpc.ClientConn).Target() != "10.0.0.1:1000" {
+		t.Fatalf("ConnectFederated() = %v, %v, want the local pod", client, err)
+	}
+	if conns := Connections("fed.ns:1000@dr"); conns != nil {
+		t.Errorf("remote pool created while the local cluster is healthy: %v", conns)
+	}
+	events := Subscribe("fed.ns:1000")
+	defer Unsubscribe("fed.ns:1000", events)
+	for _, gc := range Connections("fed.ns:1000") {
+		atomic.StoreInt32(&gc.draining, 1)
+	}
+	client, err = ConnectFederated("fed.ns:1000", fed, okBalancer{})
+	if err != nil || client.(*grpc.ClientConn).Target() != "10.1.0.1:1000" {
+		t.Fatalf("ConnectFederated() = %v, %v, want the remote pod", client, err)
+	}
+	for {
+		select {
+		case e := <-events:
+			if e.Type != PoolFailover {
+				continue
+			}
+			if e.Reason != `cluster "" to "dr"` {
+				t.Errorf("failover reason = %q", e.Reason)
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatal("no PoolFailover event")
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// check - Outcome of the health check of an endpoint
+type check struct {
+	pod     string
+	ip      string
+	latency time.Duration
+	err     error
+}
+
+// describeService - Prints the service and the pods its selector matches, as the k8s API returns them to the user of
+// the kubeconfig
+func describeService(ctx context.Context, k8s kubernetes.Interface, w io.Writer, name, namespace string) {
+	svc, err := k8s.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		fmt.Fprintf(w, "Service %s/%s: %v\n", namespace, name, err)
+		if h := apiHint(err, "get", "services", namespace); h != "" {
+			fmt.Fprintf(w, "  %s\n", h)
+		}
+		return
+	}
+	fmt.Fprintf(w, "Service %s/%s (%s), selector %s\n", namespace, name, svc.Spec.Type,
+		labels.SelectorFromSet(svc.Spec.Selector))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  PORT\tNAME\tTARGET\tPROTOCOL")
+	for _, p := range svc.Spec.Ports {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", p.Port, p.Name, p.TargetPort.String(), p.Protocol)
+	}
+	tw.Flush()
+	if len(svc.Spec.Selector) == 0 {
+		fmt.Fprintln(w, "  The service has no selector: kube-grpc discovers no pods through it")
+		return
+	}
+
+	pods, err := k8s.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String()})
+	if err != nil {
+		fmt.Fprintf(w, "Pods: %v\n", err)
+		if h := apiHint(err, "list", "pods", namespace); h != "" {
+			fmt.Fprintf(w, "  %s\n", h)
+		}
+		return
+	}
+	fmt.Fprintf(w, "Pods matching the selector: %d\n", len(pods.Items))
+	if len(pods.Items) == 0 {
+		fmt.Fprintln(w, "  Check the selector against the labels of the pods (kubectl get pods --show-labels)")
+		return
+	}
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  POD\tIP\tPHASE\tREADY\tNODE\tCONTAINER PORTS")
+	for _, pod := range pods.Items {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%v\t%s\t%s\n", pod.Name, pod.Status.PodIP, pod.Status.Phase, podReady(pod),
+			pod.Spec.NodeName, containerPorts(pod))
+	}
+	tw.Flush()
+}
+
+// podReady - Whether the pod reports the Ready condition
+func podReady(pod corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// containerPorts - The container ports of the pod as name:number, or the number for unnamed ports
+func containerPorts(pod corev1.Pod) string {
+	ports := make([]string, 0)
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name != "" {
+				ports = append(ports, fmt.Sprintf("%s:%d", p.Name, p.ContainerPort))
+			} else {
+				ports = append(ports, fmt.Sprint(p.ContainerPort))
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return "-"
+	}
+	return strings.Join(ports, ",")
+}
+
+// apiHint - What to fix for an error of the k8s API, empty if there is nothing obvious
+func apiHint(err error, verb, resource, namespace string) string {
+	switch {
+	case apierrors.IsForbidden(err):
+		return fmt.Sprintf("Grant %s on %s in namespace %s to the user of the kubeconfig, and to the service account of "+
+			"the application", verb, resource, namespace)
+	case apierrors.IsNotFound(err):
+		return "Check the name and the namespace of the service"
+	case apierrors.IsUnauthorized(err):
+		return "The credentials of the kubeconfig were refused, log in to the cluster again"
+	}
+	return ""
+}
+
+// hint - What to fix for an error of Connect, empty if there is nothing obvious
+func hint(err error) string {
+	var denied *kubegrpc.ErrPermissionDenied
+	var dial *kubegrpc.ErrDialFailed
+	switch {
+	case errors.As(err, &denied):
+		return fmt.Sprintf("Grant %s on %s in namespace %s to the service account of the application", denied.Verb,
+			denied.Resource, denied.Namespace)
+	case errors.Is(err, kubegrpc.ErrNoPort):
+		return "Name the grpc port of the containers `grpc`, or pass the port number or name with -port"
+	case errors.Is(err, kubegrpc.ErrServiceNotFound):
+		return "Check the name and the namespace of the service"
+	case errors.Is(err, kubegrpc.ErrKubernetesUnavailable):
+		return "Check the kubeconfig and the reachability of the k8s API"
+	case errors.As(err, &dial):
+		return "The pods were found but could not be dialed: check the port and that the pod IPs are reachable from " +
+			"here"
+	case errors.Is(err, kubegrpc.ErrNoHealthyEndpoints):
+		return "No pod of the service could be used, see the pods above"
+	}
+	return ""
+}
+
+// printEvents - Prints the events of the pool received until the channel was closed
+func printEvents(w io.Writer, events <-chan kubegrpc.PoolEvent) {
+	header := false
+	for e := range events {
+		if !header {
+			fmt.Fprintln(w, "\nEvents:")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s %v %s", e.Time.Format("15:04:05.000"), e.Type, e.Endpoint.PodName)
+		if e.Reason != "" {
+			fmt.Fprintf(w, ": %s", e.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// runChecks - Health checks the connections of the pool once more, with the balancer of the pool
+func runChecks(b kubegrpc.GrpcKubeBalancer, conns []*kubegrpc.GrpcConnection) []check {
+	checks := make([]check, 0, len(conns))
+	for _, gc := range conns {
+		info := gc.Info()
+		start := time.Now()
+		err := b.Ping(gc.Client())
+		checks = append(checks, check{pod: info.PodName, ip: info.IP, latency: time.Since(start), err: err})
+	}
+	return checks
+}
+
+// printPool - Prints the endpoints of the pool with the outcome of their health checks, and the pods backing off
+func printPool(w io.Writer, stats kubegrpc.PoolStats, checks []check) {
+	fmt.Fprintf(w, "\nPool %s: %d endpoints", stats.ServiceName, len(stats.Endpoints))
+	if stats.Degraded {
+		fmt.Fprint(w, ", degraded")
+	}
+	fmt.Fprintln(w)
+	byIP := make(map[string]check, len(checks))
+	for _, c := range checks {
+		byIP[c.ip] = c
+	}
+	endpoints := append([]kubegrpc.EndpointSnapshot(nil), stats.Endpoints...)
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Info.PodName < endpoints[j].Info.PodName })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  POD\tIP\tNODE\tZONE\tSTATE\tCONNECTIVITY\tCHECK\tLAST ERROR")
+	for _, ep := range endpoints {
+		result := "-"
+		if c, ok := byIP[ep.Info.IP]; ok {
+			result = fmt.Sprintf("ok %v", c.latency.Round(time.Millisecond))
+			if c.err != nil {
+				result = fmt.Sprintf("failed: %v", c.err)
+			}
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%v\t%v\t%s\t%s\n", ep.Info.PodName, ep.Info.IP, orDash(ep.Info.NodeName),
+			orDash(ep.Info.Zone), ep.Stats.State(), ep.Stats.Connectivity, result, orDash(ep.Stats.LastError))
+	}
+	tw.Flush()
+	if len(stats.BackingOff) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nNot in the pool, failed to dial or their health check:")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  POD\tIP\tFAILURES\tNEXT ATTEMPT")
+	for _, b := range stats.BackingOff {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%s\n", b.Pod, b.IP, b.Failures, b.NextAttempt.Format("15:04:05"))
+	}
+	tw.Flush()
+}
+
+// orDash - The value, or a dash if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
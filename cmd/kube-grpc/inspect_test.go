@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDescribeService(t *testing.T) {
+	k8s := fake.NewSimpleClientset(
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "shop"},
+			Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "orders"},
+				Ports: []corev1.ServicePort{{Name: "grpc", Port: 9000}}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "orders-1", Namespace: "shop",
+			Labels: map[string]string{"app": "orders"}},
+			Spec: corev1.PodSpec{NodeName: "node-a", Containers: []corev1.Container{{
+				Ports: []corev1.ContainerPort{{Name: "grpc", ContainerPort: 9000}}}}},
+			Status: corev1.PodStatus{PodIP: "10.0.0.1", Phase: corev1.PodRunning}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "shop"},
+			Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "none"}}})
+
+	var b bytes.Buffer
+	describeService(context.Background(), k8s, &b, "orders", "shop")
+	out := b.String()
+	for _, want := range []string{"selector app=orders", "Pods matching the selector: 1", "orders-1", "10.0.0.1",
+		"node-a", "grpc:9000"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	b.Reset()
+	describeService(context.Background(), k8s, &b, "empty", "shop")
+	if out := b.String(); !strings.Contains(out, "Pods matching the selector: 0") ||
+		!strings.Contains(out, "show-labels") {
+		t.Errorf("no selector hint in\n%s", out)
+	}
+	b.Reset()
+	describeService(context.Background(), k8s, &b, "missing", "shop")
+	if out := b.String(); !strings.Contains(out, "Check the name and the namespace") {
+		t.Errorf("no hint for a missing service in\n%s", out)
+	}
+}
+
+func TestHint(t *testing.T) {
+	denied := fmt.Errorf("refresh: %w", &kubegrpc.ErrPermissionDenied{Verb: "list", Resource: "pods", Namespace: "shop"})
+	if h := hint(denied); !strings.Contains(h, "Grant list on pods in namespace shop") {
+		t.Errorf("hint(%v) = %q", denied, h)
+	}
+	if h := hint(fmt.Errorf("%w: orders-1", kubegrpc.ErrNoPort)); !strings.Contains(h, "-port") {
+		t.Errorf("hint(ErrNoPort) = %q", h)
+	}
+	if h := hint(errors.New("other")); h != "" {
+		t.Errorf("hint(other) = %q, want none", h)
+	}
+}
+
+func TestPrintPool(t *testing.T) {
+	stats := kubegrpc.PoolStats{ServiceName: "orders.shop:grpc", Endpoints: []kubegrpc.EndpointSnapshot{
+		{Info: kubegrpc.EndpointInfo{PodName: "orders-2", IP: "10.0.0.2"}, Stats: kubegrpc.EndpointStats{Weight: 1}},
+		{Info: kubegrpc.EndpointInfo{PodName: "orders-1", IP: "10.0.0.1", Zone: "a"},
+			Stats: kubegrpc.EndpointStats{Weight: 1}},
+	}, BackingOff: []kubegrpc.BackoffState{{Pod: "orders-3", IP: "10.0.0.3", Failures: 2}}}
+	checks := []check{{pod: "orders-1", ip: "10.0.0.1"}, {pod: "orders-2", ip: "10.0.0.2", err: errors.New("NOT_SERVING")}}
+
+	var b bytes.Buffer
+	printPool(&b, stats, checks)
+	out := b.String()
+	first, second := strings.Index(out, "orders-1"), strings.Index(out, "orders-2")
+	if first < 0 || second < first {
+		t.Errorf("endpoints not listed by pod name in\n%s", out)
+	}
+	for _, want := range []string{"2 endpoints", "ok 0s", "failed: NOT_SERVING", "orders-3", "Healthy"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Command kube-grpc shows a service the way kube-grpc sees it, before any code is written against it: the service and
+// the pods its selector matches, the endpoints the library discovers, the outcome of dialing and health checking each
+// of them, and the resulting pool. It pinpoints RBAC, port and selector problems.
+//
+// The tool uses the kubeconfig (the current context by default, the in cluster config when there is none), so it
+// checks the permissions of the user or service account running it. Run it where the pod IPs are reachable, eg in a
+// debug pod in the cluster or on a node. The health checks use the standard grpc health service
+// (grpc.health.v1.Health); backends without it can be checked on their connectivity only with -check connect.
+//
+//	kube-grpc -namespace shop -service orders -port grpc -wait 5s
+//
+// The exit code is 1 when no endpoint passed its health check, 2 on setup errors.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Health check modes of -check
+const (
+	checkHealth  = "health"  // grpc.health.v1.Health/Check
+	checkConnect = "connect" // The grpc connection becomes ready
+)
+
+// probeBalancer - Balancer health checking the endpoints with the grpc health service, or on their connectivity only
+type probeBalancer struct {
+	mode    string
+	service string // Service of the health check requests, empty for the server as a whole
+	timeout time.Duration
+}
+
+func (b probeBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) {
+	if b.mode == checkConnect {
+		return conn, nil
+	}
+	return grpc_health_v1.NewHealthClient(conn), nil
+}
+
+func (b probeBalancer) Ping(client interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	if conn, ok := client.(*grpc.ClientConn); ok {
+		for {
+			s := conn.GetState()
+			if s == connectivity.Ready {
+				return nil
+			}
+			if !conn.WaitForStateChange(ctx, s) {
+				return fmt.Errorf("connection %v after %v", s, b.timeout)
+			}
+		}
+	}
+	res, err := client.(grpc_health_v1.HealthClient).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: b.service})
+	if err != nil {
+		return err
+	}
+	if res.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("health status %v", res.Status)
+	}
+	return nil
+}
+
+func main() {
+	var (
+		kubeconfig, kubeContext, service, namespace, port string
+		wait                                              time.Duration
+		verbose                                           bool
+		b                                                 probeBalancer
+	)
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path of the kubeconfig, default $KUBECONFIG or ~/.kube/config")
+	flag.StringVar(&kubeContext, "context", "", "Context of the kubeconfig, default the current context")
+	flag.StringVar(&service, "service", "", "Name of the service")
+	flag.StringVar(&namespace, "namespace", "default", "Namespace of the service")
+	flag.StringVar(&port, "port", "", "Port number or name to dial, default the port kube-grpc picks (see README)")
+	flag.StringVar(&b.mode, "check", checkHealth, "Health check: health (grpc health service) or connect")
+	flag.StringVar(&b.service, "health-service", "", "Service name of the health check requests")
+	flag.DurationVar(&b.timeout, "timeout", 2*time.Second, "Timeout per dial and health check")
+	flag.DurationVar(&wait, "wait", 3*time.Second, "Time the pool gets to dial and check the endpoints")
+	flag.BoolVar(&verbose, "v", false, "Show the log of the library")
+	flag.Parse()
+	if service == "" || (b.mode != checkHealth && b.mode != checkConnect) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kube-grpc: Could not load the kubeconfig. Error: %v\n", err)
+		os.Exit(2)
+	}
+	k8s, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kube-grpc: Could not connect to the kube cluster. Error: %v\n", err)
+		os.Exit(2)
+	}
+	kubegrpc.SetClientset(k8s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	describeService(ctx, k8s, os.Stdout, service, namespace)
+	cancel()
+
+	serviceName := service + "." + namespace
+	if port != "" {
+		serviceName += ":" + port
+	}
+	events := kubegrpc.Subscribe(serviceName)
+	_, err = kubegrpc.ConnectWithOptions(serviceName, b, kubegrpc.WithConnectTimeout(b.timeout))
+	if err != nil {
+		fmt.Printf("\nConnect(%q) failed: %v\n", serviceName, err)
+		if h := hint(err); h != "" {
+			fmt.Printf("  %s\n", h)
+		}
+	}
+	time.Sleep(wait)
+	kubegrpc.Unsubscribe(serviceName, events)
+	printEvents(os.Stdout, events)
+
+	stats, err := kubegrpc.Stats(serviceName)
+	if err != nil {
+		// The pool was not created, the reason is shown above
+		os.Exit(1)
+	}
+	checks := runChecks(b, kubegrpc.Connections(serviceName))
+	printPool(os.Stdout, stats, checks)
+	kubegrpc.ClosePool(serviceName)
+	for _, c := range checks {
+		if c.err == nil {
+			return
+		}
+	}
+	os.Exit(1)
+}
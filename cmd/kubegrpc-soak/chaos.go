@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// chaos - Deletes random backend pods and scales the backend deployment
+type chaos struct {
+	k8s       kubernetes.Interface
+	cfg       config
+	report    *report
+	namespace string
+	selector  string
+}
+
+func newChaos(k8s kubernetes.Interface, cfg config, r *report) (*chaos, error) {
+	name, namespace := serviceParts(cfg.service)
+	svc, err := k8s.CoreV1().Services(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can not get service %s: %w", cfg.service, err)
+	}
+	return &chaos{
+		k8s:       k8s,
+		cfg:       cfg,
+		report:    r,
+		namespace: namespace,
+		selector:  labels.Set(svc.Spec.Selector).AsSelector().String(),
+	}, nil
+}
+
+// serviceParts - Service name and namespace of `service.namespace[...][:port]`
+func serviceParts(serviceName string) (name, namespace string) {
+	host := strings.SplitN(serviceName, ":", 2)[0]
+	parts := strings.Split(host, ".")
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// run - Disrupts the backend until ctx is done
+func (c *chaos) run(ctx context.Context) {
+	var kill, scale <-chan time.Time
+	if c.cfg.killInterval > 0 {
+		t := time.NewTicker(c.cfg.killInterval)
+		defer t.Stop()
+		kill = t.C
+	}
+	if c.cfg.deployment != "" {
+		t := time.NewTicker(c.cfg.scaleInterval)
+		defer t.Stop()
+		scale = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-kill:
+			c.killPod(ctx)
+		case <-scale:
+			c.scale(ctx)
+		}
+	}
+}
+
+// killPod - Deletes a random running backend pod
+func (c *chaos) killPod(ctx context.Context) {
+	pods, err := c.k8s.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: c.selector})
+	if err != nil {
+		log.Printf("ERROR: chaos.killPod(): Can not list pods. Error: %v", err)
+		return
+	}
+	candidates := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.PodIP != "" {
+			candidates = append(candidates, pod.Name)
+		}
+	}
+	if len(candidates) < 2 {
+		// Never take down the last pod, the test measures failover not outage
+		return
+	}
+	name := candidates[rand.Intn(len(candidates))]
+	c.report.disrupted(name)
+	if err := c.k8s.CoreV1().Pods(c.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		log.Printf("ERROR: chaos.killPod(): Can not delete pod %s. Error: %v", name, err)
+		return
+	}
+	log.Printf("INFO: chaos.killPod(): Deleted pod %s", name)
+}
+
+// scale - Sets the backend deployment to a random replica count within the limits
+func (c *chaos) scale(ctx context.Context) {
+	deployments := c.k8s.AppsV1().Deployments(c.namespace)
+	s, err := deployments.GetScale(ctx, c.cfg.deployment, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("ERROR: chaos.scale(): Can not get scale of %s. Error: %v", c.cfg.deployment, err)
+		return
+	}
+	s.Spec.Replicas = int32(c.cfg.minReplicas + rand.Intn(c.cfg.maxReplicas-c.cfg.minReplicas+1))
+	if _, err := deployments.UpdateScale(ctx, c.cfg.deployment, s, metav1.UpdateOptions{}); err != nil {
+		log.Printf("ERROR: chaos.scale(): Can not scale %s. Error: %v", c.cfg.deployment, err)
+		return
+	}
+	log.Printf("INFO: chaos.scale(): Scaled %s to %d replicas", c.cfg.deployment, s.Spec.Replicas)
+}
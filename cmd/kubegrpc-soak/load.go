@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// config - Command line configuration
+type config struct {
+	service       string
+	duration      time.Duration
+	concurrency   int
+	qps           float64
+	timeout       time.Duration
+	killInterval  time.Duration
+	deployment    string
+	minReplicas   int
+	maxReplicas   int
+	scaleInterval time.Duration
+	slo           slo
+}
+
+// runLoad - Calls the health service through the pool until ctx is done
+func runLoad(ctx context.Context, cfg config, r *report) {
+	var tick <-chan time.Time
+	if cfg.qps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.qps))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tick != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tick:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				r.call(call(ctx, cfg))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// call - Makes a single RPC through the pool
+func call(ctx context.Context, cfg config) error {
+	client, err := kubegrpc.Connect(cfg.service, healthBalancer{})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+	_, err = client.(grpc_health_v1.HealthClient).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if ctx.Err() == context.Canceled {
+		// End of the test, not a failure
+		return nil
+	}
+	return err
+}
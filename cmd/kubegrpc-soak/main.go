@@ -0,0 +1,120 @@
+// Command kubegrpc-soak qualifies kube-grpc against a live service: it generates RPC load through a pool while
+// continuously deleting and scaling the backend pods, and checks the error rate and failover latency against SLOs.
+//
+// The tool runs inside the cluster (eg as a Job) with a service account allowed to list services and pods, delete pods
+// and update the scale of the backend deployment. The backend must implement the standard grpc health service
+// (grpc.health.v1.Health), which is used for both the load and the pings.
+//
+//	kubegrpc-soak -service echo.soak:9000 -duration 30m -kill-interval 20s \
+//		-deployment echo -min-replicas 2 -max-replicas 6
+//
+// The exit code is 1 when an SLO was violated, 2 on setup errors.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// healthBalancer - Balancer using the grpc health service
+type healthBalancer struct{}
+
+func (healthBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) {
+	return grpc_health_v1.NewHealthClient(conn), nil
+}
+
+func (healthBalancer) Ping(client interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.(grpc_health_v1.HealthClient).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+// validate - Checks the flags, before the tickers of the chaos would panic on a non positive interval
+func (c config) validate() error {
+	switch {
+	case c.service == "":
+		return errors.New("-service is required")
+	case c.concurrency <= 0:
+		return fmt.Errorf("-concurrency %d, want at least 1", c.concurrency)
+	case c.killInterval < 0:
+		return fmt.Errorf("-kill-interval %v, want 0 (disabled) or more", c.killInterval)
+	case c.deployment == "":
+		return nil
+	case c.scaleInterval <= 0:
+		return fmt.Errorf("-scale-interval %v, want more than 0 with -deployment", c.scaleInterval)
+	case c.maxReplicas < c.minReplicas:
+		return fmt.Errorf("-max-replicas %d below -min-replicas %d", c.maxReplicas, c.minReplicas)
+	}
+	return nil
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.service, "service", "", "Target service `service.namespace:port`")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Minute, "Duration of the soak test")
+	flag.IntVar(&cfg.concurrency, "concurrency", 8, "Concurrent callers")
+	flag.Float64Var(&cfg.qps, "qps", 200, "Total RPCs per second, 0 for unlimited")
+	flag.DurationVar(&cfg.timeout, "timeout", time.Second, "Timeout per RPC")
+	flag.DurationVar(&cfg.killInterval, "kill-interval", 30*time.Second, "Interval between pod deletions, 0 disables")
+	flag.StringVar(&cfg.deployment, "deployment", "", "Deployment of the backend to scale, empty disables scaling")
+	flag.IntVar(&cfg.minReplicas, "min-replicas", 2, "Minimum replicas when scaling")
+	flag.IntVar(&cfg.maxReplicas, "max-replicas", 5, "Maximum replicas when scaling")
+	flag.DurationVar(&cfg.scaleInterval, "scale-interval", time.Minute, "Interval between scale changes")
+	flag.Float64Var(&cfg.slo.maxErrorRate, "max-error-rate", 0.001, "SLO: maximum fraction of failed RPCs")
+	flag.DurationVar(&cfg.slo.maxFailover, "max-failover", 5*time.Second,
+		"SLO: maximum time from a pod deletion until its connections left the pool")
+	flag.Parse()
+	if err := cfg.validate(); err != nil {
+		log.Printf("ERROR: main(): %v", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.Printf("ERROR: main(): Could not get kube config in cluster. Error: %v", err)
+		os.Exit(2)
+	}
+	k8s, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		log.Printf("ERROR: main(): Could not connect to kube cluster with config. Error: %v", err)
+		os.Exit(2)
+	}
+	if _, err := kubegrpc.Connect(cfg.service, healthBalancer{}); err != nil {
+		log.Printf("ERROR: main(): Could not connect to %s. Error: %v", cfg.service, err)
+		os.Exit(2)
+	}
+	defer kubegrpc.ClosePool(cfg.service)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+	r := newReport()
+	events := kubegrpc.Subscribe(cfg.service)
+	defer kubegrpc.Unsubscribe(cfg.service, events)
+	go r.watch(events)
+	c, err := newChaos(k8s, cfg, r)
+	if err != nil {
+		log.Printf("ERROR: main(): %v", err)
+		os.Exit(2)
+	}
+	go c.run(ctx)
+	runLoad(ctx, cfg, r)
+
+	result := r.evaluate(cfg.slo)
+	log.Printf("INFO: main(): %s", result)
+	if !result.passed() {
+		os.Exit(1)
+	}
+}
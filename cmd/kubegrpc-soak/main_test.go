@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := config{service: "echo.soak:9000", concurrency: 8, killInterval: 30 * time.Second, deployment: "echo",
+		minReplicas: 2, maxReplicas: 5, scaleInterval: time.Minute}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("validate() = %v", err)
+	}
+	noChaos := valid
+	noChaos.killInterval, noChaos.deployment, noChaos.scaleInterval = 0, "", 0
+	if err := noChaos.validate(); err != nil {
+		t.Errorf("validate() without chaos = %v", err)
+	}
+	for name, invalid := range map[string]func(*config){
+		"no service":            func(c *config) { c.service = "" },
+		"no callers":            func(c *config) { c.concurrency = 0 },
+		"negative kills":        func(c *config) { c.killInterval = -time.Second },
+		"no scale interval":     func(c *config) { c.scaleInterval = 0 },
+		"replicas out of order": func(c *config) { c.minReplicas, c.maxReplicas = 5, 2 },
+	} {
+		c := valid
+		invalid(&c)
+		if err := c.validate(); err == nil {
+			t.Errorf("validate() with %s = nil, want an error", name)
+		}
+	}
+}
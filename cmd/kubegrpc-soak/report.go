@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+)
+
+// slo - Thresholds the run is checked against
+type slo struct {
+	maxErrorRate float64
+	maxFailover  time.Duration
+}
+
+// report - Collects the RPC results and failover latencies
+type report struct {
+	mutex     sync.Mutex
+	now       func() time.Time
+	calls     int
+	failures  int
+	pending   map[string]time.Time // Deleted pods whose connections are still in the pool, by pod name
+	failovers []time.Duration
+}
+
+func newReport() *report {
+	return &report{now: time.Now, pending: make(map[string]time.Time)}
+}
+
+// call - Records the result of an RPC
+func (r *report) call(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls++
+	if err != nil {
+		r.failures++
+	}
+}
+
+// disrupted - Records the deletion of a pod
+func (r *report) disrupted(pod string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pending[pod] = r.now()
+}
+
+// removed - Records that a connection to the pod left the pool, completing its failover
+func (r *report) removed(pod string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	start, found := r.pending[pod]
+	if !found {
+		return
+	}
+	delete(r.pending, pod)
+	r.failovers = append(r.failovers, r.now().Sub(start))
+}
+
+// watch - Completes failovers from the pool events until the channel is closed
+func (r *report) watch(events <-chan kubegrpc.PoolEvent) {
+	for e := range events {
+		if e.Type == kubegrpc.EndpointRemoved || e.Type == kubegrpc.EndpointDraining {
+			r.removed(e.Endpoint.PodName)
+		}
+	}
+}
+
+// result - Outcome of the run
+type result struct {
+	slo        slo
+	calls      int
+	errorRate  float64
+	failovers  int
+	p99        time.Duration
+	max        time.Duration
+	incomplete int // Deleted pods which never left the pool
+}
+
+// evaluate - Computes the result. Deleted pods which never left the pool count as failovers taking the remaining time.
+func (r *report) evaluate(s slo) result {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	latencies := append([]time.Duration(nil), r.failovers...)
+	now := r.now()
+	for _, start := range r.pending {
+		latencies = append(latencies, now.Sub(start))
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	res := result{slo: s, calls: r.calls, failovers: len(latencies), incomplete: len(r.pending)}
+	if r.calls > 0 {
+		res.errorRate = float64(r.failures) / float64(r.calls)
+	}
+	if len(latencies) > 0 {
+		res.p99 = latencies[(len(latencies)*99+99)/100-1]
+		res.max = latencies[len(latencies)-1]
+	}
+	return res
+}
+
+// passed - True if the run met the SLOs
+func (res result) passed() bool {
+	return res.calls > 0 && res.errorRate <= res.slo.maxErrorRate && res.p99 <= res.slo.maxFailover
+}
+
+func (res result) String() string {
+	verdict := "PASSED"
+	if !res.passed() {
+		verdict = "FAILED"
+	}
+	return fmt.Sprintf("%s: %d calls, error rate %.5f (max %.5f), %d failovers (%d incomplete), p99 %v, max %v (max %v)",
+		verdict, res.calls, res.errorRate, res.slo.maxErrorRate, res.failovers, res.incomplete, res.p99, res.max,
+		res.slo.maxFailover)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+)
+
+func TestReportFailover(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := newReport()
+	r.now = func() time.Time { return now }
+	r.disrupted("echo-1")
+	r.disrupted("echo-2")
+	now = now.Add(2 * time.Second)
+	events := make(chan kubegrpc.PoolEvent, 2)
+	events <- kubegrpc.PoolEvent{Type: kubegrpc.EndpointRemoved, Endpoint: kubegrpc.EndpointInfo{PodName: "echo-1"}}
+	events <- kubegrpc.PoolEvent{Type: kubegrpc.EndpointRemoved, Endpoint: kubegrpc.EndpointInfo{PodName: "echo-1"}}
+	close(events)
+	r.watch(events)
+	now = now.Add(8 * time.Second)
+	for i := 0; i < 999; i++ {
+		r.call(nil)
+	}
+	r.call(errors.New("unavailable"))
+
+	res := r.evaluate(slo{maxErrorRate: 0.001, maxFailover: 5 * time.Second})
+	if res.calls != 1000 || res.errorRate != 0.001 || res.failovers != 2 || res.incomplete != 1 {
+		t.Errorf("evaluate() = %+v", res)
+	}
+	// echo-2 never left the pool: 10s
+	if res.max != 10*time.Second || res.p99 != 10*time.Second || res.passed() {
+		t.Errorf("evaluate() = %v, want failed on the failover latency", res)
+	}
+	if res = r.evaluate(slo{maxErrorRate: 0.001, maxFailover: 10 * time.Second}); !res.passed() {
+		t.Errorf("evaluate() = %v, want passed", res)
+	}
+}
+
+func TestServiceParts(t *testing.T) {
+	if name, namespace := serviceParts("echo.soak.svc.cluster.local:9000"); name != "echo" || namespace != "soak" {
+		t.Errorf("serviceParts() = %q, %q", name, namespace)
+	}
+}
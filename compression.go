@@ -0,0 +1,31 @@
+package kubegrpc
+
+import (
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // Registers the gzip compressor
+)
+
+// WithCompression - Compresses the requests of all calls made through the connections of the pool with the named
+// compressor: "gzip" or a compressor registered with encoding.RegisterCompressor, for bandwidth heavy traffic. The
+// servers answer with the same compressor (grpc-go servers have gzip registered when they import the gzip package).
+// Calls can still override it with grpc.UseCompressor. An unknown compressor is ignored.
+func WithCompression(name string) PoolOption {
+	return func(c *poolConfig) {
+		if encoding.GetCompressor(name) == nil {
+			log.Printf("WARNING: WithCompression(): Compressor %q is not registered, compression ignored", name)
+			return
+		}
+		c.compression = name
+	}
+}
+
+// compressionOption - Dial option of the compression of the pool, nil without compression
+func (c poolConfig) compressionOption() grpc.DialOption {
+	if c.compression == "" {
+		return nil
+	}
+	return grpc.WithDefaultCallOptions(grpc.UseCompressor(c.compression))
+}
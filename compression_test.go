@@ -0,0 +1,61 @@
+package kubegrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// countingCompressor - gzip under another name, counts the compressed messages
+type countingCompressor struct {
+	encoding.Compressor
+	compressed int32
+}
+
+func (c *countingCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt32(&c.compressed, 1)
+	return c.Compressor.Compress(w)
+}
+
+func (c *countingCompressor) Name() string {
+	return "kubegrpc-test"
+}
+
+func TestCompression(t *testing.T) {
+	compressor := &countingCompressor{Compressor: encoding.GetCompressor(gzip.Name)}
+	encoding.RegisterCompressor(compressor)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	if c := newPoolConfig([]PoolOption{WithCompression("unknown")}); c.compressionOption() != nil {
+		t.Error("compression with an unknown compressor")
+	}
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithCompression("kubegrpc-test")}))
+	gc, dialErr := newGrpcConnection("svc.ns:"+port, p, testPod("svc-1", "ns", "svc", "127.0.0.1"), port)
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+	defer gc.conn.Close()
+	if _, err := healthpb.NewHealthClient(gc.conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	// The request on the client and the response on the server
+	if n := atomic.LoadInt32(&compressor.compressed); n != 2 {
+		t.Errorf("%d messages compressed, want 2", n)
+	}
+}
@@ -0,0 +1,127 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ErrConnectTimeout - A dialed pod did not reach the grpc state READY within the connect timeout, see
+// WithConnectTimeout
+var ErrConnectTimeout = errors.New("kubegrpc: connection not ready within the connect timeout")
+
+// WithConnectTimeout - Admits new connections to the pool only once they reached the grpc state READY, so broken pods
+// never receive picks. The pods found by a discovery are dialed as before, then their connections wait concurrently up
+// to the timeout; the ones which are not READY by then are closed and their pods backed off like failed dials
+// (ErrDialFailed wrapping ErrConnectTimeout). The other pools are not blocked while waiting; the first discovery of a
+// pool delays Connect by up to the timeout. 0, the default, admits the connections right after the dial.
+func WithConnectTimeout(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.connectTimeout = d
+	}
+}
+
+// awaitReady - Waits concurrently for the new connections of the pool to become READY within the connect timeout.
+// Returns the ready connections and the error of the last one which was not, those are closed and backed off.
+func awaitReady(c *connection, conns []*GrpcConnection) ([]*GrpcConnection, *ErrDialFailed) {
+	ctx, cancel := context.WithTimeout(c.poolContext(), c.config.connectTimeout)
+	defer cancel()
+	states := make([]connectivity.State, len(conns))
+	var wg sync.WaitGroup
+	for i, gc := range conns {
+		wg.Add(1)
+		go func(i int, conn *grpc.ClientConn) {
+			defer wg.Done()
+			states[i] = waitReady(ctx, conn)
+		}(i, gc.conn)
+	}
+	wg.Wait()
+	ready := make([]*GrpcConnection, 0, len(conns))
+	var lastErr *ErrDialFailed
+	for i, gc := range conns {
+		if states[i] == connectivity.Ready {
+			ready = append(ready, gc)
+			continue
+		}
+		gc.conn.Close()
+		lastErr = &ErrDialFailed{Pod: gc.podName, IP: gc.connectionIP,
+			Err: fmt.Errorf("%w: %s after %v", ErrConnectTimeout, states[i], c.config.connectTimeout)}
+		delay := c.backoff.failure(gc.connectionIP, gc.podName)
+		log.Printf("INFO: awaitReady(): %v. Next attempt in %v", lastErr, delay)
+		emitBackoff(gc.serviceName, c, gc.Info(), lastErr.Error())
+	}
+	return ready, lastErr
+}
+
+// preflight - Checks the new connections of the pool concurrently with the reflection check and the version probe of
+// the pool, see WithReflectionCheck and WithVersionProbe. Returns the connections passing the checks and the error of
+// the last one which did not, those are closed and backed off. Takes up to the ping timeout, do not hold mutex.
+func preflight(c *connection, conns []*GrpcConnection) ([]*GrpcConnection, *ErrDialFailed) {
+	errs := make([]error, len(conns))
+	var wg sync.WaitGroup
+	for i, gc := range conns {
+		wg.Add(1)
+		go func(i int, gc *GrpcConnection) {
+			defer wg.Done()
+			if len(c.config.reflectionCheck) > 0 {
+				if errs[i] = gc.checkReflection(c); errs[i] != nil {
+					return
+				}
+			}
+			if c.config.versionProbe != nil {
+				gc.probeVersion(c)
+			}
+		}(i, gc)
+	}
+	wg.Wait()
+	passed := make([]*GrpcConnection, 0, len(conns))
+	var lastErr *ErrDialFailed
+	for i, gc := range conns {
+		if errs[i] == nil {
+			passed = append(passed, gc)
+			continue
+		}
+		gc.conn.Close()
+		lastErr = &ErrDialFailed{Pod: gc.podName, IP: gc.connectionIP, Err: errs[i]}
+		delay := c.backoff.failure(gc.connectionIP, gc.podName)
+		log.Printf("INFO: preflight(): %v. Next attempt in %v", lastErr, delay)
+		emitBackoff(gc.serviceName, c, gc.Info(), lastErr.Error())
+	}
+	return passed, lastErr
+}
+
+// waitReady - Waits until the connection is READY or ctx is done, returns the last state
+func waitReady(ctx context.Context, conn *grpc.ClientConn) connectivity.State {
+	for {
+		s := conn.GetState()
+		if s == connectivity.Ready || s == connectivity.Shutdown || !conn.WaitForStateChange(ctx, s) {
+			return s
+		}
+	}
+}
+
+// admitConnections - Adds the ready connections to the pool, unless their pods got their connections from a concurrent
+// update meanwhile or the pool is full. Returns the added connections, the others are closed. Caller must hold mutex.
+func admitConnections(c *connection, ready []*GrpcConnection) []*GrpcConnection {
+	next := make([]*GrpcConnection, len(c.grpcConnection), len(c.grpcConnection)+len(ready))
+	copy(next, c.grpcConnection)
+	added := make([]*GrpcConnection, 0, len(ready))
+	for _, gc := range ready {
+		if c.closed || countConnections(next, gc.connectionIP) >= c.config.perEndpoint() || poolFull(c, len(next)) {
+			gc.conn.Close()
+			continue
+		}
+		next = append(next, gc)
+		added = append(added, gc)
+	}
+	if len(added) > 0 {
+		c.swapConnections(next)
+	}
+	return added
+}
@@ -0,0 +1,63 @@
+package kubegrpc
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestConnectTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	serviceName := "svc.ns:" + port
+	// Nothing listens on 127.0.0.2
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"),
+		testPod("svc-1", "ns", "svc", "127.0.0.2"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithConnectTimeout(300 * time.Millisecond)}))
+	mutex.Lock()
+	setPool(serviceName, c)
+	mutex.Unlock()
+	defer ClosePool(serviceName)
+	events := Subscribe(serviceName)
+	defer Unsubscribe(serviceName, events)
+
+	if err := updateConnectionPool(serviceName, c, true); err != nil {
+		t.Fatal(err)
+	}
+	pool := ListPool(serviceName)
+	if len(pool) != 1 || pool[0].connectionIP != "127.0.0.1" {
+		t.Fatalf("pool = %v, want only the ready pod", pool)
+	}
+	if e := <-events; e.Type != EndpointBackingOff || e.Endpoint.IP != "127.0.0.2" || e.Backoff.Failures != 1 {
+		t.Errorf("event = %+v, want EndpointBackingOff of the pod which did not become ready", e)
+	}
+	if e := <-events; e.Type != EndpointAdded || e.Endpoint.IP != "127.0.0.1" {
+		t.Errorf("event = %+v, want EndpointAdded of the ready pod", e)
+	}
+	if c.backoff.allow("127.0.0.2") {
+		t.Error("pod which did not become ready is not backed off")
+	}
+}
+
+func TestConnectTimeoutNoneReady(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-1", "ns", "svc", "127.0.0.2"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithConnectTimeout(100 * time.Millisecond)}))
+	mutex.Lock()
+	setPool("svc.ns:1", c)
+	mutex.Unlock()
+	defer ClosePool("svc.ns:1")
+	err := updateConnectionPool("svc.ns:1", c, true)
+	var dialErr *ErrDialFailed
+	if !errors.Is(err, ErrNoHealthyEndpoints) || !errors.As(err, &dialErr) || !errors.Is(err, ErrConnectTimeout) {
+		t.Errorf("error %v, want ErrNoHealthyEndpoints with the ErrConnectTimeout of the pod", err)
+	}
+}
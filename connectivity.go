@@ -0,0 +1,51 @@
+package kubegrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// state - Connectivity state of the grpc connection
+func (c *GrpcConnection) state() connectivity.State {
+	if c.conn == nil {
+		return connectivity.Idle
+	}
+	return c.conn.GetState()
+}
+
+// watchState - Follows the connectivity state of the connection until it shuts down or the pool is closed, as a
+// passive health signal next to the periodic ping. TRANSIENT_FAILURE pings the connection right away instead of at the
+// next health check, so a failing pod leaves the pool without waiting for the ping interval. A SHUTDOWN of a connection
+// which is still in its pool (closed outside of the pool maintenance) removes it from the pool.
+func (c *GrpcConnection) watchState(ctx context.Context) {
+	for state := c.conn.GetState(); ; state = c.conn.GetState() {
+		switch state {
+		case connectivity.TransientFailure:
+			if h := c.health(); h != nil {
+				go checkConnection(h)
+			}
+		case connectivity.Shutdown:
+			if c.health() != nil {
+				emitEndpoint(EndpointUnhealthy, c, 0, "connection shut down")
+				dirtyConnections.push(c)
+			}
+			return
+		}
+		if !c.conn.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
+
+// health - Health check parameters of the connection, nil if it is no longer in an open pool
+func (c *GrpcConnection) health() *connHealth {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	p := connectionCache[c.serviceName]
+	if p == nil || p != c.pool || p.closed || !containsConnection(p.grpcConnection, c) {
+		return nil
+	}
+	return &connHealth{functions: c.clientBalancer(p.functions), grpcConn: c, backoff: p.pingBackoff(), ctx: p.poolContext(),
+		timeout: p.config.pingTimeout}
+}
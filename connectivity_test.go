@@ -0,0 +1,56 @@
+package kubegrpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestShutdownRemovesConnection(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	c := newConnection(okBalancer{}, newPoolConfig(nil))
+	cachePool(t, c)
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	events := Subscribe("svc.ns:1000")
+	defer Unsubscribe("svc.ns:1000", events)
+	ListPool("svc.ns:1000")[0].conn.Close()
+	if n := poolSize(c, 0); n != 0 {
+		t.Fatalf("pool size after the connection shut down = %d, want 0", n)
+	}
+	select {
+	case e := <-events:
+		if e.Type != EndpointUnhealthy {
+			t.Errorf("event = %v, want EndpointUnhealthy", e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("no event for the shut down connection")
+	}
+}
+
+func TestConnectivityStats(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close() // Dials are refused
+	p := newConnection(okBalancer{}, newPoolConfig(nil))
+	gc, dialErr := newGrpcConnection("svc.ns:"+port, p, testPod("svc-0", "ns", "svc", "127.0.0.1"), port)
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+	defer gc.conn.Close()
+	for i := 0; i < 100 && gc.Stats().Connectivity != connectivity.TransientFailure; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := gc.Stats().Connectivity; got != connectivity.TransientFailure {
+		t.Errorf("Stats().Connectivity = %v, want TRANSIENT_FAILURE", got)
+	}
+	if got := (&GrpcConnection{}).Stats().Connectivity; got != connectivity.Idle {
+		t.Errorf("Stats().Connectivity without connection = %v, want IDLE", got)
+	}
+}
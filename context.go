@@ -0,0 +1,76 @@
+package kubegrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// defaultPingTimeout - Deadline of the context passed to PingContext
+const defaultPingTimeout = 5 * time.Second
+
+// ContextBalancer - Optional extension of GrpcKubeBalancer. When the balancer implements it, the context variants are
+// called instead of NewGrpcClient and Ping. The context carries the endpoint (see EndpointFromContext) so
+// implementations can log and trace which backend they set up or probe, is cancelled when the pool is closed, and has
+// the ping timeout of the pool as deadline for PingContext.
+type ContextBalancer interface {
+	GrpcKubeBalancer
+	NewGrpcClientContext(ctx context.Context, conn *grpc.ClientConn) (interface{}, error)
+	PingContext(ctx context.Context, grpcConnection interface{}) error
+}
+
+// WithPingTimeout - Deadline of the context passed to PingContext, default 5 seconds
+func WithPingTimeout(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.pingTimeout = d
+	}
+}
+
+// endpointContextKey - Context key of the EndpointInfo
+type endpointContextKey struct{}
+
+// EndpointFromContext - Returns the endpoint a NewGrpcClientContext or PingContext call is made for
+func EndpointFromContext(ctx context.Context) (EndpointInfo, bool) {
+	info, ok := ctx.Value(endpointContextKey{}).(EndpointInfo)
+	return info, ok
+}
+
+// poolContext - Context of the pool, cancelled by ClosePool
+func (c *connection) poolContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// endpointContext - Pool context carrying the endpoint of the connection
+func (c *GrpcConnection) endpointContext(parent context.Context) context.Context {
+	return context.WithValue(parent, endpointContextKey{}, c.Info())
+}
+
+// newClient - Creates the client of the connection with the balancer of the pool, which is recorded for the pings
+func (c *connection) newClient(gc *GrpcConnection) (interface{}, error) {
+	gc.functions = c.functions
+	if cb, ok := c.functions.(ContextBalancer); ok {
+		return cb.NewGrpcClientContext(gc.endpointContext(c.poolContext()), gc.conn)
+	}
+	return c.functions.NewGrpcClient(gc.conn)
+}
+
+// ping - Pings the connection with the balancer, within the timeout when the balancer takes a context
+func ping(f GrpcKubeBalancer, parent context.Context, timeout time.Duration, gc *GrpcConnection) error {
+	if err := injectPingFault(gc); err != nil {
+		return err
+	}
+	cb, ok := f.(ContextBalancer)
+	if !ok {
+		return f.Ping(gc.GrpcConnection)
+	}
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(gc.endpointContext(parent), timeout)
+	defer cancel()
+	return cb.PingContext(ctx, gc.GrpcConnection)
+}
@@ -0,0 +1,70 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// contextBalancer - ContextBalancer recording the contexts it is called with
+type contextBalancer struct {
+	okBalancer
+	created chan context.Context
+	pinged  chan context.Context
+}
+
+func (b *contextBalancer) NewGrpcClientContext(ctx context.Context, conn *grpc.ClientConn) (interface{}, error) {
+	b.created <- ctx
+	return conn, nil
+}
+
+func (b *contextBalancer) PingContext(ctx context.Context, grpcConnection interface{}) error {
+	b.pinged <- ctx
+	return nil
+}
+
+func TestContextBalancer(t *testing.T) {
+	b := &contextBalancer{created: make(chan context.Context, 1), pinged: make(chan context.Context, 1)}
+	p := newConnection(b, newPoolConfig([]PoolOption{WithPingTimeout(time.Second)}))
+	gc, err := newGrpcConnection("svc.ns:1000", p, testPod("svc-1", "ns", "svc", "10.0.0.1"), "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.conn.Close()
+	ctx := <-b.created
+	if info, ok := EndpointFromContext(ctx); !ok || info.PodName != "svc-1" || info.ServiceName != "svc.ns:1000" {
+		t.Errorf("EndpointFromContext() = %+v, %v, want svc-1", info, ok)
+	}
+
+	if err := ping(b, p.poolContext(), p.config.pingTimeout, gc); err != nil {
+		t.Fatal(err)
+	}
+	ctx = <-b.pinged
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("ping deadline = %v, %v, want within a second", deadline, ok)
+	}
+	if info, ok := EndpointFromContext(ctx); !ok || info.IP != "10.0.0.1" {
+		t.Errorf("EndpointFromContext() = %+v, %v, want 10.0.0.1", info, ok)
+	}
+
+	mutex.Lock()
+	closePool("svc.ns:1000", p)
+	mutex.Unlock()
+	if p.poolContext().Err() == nil {
+		t.Error("pool context not cancelled by closePool")
+	}
+}
+
+// unhealthyBalancer - GrpcKubeBalancer whose pings always fail
+type unhealthyBalancer struct{ okBalancer }
+
+func (unhealthyBalancer) Ping(interface{}) error { return errors.New("unhealthy") }
+
+func TestPingWithoutContext(t *testing.T) {
+	if err := ping(unhealthyBalancer{}, context.Background(), 0, &GrpcConnection{}); err == nil {
+		t.Error("ping() = nil, want the Ping error of the balancer")
+	}
+}
@@ -0,0 +1,131 @@
+package kubegrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrNoToken - The token file of TokenCredentials could not be read and no valid token is cached
+var ErrNoToken = errors.New("kubegrpc: no token")
+
+const (
+	// ServiceAccountTokenPath - Token of the service account of the pod, mounted by kubernetes
+	ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// tokenRefreshInterval - Interval in which the token file is read again. The kubelet rotates projected tokens at 80%
+	// of their lifetime (at least 10 minutes), so the token is replaced well before it expires.
+	tokenRefreshInterval = time.Minute
+	// tokenExpiryMargin - A cached token expiring within the margin is read again on the next call
+	tokenExpiryMargin = 30 * time.Second
+)
+
+// readTokenFile - Replaced in tests
+var readTokenFile = ioutil.ReadFile
+
+// WithPerRPCCredentials - Attaches the credentials (tokens, API keys, ...) to every RPC on the connections of the pool.
+// Credentials requiring transport security are only attached on TLS connections (see WithTLSMigration); plaintext
+// connections of the pool are dialed without them.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) PoolOption {
+	return func(c *poolConfig) {
+		c.perRPCCredentials = creds
+	}
+}
+
+// WithServiceAccountToken - Sends the bound service account token at path (ServiceAccountTokenPath for an empty path,
+// or a projected token volume with the audience of the backend) as bearer token on every RPC, see TokenCredentials.
+// The token is only sent on TLS connections; for plaintext pools use
+// WithPerRPCCredentials(NewTokenCredentials(path, false)).
+func WithServiceAccountToken(path string) PoolOption {
+	return WithPerRPCCredentials(NewTokenCredentials(path, true))
+}
+
+// TokenCredentials - PerRPCCredentials sending a JWT read from a file as `authorization: Bearer <token>`. The file is
+// read again every minute, and earlier when the cached token is about to expire, so tokens rotated by the kubelet are
+// picked up without restart. When the file cannot be read, the cached token is used until it expires.
+type TokenCredentials struct {
+	path       string
+	requireTLS bool
+	mutex      sync.Mutex
+	token      string
+	expiry     time.Time // exp claim of the token, zero if unknown
+	read       time.Time // Last time the file was read successfully
+}
+
+// NewTokenCredentials - Credentials for the token file at path, ServiceAccountTokenPath for an empty path. requireTLS
+// false allows sending the token over plaintext connections, e.g. behind a service mesh encrypting the traffic.
+func NewTokenCredentials(path string, requireTLS bool) *TokenCredentials {
+	if path == "" {
+		path = ServiceAccountTokenPath
+	}
+	return &TokenCredentials{path: path, requireTLS: requireTLS}
+}
+
+// GetRequestMetadata - Implements credentials.PerRPCCredentials
+func (t *TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := t.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity - Implements credentials.PerRPCCredentials
+func (t *TokenCredentials) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
+
+// Token - Returns the current token, reading the file again when due
+func (t *TokenCredentials) Token() (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	expiring := !t.expiry.IsZero() && now.Add(tokenExpiryMargin).After(t.expiry)
+	if t.token != "" && now.Sub(t.read) < tokenRefreshInterval && !expiring {
+		return t.token, nil
+	}
+	b, err := readTokenFile(t.path)
+	token := strings.TrimSpace(string(b))
+	if err == nil && token == "" {
+		err = errors.New("empty token file")
+	}
+	if err != nil {
+		if t.token != "" && (t.expiry.IsZero() || now.Before(t.expiry)) {
+			log.Printf("WARNING: TokenCredentials.Token(): Unable to read %s, using the cached token: %v", t.path, err)
+			return t.token, nil
+		}
+		return "", fmt.Errorf("%w: %s: %v", ErrNoToken, t.path, err)
+	}
+	t.token = token
+	t.expiry = tokenExpiry(token)
+	t.read = now
+	return t.token, nil
+}
+
+// tokenExpiry - exp claim of the JWT, zero if the token is no JWT or has no exp claim. The signature is not verified,
+// the token is only forwarded.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
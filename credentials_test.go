@@ -0,0 +1,126 @@
+package kubegrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// useTokenFile - Replaces the token file reader for the test, the returned function sets the content or error
+func useTokenFile(t *testing.T) func(token string, err error) {
+	t.Helper()
+	previous := readTokenFile
+	var content string
+	var readErr error
+	readTokenFile = func(string) ([]byte, error) { return []byte(content), readErr }
+	t.Cleanup(func() { readTokenFile = previous })
+	return func(token string, err error) { content, readErr = token, err }
+}
+
+// testJWT - Unsigned JWT expiring at exp
+func testJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+	return "e30." + payload + ".sig"
+}
+
+func TestTokenCredentials(t *testing.T) {
+	setToken := useTokenFile(t)
+	creds := NewTokenCredentials("", true)
+	if creds.path != ServiceAccountTokenPath || !creds.RequireTransportSecurity() {
+		t.Fatalf("defaults: %q, %v", creds.path, creds.RequireTransportSecurity())
+	}
+	if _, err := creds.Token(); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("Token() without file = %v, want ErrNoToken", err)
+	}
+
+	first := testJWT(time.Now().Add(time.Hour))
+	setToken(first+"\n", nil)
+	md, err := creds.GetRequestMetadata(context.Background())
+	if err != nil || md["authorization"] != "Bearer "+first {
+		t.Fatalf("GetRequestMetadata() = %v, %v", md, err)
+	}
+	setToken(testJWT(time.Now().Add(2*time.Hour)), nil)
+	if token, _ := creds.Token(); token != first {
+		t.Error("token read again before the refresh interval")
+	}
+
+	// About to expire: read again
+	expiring := testJWT(time.Now().Add(10 * time.Second))
+	creds.expiry = time.Now().Add(10 * time.Second)
+	setToken(expiring, nil)
+	if token, _ := creds.Token(); token != expiring {
+		t.Error("expiring token not read again")
+	}
+
+	// Unreadable file: the cached token is used until it expired
+	setToken("", errors.New("gone"))
+	if token, err := creds.Token(); err != nil || token != expiring {
+		t.Errorf("Token() with unreadable file = %q, %v, want the cached token", token, err)
+	}
+	creds.expiry = time.Now().Add(-time.Second)
+	if _, err := creds.Token(); !errors.Is(err, ErrNoToken) {
+		t.Errorf("Token() with expired cache = %v, want ErrNoToken", err)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	if got := tokenExpiry(testJWT(exp)); !got.Equal(exp) {
+		t.Errorf("tokenExpiry() = %v, want %v", got, exp)
+	}
+	for _, token := range []string{"opaque", "a.!.c", "e30.e30.sig"} {
+		if got := tokenExpiry(token); !got.IsZero() {
+			t.Errorf("tokenExpiry(%q) = %v, want zero", token, got)
+		}
+	}
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		received <- md["authorization"]
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	setToken := useTokenFile(t)
+	setToken("token", nil)
+	for _, tt := range []struct {
+		requireTLS bool
+		want       string
+	}{{false, "Bearer token"}, {true, ""}} {
+		p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{
+			WithPerRPCCredentials(NewTokenCredentials("token", tt.requireTLS))}))
+		gc, dialErr := newGrpcConnection("svc.ns:"+port, p, testPod("svc-1", "ns", "svc", "127.0.0.1"), port)
+		if dialErr != nil {
+			t.Fatal(dialErr)
+		}
+		_, err := healthpb.NewHealthClient(gc.conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		gc.conn.Close()
+		if err != nil {
+			t.Fatalf("requireTLS %v: Check() = %v", tt.requireTLS, err)
+		}
+		got := <-received
+		if (tt.want == "" && len(got) != 0) || (tt.want != "" && (len(got) != 1 || got[0] != tt.want)) {
+			t.Errorf("requireTLS %v: authorization = %v, want %q", tt.requireTLS, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package kubegrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AttemptContext - Context for the attempt (counting from 1) of a call to the pool of the service: its deadline is the
+// remaining deadline of ctx split evenly over the attempts left, with the MaxAttempts of the RetryPolicy of the pool
+// or else the 3 attempts of Do. A hanging endpoint so leaves time for the retries on other endpoints, and all attempts
+// together stay within the deadline of ctx. The last attempt, and every attempt when ctx has no deadline, gets ctx with
+// its own deadline. Hedged calls run their attempts concurrently and need no split.
+func AttemptContext(ctx context.Context, serviceName string, attempt int) (context.Context, context.CancelFunc) {
+	maxAttempts := doMaxAttempts
+	if c := publishedPool(serviceName); c != nil && c.config.retryPolicy != nil {
+		maxAttempts = c.config.retryPolicy.MaxAttempts
+	}
+	return attemptContext(ctx, maxAttempts, attempt)
+}
+
+// attemptContext - Context for the attempt with its share of the remaining deadline of ctx
+func attemptContext(ctx context.Context, maxAttempts, attempt int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	left := maxAttempts - attempt + 1
+	if !ok || left <= 1 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(left))
+}
+
+// attemptExpired - True if the attempt failed on its own deadline while the deadline of the call, ctx, is not reached
+func attemptExpired(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && (err == context.DeadlineExceeded || status.Code(err) == codes.DeadlineExceeded)
+}
+
+// DoWithDeadline - Do with a deadline per attempt, see AttemptContext: fn gets the context of its attempt to make
+// its RPCs with, and an attempt which runs out of its share of the deadline is retried on another endpoint like a
+// connection error. Returns ErrPoolNotFound if there is no pool.
+func DoWithDeadline(ctx context.Context, serviceName string,
+	fn func(ctx context.Context, client interface{}) error) error {
+	gc, err := PickConnection(serviceName)
+	if err != nil {
+		return err
+	}
+	return gc.DoWithDeadline(ctx, fn)
+}
+
+// DoWithDeadline - GrpcConnection.Do with a deadline per attempt, see DoWithDeadline
+func (c *GrpcConnection) DoWithDeadline(ctx context.Context, fn func(ctx context.Context, client interface{}) error) error {
+	maxAttempts := c.maxAttempts()
+	return c.doAttempts(ctx, func(attempt int, client interface{}) error {
+		attemptCtx, cancel := attemptContext(ctx, maxAttempts, attempt)
+		defer cancel()
+		return fn(attemptCtx, client)
+	}, true)
+}
@@ -0,0 +1,73 @@
+package kubegrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAttemptContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 900*time.Millisecond)
+	defer cancel()
+	overall, _ := ctx.Deadline()
+	first, cancelFirst := AttemptContext(ctx, "svc.ns:1000", 1)
+	defer cancelFirst()
+	if deadline, _ := first.Deadline(); time.Until(deadline) > 300*time.Millisecond || time.Until(deadline) < 200*time.Millisecond {
+		t.Errorf("first of 3 attempts has %v left, want a third of the deadline", time.Until(deadline))
+	}
+	last, cancelLast := AttemptContext(ctx, "svc.ns:1000", 3)
+	defer cancelLast()
+	if deadline, _ := last.Deadline(); !deadline.Equal(overall) {
+		t.Errorf("last attempt deadline = %v, want the deadline of the call %v", deadline, overall)
+	}
+	unbounded, cancelUnbounded := AttemptContext(context.Background(), "svc.ns:1000", 1)
+	defer cancelUnbounded()
+	if _, ok := unbounded.Deadline(); ok {
+		t.Error("attempt of a call without deadline has a deadline")
+	}
+}
+
+func TestRetryAttemptDeadline(t *testing.T) {
+	p := testPool(t, 3, WithRetryPolicy(RetryPolicy{IdempotentMethods: []string{"*"}, AttemptDeadline: true}))
+	inv := &recordingInvoker{answer: func(ctx context.Context, target string, _ interface{}) error {
+		if target == "10.0.0.1:1000" {
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return nil
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	first := p.grpcConnection[0]
+	if err := first.unaryInterceptor(ctx, "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke); err != nil {
+		t.Fatalf("call error = %v, want retried within the deadline", err)
+	}
+	if len(inv.targets) != 2 {
+		t.Errorf("attempts = %v, want the hanging endpoint and one retry", inv.targets)
+	}
+}
+
+func TestDoWithDeadline(t *testing.T) {
+	p := testPool(t, 3)
+	cachePool(t, p)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	attempts := 0
+	err := DoWithDeadline(ctx, "svc.ns:1000", func(attemptCtx context.Context, _ interface{}) error {
+		attempts++
+		if attempts == 1 {
+			<-attemptCtx.Done()
+			return status.Error(codes.DeadlineExceeded, "hanging endpoint")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("DoWithDeadline() = %v after %d attempts, want success on the second", err, attempts)
+	}
+	if ctx.Err() != nil {
+		t.Error("the attempts used up the deadline of the call")
+	}
+}
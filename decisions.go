@@ -0,0 +1,201 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DecisionType - Kind of a decision of a pool
+type DecisionType int
+
+// Decision types
+const (
+	DecisionPick     DecisionType = iota // A connection was picked for a call
+	DecisionEviction                     // A connection was evicted, ejected or excluded
+	DecisionRefresh                      // The pool was refreshed from the discovery
+)
+
+func (t DecisionType) String() string {
+	switch t {
+	case DecisionPick:
+		return "pick"
+	case DecisionEviction:
+		return "eviction"
+	case DecisionRefresh:
+		return "refresh"
+	}
+	return fmt.Sprintf("DecisionType(%d)", int(t))
+}
+
+// Strategies of the pick decisions
+const (
+	StrategyUniform  = "uniform"  // Uniformly random among the usable connections
+	StrategyWeighted = "weighted" // Random in proportion to the weights of the connections
+	StrategyPicker   = "picker"   // Selected by the picker of the pool, see WithPicker
+	StrategyFallback = "fallback" // No usable connection, random among all: ejected, excluded or weighted to 0
+)
+
+// DecisionCandidate - An endpoint considered by a pick
+type DecisionCandidate struct {
+	Endpoint EndpointInfo
+	State    HealthState
+	Weight   float64 // Combined weight of health, override, pod weight, load and scorers; 0 if not usable
+}
+
+// Decision - A decision of a pool with its reasoning, see SetDecisionLog
+type Decision struct {
+	Type        DecisionType
+	Time        time.Time
+	ServiceName string
+	Endpoint    EndpointInfo        // Picked or evicted endpoint, zero for refreshes
+	Strategy    string              // How the endpoint was picked, see StrategyUniform etc. Empty for other decisions
+	Reason      string              // Why the endpoint was evicted, or the outcome of the refresh
+	Candidates  []DecisionCandidate // Endpoints the pick chose from
+}
+
+// String - The decision for the logs
+func (d Decision) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %s", d.Type, d.ServiceName)
+	if d.Endpoint.PodName != "" || d.Endpoint.IP != "" {
+		fmt.Fprintf(&b, " %s (%s)", d.Endpoint.PodName, d.Endpoint.IP)
+	}
+	if d.Strategy != "" {
+		fmt.Fprintf(&b, " %s", d.Strategy)
+	}
+	if d.Reason != "" {
+		fmt.Fprintf(&b, ": %s", d.Reason)
+	}
+	for i, c := range d.Candidates {
+		sep := " "
+		if i == 0 {
+			sep = " from "
+		}
+		fmt.Fprintf(&b, "%s%s=%.3g/%v", sep, c.Endpoint.PodName, c.Weight, c.State)
+	}
+	return b.String()
+}
+
+// decisionBufferSize - Decisions waiting for the sink. Decisions are dropped when the sink does not keep up, recording
+// never blocks the picks or the pool maintenance.
+const decisionBufferSize = 1024
+
+// decisionLog - The sink of the decisions and the pools it receives them for
+type decisionLog struct {
+	sink     func(Decision)
+	services map[string]bool // nil for all pools
+	ch       chan Decision
+	done     chan struct{}
+	dropped  uint64 // atomic
+}
+
+var (
+	// decisions - The current *decisionLog, nil while decisions are not recorded. Read by the picks without locking,
+	// replaced under decisionsMutex.
+	decisions      atomic.Value
+	decisionsMutex = &sync.Mutex{}
+)
+
+// SetDecisionLog - Records every pick, eviction and refresh of the pools of the service names (all pools without
+// names) with its reasoning: the strategy of the pick and the weights and health states of the candidates, the reason
+// of an eviction, the outcome of a refresh. Meant to find out in production why traffic skews to some pods; the
+// behavior of the pools does not change. The sink (eg LogDecisions) is called from a separate go routine in the order
+// of the decisions, which are dropped while it does not keep up. Recording every pick is expensive, restrict it to the
+// pools under investigation. nil stops the recording.
+func SetDecisionLog(sink func(Decision), serviceNames ...string) {
+	var next *decisionLog
+	if sink != nil {
+		next = &decisionLog{sink: sink, ch: make(chan Decision, decisionBufferSize), done: make(chan struct{})}
+		if len(serviceNames) > 0 {
+			next.services = make(map[string]bool, len(serviceNames))
+			for _, serviceName := range serviceNames {
+				next.services[serviceName] = true
+			}
+		}
+		go next.run()
+	}
+	decisionsMutex.Lock()
+	previous, _ := decisions.Load().(*decisionLog)
+	decisions.Store(next)
+	decisionsMutex.Unlock()
+	if previous != nil {
+		close(previous.done)
+	}
+}
+
+// LogDecisions - Decision sink writing the decisions to the log
+func LogDecisions(d Decision) {
+	log.Printf("INFO: decision(): %v", d)
+}
+
+// run - Hands the decisions to the sink until the log is replaced
+func (l *decisionLog) run() {
+	for {
+		select {
+		case d := <-l.ch:
+			l.sink(d)
+		case <-l.done:
+			if n := atomic.LoadUint64(&l.dropped); n > 0 {
+				log.Printf("WARNING: SetDecisionLog(): %d decisions dropped, the sink did not keep up", n)
+			}
+			return
+		}
+	}
+}
+
+// decisionLogFor - The decision log recording the pool, nil if its decisions are not recorded
+func decisionLogFor(serviceName string) *decisionLog {
+	l, _ := decisions.Load().(*decisionLog)
+	if l == nil || (l.services != nil && !l.services[serviceName]) {
+		return nil
+	}
+	return l
+}
+
+// record - Queues the decision for the sink, drops it if the buffer is full
+func (l *decisionLog) record(d Decision) {
+	d.Time = time.Now()
+	select {
+	case l.ch <- d:
+	default:
+		atomic.AddUint64(&l.dropped, 1)
+	}
+}
+
+// decidePick - Records the pick of gc with the candidates it was chosen from and returns gc
+func decidePick(l *decisionLog, serviceName string, gc *GrpcConnection, strategy string, active,
+	candidates []*GrpcConnection, weights []float64) *GrpcConnection {
+	if l == nil {
+		return gc
+	}
+	weight := make(map[*GrpcConnection]float64, len(candidates))
+	for i, c := range candidates {
+		weight[c] = weights[i]
+	}
+	d := Decision{Type: DecisionPick, ServiceName: serviceName, Endpoint: gc.Info(), Strategy: strategy,
+		Candidates: make([]DecisionCandidate, 0, len(active))}
+	for _, c := range active {
+		d.Candidates = append(d.Candidates, DecisionCandidate{Endpoint: c.Info(), State: c.Stats().State(),
+			Weight: weight[c]})
+	}
+	l.record(d)
+	return gc
+}
+
+// decideEviction - Records the eviction of the connection
+func decideEviction(gc *GrpcConnection, reason string) {
+	if l := decisionLogFor(gc.serviceName); l != nil {
+		l.record(Decision{Type: DecisionEviction, ServiceName: gc.serviceName, Endpoint: gc.Info(), Reason: reason})
+	}
+}
+
+// decideRefresh - Records the outcome of a refresh of the pool
+func decideRefresh(serviceName, outcome string) {
+	if l := decisionLogFor(serviceName); l != nil {
+		l.record(Decision{Type: DecisionRefresh, ServiceName: serviceName, Reason: outcome})
+	}
+}
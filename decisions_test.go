@@ -0,0 +1,69 @@
+package kubegrpc
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordDecisions - Records the decisions of the pools of the service names for the test
+func recordDecisions(t *testing.T, serviceNames ...string) <-chan Decision {
+	ch := make(chan Decision, 16)
+	SetDecisionLog(func(d Decision) { ch <- d }, serviceNames...)
+	t.Cleanup(func() { SetDecisionLog(nil) })
+	return ch
+}
+
+// nextDecision - The next recorded decision, fails the test after a second
+func nextDecision(t *testing.T, ch <-chan Decision) Decision {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no decision recorded")
+	}
+	return Decision{}
+}
+
+func TestDecisionLog(t *testing.T) {
+	ch := recordDecisions(t, "svc.ns:1000")
+	p := testPool(t, 2)
+	// Excluded like by ReportFailure, so the pick is down to one usable endpoint
+	atomic.StoreInt64(&p.grpcConnection[1].excludedUntil, time.Now().Add(time.Minute).UnixNano())
+
+	picked := pickConnection("svc.ns:1000", p.grpcConnection)
+	d := nextDecision(t, ch)
+	if d.Type != DecisionPick || d.Endpoint.PodName != picked.podName || d.Strategy != StrategyUniform ||
+		len(d.Candidates) != 2 {
+		t.Fatalf("decision = %+v, want the uniform pick among both endpoints", d)
+	}
+	for _, c := range d.Candidates {
+		if want := c.Endpoint.PodName == "svc-1"; (c.Weight > 0) != want {
+			t.Errorf("candidate %s weight %v state %v", c.Endpoint.PodName, c.Weight, c.State)
+		}
+	}
+	if s := d.String(); !strings.Contains(s, "pick svc.ns:1000 svc-1 (10.0.0.1) uniform from svc-1=1/") {
+		t.Errorf("String() = %q", s)
+	}
+
+	evictions(p.grpcConnection[:1], nil)
+	if d := nextDecision(t, ch); d.Type != DecisionEviction || d.Endpoint.PodName != "svc-1" || d.Reason == "" {
+		t.Errorf("decision = %+v, want the eviction with its reason", d)
+	}
+
+	// Other pools are not recorded
+	other := testPool(t, 1)
+	mutex.Lock()
+	for _, gc := range other.grpcConnection {
+		gc.serviceName = "other.ns:1000"
+	}
+	mutex.Unlock()
+	pickConnection("other.ns:1000", other.grpcConnection)
+	select {
+	case d := <-ch:
+		t.Errorf("decision %v recorded for a pool not under investigation", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
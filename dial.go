@@ -0,0 +1,58 @@
+package kubegrpc
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultDialParallelism - Connections dialed at once by an update of a pool
+const defaultDialParallelism = 16
+
+// WithDialParallelism - Number of new connections a pool update dials at once, default 16, so building the pool of a
+// large service (eg TLS, WithReflectionCheck or WithVersionProbe per pod) takes about as long as a single dial. The
+// NewGrpcClient of the balancer is called concurrently accordingly; 1 dials one pod after the other.
+func WithDialParallelism(n int) PoolOption {
+	return func(c *poolConfig) {
+		if n < 1 {
+			n = 1
+		}
+		c.dialParallelism = n
+	}
+}
+
+// dialResult - Outcome of the dial of a pod by dialPods
+type dialResult struct {
+	gc  *GrpcConnection
+	err *ErrDialFailed
+}
+
+// dialPods - Dials a connection per entry of pods (a pod appears once per connection to add), at most the dial
+// parallelism of the pool at once. The results are in the order of pods. Caller must hold mutex; the dials only read
+// the pool.
+func dialPods(serviceName string, c *connection, pods []*corev1.Pod, port string) []dialResult {
+	results := make([]dialResult, len(pods))
+	parallelism := c.config.dialParallelism
+	if parallelism < 1 {
+		parallelism = defaultDialParallelism
+	}
+	if parallelism == 1 || len(pods) == 1 {
+		for i, pod := range pods {
+			results[i].gc, results[i].err = newGrpcConnection(serviceName, c, pod, port)
+		}
+		return results
+	}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, pod *corev1.Pod) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i].gc, results[i].err = newGrpcConnection(serviceName, c, pod, port)
+		}(i, pod)
+	}
+	wg.Wait()
+	return results
+}
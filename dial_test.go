@@ -0,0 +1,77 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// slowBalancer - Creates clients slowly, records the maximum number of concurrent NewGrpcClient calls
+type slowBalancer struct {
+	running, peak int32
+}
+
+func (b *slowBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) {
+	n := atomic.AddInt32(&b.running, 1)
+	defer atomic.AddInt32(&b.running, -1)
+	for {
+		peak := atomic.LoadInt32(&b.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&b.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return conn, nil
+}
+
+func (b *slowBalancer) Ping(interface{}) error { return nil }
+
+func TestDialParallelism(t *testing.T) {
+	objects := []interface{}{testService("svc", "ns")}
+	for i := 1; i <= 8; i++ {
+		objects = append(objects, testPod(fmt.Sprintf("svc-%d", i), "ns", "svc", fmt.Sprintf("10.0.0.%d", i)))
+	}
+	useFakeClientset(t, objects...)
+	b := &slowBalancer{}
+	c := newConnection(b, newPoolConfig([]PoolOption{WithDialParallelism(4)}))
+	mutex.Lock()
+	setPool("svc.ns:1000", c)
+	mutex.Unlock()
+	defer ClosePool("svc.ns:1000")
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ListPool("svc.ns:1000")); n != 8 {
+		t.Errorf("%d connections, want 8", n)
+	}
+	if peak := atomic.LoadInt32(&b.peak); peak != 4 {
+		t.Errorf("%d concurrent dials, want 4", peak)
+	}
+}
+
+func TestDialPodsErrors(t *testing.T) {
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithFaultInjection(FaultInjection{DialFailureRate: 1,
+		Pods: []string{"svc-2", "svc-3"}})}))
+	pods := []*corev1.Pod{testPod("svc-1", "ns", "svc", "10.0.0.1"), testPod("svc-2", "ns", "svc", "10.0.0.2"),
+		testPod("svc-3", "ns", "svc", "10.0.0.3")}
+	results := dialPods("svc.ns:1000", c, pods, "1000")
+	for i, r := range results {
+		if (r.err != nil) != (i > 0) || (r.err != nil && r.err.Pod != pods[i].Name) {
+			t.Errorf("result %d = %+v, want the results in the order of the pods", i, r)
+		}
+		if r.gc != nil {
+			r.gc.conn.Close()
+		}
+	}
+	err := error(&noEndpointsError{dialErr: results[2].err, failed: 2})
+	if !errors.Is(err, ErrNoHealthyEndpoints) || !errors.Is(err, ErrInjectedFault) ||
+		!strings.Contains(err.Error(), "and 1 more failed dials") {
+		t.Errorf("error %v, want the last dial failure and the number of the others", err)
+	}
+}
@@ -0,0 +1,294 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ErrDiscoveryFailed - A Discoverer of the pool failed, the pool is left unchanged until the next refresh
+var ErrDiscoveryFailed = errors.New("kubegrpc: discovery failed")
+
+// lookupSRV - Resolves DNS SRV records, replaced in tests
+var lookupSRV = net.LookupSRV
+
+// DiscoveredEndpoint - An endpoint found by a Discoverer
+type DiscoveredEndpoint struct {
+	Name    string            // Identifies the endpoint like a pod name, default the resolved `ip:port`
+	Address string            // host:port, host names are resolved on every discovery
+	Labels  map[string]string // Labels of the endpoint as seen by scorers and pickers, see EndpointInfo
+	pod     *corev1.Pod       // The pod found by the Kubernetes discoverers, used instead of Address
+}
+
+// Discoverer - Source of the endpoints of a pool, called on every refresh of the pool with the pool context and the
+// service name the pool was created with. Returning an error leaves the pool unchanged until the next refresh.
+type Discoverer interface {
+	Discover(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error)
+}
+
+// DiscovererFunc - Adapter to use an ordinary function as Discoverer
+type DiscovererFunc func(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error)
+
+// Discover - Implements Discoverer
+func (f DiscovererFunc) Discover(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error) {
+	return f(ctx, serviceName)
+}
+
+// WithDiscovery - Takes the endpoints of the pool from the discoverers instead of the Kubernetes service of the service
+// name. The endpoints of all discoverers are merged, so sources can be mixed, eg ServiceDiscoverer() with
+// StaticDiscoverer for a backend outside of the cluster; the pool is only updated when all discoverers succeed. Pools
+// without Kubernetes discoverers (ServiceDiscoverer, EndpointSliceDiscoverer, SelectorDiscoverer, EndpointsDiscoverer)
+// never contact the Kubernetes API and need no cluster at run time; the package still links client-go. The service
+// name identifies the pool and follows the service name convention; without a port in the service name the endpoints
+// are dialed on the port of their address.
+func WithDiscovery(discoverers ...Discoverer) PoolOption {
+	return func(c *poolConfig) {
+		c.discoverers = append(c.discoverers, discoverers...)
+	}
+}
+
+// serviceDiscoverer - Discoverer of ServiceDiscoverer
+type serviceDiscoverer struct{}
+
+// ServiceDiscoverer - The default discovery: the pods of the Kubernetes service of the service name, including
+// headless, ExternalName and passthrough services. The annotations of the service configure the pool.
+func ServiceDiscoverer() Discoverer {
+	return serviceDiscoverer{}
+}
+
+func (serviceDiscoverer) Discover(_ context.Context, serviceName string) ([]DiscoveredEndpoint, error) {
+	c := publishedPool(serviceName)
+	if c == nil {
+		c = &connection{config: newPoolConfig(nil)}
+	}
+	_, _, port, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	_, pods, err := discoverService(serviceName, port, c)
+	if err != nil {
+		return nil, err
+	}
+	return podEndpoints(pods.Items), nil
+}
+
+// endpointSliceDiscoverer - Discoverer of EndpointSliceDiscoverer
+type endpointSliceDiscoverer struct{}
+
+// EndpointSliceDiscoverer - The ready endpoints of the EndpointSlices of the Kubernetes service of the service name,
+// labeled with the topology of the endpoint (eg the zone). Scales to services with thousands of pods without listing
+// the pods.
+func EndpointSliceDiscoverer() Discoverer {
+	return endpointSliceDiscoverer{}
+}
+
+func (endpointSliceDiscoverer) Discover(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error) {
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	selector := labels.Set{discoveryv1beta1.LabelServiceName: name}.AsSelector().String()
+	slices, err := k8s.DiscoveryV1beta1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, kubernetesError(err, "list", "endpointslices", namespace)
+	}
+	endpoints := make([]DiscoveredEndpoint, 0)
+	for _, slice := range slices.Items {
+		ports := make([]corev1.EndpointPort, 0, len(slice.Ports))
+		for _, p := range slice.Ports {
+			if p.Port == nil {
+				continue
+			}
+			port := corev1.EndpointPort{Port: *p.Port}
+			if p.Name != nil {
+				port.Name = *p.Name
+			}
+			ports = append(ports, port)
+		}
+		for _, e := range slice.Endpoints {
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			for _, ip := range e.Addresses {
+				address := corev1.EndpointAddress{IP: ip, TargetRef: e.TargetRef}
+				if e.Hostname != nil {
+					address.Hostname = *e.Hostname
+				}
+				if node, found := e.Topology[corev1.LabelHostname]; found {
+					address.NodeName = &node
+				}
+				pod := addressPod(namespace, address, ports)
+				pod.Labels = e.Topology
+				endpoints = append(endpoints, DiscoveredEndpoint{Name: pod.Name, Labels: pod.Labels, pod: &pod})
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// selectorDiscoverer - Discoverer of SelectorDiscoverer
+type selectorDiscoverer struct {
+	namespace string
+	selector  map[string]string
+}
+
+// SelectorDiscoverer - The pods in the namespace matching the label selector, like ConnectSelector. An empty namespace
+// uses the namespace of the service name.
+func SelectorDiscoverer(namespace string, selector map[string]string) Discoverer {
+	return selectorDiscoverer{namespace: namespace, selector: selector}
+}
+
+func (d selectorDiscoverer) Discover(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error) {
+	_, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	if d.namespace != "" {
+		namespace = d.namespace
+	}
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	selector := labels.Set(d.selector).AsSelector().String()
+	pods, err := k8s.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, kubernetesError(err, "list", "pods", namespace)
+	}
+	return podEndpoints(pods.Items), nil
+}
+
+// StaticDiscoverer - A fixed list of `host:port` addresses, like ConnectStatic
+func StaticDiscoverer(addresses ...string) Discoverer {
+	return DiscovererFunc(func(context.Context, string) ([]DiscoveredEndpoint, error) {
+		endpoints := make([]DiscoveredEndpoint, 0, len(addresses))
+		for _, address := range addresses {
+			endpoints = append(endpoints, DiscoveredEndpoint{Address: address})
+		}
+		return endpoints, nil
+	})
+}
+
+// SRVDiscoverer - The targets of the DNS SRV records of `_service._proto.name` with the lowest priority, eg for
+// Consul or a headless service queried by port name. Empty service and proto look up name directly.
+func SRVDiscoverer(service, proto, name string) Discoverer {
+	return DiscovererFunc(func(context.Context, string) ([]DiscoveredEndpoint, error) {
+		_, records, err := lookupSRV(service, proto, name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrResolveFailed, err)
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+		endpoints := make([]DiscoveredEndpoint, 0, len(records))
+		for _, r := range records {
+			if r.Priority != records[0].Priority {
+				break
+			}
+			host := strings.TrimSuffix(r.Target, ".")
+			endpoints = append(endpoints, DiscoveredEndpoint{Address: net.JoinHostPort(host, strconv.Itoa(int(r.Port)))})
+		}
+		return endpoints, nil
+	})
+}
+
+// podEndpoints - The endpoints of the pods found by a Kubernetes discoverer
+func podEndpoints(pods []corev1.Pod) []DiscoveredEndpoint {
+	endpoints := make([]DiscoveredEndpoint, 0, len(pods))
+	for i := range pods {
+		pod := &pods[i]
+		endpoints = append(endpoints, DiscoveredEndpoint{Name: pod.Name, Address: pod.Status.PodIP, Labels: pod.Labels,
+			pod: pod})
+	}
+	return endpoints
+}
+
+// usesKubernetes - True if one of the discoverers queries the Kubernetes API, so its discoveries are rate limited
+func usesKubernetes(discoverers []Discoverer) bool {
+	for _, d := range discoverers {
+		if kubernetesDiscoverer(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetesDiscoverer - True for the discoverers querying the Kubernetes API, whose errors are returned as is
+func kubernetesDiscoverer(d Discoverer) bool {
+	switch d.(type) {
+	case serviceDiscoverer, endpointSliceDiscoverer, selectorDiscoverer, *endpointsDiscoverer:
+		return true
+	}
+	return false
+}
+
+// discoverEndpoints - The service and pods standing in for the endpoints of the discoverers of the pool. The service
+// is the one of ServiceDiscoverer, or else stands in for the service name.
+func discoverEndpoints(serviceName, port string, c *connection) (*corev1.Service, *corev1.PodList, error) {
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	pods := &corev1.PodList{}
+	seen := make(map[string]bool)
+	add := func(pod corev1.Pod) {
+		if key := pod.Name + "/" + pod.Status.PodIP; !seen[key] {
+			seen[key] = true
+			pods.Items = append(pods.Items, pod)
+		}
+	}
+	for _, d := range c.config.discoverers {
+		if _, ok := d.(serviceDiscoverer); ok {
+			// The service itself is kept for its annotations and the policies
+			s, found, err := discoverService(serviceName, port, c)
+			if err != nil {
+				return nil, nil, err
+			}
+			svc = s
+			for _, pod := range found.Items {
+				add(pod)
+			}
+			continue
+		}
+		endpoints, err := d.Discover(c.poolContext(), serviceName)
+		if err != nil {
+			log.Printf("ERROR: discoverEndpoints(): Discovery of %s failed. Error %v", serviceName, err)
+			if kubernetesDiscoverer(d) {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("%w: %v", ErrDiscoveryFailed, err)
+		}
+		for _, e := range endpoints {
+			if e.pod != nil {
+				add(*e.pod)
+				continue
+			}
+			resolved, err := resolvePods(namespace, []string{e.Address})
+			if err != nil {
+				// Logged by resolvePods, the other endpoints are still used
+				continue
+			}
+			for _, pod := range resolved.Items {
+				if e.Name != "" && len(resolved.Items) == 1 {
+					pod.Name = e.Name
+				}
+				pod.Labels = e.Labels
+				add(pod)
+			}
+		}
+	}
+	return svc, pods, nil
+}
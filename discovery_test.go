@@ -0,0 +1,123 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// useLookupSRV - Answers the SRV lookups of the test with the records, other names fail
+func useLookupSRV(t *testing.T, name string, records []*net.SRV) {
+	previous := lookupSRV
+	lookupSRV = func(service, proto, n string) (string, []*net.SRV, error) {
+		if n != name {
+			return "", nil, errors.New("no such host")
+		}
+		return n, records, nil
+	}
+	t.Cleanup(func() { lookupSRV = previous })
+}
+
+func TestWithDiscoveryWithoutKubernetes(t *testing.T) {
+	useFakeClientset(t) // Any k8s lookup would fail with ErrServiceNotFound
+	useLookupHost(t, map[string][]string{"10.6.0.1": {"10.6.0.1"}, "a.backend.example": {"10.6.0.2"},
+		"b.backend.example": {"10.6.0.3"}, "10.6.0.5": {"10.6.0.5"}})
+	useLookupSRV(t, "backend.example", []*net.SRV{
+		{Target: "a.backend.example.", Port: 7001, Priority: 10},
+		{Target: "b.backend.example.", Port: 7001, Priority: 20},
+	})
+	fail := false
+	custom := DiscovererFunc(func(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error) {
+		if fail {
+			return nil, errors.New("registry down")
+		}
+		return []DiscoveredEndpoint{{Name: "gpu-0", Address: "10.6.0.5:7002", Labels: map[string]string{"gpu": "a100"}}}, nil
+	})
+	defer ClosePool("mixed.external")
+	_, err := ConnectWithOptions("mixed.external", okBalancer{},
+		WithDiscovery(StaticDiscoverer("10.6.0.1:7000"), SRVDiscoverer("grpc", "tcp", "backend.example"), custom))
+	if err != nil {
+		t.Fatalf("ConnectWithOptions() error = %v", err)
+	}
+	conns := Connections("mixed.external")
+	got := targets(conns)
+	if len(got) != 3 || got[0] != "10.6.0.1:7000" || got[1] != "10.6.0.2:7001" || got[2] != "10.6.0.5:7002" {
+		t.Errorf("targets = %v, want the static, SRV and custom endpoints", got)
+	}
+	for _, gc := range conns {
+		if gc.connectionIP == "10.6.0.5" && (gc.Info().PodName != "gpu-0" || gc.Info().Labels["gpu"] != "a100") {
+			t.Errorf("Info() of the custom endpoint = %+v", gc.Info())
+		}
+	}
+
+	// A failing discoverer leaves the pool unchanged
+	fail = true
+	if err := Refresh("mixed.external"); !errors.Is(err, ErrDiscoveryFailed) {
+		t.Errorf("Refresh() error = %v, want ErrDiscoveryFailed", err)
+	}
+	if n := len(Connections("mixed.external")); n != 3 {
+		t.Errorf("%d connections after a failed discovery, want 3", n)
+	}
+}
+
+func TestKubernetesDiscoverers(t *testing.T) {
+	ready, notReady := true, false
+	port, name := int32(7000), "grpc"
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.7.0.1"),
+		testPod("worker-0", "ns", "worker", "10.7.0.2"),
+		&discoveryv1beta1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc-abc", Namespace: "ns",
+				Labels: map[string]string{discoveryv1beta1.LabelServiceName: "svc"}},
+			AddressType: discoveryv1beta1.AddressTypeIPv4,
+			Endpoints: []discoveryv1beta1.Endpoint{
+				{Addresses: []string{"10.7.0.1"}, Conditions: discoveryv1beta1.EndpointConditions{Ready: &ready},
+					TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "svc-0"},
+					Topology:  map[string]string{"topology.kubernetes.io/zone": "a"}},
+				{Addresses: []string{"10.7.0.9"}, Conditions: discoveryv1beta1.EndpointConditions{Ready: &notReady}},
+			},
+			Ports: []discoveryv1beta1.EndpointPort{{Name: &name, Port: &port}},
+		})
+
+	endpoints, err := EndpointSliceDiscoverer().Discover(context.Background(), "svc.ns:7000")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Name != "svc-0" ||
+		endpoints[0].Labels["topology.kubernetes.io/zone"] != "a" || endpoints[0].pod.Status.PodIP != "10.7.0.1" {
+		t.Errorf("EndpointSliceDiscoverer() = %+v, %v, want the ready endpoint", endpoints, err)
+	}
+	endpoints, err = SelectorDiscoverer("", map[string]string{"app": "worker"}).Discover(context.Background(), "w.ns")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Name != "worker-0" {
+		t.Errorf("SelectorDiscoverer() = %+v, %v, want the matching pod", endpoints, err)
+	}
+	endpoints, err = ServiceDiscoverer().Discover(context.Background(), "svc.ns:7000")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Address != "10.7.0.1" {
+		t.Errorf("ServiceDiscoverer() = %+v, %v, want the pod of the service", endpoints, err)
+	}
+	if _, err := ServiceDiscoverer().Discover(context.Background(), "missing.ns:7000"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("ServiceDiscoverer() of a missing service error = %v, want ErrServiceNotFound", err)
+	}
+
+	if !usesKubernetes([]Discoverer{StaticDiscoverer("10.7.0.1:7000"), EndpointSliceDiscoverer()}) ||
+		usesKubernetes([]Discoverer{StaticDiscoverer("10.7.0.1:7000")}) {
+		t.Error("usesKubernetes() does not tell the Kubernetes discoverers apart")
+	}
+}
+
+func TestWithDiscoveryMixesServiceAndStatic(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Annotations = map[string]string{maxConnsAnnotation: "5"}
+	useFakeClientset(t, svc, testPod("svc-0", "ns", "svc", "10.8.0.1"))
+	useLookupHost(t, map[string][]string{"10.8.1.1": {"10.8.1.1"}})
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{
+		WithDiscovery(ServiceDiscoverer(), StaticDiscoverer("10.8.1.1:1000"))}))
+	gotSvc, pods, err := discoverPods("svc.ns:1000", "1000", c)
+	if err != nil || len(pods.Items) != 2 {
+		t.Fatalf("discoverPods() = %v, %v, want the pod of the service and the static address", pods, err)
+	}
+	if gotSvc.Annotations[maxConnsAnnotation] != "5" {
+		t.Errorf("service = %+v, want the Kubernetes service for its annotations", gotSvc)
+	}
+}
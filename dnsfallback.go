@@ -0,0 +1,118 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dnsFallbackInterval - Refresh interval of a pool while its pods are resolved from DNS, which can not notify changes
+var dnsFallbackInterval = 30 * time.Second
+
+// dnsFallbackAnnotation - Set on the service returned by dnsFallback, so the pool knows its pods were resolved from DNS
+const dnsFallbackAnnotation = "kube-grpc/dns-fallback"
+
+// kubernetesError - Wraps an error of the k8s API in ErrKubernetesUnavailable, or in ErrPermissionDenied for the
+// request if it was forbidden
+func kubernetesError(err error, verb, resource, namespace string) error {
+	if apierrors.IsForbidden(err) {
+		return &ErrPermissionDenied{Verb: verb, Resource: resource, Namespace: namespace, Err: err}
+	}
+	return fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+}
+
+// forbidden - True if the k8s request failed because the service account lacks the RBAC permission
+func forbidden(err error) bool {
+	var denied *ErrPermissionDenied
+	return errors.As(err, &denied)
+}
+
+// dnsFallback - Resolves the DNS name of the service when the service account may not list services, pods or
+// endpoints: the A/AAAA records of `name.namespace.svc` with the port number of the service name (the pod IPs of a
+// headless service, the cluster IP otherwise), or the SRV records of the port name, without port of the gRPC port
+// names. svc is the service if it could be read, nil otherwise. The returned service is marked with
+// dnsFallbackAnnotation. Selector pools, remote clusters, pod targets and subset pools have no DNS name to fall back
+// to, err is returned for them.
+func dnsFallback(serviceName, port string, svc *corev1.Service, err error) (*corev1.Service, *corev1.PodList, error) {
+	name, namespace, _, parseErr := parseServiceName(serviceName)
+	if _, cluster := splitCluster(serviceName); parseErr != nil || cluster != "" || podTarget(serviceName) != "" ||
+		subsetSelector(serviceName) != nil || selectorService(name, namespace) != nil {
+		return nil, nil, err
+	}
+	if svc == nil {
+		svc = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	host := svc.Name + "." + svc.Namespace + ".svc"
+	var pods *corev1.PodList
+	var dnsErr error
+	switch {
+	case port == "":
+		pods, dnsErr = srvPods(svc.Namespace, host, grpcPortNames...)
+	case numericPort(port):
+		pods, dnsErr = resolvePods(svc.Namespace, []string{net.JoinHostPort(host, port)})
+	default:
+		pods, dnsErr = srvPods(svc.Namespace, host, port)
+	}
+	if dnsErr != nil {
+		log.Printf("ERROR: dnsFallback(): No DNS fallback for %s. Error %v", serviceName, dnsErr)
+		return nil, nil, fmt.Errorf("%w (DNS fallback: %v)", err, dnsErr)
+	}
+	svc = svc.DeepCopy()
+	if svc.Annotations == nil {
+		svc.Annotations = make(map[string]string)
+	}
+	svc.Annotations[dnsFallbackAnnotation] = strconv.FormatBool(true)
+	return svc, pods, nil
+}
+
+// srvPods - The pods standing in for the targets of the SRV records of the first port name of the service which has
+// records
+func srvPods(namespace, host string, portNames ...string) (*corev1.PodList, error) {
+	var lastErr error
+	for _, portName := range portNames {
+		endpoints, err := SRVDiscoverer(portName, "tcp", host).Discover(context.Background(), "")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addresses := make([]string, 0, len(endpoints))
+		for _, e := range endpoints {
+			addresses = append(addresses, e.Address)
+		}
+		return resolvePods(namespace, addresses)
+	}
+	return nil, lastErr
+}
+
+// setDNSFallback - Records whether the pods of the pool were resolved from DNS, logging the changes. Caller must hold
+// mutex.
+func (c *connection) setDNSFallback(serviceName string, svc *corev1.Service) {
+	enabled, _ := strconv.ParseBool(svc.Annotations[dnsFallbackAnnotation])
+	if c.dnsFallback == enabled {
+		return
+	}
+	c.dnsFallback = enabled
+	if enabled {
+		log.Printf("WARNING: setDNSFallback(): No RBAC permission to discover %s, resolving its DNS name every %v",
+			serviceName, dnsFallbackInterval)
+	} else {
+		log.Printf("INFO: setDNSFallback(): Discovering %s from k8s again", serviceName)
+	}
+}
+
+// refreshInterval - Interval of the full re-discovery of the pool, shortened while resolved from DNS. Caller must hold
+// mutex.
+func (c *connection) refreshInterval() time.Duration {
+	if c.dnsFallback && dnsFallbackInterval < c.config.refreshInterval {
+		return dnsFallbackInterval
+	}
+	return c.config.refreshInterval
+}
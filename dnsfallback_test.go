@@ -0,0 +1,81 @@
+package kubegrpc
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// forbidList - Lets the fake clientset of the test refuse to list the resource, as without RBAC permission
+func forbidList(t *testing.T, resource string) {
+	t.Helper()
+	clientset.(*fake.Clientset).PrependReactor("list", resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: resource}, "", errors.New("rbac"))
+	})
+}
+
+func TestDNSFallback(t *testing.T) {
+	useFakeClientset(t)
+	forbidList(t, "services")
+	useLookupHost(t, map[string][]string{"svc.ns.svc": {"10.9.0.1", "10.9.0.2"}, "10-9-0-3.svc.ns.svc": {"10.9.0.3"}})
+	useLookupSRV(t, "svc.ns.svc", []*net.SRV{{Target: "10-9-0-3.svc.ns.svc.", Port: 7000}})
+	c := newConnection(okBalancer{}, newPoolConfig(nil))
+	defer func() {
+		for _, gc := range c.grpcConnection {
+			gc.conn.Close()
+		}
+	}()
+
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if got := targets(c.grpcConnection); len(got) != 2 || got[0] != "10.9.0.1:1000" || got[1] != "10.9.0.2:1000" {
+		t.Errorf("targets = %v, want the A records of the service", got)
+	}
+	mutex.Lock()
+	if d := c.refreshInterval(); d != dnsFallbackInterval {
+		t.Errorf("refreshInterval() = %v during the fallback, want %v", d, dnsFallbackInterval)
+	}
+	mutex.Unlock()
+	svc, pods, err := discoverService("svc.ns", "", c)
+	if err != nil || len(pods.Items) != 1 || pods.Items[0].Status.PodIP != "10.9.0.3" ||
+		svc.Annotations[dnsFallbackAnnotation] != "true" {
+		t.Errorf("discoverService() without port = %v, %v, want the SRV targets", pods, err)
+	}
+	if _, _, err := discoverService("gone.ns:1000", "1000", c); !errors.Is(err, ErrKubernetesUnavailable) {
+		t.Errorf("discoverService() without DNS records error = %v, want ErrKubernetesUnavailable", err)
+	}
+
+	// With the permission back the pool is discovered from k8s at its own interval again
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.9.1.1"))
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	mutex.Lock()
+	if d := c.refreshInterval(); d != c.config.refreshInterval {
+		t.Errorf("refreshInterval() = %v after the fallback, want %v", d, c.config.refreshInterval)
+	}
+	mutex.Unlock()
+}
+
+func TestDNSFallbackKeepsService(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Annotations = map[string]string{maxConnsAnnotation: "3"}
+	useFakeClientset(t, svc)
+	forbidList(t, "pods")
+	useLookupHost(t, map[string][]string{"svc.ns.svc": {"10.9.0.1"}})
+	got, pods, err := discoverService("svc.ns:1000", "1000", newConnection(okBalancer{}, newPoolConfig(nil)))
+	if err != nil || len(pods.Items) != 1 || got.Annotations[maxConnsAnnotation] != "3" ||
+		got.Annotations[dnsFallbackAnnotation] != "true" {
+		t.Errorf("discoverService() = %+v, %v, %v, want the service with the resolved pods", got, pods, err)
+	}
+	if svc.Annotations[dnsFallbackAnnotation] != "" {
+		t.Error("dnsFallback() modified the service of the clientset")
+	}
+}
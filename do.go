@@ -0,0 +1,79 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// doMaxAttempts - Attempts of Do on pools without RetryPolicy
+const doMaxAttempts = 3
+
+// Do - Picks a connection of the existing pool of the service like PickConnection and runs fn with its client, see
+// GrpcConnection.Do. Returns ErrPoolNotFound if there is no pool.
+func Do(ctx context.Context, serviceName string, fn func(client interface{}) error) error {
+	gc, err := PickConnection(serviceName)
+	if err != nil {
+		return err
+	}
+	return gc.Do(ctx, fn)
+}
+
+// Do - Runs fn with the client of the connection. While fn runs the call counts as an RPC in flight of the endpoint (in
+// addition to the unary RPCs fn makes), so least requests balancing sees it and a drain waits for it, including
+// streams. When fn fails with a connection error (codes.Unavailable), fn runs again with another endpoint of the pool
+// which was not tried yet, up to the MaxAttempts of the RetryPolicy of the pool (within its retry budget) or 3
+// attempts, and as long as ctx is not done. fn must be safe to run more than once.
+func (c *GrpcConnection) Do(ctx context.Context, fn func(client interface{}) error) error {
+	return c.doAttempts(ctx, func(_ int, client interface{}) error {
+		return fn(client)
+	}, false)
+}
+
+// doAttempts - Runs fn with the attempt number and the client of the connection, and again with other endpoints as
+// described for Do. With retryExpired an attempt which ran out of its own deadline is retried as well.
+func (c *GrpcConnection) doAttempts(ctx context.Context, fn func(attempt int, client interface{}) error,
+	retryExpired bool) error {
+	maxAttempts := c.maxAttempts()
+	var budget *retryBudget
+	if c.pool != nil && c.pool.config.retryPolicy != nil {
+		budget = c.pool.retryBudget
+		budget.deposit()
+	}
+	tried := map[*GrpcConnection]bool{}
+	gc := c
+	for attempt := 1; ; attempt++ {
+		tried[gc] = true
+		err := gc.do(func(client interface{}) error {
+			return fn(attempt, client)
+		})
+		retry := status.Code(err) == codes.Unavailable || (retryExpired && attemptExpired(ctx, err))
+		if !retry || attempt >= maxAttempts || ctx.Err() != nil || gc.pool == nil {
+			return err
+		}
+		next := gc.pool.alternative(tried)
+		if next == nil || (budget != nil && !budget.withdraw()) {
+			return err
+		}
+		atomic.AddUint64(&next.picks, 1)
+		gc = next
+	}
+}
+
+// do - Runs fn with the client of the connection, counted as RPC in flight
+func (c *GrpcConnection) do(fn func(client interface{}) error) error {
+	atomic.AddInt64(&c.inFlight, 1)
+	defer atomic.AddInt64(&c.inFlight, -1)
+	return fn(c.GrpcConnection)
+}
+
+// maxAttempts - Attempts per call of the pool of the connection: the MaxAttempts of its RetryPolicy, else
+// doMaxAttempts
+func (c *GrpcConnection) maxAttempts() int {
+	if c.pool != nil && c.pool.config.retryPolicy != nil {
+		return c.pool.config.retryPolicy.MaxAttempts
+	}
+	return doMaxAttempts
+}
@@ -0,0 +1,63 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDoRetriesConnectionErrors(t *testing.T) {
+	p := testPool(t, 3)
+	cachePool(t, p)
+	clients := map[interface{}]bool{}
+	err := Do(context.Background(), "svc.ns:1000", func(client interface{}) error {
+		for _, gc := range p.grpcConnection {
+			if gc.GrpcConnection == client && atomic.LoadInt64(&gc.inFlight) != 1 {
+				t.Errorf("%s: %d RPCs in flight during Do, want 1", gc.podName, atomic.LoadInt64(&gc.inFlight))
+			}
+		}
+		clients[client] = true
+		if len(clients) < 3 {
+			return status.Error(codes.Unavailable, "connection refused")
+		}
+		return nil
+	})
+	if err != nil || len(clients) != 3 {
+		t.Errorf("Do() = %v on %d endpoints, want success on the third", err, len(clients))
+	}
+	for _, gc := range p.grpcConnection {
+		if n := atomic.LoadInt64(&gc.inFlight); n != 0 {
+			t.Errorf("%s: %d RPCs in flight after Do", gc.podName, n)
+		}
+	}
+}
+
+func TestDoDoesNotRetryOtherErrors(t *testing.T) {
+	p := testPool(t, 3)
+	cachePool(t, p)
+	calls := 0
+	errDenied := status.Error(codes.PermissionDenied, "denied")
+	if err := Do(context.Background(), "svc.ns:1000", func(interface{}) error {
+		calls++
+		return errDenied
+	}); err != errDenied || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want the error after 1", err, calls)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	Do(ctx, "svc.ns:1000", func(interface{}) error {
+		calls++
+		return status.Error(codes.Unavailable, "down")
+	})
+	if calls != 1 {
+		t.Errorf("%d calls with a cancelled context, want 1", calls)
+	}
+	if err := Do(context.Background(), "unknown.ns:1000", nil); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("Do() error = %v, want ErrPoolNotFound", err)
+	}
+}
@@ -0,0 +1,96 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	drainPollInterval   = 100 * time.Millisecond
+)
+
+// WithDrainTimeout - Maximum time to wait for in flight RPCs on a connection to a terminating or removed pod before the
+// connection is closed. The connection is no longer picked during the drain. Defaults to 30 seconds (the default
+// termination grace period of k8s); 0 closes connections immediately.
+func WithDrainTimeout(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.drainTimeout = d
+	}
+}
+
+// podTerminating - True for pods which are being deleted (eg replaced during a rolling deploy)
+func podTerminating(pod *corev1.Pod) bool {
+	return pod.DeletionTimestamp != nil
+}
+
+// isDraining - True once the connection is being drained
+func (c *GrpcConnection) isDraining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+// anyDraining - True if one of the connections is being drained
+func anyDraining(conns []*GrpcConnection) bool {
+	for _, c := range conns {
+		if c.isDraining() {
+			return true
+		}
+	}
+	return false
+}
+
+// drain - Stops picking the connection, waits until its in flight RPCs completed or the timeout passed, and then hands
+// the connection to cleanConnections for removal. Blocks, run as go routine. Draining twice is a no-op.
+func drain(c *GrpcConnection, timeout time.Duration) {
+	if startDrain(c) {
+		finishDrain(c, timeout)
+	}
+}
+
+// startDrain - Stops picking the connection. Returns false if it was draining already.
+func startDrain(c *GrpcConnection) bool {
+	if !atomic.CompareAndSwapInt32(&c.draining, 0, 1) {
+		return false
+	}
+	emitEndpoint(EndpointDraining, c, 0, "")
+	return true
+}
+
+// finishDrain - Waits until the in flight RPCs of the draining connection completed or the timeout passed, and then
+// hands the connection to cleanConnections for removal. With WithStreamDrain it also waits for the open streams, up to
+// the timeout of the policy. Blocks, run as go routine.
+func finishDrain(c *GrpcConnection, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	policy := c.streamDrain()
+	var streamDeadline time.Time
+	if policy != nil {
+		c.drainStreams(policy)
+		streamTimeout := policy.Timeout
+		if streamTimeout == 0 {
+			streamTimeout = timeout
+		}
+		streamDeadline = time.Now().Add(streamTimeout)
+	}
+	for {
+		now := time.Now()
+		rpcs := atomic.LoadInt64(&c.inFlight) > 0 && now.Before(deadline)
+		streams := policy != nil && atomic.LoadInt64(&c.streams) > 0 && now.Before(streamDeadline)
+		if !rpcs && !streams {
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+	if n := atomic.LoadInt64(&c.inFlight); n > 0 {
+		log.Printf("INFO: drain(): Drain timeout for %s of %s, closing with %d RPCs in flight", c.describe(), c.serviceName, n)
+	}
+	if policy != nil {
+		if n := c.cancelStreams(); n > 0 {
+			log.Printf("INFO: drain(): Stream drain timeout for %s of %s, cancelled %d streams", c.describe(),
+				c.serviceName, n)
+		}
+	}
+	dirtyConnections.push(c)
+}
@@ -0,0 +1,106 @@
+package kubegrpc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cachePool - Registers the pool under the test service name, so cleanConnections processes its connections
+func cachePool(t *testing.T, p *connection) {
+	t.Helper()
+	mutex.Lock()
+	setPool("svc.ns:1000", p)
+	mutex.Unlock()
+	t.Cleanup(func() {
+		mutex.Lock()
+		removePool("svc.ns:1000")
+		mutex.Unlock()
+	})
+}
+
+// poolSize - Number of connections in the pool, waits up to a second for it to reach want
+func poolSize(p *connection, want int) int {
+	for i := 0; i < 100; i++ {
+		mutex.RLock()
+		n := len(p.grpcConnection)
+		mutex.RUnlock()
+		if n == want {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(p.grpcConnection)
+}
+
+func TestDrainWaitsForInFlight(t *testing.T) {
+	p := testPool(t, 2)
+	cachePool(t, p)
+	gc := p.grpcConnection[0]
+	atomic.AddInt64(&gc.inFlight, 1)
+	go drain(gc, time.Minute)
+	time.Sleep(300 * time.Millisecond)
+	if !gc.Stats().Draining {
+		t.Fatal("connection not draining")
+	}
+	mutex.RLock()
+	for i := 0; i < 50; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection) == gc {
+			t.Fatal("draining connection picked")
+		}
+	}
+	mutex.RUnlock()
+	if n := poolSize(p, 2); n != 2 {
+		t.Fatalf("pool size = %d while RPC in flight, want 2", n)
+	}
+	atomic.AddInt64(&gc.inFlight, -1)
+	if n := poolSize(p, 1); n != 1 {
+		t.Fatalf("pool size = %d after drain, want 1", n)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	p := testPool(t, 1)
+	cachePool(t, p)
+	gc := p.grpcConnection[0]
+	atomic.AddInt64(&gc.inFlight, 1)
+	go drain(gc, 200*time.Millisecond)
+	if n := poolSize(p, 0); n != 0 {
+		t.Fatalf("pool size = %d after drain timeout, want 0", n)
+	}
+}
+
+func TestPickAllDraining(t *testing.T) {
+	p := testPool(t, 2)
+	for _, gc := range p.grpcConnection {
+		atomic.StoreInt32(&gc.draining, 1)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if pickConnection("svc.ns:1000", p.grpcConnection) == nil {
+		t.Error("pickConnection() = nil with all connections draining")
+	}
+}
+
+func TestTerminatingPodDrained(t *testing.T) {
+	terminating := testPod("svc-1", "ns", "svc", "10.0.0.1")
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	useFakeClientset(t, testService("svc", "ns"), terminating, testPod("svc-2", "ns", "svc", "10.0.0.2"))
+	p := testPool(t, 2, WithDrainTimeout(0))
+	cachePool(t, p)
+	if err := updateConnectionPool("svc.ns:1000", p, true); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if n := poolSize(p, 1); n != 1 {
+		t.Fatalf("pool size = %d, want 1", n)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if p.grpcConnection[0].podName != "svc-2" {
+		t.Errorf("pool kept %s, want svc-2", p.grpcConnection[0].podName)
+	}
+}
@@ -0,0 +1,105 @@
+package kubegrpc
+
+import (
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// IPFamily - IP family of the pod addresses a pool connects to
+type IPFamily int
+
+// IP families
+const (
+	AnyIPFamily IPFamily = iota // The primary pod IP (status.podIP), whichever family it has
+	IPv4                        // The IPv4 address of the pod
+	IPv6                        // The IPv6 address of the pod
+)
+
+// WithIPFamily - Connects to the pod address of the family on dual-stack clusters. Pods without an address of the
+// family are connected on their primary IP.
+func WithIPFamily(family IPFamily) PoolOption {
+	return func(c *poolConfig) {
+		c.ipFamily = family
+	}
+}
+
+// WithDualStack - Connects to every address of the pods, one connection per IP family, so the pool keeps working when
+// one family breaks. Picks are spread over all connections.
+func WithDualStack() PoolOption {
+	return func(c *poolConfig) {
+		c.dualStack = true
+	}
+}
+
+// ipFamily - The family of the ip, AnyIPFamily if it does not parse
+func ipFamily(ip string) IPFamily {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return AnyIPFamily
+	case parsed.To4() != nil:
+		return IPv4
+	}
+	return IPv6
+}
+
+// podIPs - All addresses of the pod, the primary IP first
+func podIPs(pod *corev1.Pod) []string {
+	ips := make([]string, 0, 2)
+	if pod.Status.PodIP != "" {
+		ips = append(ips, pod.Status.PodIP)
+	}
+	for _, ip := range pod.Status.PodIPs {
+		if ip.IP != "" && ip.IP != pod.Status.PodIP {
+			ips = append(ips, ip.IP)
+		}
+	}
+	return ips
+}
+
+// podHasIP - True if the ip is one of the addresses of the pod
+func podHasIP(pod *corev1.Pod, ip string) bool {
+	for _, v := range podIPs(pod) {
+		if v == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// selectIPs - The addresses of the pod to connect to: all of them for dual-stack, otherwise the first one of the
+// family, falling back to the primary IP
+func selectIPs(pod *corev1.Pod, family IPFamily, dualStack bool) []string {
+	ips := podIPs(pod)
+	if dualStack || len(ips) <= 1 {
+		return ips
+	}
+	if family != AnyIPFamily {
+		for _, ip := range ips {
+			if ipFamily(ip) == family {
+				return []string{ip}
+			}
+		}
+	}
+	return ips[:1]
+}
+
+// expandPodIPs - One copy of every pod per address to connect to, with the address as pod IP. The pool identifies
+// connections by pod IP, so the families of a pod are independent endpoints.
+func expandPodIPs(pods []corev1.Pod, family IPFamily, dualStack bool) []corev1.Pod {
+	expanded := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		ips := selectIPs(&pod, family, dualStack)
+		if len(ips) <= 1 && (len(ips) == 0 || ips[0] == pod.Status.PodIP) {
+			expanded = append(expanded, pod)
+			continue
+		}
+		for _, ip := range ips {
+			copied := pod
+			copied.Status.PodIP = ip
+			expanded = append(expanded, copied)
+		}
+	}
+	return expanded
+}
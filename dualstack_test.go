@@ -0,0 +1,69 @@
+package kubegrpc
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// testDualStackPod - Pod with IPv4 primary address and an IPv6 address
+func testDualStackPod() *corev1.Pod {
+	pod := testPod("svc-0", "ns", "svc", "10.0.0.1")
+	pod.Status.PodIPs = []corev1.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}}
+	return pod
+}
+
+func TestSelectIPs(t *testing.T) {
+	pod := testDualStackPod()
+	for _, tc := range []struct {
+		family    IPFamily
+		dualStack bool
+		want      []string
+	}{
+		{AnyIPFamily, false, []string{"10.0.0.1"}},
+		{IPv4, false, []string{"10.0.0.1"}},
+		{IPv6, false, []string{"fd00::1"}},
+		{AnyIPFamily, true, []string{"10.0.0.1", "fd00::1"}},
+	} {
+		got := selectIPs(pod, tc.family, tc.dualStack)
+		if len(got) != len(tc.want) || got[0] != tc.want[0] || got[len(got)-1] != tc.want[len(tc.want)-1] {
+			t.Errorf("selectIPs(%v, %v) = %v, want %v", tc.family, tc.dualStack, got, tc.want)
+		}
+	}
+	single := testPod("svc-1", "ns", "svc", "10.0.0.2")
+	if got := selectIPs(single, IPv6, false); len(got) != 1 || got[0] != "10.0.0.2" {
+		t.Errorf("selectIPs() without IPv6 address = %v, want the primary IP", got)
+	}
+}
+
+func TestDualStackPool(t *testing.T) {
+	for _, tc := range []struct {
+		opts []PoolOption
+		want []string
+	}{
+		{[]PoolOption{WithIPFamily(IPv6)}, []string{"[fd00::1]:1000"}},
+		{[]PoolOption{WithDualStack()}, []string{"10.0.0.1:1000", "[fd00::1]:1000"}},
+	} {
+		useFakeClientset(t, testService("svc", "ns"), testDualStackPod())
+		c := newConnection(okBalancer{}, newPoolConfig(tc.opts))
+		for i := 0; i < 2; i++ {
+			// The refresh keeps the connections
+			if err := updateConnectionPool("svc.ns:1000", c, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := targets(c.grpcConnection)
+		if len(got) != len(tc.want) || got[0] != tc.want[0] || got[len(got)-1] != tc.want[len(tc.want)-1] {
+			t.Errorf("targets = %v, want %v", got, tc.want)
+		}
+		for _, gc := range c.grpcConnection {
+			if gc.isDraining() {
+				t.Errorf("connection to %s evicted by the refresh", gc.connectionIP)
+			}
+			if reason := podMismatch(gc, testDualStackPod(), nil); reason != "" {
+				t.Errorf("podMismatch(%s) = %q, want none", gc.connectionIP, reason)
+			}
+			gc.conn.Close()
+		}
+	}
+}
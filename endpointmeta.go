@@ -0,0 +1,96 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys of WithEndpointMetadata
+const (
+	PodMetadataKey  = "kube-grpc-pod"
+	NodeMetadataKey = "kube-grpc-node"
+	ZoneMetadataKey = "kube-grpc-zone"
+)
+
+// WithEndpointMetadata - Adds the pod name, node and zone of the picked endpoint to the outgoing metadata of every
+// call (kube-grpc-pod, kube-grpc-node and kube-grpc-zone), so the interceptors of the application and the server logs
+// see which pod a request went to. Unknown nodes and zones are left out. The metadata reveals the topology of the
+// service to the servers; use PeerEndpoint to only learn the endpoint on the client.
+func WithEndpointMetadata() PoolOption {
+	return func(c *poolConfig) {
+		c.endpointMetadata = true
+	}
+}
+
+// EndpointCallOption - Call option of PeerEndpoint
+type EndpointCallOption struct {
+	grpc.EmptyCallOption
+	Endpoint *EndpointInfo
+}
+
+// PeerEndpoint - Call option which stores the endpoint that served the call in *endpoint once the call completed,
+// like grpc.Peer for the pod: application logs can say which pod served a request. Retried calls report the endpoint
+// of the last attempt, hedged calls the one whose response was used.
+func PeerEndpoint(endpoint *EndpointInfo) grpc.CallOption {
+	return EndpointCallOption{Endpoint: endpoint}
+}
+
+// peerEndpoint - The target of the PeerEndpoint option of the call, nil without
+func peerEndpoint(opts []grpc.CallOption) *EndpointInfo {
+	for _, opt := range opts {
+		if o, ok := opt.(EndpointCallOption); ok && o.Endpoint != nil {
+			return o.Endpoint
+		}
+	}
+	return nil
+}
+
+// servedEndpointKey - Context key of the servedEndpoint of a call with PeerEndpoint
+type servedEndpointKey struct{}
+
+// servedEndpoint - Endpoint serving a call, set by its attempts: the first successful attempt, else the last one
+type servedEndpoint struct {
+	mutex     sync.Mutex
+	gc        *GrpcConnection
+	succeeded bool
+}
+
+// served - Records the attempt of the call on the connection, if the call asked for PeerEndpoint
+func (c *GrpcConnection) served(ctx context.Context, err error) {
+	s, ok := ctx.Value(servedEndpointKey{}).(*servedEndpoint)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.succeeded {
+		s.gc, s.succeeded = c, err == nil
+	}
+}
+
+// copyTo - Stores the endpoint which served the call in the target of PeerEndpoint
+func (s *servedEndpoint) copyTo(endpoint *EndpointInfo) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.gc != nil {
+		*endpoint = s.gc.Info()
+	}
+}
+
+// endpointMetadata - ctx with the endpoint in its outgoing metadata, see WithEndpointMetadata
+func (c *GrpcConnection) endpointMetadata(ctx context.Context) context.Context {
+	if c.pool == nil || !c.pool.config.endpointMetadata {
+		return ctx
+	}
+	kv := []string{PodMetadataKey, c.podName}
+	if c.nodeName != "" {
+		kv = append(kv, NodeMetadataKey, c.nodeName)
+	}
+	if c.zone != "" {
+		kv = append(kv, ZoneMetadataKey, c.zone)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
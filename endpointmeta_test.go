@@ -0,0 +1,68 @@
+package kubegrpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithEndpointMetadata(t *testing.T) {
+	p := testPool(t, 1, WithEndpointMetadata())
+	gc := p.grpcConnection[0]
+	gc.nodeName = "node-a"
+	gc.zone = "zone-a"
+	var md metadata.MD
+	inv := &recordingInvoker{answer: func(ctx context.Context, _ string, _ interface{}) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}}
+	if err := gc.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, gc.conn, inv.invoke); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{PodMetadataKey: "svc-1", NodeMetadataKey: "node-a", ZoneMetadataKey: "zone-a"} {
+		if got := md.Get(key); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s = %v, want %s", key, got, want)
+		}
+	}
+
+	// Off by default
+	plain := testPool(t, 1).grpcConnection[0]
+	if err := plain.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, plain.conn, inv.invoke); err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Get(PodMetadataKey)) != 0 {
+		t.Errorf("metadata = %v without WithEndpointMetadata", md)
+	}
+}
+
+func TestPeerEndpoint(t *testing.T) {
+	p := testPool(t, 2, WithRetryPolicy(RetryPolicy{IdempotentMethods: []string{"/pkg.Svc/Get"}}))
+	inv := &recordingInvoker{answer: func(_ context.Context, target string, _ interface{}) error {
+		if target == "10.0.0.1:1000" {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	}}
+	first := p.grpcConnection[0]
+	var served EndpointInfo
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke,
+		PeerEndpoint(&served)); err != nil {
+		t.Fatal(err)
+	}
+	if served.PodName != "svc-2" || served.IP != "10.0.0.2" {
+		t.Errorf("PeerEndpoint = %+v, want the endpoint of the successful retry", served)
+	}
+
+	// Without success the last attempt is reported
+	served = EndpointInfo{}
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Put", nil, nil, first.conn, inv.invoke,
+		PeerEndpoint(&served)); err == nil {
+		t.Fatal("call succeeded, want the error of the endpoint")
+	}
+	if served.PodName != "svc-1" {
+		t.Errorf("PeerEndpoint = %+v, want the failed endpoint", served)
+	}
+}
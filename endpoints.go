@@ -0,0 +1,133 @@
+package kubegrpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// endpointsWatchRetry - Delay before a failed or ended watch of the Endpoints is started again
+var endpointsWatchRetry = 5 * time.Second
+
+// endpointsDiscoverer - Discoverer of EndpointsDiscoverer
+type endpointsDiscoverer struct {
+	mutex    sync.Mutex
+	watching map[string]bool // Service names whose Endpoints are watched
+}
+
+// EndpointsDiscoverer - Minimal RBAC discovery: the ready addresses of the Endpoints object of the service name, read
+// with `get` and watched with `watch` on that single object, so the service account needs neither list permissions
+// nor access to services or pods. A change of the Endpoints refreshes the pool right away; without the watch
+// permission the pool is refreshed at its refresh interval only. Use it with WithDiscovery; a missing permission fails
+// the discovery with an ErrPermissionDenied naming the request. Pod annotations and labels are not visible this way.
+func EndpointsDiscoverer() Discoverer {
+	return &endpointsDiscoverer{watching: make(map[string]bool)}
+}
+
+func (d *endpointsDiscoverer) Discover(ctx context.Context, serviceName string) ([]DiscoveredEndpoint, error) {
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	endpoints, err := k8s.CoreV1().Endpoints(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: endpoints %s in namespace %s", ErrServiceNotFound, name, namespace)
+	}
+	if err != nil {
+		return nil, kubernetesError(err, "get", "endpoints", namespace)
+	}
+	d.startWatch(ctx, k8s, serviceName, name, namespace, endpoints.ResourceVersion)
+	discovered := make([]DiscoveredEndpoint, 0)
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			pod := addressPod(namespace, address, subset.Ports)
+			discovered = append(discovered, DiscoveredEndpoint{Name: pod.Name, Address: address.IP, pod: &pod})
+		}
+	}
+	return discovered, nil
+}
+
+// startWatch - Watches the Endpoints for the pool until ctx, the pool context, is done, unless already watched
+func (d *endpointsDiscoverer) startWatch(ctx context.Context, k8s kubernetes.Interface, serviceName, name,
+	namespace, resourceVersion string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.watching[serviceName] {
+		return
+	}
+	d.watching[serviceName] = true
+	go func() {
+		defer func() {
+			d.mutex.Lock()
+			delete(d.watching, serviceName)
+			d.mutex.Unlock()
+		}()
+		watchEndpoints(ctx, k8s, serviceName, name, namespace, resourceVersion)
+	}()
+}
+
+// watchEndpoints - Refreshes the pool on every change of its Endpoints after resourceVersion until ctx is done or
+// watching is forbidden
+func watchEndpoints(ctx context.Context, k8s kubernetes.Interface, serviceName, name, namespace,
+	resourceVersion string) {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	for ctx.Err() == nil {
+		w, err := k8s.CoreV1().Endpoints(namespace).Watch(ctx,
+			metav1.ListOptions{FieldSelector: selector, ResourceVersion: resourceVersion})
+		if apierrors.IsForbidden(err) {
+			log.Printf("WARNING: watchEndpoints(): %v. %s is refreshed at its refresh interval only",
+				kubernetesError(err, "watch", "endpoints", namespace), serviceName)
+			return
+		}
+		if err != nil {
+			log.Printf("WARNING: watchEndpoints(): Can not watch the endpoints of %s. Error %v", serviceName, err)
+		} else {
+			resourceVersion = consumeEndpoints(ctx, w, serviceName, name, resourceVersion)
+			w.Stop()
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(endpointsWatchRetry):
+		}
+	}
+}
+
+// consumeEndpoints - Refreshes the pool on the events of the watch until it ends or ctx is done, returns the resource
+// version to watch from next
+func consumeEndpoints(ctx context.Context, w watch.Interface, serviceName, name, resourceVersion string) string {
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return resourceVersion
+			}
+			if event.Type == watch.Error {
+				// Eg the resource version expired, the next watch starts from the current state
+				return ""
+			}
+			e, ok := event.Object.(*corev1.Endpoints)
+			if !ok || e.Name != name {
+				continue
+			}
+			resourceVersion = e.ResourceVersion
+			if err := RefreshContext(ctx, serviceName); err != nil && ctx.Err() == nil {
+				log.Printf("WARNING: consumeEndpoints(): Refresh of %s failed. Error %v", serviceName, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testEndpoints - Endpoints of the service with the ready IPs on port 7000
+func testEndpoints(name, namespace string, ips ...string) *corev1.Endpoints {
+	addresses := make([]corev1.EndpointAddress, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, corev1.EndpointAddress{IP: ip})
+	}
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Subsets:    []corev1.EndpointSubset{{Addresses: addresses, Ports: []corev1.EndpointPort{{Port: 7000}}}},
+	}
+}
+
+func TestEndpointsDiscoverer(t *testing.T) {
+	useFakeClientset(t, testEndpoints("svc", "ns", "10.5.0.1"))
+	forbidList(t, "services")
+	forbidList(t, "pods")
+	watching := make(chan struct{}, 1)
+	clientset.(*fake.Clientset).PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case watching <- struct{}{}:
+		default:
+		}
+		return false, nil, nil
+	})
+	defer ClosePool("svc.ns:7000")
+	if _, err := ConnectWithOptions("svc.ns:7000", okBalancer{}, WithDiscovery(EndpointsDiscoverer())); err != nil {
+		t.Fatalf("ConnectWithOptions() error = %v", err)
+	}
+	if got := targets(Connections("svc.ns:7000")); len(got) != 1 || got[0] != "10.5.0.1:7000" {
+		t.Errorf("targets = %v, want the address of the endpoints", got)
+	}
+
+	// A change of the endpoints refreshes the pool through the watch
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the endpoints are not watched")
+	}
+	if _, err := clientset.CoreV1().Endpoints("ns").Update(context.Background(),
+		testEndpoints("svc", "ns", "10.5.0.1", "10.5.0.2"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(Connections("svc.ns:7000")) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := targets(Connections("svc.ns:7000")); len(got) != 2 {
+		t.Errorf("targets = %v after the update of the endpoints, want both addresses", got)
+	}
+}
+
+func TestEndpointsDiscovererPermissionDenied(t *testing.T) {
+	useFakeClientset(t)
+	if _, err := EndpointsDiscoverer().Discover(context.Background(), "missing.ns:7000"); !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("Discover() of missing endpoints error = %v, want ErrServiceNotFound", err)
+	}
+	clientset.(*fake.Clientset).PrependReactor("get", "endpoints", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "endpoints"}, "svc", errors.New("rbac"))
+	})
+	_, err := EndpointsDiscoverer().Discover(context.Background(), "svc.ns:7000")
+	var denied *ErrPermissionDenied
+	if !errors.As(err, &denied) || denied.Verb != "get" || denied.Resource != "endpoints" || denied.Namespace != "ns" {
+		t.Fatalf("Discover() error = %v, want ErrPermissionDenied for get endpoints", err)
+	}
+	if !errors.Is(err, ErrKubernetesUnavailable) {
+		t.Errorf("Discover() error = %v, want it to match ErrKubernetesUnavailable", err)
+	}
+}
@@ -0,0 +1,59 @@
+package kubegrpc
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultRefreshInterval   = time.Minute
+	ephemeralRefreshInterval = 5 * time.Second
+)
+
+// WithEphemeralMembership - Configures the pool for highly dynamic pod sets (Jobs, preemptible batch workers):
+// the pool is refreshed every 5 seconds instead of every minute, and pods which stop answering pings are not backed off
+// since pods going away is expected. With autoClose the pool is closed (ErrPoolClosed) once all pods have completed.
+func WithEphemeralMembership(autoClose bool) PoolOption {
+	return func(c *poolConfig) {
+		c.ephemeral = true
+		c.autoClose = autoClose
+	}
+}
+
+// pingBackoff - Backoff applied on ping failures, nil (no backoff) for ephemeral pools
+func (c *connection) pingBackoff() *dialBackoff {
+	if c.config.ephemeral {
+		return nil
+	}
+	return c.backoff
+}
+
+// podCompleted - True for pods which ran to completion or failed; these are never connected
+func podCompleted(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// activePods - Filters out the completed pods
+func activePods(pods []corev1.Pod) []corev1.Pod {
+	active := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if !podCompleted(&pod) {
+			active = append(active, pod)
+		}
+	}
+	return active
+}
+
+// workloadCompleted - True if there are pods and all of them completed (eg a finished Job)
+func workloadCompleted(pods []corev1.Pod) bool {
+	if len(pods) == 0 {
+		return false
+	}
+	for _, pod := range pods {
+		if !podCompleted(&pod) {
+			return false
+		}
+	}
+	return true
+}
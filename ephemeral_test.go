@@ -0,0 +1,58 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func podInPhase(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+	pod := testPod(name, "ns", "job", ip)
+	pod.Status.Phase = phase
+	return pod
+}
+
+func TestCompletedPodsNotConnected(t *testing.T) {
+	useFakeClientset(t, testService("job", "ns"),
+		podInPhase("job-0", "10.0.0.1", corev1.PodSucceeded), podInPhase("job-1", "10.0.0.2", corev1.PodRunning))
+	c := &connection{functions: okBalancer{}}
+	if err := updateConnectionPool("job.ns:1000", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if len(c.grpcConnection) != 1 || c.grpcConnection[0].podName != "job-1" {
+		t.Errorf("pool = %+v, want only the running pod", c.grpcConnection)
+	}
+}
+
+func TestEphemeralAutoClose(t *testing.T) {
+	useFakeClientset(t, testService("job", "ns"),
+		podInPhase("job-0", "10.0.0.1", corev1.PodSucceeded), podInPhase("job-1", "10.0.0.2", corev1.PodFailed))
+	c := &connection{functions: okBalancer{}, config: newPoolConfig([]PoolOption{WithEphemeralMembership(true)})}
+	mutex.Lock()
+	setPool("job.ns:1000", c)
+	mutex.Unlock()
+	err := updateConnectionPool("job.ns:1000", c, true)
+	if !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrPoolClosed", err)
+	}
+	mutex.RLock()
+	_, found := connectionCache["job.ns:1000"]
+	mutex.RUnlock()
+	if found || !c.closed {
+		t.Errorf("pool not closed after all pods completed")
+	}
+}
+
+func TestEphemeralConfig(t *testing.T) {
+	c := &connection{config: newPoolConfig([]PoolOption{WithEphemeralMembership(false)}), backoff: newDialBackoff(0, 0)}
+	if c.config.refreshInterval != ephemeralRefreshInterval {
+		t.Errorf("refresh interval = %v, want %v", c.config.refreshInterval, ephemeralRefreshInterval)
+	}
+	if c.pingBackoff() != nil {
+		t.Errorf("ephemeral pool backs off on ping failures")
+	}
+	if workloadCompleted(nil) {
+		t.Errorf("workloadCompleted() = true without pods")
+	}
+}
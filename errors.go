@@ -0,0 +1,83 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the package. Errors are wrapped with additional context, compare using errors.Is/errors.As.
+var (
+	// ErrInvalidServiceName - The service name does not follow the `service.namespace...:port` convention from the README
+	ErrInvalidServiceName = errors.New("kubegrpc: invalid service name")
+	// ErrKubernetesUnavailable - The k8s API could not be reached or refused the request
+	ErrKubernetesUnavailable = errors.New("kubegrpc: k8s interaction not possible")
+	// ErrServiceNotFound - The service does not exist in the namespace
+	ErrServiceNotFound = errors.New("kubegrpc: service not found")
+	// ErrNoHealthyEndpoints - The pool has no connections to hand out (no pods, or all dials failed)
+	ErrNoHealthyEndpoints = errors.New("kubegrpc: no healthy endpoints")
+	// ErrPoolClosed - The pool has been closed
+	ErrPoolClosed = errors.New("kubegrpc: pool closed")
+	// ErrShutdown - The balancing was shut down with Shutdown
+	ErrShutdown = errors.New("kubegrpc: shut down")
+)
+
+// ErrDialFailed - A connection to a pod could not be set up
+type ErrDialFailed struct {
+	Pod string // Name of the pod
+	IP  string // Address dialed
+	Err error  // Underlying dial or NewGrpcClient error
+}
+
+func (e *ErrDialFailed) Error() string {
+	return fmt.Sprintf("kubegrpc: dial to pod %s (%s) failed: %v", e.Pod, e.IP, e.Err)
+}
+
+// Unwrap - Gives access to the underlying error
+func (e *ErrDialFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrPermissionDenied - The service account of the pod lacks the RBAC permission for a k8s request. Also matches
+// ErrKubernetesUnavailable with errors.Is.
+type ErrPermissionDenied struct {
+	Verb      string // get, list or watch
+	Resource  string // services, pods, endpoints, ...
+	Namespace string
+	Err       error // Error of the k8s API
+}
+
+func (e *ErrPermissionDenied) Error() string {
+	return fmt.Sprintf("kubegrpc: no RBAC permission to %s %s in namespace %s: %v", e.Verb, e.Resource, e.Namespace,
+		e.Err)
+}
+
+func (e *ErrPermissionDenied) Is(target error) bool {
+	return target == ErrKubernetesUnavailable
+}
+
+// Unwrap - Gives access to the error of the k8s API
+func (e *ErrPermissionDenied) Unwrap() error {
+	return e.Err
+}
+
+// noEndpointsError - ErrNoHealthyEndpoints which also carries the last dial failure, so both errors.Is(err, ErrNoHealthyEndpoints)
+// and errors.As(err, **ErrDialFailed) work on the result
+type noEndpointsError struct {
+	dialErr *ErrDialFailed
+	failed  int // Failed dials of the update, including dialErr
+}
+
+func (e *noEndpointsError) Error() string {
+	if e.failed > 1 {
+		return fmt.Sprintf("%v: %v (and %d more failed dials)", ErrNoHealthyEndpoints, e.dialErr, e.failed-1)
+	}
+	return fmt.Sprintf("%v: %v", ErrNoHealthyEndpoints, e.dialErr)
+}
+
+func (e *noEndpointsError) Is(target error) bool {
+	return target == ErrNoHealthyEndpoints
+}
+
+func (e *noEndpointsError) Unwrap() error {
+	return e.dialErr
+}
@@ -0,0 +1,142 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// failingBalancer - GrpcKubeBalancer whose client factory always fails
+type failingBalancer struct{}
+
+func (failingBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) {
+	return nil, errors.New("stub constructor failed")
+}
+
+func (failingBalancer) Ping(interface{}) error { return nil }
+
+// useFakeClientset - Replaces the k8s clientset for the duration of the test
+func useFakeClientset(t *testing.T, objects ...interface{}) {
+	t.Helper()
+	cs := fake.NewSimpleClientset()
+	for _, o := range objects {
+		var err error
+		switch obj := o.(type) {
+		case *corev1.Service:
+			err = cs.Tracker().Add(obj)
+		case *corev1.Pod:
+			err = cs.Tracker().Add(obj)
+		case *corev1.ConfigMap:
+			err = cs.Tracker().Add(obj)
+		case *corev1.Endpoints:
+			err = cs.Tracker().Add(obj)
+		case *discoveryv1beta1.EndpointSlice:
+			err = cs.Tracker().Add(obj)
+		case *corev1.Node:
+			err = cs.Tracker().Add(obj)
+		case *corev1.Namespace:
+			err = cs.Tracker().Add(obj)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	clientsetMutex.Lock()
+	previous := clientset
+	clientset = cs
+	clientsetMutex.Unlock()
+	t.Cleanup(func() {
+		clientsetMutex.Lock()
+		clientset = previous
+		clientsetMutex.Unlock()
+	})
+}
+
+func testService(name, namespace string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": name}},
+	}
+}
+
+func testPod(name, namespace, app, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": app}},
+		Status:     corev1.PodStatus{PodIP: ip},
+	}
+}
+
+func TestParseServiceName(t *testing.T) {
+	noClientNamespace(t)
+	name, namespace, port, err := parseServiceName("abc.ns.svc.cluster.local:10000")
+	if err != nil || name != "abc" || namespace != "ns" || port != "10000" {
+		t.Errorf("parseServiceName() = %q, %q, %q, %v", name, namespace, port, err)
+	}
+	if _, _, port, err := parseServiceName("abc.ns"); err != nil || port != "" {
+		t.Errorf("parseServiceName() without port = %q, %v, want empty port", port, err)
+	}
+	for _, invalid := range []string{"abc.ns:", "abc:10000", "abc.ns:1:2"} {
+		if _, _, _, err := parseServiceName(invalid); !errors.Is(err, ErrInvalidServiceName) {
+			t.Errorf("parseServiceName(%q) error = %v, want ErrInvalidServiceName", invalid, err)
+		}
+	}
+}
+
+func TestPoolInvalidServiceName(t *testing.T) {
+	noClientNamespace(t)
+	_, _, err := Pool("no-namespace:1000", failingBalancer{})
+	if !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("Pool() error = %v, want ErrInvalidServiceName", err)
+	}
+}
+
+func TestUpdateConnectionPoolServiceNotFound(t *testing.T) {
+	useFakeClientset(t)
+	err := updateConnectionPool("missing.ns:1000", &connection{functions: failingBalancer{}}, false)
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrServiceNotFound", err)
+	}
+}
+
+func TestUpdateConnectionPoolDialFailed(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	err := updateConnectionPool("svc.ns:1000", &connection{functions: failingBalancer{}}, false)
+	if !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrNoHealthyEndpoints", err)
+	}
+	var dialErr *ErrDialFailed
+	if !errors.As(err, &dialErr) {
+		t.Fatalf("updateConnectionPool() error = %v, want ErrDialFailed", err)
+	}
+	if dialErr.Pod != "svc-0" || dialErr.IP != "10.0.0.1" {
+		t.Errorf("ErrDialFailed = %+v, want pod svc-0 at 10.0.0.1", dialErr)
+	}
+}
+
+func TestUpdateConnectionPoolNoPods(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"))
+	err := updateConnectionPool("svc.ns:1000", &connection{functions: failingBalancer{}}, false)
+	if !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrNoHealthyEndpoints", err)
+	}
+	var dialErr *ErrDialFailed
+	if errors.As(err, &dialErr) {
+		t.Errorf("updateConnectionPool() error = %v, want no ErrDialFailed without pods", err)
+	}
+}
+
+func TestClosePool(t *testing.T) {
+	if err := ClosePool("never-opened.ns:1000"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("ClosePool() error = %v, want ErrPoolClosed", err)
+	}
+	useFakeClientset(t, testService("svc", "ns"))
+	c := &connection{functions: failingBalancer{}, closed: true}
+	if err := updateConnectionPool("svc.ns:1000", c, false); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("updateConnectionPool() on closed pool error = %v, want ErrPoolClosed", err)
+	}
+}
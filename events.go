@@ -0,0 +1,162 @@
+package kubegrpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolEventType - Kind of PoolEvent
+type PoolEventType int
+
+// Pool event types
+const (
+	EndpointAdded      PoolEventType = iota // A connection was added to the pool
+	EndpointRemoved                         // A connection was removed from the pool
+	EndpointUnhealthy                       // A connection failed its ping, was ejected by its circuit breaker or reported failed
+	PoolDegraded                            // The pool dropped below its minimum healthy connections
+	PoolRecovered                           // The pool is back at or above its minimum healthy connections
+	PoolClosed                              // The pool was closed, no further events follow
+	EndpointDraining                        // A connection is no longer picked and closes once its RPCs completed
+	PoolFailover                            // A pool switched cluster or secondary pool, see ConnectFederated and WithFailover
+	LeaderChanged                           // The leader of a pool in leader only mode changed, see WithLeaderOnly
+	EndpointBackingOff                      // A pod failed to dial, it is dialed again at the NextAttempt of the Backoff
+	PoolStale                               // The pool was not discovered within its WithStaleAfter refresh intervals
+	PoolRefreshed                           // A stale pool was discovered again
+)
+
+func (t PoolEventType) String() string {
+	switch t {
+	case EndpointAdded:
+		return "EndpointAdded"
+	case EndpointRemoved:
+		return "EndpointRemoved"
+	case EndpointUnhealthy:
+		return "EndpointUnhealthy"
+	case PoolDegraded:
+		return "PoolDegraded"
+	case PoolRecovered:
+		return "PoolRecovered"
+	case PoolClosed:
+		return "PoolClosed"
+	case EndpointDraining:
+		return "EndpointDraining"
+	case PoolFailover:
+		return "PoolFailover"
+	case LeaderChanged:
+		return "LeaderChanged"
+	case EndpointBackingOff:
+		return "EndpointBackingOff"
+	case PoolStale:
+		return "PoolStale"
+	case PoolRefreshed:
+		return "PoolRefreshed"
+	}
+	return "Unknown"
+}
+
+// PoolEvent - Membership or health change of a pool
+type PoolEvent struct {
+	Type        PoolEventType
+	Time        time.Time
+	ServiceName string
+	Endpoint    EndpointInfo // Zero for pool level events
+	Connections int          // Number of connections in the pool after the change, 0 for EndpointUnhealthy
+	Reason      string
+	Version     uint64        // Snapshot version of the endpoint set of the pool when the event was emitted, see PoolStats
+	Backoff     *BackoffState // Backoff of the endpoint for EndpointBackingOff and a failed health check, nil otherwise
+}
+
+// eventBufferSize - Buffer per listener. Events are dropped for listeners which do not keep up, emitting never blocks
+// the pool maintenance.
+const eventBufferSize = 64
+
+// eventListener - Receiving side of the events of a pool
+type eventListener struct {
+	ch      chan PoolEvent
+	dropped uint64 // atomic
+}
+
+var (
+	eventListeners = make(map[string][]*eventListener)
+	eventsMutex    = &sync.Mutex{}
+)
+
+// addListener - Registers a listener for the events of the service
+func addListener(serviceName string) *eventListener {
+	l := &eventListener{ch: make(chan PoolEvent, eventBufferSize)}
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	eventListeners[serviceName] = append(eventListeners[serviceName], l)
+	return l
+}
+
+// removeListener - Unregisters the listener and closes its channel
+func removeListener(serviceName string, l *eventListener) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	listeners := eventListeners[serviceName]
+	for k, v := range listeners {
+		if v == l {
+			listeners[k] = listeners[len(listeners)-1]
+			eventListeners[serviceName] = listeners[:len(listeners)-1]
+			close(l.ch)
+			break
+		}
+	}
+	if len(eventListeners[serviceName]) == 0 {
+		delete(eventListeners, serviceName)
+	}
+}
+
+// emit - Sends the event to all listeners of the service without blocking
+func emit(e PoolEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	queueKubernetesEvent(e)
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	for _, l := range eventListeners[e.ServiceName] {
+		select {
+		case l.ch <- e:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+}
+
+// emitEndpoint - Emits an endpoint level event. Draining and unhealthy connections wake the hooks, see OnPoolEmpty.
+func emitEndpoint(t PoolEventType, c *GrpcConnection, connections int, reason string) {
+	if t == EndpointDraining || t == EndpointUnhealthy {
+		notifyHooks(c.serviceName)
+	}
+	emit(PoolEvent{Type: t, ServiceName: c.serviceName, Endpoint: c.Info(), Connections: connections, Reason: reason,
+		Version: c.pool.snapshotVersion()})
+}
+
+// Subscribe - Returns a channel receiving the events of the pool of the service: membership (EndpointAdded,
+// EndpointRemoved, EndpointDraining), health (EndpointUnhealthy, EndpointBackingOff, PoolDegraded, PoolRecovered),
+// discovery (PoolStale, PoolRefreshed) and PoolClosed. The pool does not need to exist yet, so a subscription made
+// before Connect sees the initial endpoints being added.
+// Events are dropped when the channel is not drained fast enough, emitting never blocks the pool.
+// Call Unsubscribe when done.
+func Subscribe(serviceName string) <-chan PoolEvent {
+	return addListener(serviceName).ch
+}
+
+// Unsubscribe - Ends the subscription and closes its channel
+func Unsubscribe(serviceName string, ch <-chan PoolEvent) {
+	eventsMutex.Lock()
+	var l *eventListener
+	for _, v := range eventListeners[serviceName] {
+		if v.ch == ch {
+			l = v
+			break
+		}
+	}
+	eventsMutex.Unlock()
+	if l != nil {
+		removeListener(serviceName, l)
+	}
+}
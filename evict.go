@@ -0,0 +1,112 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync"
+)
+
+// evictQueue - Connections handed in for removal from their pool (failed health checks, finished drains, shut down
+// connections). Pushing never blocks, also not while holding mutex; cleanConnections takes the queued connections in
+// batches. A connection queued twice is removed once.
+type evictQueue struct {
+	mutex   sync.Mutex
+	pending []*GrpcConnection
+	queued  map[*GrpcConnection]bool
+	signal  chan struct{} // Buffered, holds a token while connections are pending
+}
+
+func newEvictQueue() *evictQueue {
+	return &evictQueue{queued: make(map[*GrpcConnection]bool), signal: make(chan struct{}, 1)}
+}
+
+// push - Queues the connection for removal
+func (q *evictQueue) push(gc *GrpcConnection) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.queued[gc] {
+		return
+	}
+	q.queued[gc] = true
+	q.pending = append(q.pending, gc)
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take - Waits for queued connections and returns all of them, in the order they were queued. Returns nil once stop
+// is closed.
+func (q *evictQueue) take(stop <-chan struct{}) []*GrpcConnection {
+	for {
+		select {
+		case <-q.signal:
+		case <-stop:
+			return nil
+		}
+		q.mutex.Lock()
+		batch := q.pending
+		q.pending = nil
+		q.queued = make(map[*GrpcConnection]bool)
+		q.mutex.Unlock()
+		if len(batch) > 0 {
+			return batch
+		}
+	}
+}
+
+// cleanConnections - Processes the connections which are stale/can not be reached and removes them from the cache
+func cleanConnections(stop <-chan struct{}) {
+	defer maintenance.Done()
+	for batch := dirtyConnections.take(stop); batch != nil; batch = dirtyConnections.take(stop) {
+		removeConnections(batch)
+	}
+}
+
+// removeConnections - Removes the connections from their pools with a single swap per pool
+func removeConnections(batch []*GrpcConnection) {
+	byPool := make(map[string][]*GrpcConnection)
+	services := make([]string, 0)
+	for _, gc := range batch {
+		if _, ok := byPool[gc.serviceName]; !ok {
+			services = append(services, gc.serviceName)
+		}
+		byPool[gc.serviceName] = append(byPool[gc.serviceName], gc)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, serviceName := range services {
+		conns := connectionCache[serviceName]
+		if conns == nil {
+			// Pool closed in the mean time, ClosePool already closed the connections
+			continue
+		}
+		// healthCheck and updatePool could both hand in the same connection; once removed it is no longer contained
+		current := make(map[*GrpcConnection]bool, len(conns.grpcConnection))
+		for _, gc := range conns.grpcConnection {
+			current[gc] = true
+		}
+		removed := make([]*GrpcConnection, 0, len(byPool[serviceName]))
+		for _, gc := range byPool[serviceName] {
+			if current[gc] {
+				delete(current, gc)
+				removed = append(removed, gc)
+			}
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		next := make([]*GrpcConnection, 0, len(current))
+		for _, gc := range conns.grpcConnection {
+			if current[gc] {
+				next = append(next, gc)
+			}
+		}
+		conns.swapConnections(next)
+		for _, gc := range removed {
+			go gc.conn.Close() // Close open connections just in case there is a non-implementation of the healthcheck or other failure making the connection not terminate
+			emitEndpoint(EndpointRemoved, gc, conns.nConnections, "")
+		}
+		updateDegraded(serviceName, conns)
+		log.Printf("INFO: cleanConnections(): Pool %s after clean: %v", serviceName, conns)
+	}
+}
@@ -0,0 +1,86 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvictQueue(t *testing.T) {
+	q := newEvictQueue()
+	a, b := &GrpcConnection{podName: "a"}, &GrpcConnection{podName: "b"}
+	// Pushing never blocks, also while mutex is held and nothing takes from the queue
+	mutex.Lock()
+	q.push(a)
+	q.push(b)
+	q.push(a)
+	mutex.Unlock()
+	got := q.take(nil)
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("take() = %v, want a and b once", got)
+	}
+	q.push(a)
+	if got := q.take(nil); len(got) != 1 || got[0] != a {
+		t.Errorf("take() after a new push = %v, want a", got)
+	}
+}
+
+func TestRemoveConnectionsBatch(t *testing.T) {
+	p := testPool(t, 4)
+	cachePool(t, p)
+	events := Subscribe("svc.ns:1000")
+	defer Unsubscribe("svc.ns:1000", events)
+	version := p.snapshotVersion()
+	removed := []*GrpcConnection{p.grpcConnection[1], p.grpcConnection[3], p.grpcConnection[1]}
+	removeConnections(append(removed, &GrpcConnection{serviceName: "closed.ns:1000"}))
+	if len(p.grpcConnection) != 2 || p.grpcConnection[0].podName != "svc-1" || p.grpcConnection[1].podName != "svc-3" {
+		t.Fatalf("pool after removal = %v, want svc-1 and svc-3", p.grpcConnection)
+	}
+	if v := p.snapshotVersion(); v != version+1 {
+		t.Errorf("version = %d, want a single swap to %d", v, version+1)
+	}
+	for i := 0; i < 2; i++ {
+		if e := <-events; e.Type != EndpointRemoved || e.Connections != 2 {
+			t.Errorf("event %d = %v with %d connections, want EndpointRemoved with 2", i, e.Type, e.Connections)
+		}
+	}
+}
+
+func TestConcurrentFailuresDuringUpdate(t *testing.T) {
+	objects := []interface{}{testService("svc", "ns")}
+	for i := 1; i <= 20; i++ {
+		objects = append(objects, testPod(fmt.Sprintf("svc-%d", i), "ns", "svc", fmt.Sprintf("10.0.0.%d", i)))
+	}
+	useFakeClientset(t, objects...)
+	// The pings of the health check fail as well, a successful one would reset the backoff of the failed pods
+	c := newConnection(unhealthyBalancer{}, newPoolConfig(nil))
+	cachePool(t, c)
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	failed := ListPool("svc.ns:1000")
+	var wg sync.WaitGroup
+	for _, gc := range failed {
+		wg.Add(1)
+		go func(gc *GrpcConnection) {
+			defer wg.Done()
+			unhealthy(gc, c.backoff, fmt.Errorf("ping failed"))
+		}(gc)
+	}
+	done := make(chan struct{})
+	go func() {
+		// The refresh runs while the failures are queued; the backoff keeps it from redialing the failed pods
+		updateConnectionPool("svc.ns:1000", c, true)
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failures during the pool update did not complete")
+	}
+	if n := poolSize(c, 0); n != 0 {
+		t.Errorf("pool size = %d, want all failed connections removed", n)
+	}
+}
@@ -0,0 +1,139 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrResolveFailed - None of the host names of an external or static pool could be resolved
+var ErrResolveFailed = errors.New("kubegrpc: address resolution failed")
+
+var (
+	// staticPools - Addresses (`host:port`) of the static pools by pool key, see ConnectStatic
+	staticPools = make(map[string][]string)
+	staticMutex = &sync.RWMutex{}
+	// lookupHost - Resolves host names, replaced in tests
+	lookupHost = net.LookupHost
+)
+
+// ConnectStatic - Connects to a fixed list of `host:port` addresses outside of the cluster (or inside without any k8s
+// object), with the same pooling, health checks and balancing as service pools, so hybrid deployments use one client
+// code path. serviceName identifies the pool and follows the service name convention (`name.namespace`), no k8s
+// objects are looked up for it. Host names are resolved on every refresh and every address they resolve to becomes an
+// endpoint. Change the addresses with SetStaticAddresses.
+func ConnectStatic(serviceName string, addresses []string, f GrpcKubeBalancer, opts ...PoolOption) (interface{}, error) {
+	if err := setStaticAddresses(serviceName, addresses); err != nil {
+		return nil, err
+	}
+	return ConnectWithOptions(serviceName, f, opts...)
+}
+
+// SetStaticAddresses - Replaces the addresses of a static pool, the pool is refreshed right away. Returns
+// ErrPoolNotFound if there is no pool.
+func SetStaticAddresses(serviceName string, addresses []string) error {
+	mutex.RLock()
+	c := connectionCache[serviceName]
+	mutex.RUnlock()
+	if c == nil {
+		return ErrPoolNotFound
+	}
+	if err := setStaticAddresses(serviceName, addresses); err != nil {
+		return err
+	}
+	go updateConnectionPool(serviceName, c, true)
+	return nil
+}
+
+// setStaticAddresses - Validates and registers the addresses of the static pool
+func setStaticAddresses(serviceName string, addresses []string) error {
+	if _, _, port, err := parseServiceName(serviceName); err != nil {
+		return err
+	} else if port != "" {
+		return fmt.Errorf("%w: the port of static pools is part of the addresses. Service name: %s",
+			ErrInvalidServiceName, serviceName)
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("%w: no addresses for %s", ErrInvalidServiceName, serviceName)
+	}
+	for _, address := range addresses {
+		if _, port, err := net.SplitHostPort(address); err != nil || port == "" {
+			return fmt.Errorf("%w: address %q is not host:port", ErrInvalidServiceName, address)
+		}
+	}
+	staticMutex.Lock()
+	defer staticMutex.Unlock()
+	staticPools[serviceName] = append([]string(nil), addresses...)
+	return nil
+}
+
+// staticAddresses - The addresses of the static pool, false if the pool is not static
+func staticAddresses(serviceName string) ([]string, bool) {
+	staticMutex.RLock()
+	defer staticMutex.RUnlock()
+	addresses, static := staticPools[serviceName]
+	return addresses, static
+}
+
+// staticDiscovery - The service and pods standing in for the addresses of a static pool
+func staticDiscovery(serviceName string, addresses []string) (*corev1.Service, *corev1.PodList, error) {
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	pods, err := resolvePods(namespace, addresses)
+	return svc, pods, err
+}
+
+// externalNamePods - The pods standing in for the addresses the external name of the service resolves to
+func externalNamePods(svc *corev1.Service, explicit string) (*corev1.PodList, error) {
+	port, err := servicePort(explicit, svc)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePods(svc.Namespace, []string{net.JoinHostPort(svc.Spec.ExternalName, port)})
+}
+
+// resolvePods - Resolves the `host:port` addresses to pods named `ip:port`, with the port as grpc container port.
+// Hosts which do not resolve are skipped; fails only if nothing resolved.
+func resolvePods(namespace string, addresses []string) (*corev1.PodList, error) {
+	pods := &corev1.PodList{}
+	seen := make(map[string]bool)
+	var lastErr error
+	for _, address := range addresses {
+		host, port, _ := net.SplitHostPort(address)
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips, err := lookupHost(host)
+		if err != nil {
+			log.Printf("WARNING: resolvePods(): Can not resolve %s. Error %v", host, err)
+			lastErr = err
+			continue
+		}
+		for _, ip := range ips {
+			name := net.JoinHostPort(ip, port)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			pod := addressPod(namespace, corev1.EndpointAddress{IP: ip},
+				[]corev1.EndpointPort{{Name: grpcPortNames[0], Port: int32(p)}})
+			pod.Name = name
+			pods.Items = append(pods.Items, pod)
+		}
+	}
+	if len(pods.Items) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResolveFailed, lastErr)
+	}
+	return pods, nil
+}
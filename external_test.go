@@ -0,0 +1,105 @@
+package kubegrpc
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// useLookupHost - Resolves the host names of the test from the map, other names fail
+func useLookupHost(t *testing.T, hosts map[string][]string) {
+	previous := lookupHost
+	lookupHost = func(host string) ([]string, error) {
+		if ips, found := hosts[host]; found {
+			return ips, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	t.Cleanup(func() { lookupHost = previous })
+}
+
+// targets - Sorted dial targets of the connections
+func targets(conns []*GrpcConnection) []string {
+	t := make([]string, 0, len(conns))
+	for _, gc := range conns {
+		t = append(t, gc.conn.Target())
+	}
+	sort.Strings(t)
+	return t
+}
+
+func TestConnectStaticInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		serviceName string
+		addresses   []string
+	}{
+		{"legacy.external", nil},
+		{"legacy.external", []string{"10.5.0.1"}},
+		{"legacy.external:7000", []string{"10.5.0.1:7000"}},
+	} {
+		if _, err := ConnectStatic(tc.serviceName, tc.addresses, okBalancer{}); !errors.Is(err, ErrInvalidServiceName) {
+			t.Errorf("ConnectStatic(%s, %v) error = %v, want ErrInvalidServiceName", tc.serviceName, tc.addresses, err)
+		}
+	}
+	if err := SetStaticAddresses("missing.external", []string{"10.5.0.1:7000"}); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("SetStaticAddresses() error = %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestConnectStatic(t *testing.T) {
+	useLookupHost(t, map[string][]string{"10.5.0.1": {"10.5.0.1"}, "db.example": {"10.5.0.2", "10.5.0.3"},
+		"10.5.0.4": {"10.5.0.4"}})
+	defer func() {
+		ClosePool("legacy.external")
+		staticMutex.Lock()
+		delete(staticPools, "legacy.external")
+		staticMutex.Unlock()
+	}()
+	if _, err := ConnectStatic("legacy.external", []string{"10.5.0.1:7000", "db.example:7001", "gone.example:7002"},
+		okBalancer{}); err != nil {
+		t.Fatalf("ConnectStatic() error = %v", err)
+	}
+	got := targets(Connections("legacy.external"))
+	if len(got) != 3 || got[0] != "10.5.0.1:7000" || got[1] != "10.5.0.2:7001" || got[2] != "10.5.0.3:7001" {
+		t.Errorf("targets = %v, want the static and resolved addresses", got)
+	}
+	if err := SetStaticAddresses("legacy.external", []string{"10.5.0.4:7000"}); err != nil {
+		t.Fatal(err)
+	}
+	mutex.RLock()
+	p := connectionCache["legacy.external"]
+	mutex.RUnlock()
+	// The replaced endpoints drain without RPCs in flight and are removed
+	if n := poolSize(p, 1); n != 1 {
+		t.Fatalf("pool size after SetStaticAddresses() = %d, want 1", n)
+	}
+	if got := targets(Connections("legacy.external")); got[0] != "10.5.0.4:7000" {
+		t.Errorf("targets = %v, want the new address", got)
+	}
+}
+
+func TestExternalNameService(t *testing.T) {
+	useLookupHost(t, map[string][]string{"ext.example": {"10.6.0.1"}})
+	svc := testService("ext", "ns")
+	svc.Spec.Type = corev1.ServiceTypeExternalName
+	svc.Spec.ExternalName = "ext.example"
+	svc.Spec.Ports = []corev1.ServicePort{{Name: "grpc", Port: 9000}}
+	useFakeClientset(t, svc)
+	c := newConnection(okBalancer{}, newPoolConfig(nil))
+	if err := updateConnectionPool("ext.ns", c, false); err != nil {
+		t.Fatal(err)
+	}
+	defer c.grpcConnection[0].conn.Close()
+	if got := targets(c.grpcConnection); len(got) != 1 || got[0] != "10.6.0.1:9000" {
+		t.Errorf("targets = %v, want the resolved external name", got)
+	}
+	useLookupHost(t, nil)
+	if err := updateConnectionPool("ext.ns", c, false); !errors.Is(err, ErrResolveFailed) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrResolveFailed", err)
+	}
+	if len(c.grpcConnection) != 1 {
+		t.Errorf("resolution failure evicted the connections")
+	}
+}
@@ -0,0 +1,80 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"log"
+)
+
+// WithFailover - Chains the pool to a secondary pool, eg a fallback service or the service in a remote cluster
+// (`svc.ns:50051@dr`, see AddCluster): Pool and Connect pick from the secondary pool while the pool has fewer than
+// minHealthy usable connections (not draining, not ejected), and from the pool again as soon as it recovers. The
+// secondary pool is created with the same options once it is needed and is then maintained like any pool, so failing
+// back is immediate; it is closed with its own ClosePool. The secondary is only used when it has more usable connections
+// than the pool. A change emits a PoolFailover event for the service name of the pool. minHealthy defaults to 1.
+func WithFailover(secondary string, minHealthy int) PoolOption {
+	if minHealthy <= 0 {
+		minHealthy = 1
+	}
+	return func(c *poolConfig) {
+		c.failoverService = secondary
+		c.failoverMinHealthy = minHealthy
+	}
+}
+
+// failover - The service name and pool to pick from: the primary pool, or its secondary pool when the primary has
+// fewer usable connections than configured. primaryErr is the error of opening the primary pool, returned when neither
+// pool has connections. Caller must hold mutex.
+func failover(serviceName string, primary *connection, f GrpcKubeBalancer, opts []PoolOption,
+	primaryErr error) (string, *connection, error) {
+	secondaryName := primary.config.failoverService
+	healthy := healthyConnections(primary)
+	if healthy >= primary.config.failoverMinHealthy || secondaryName == serviceName {
+		setFailedOver(serviceName, primary, false, healthy)
+		return serviceName, primary, primaryErr
+	}
+	// The secondary pool does not fail over itself: failover is not transitive
+	secondaryOpts := append(append([]PoolOption{}, opts...), WithFailover("", 0))
+	secondary, err := openPool(secondaryName, f, secondaryOpts)
+	if err != nil || healthyConnections(secondary) <= healthy {
+		if err != nil {
+			log.Printf("WARNING: failover(): Could not open the secondary pool %s of %s. Error: %v",
+				secondaryName, serviceName, err)
+		}
+		setFailedOver(serviceName, primary, false, healthy)
+		if primaryErr == nil && len(primary.grpcConnection) == 0 {
+			primaryErr = ErrNoHealthyEndpoints
+		}
+		return serviceName, primary, primaryErr
+	}
+	setFailedOver(serviceName, primary, true, healthyConnections(secondary))
+	return secondaryName, secondary, nil
+}
+
+// setFailedOver - Records whether the picks of the pool go to its secondary pool, logging and emitting changes.
+// Caller must hold mutex.
+func setFailedOver(serviceName string, primary *connection, failedOver bool, healthy int) {
+	if primary.failedOver == failedOver {
+		return
+	}
+	primary.failedOver = failedOver
+	secondaryName := primary.config.failoverService
+	if failedOver {
+		log.Printf("WARNING: setFailedOver(): %s failed over to %s with %d usable connections",
+			serviceName, secondaryName, healthy)
+		emit(PoolEvent{Type: PoolFailover, ServiceName: serviceName, Connections: healthy,
+			Reason: fmt.Sprintf("to %s", secondaryName), Version: primary.snapshotVersion()})
+		return
+	}
+	log.Printf("INFO: setFailedOver(): %s failed back from %s with %d usable connections",
+		serviceName, secondaryName, healthy)
+	emit(PoolEvent{Type: PoolFailover, ServiceName: serviceName, Connections: healthy,
+		Reason: fmt.Sprintf("back from %s", secondaryName), Version: primary.snapshotVersion()})
+}
+
+// IsFailedOver - Returns true if the picks of the pool of the service go to its secondary pool, see WithFailover
+func IsFailedOver(serviceName string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	c := connectionCache[serviceName]
+	return c != nil && c.failedOver
+}
@@ -0,0 +1,83 @@
+package kubegrpc
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestFailover(t *testing.T) {
+	useFakeClientset(t, testService("pri", "ns"), testPod("pri-0", "ns", "pri", "10.0.0.1"),
+		testService("sec", "ns"), testPod("sec-0", "ns", "sec", "10.0.1.1"))
+	defer ClosePool("pri.ns:1000")
+	defer ClosePool("sec.ns:1000")
+	opts := []PoolOption{WithFailover("sec.ns:1000", 1)}
+	client, err := ConnectWithOptions("pri.ns:1000", okBalancer{}, opts...)
+	if err != nil || client.(*grpc.ClientConn).Target() != "10.0.0.1:1000" {
+		t.Fatalf("Connect() = %v, %v, want the primary pod", client, err)
+	}
+	if conns := Connections("sec.ns:1000"); conns != nil {
+		t.Errorf("secondary pool created while the primary is healthy: %v", conns)
+	}
+	events := Subscribe("pri.ns:1000")
+	defer Unsubscribe("pri.ns:1000", events)
+
+	primary := Connections("pri.ns:1000")
+	for _, gc := range primary {
+		atomic.StoreInt32(&gc.draining, 1)
+	}
+	client, err = ConnectWithOptions("pri.ns:1000", okBalancer{}, opts...)
+	if err != nil || client.(*grpc.ClientConn).Target() != "10.0.1.1:1000" {
+		t.Fatalf("Connect() = %v, %v, want the secondary pod", client, err)
+	}
+	if !IsFailedOver("pri.ns:1000") {
+		t.Error("IsFailedOver() = false after the failover")
+	}
+	mutex.RLock()
+	secondaryFailover := connectionCache["sec.ns:1000"].config.failoverService
+	mutex.RUnlock()
+	if secondaryFailover != "" {
+		t.Errorf("secondary pool fails over to %q", secondaryFailover)
+	}
+
+	for _, gc := range primary {
+		atomic.StoreInt32(&gc.draining, 0)
+	}
+	client, err = ConnectWithOptions("pri.ns:1000", okBalancer{}, opts...)
+	if err != nil || client.(*grpc.ClientConn).Target() != "10.0.0.1:1000" {
+		t.Fatalf("Connect() = %v, %v, want the recovered primary pod", client, err)
+	}
+	if IsFailedOver("pri.ns:1000") {
+		t.Error("IsFailedOver() = true after the recovery")
+	}
+	var reasons []string
+	for len(reasons) < 2 {
+		select {
+		case e := <-events:
+			if e.Type == PoolFailover {
+				reasons = append(reasons, e.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("PoolFailover events = %q, want 2", reasons)
+		}
+	}
+	if reasons[0] != "to sec.ns:1000" || reasons[1] != "back from sec.ns:1000" {
+		t.Errorf("PoolFailover reasons = %q", reasons)
+	}
+}
+
+func TestFailoverSecondaryUnavailable(t *testing.T) {
+	useFakeClientset(t, testService("pri", "ns"), testPod("pri-0", "ns", "pri", "10.0.0.1"))
+	defer ClosePool("pri.ns:1000")
+	defer ClosePool("missing.ns:1000")
+	opts := []PoolOption{WithFailover("missing.ns:1000", 2)}
+	client, err := ConnectWithOptions("pri.ns:1000", okBalancer{}, opts...)
+	if err != nil || client.(*grpc.ClientConn).Target() != "10.0.0.1:1000" {
+		t.Fatalf("Connect() = %v, %v, want the primary pod below the minimum", client, err)
+	}
+	if IsFailedOver("pri.ns:1000") {
+		t.Error("IsFailedOver() = true without a secondary pool")
+	}
+}
@@ -0,0 +1,97 @@
+package kubegrpc
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault - Dial or ping failure injected with WithFaultInjection/SetFaultInjection
+var ErrInjectedFault = errors.New("kubegrpc: injected fault")
+
+// FaultInjection - Artificial failures of a pool for resilience tests, so the behavior of an application on a degrading
+// pool can be verified without killing pods. Not meant for production pools.
+type FaultInjection struct {
+	DialFailureRate float64       // Fraction [0-1] of the dials which fail with ErrInjectedFault
+	PingFailureRate float64       // Fraction [0-1] of the health check pings which fail with ErrInjectedFault
+	DiscoveryDelay  time.Duration // Added to every discovery (k8s lookup) of the pool
+	Pods            []string      // Pods the dial and ping failures apply to, empty for all pods
+}
+
+var (
+	faultOverrides = make(map[string]*FaultInjection) // By service name, see SetFaultInjection
+	faultsMutex    = &sync.RWMutex{}
+	faultRandom    = rand.Float64 // Replaced in tests
+)
+
+// WithFaultInjection - Injects the faults into the pool from its creation on
+func WithFaultInjection(f FaultInjection) PoolOption {
+	return func(c *poolConfig) {
+		c.faults = &f
+	}
+}
+
+// SetFaultInjection - Replaces the faults of the pool of the service at runtime, also before the pool exists. A zero
+// FaultInjection stops injecting; ClearFaultInjection restores the faults set with WithFaultInjection.
+func SetFaultInjection(serviceName string, f FaultInjection) {
+	faultsMutex.Lock()
+	defer faultsMutex.Unlock()
+	faultOverrides[serviceName] = &f
+}
+
+// ClearFaultInjection - Removes the runtime faults of the service
+func ClearFaultInjection(serviceName string) {
+	faultsMutex.Lock()
+	defer faultsMutex.Unlock()
+	delete(faultOverrides, serviceName)
+}
+
+// injectedFaults - Faults of the pool: the runtime override, or the pool option. nil for none.
+func injectedFaults(serviceName string, c *connection) *FaultInjection {
+	faultsMutex.RLock()
+	f := faultOverrides[serviceName]
+	faultsMutex.RUnlock()
+	if f == nil && c != nil {
+		f = c.config.faults
+	}
+	return f
+}
+
+// appliesTo - True if the faults target the pod
+func (f *FaultInjection) appliesTo(podName string) bool {
+	if len(f.Pods) == 0 {
+		return true
+	}
+	for _, p := range f.Pods {
+		if p == podName {
+			return true
+		}
+	}
+	return false
+}
+
+// injectDialFault - Returns ErrInjectedFault if the dial to the pod is to fail
+func injectDialFault(serviceName string, c *connection, podName string) error {
+	f := injectedFaults(serviceName, c)
+	if f == nil || f.DialFailureRate <= 0 || !f.appliesTo(podName) || faultRandom() >= f.DialFailureRate {
+		return nil
+	}
+	return ErrInjectedFault
+}
+
+// injectPingFault - Returns ErrInjectedFault if the ping of the connection is to fail
+func injectPingFault(gc *GrpcConnection) error {
+	f := injectedFaults(gc.serviceName, gc.pool)
+	if f == nil || f.PingFailureRate <= 0 || !f.appliesTo(gc.podName) || faultRandom() >= f.PingFailureRate {
+		return nil
+	}
+	return ErrInjectedFault
+}
+
+// injectDiscoveryDelay - Delays the discovery of the pool
+func injectDiscoveryDelay(serviceName string, c *connection) {
+	if f := injectedFaults(serviceName, c); f != nil && f.DiscoveryDelay > 0 {
+		time.Sleep(f.DiscoveryDelay)
+	}
+}
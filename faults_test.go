@@ -0,0 +1,72 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// useFaultRandom - Replaces the random source of the fault injection for the test
+func useFaultRandom(t *testing.T, v float64) {
+	t.Helper()
+	previous := faultRandom
+	faultRandom = func() float64 { return v }
+	t.Cleanup(func() { faultRandom = previous })
+}
+
+func TestDialFaults(t *testing.T) {
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{
+		WithFaultInjection(FaultInjection{DialFailureRate: 0.5, Pods: []string{"svc-2"}})}))
+	useFaultRandom(t, 0.4)
+	gc, err := newGrpcConnection("svc.ns:1000", p, testPod("svc-1", "ns", "svc", "10.0.0.1"), "1000")
+	if err != nil {
+		t.Fatalf("dial of a pod without faults: %v", err)
+	}
+	gc.conn.Close()
+	_, dialErr := newGrpcConnection("svc.ns:1000", p, testPod("svc-2", "ns", "svc", "10.0.0.2"), "1000")
+	if !errors.Is(dialErr, ErrInjectedFault) {
+		t.Errorf("dial error = %v, want ErrInjectedFault", dialErr)
+	}
+	useFaultRandom(t, 0.6)
+	gc, err = newGrpcConnection("svc.ns:1000", p, testPod("svc-2", "ns", "svc", "10.0.0.2"), "1000")
+	if err != nil {
+		t.Fatalf("dial above the failure rate: %v", err)
+	}
+	gc.conn.Close()
+}
+
+func TestPingFaults(t *testing.T) {
+	p := testPool(t, 1)
+	gc := p.grpcConnection[0]
+	useFaultRandom(t, 0)
+	if err := ping(okBalancer{}, context.Background(), 0, gc); err != nil {
+		t.Fatalf("ping() without faults = %v", err)
+	}
+	SetFaultInjection("svc.ns:1000", FaultInjection{PingFailureRate: 1})
+	defer ClearFaultInjection("svc.ns:1000")
+	if err := ping(okBalancer{}, context.Background(), 0, gc); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("ping() = %v, want ErrInjectedFault", err)
+	}
+	SetFaultInjection("svc.ns:1000", FaultInjection{})
+	if err := ping(okBalancer{}, context.Background(), 0, gc); err != nil {
+		t.Errorf("ping() after disabling the faults = %v", err)
+	}
+}
+
+func TestFaultOverride(t *testing.T) {
+	p := testPool(t, 0, WithFaultInjection(FaultInjection{DiscoveryDelay: time.Second}))
+	if f := injectedFaults("svc.ns:1000", p); f == nil || f.DiscoveryDelay != time.Second {
+		t.Fatalf("injectedFaults() = %+v, want the pool option", f)
+	}
+	SetFaultInjection("svc.ns:1000", FaultInjection{DiscoveryDelay: 20 * time.Millisecond})
+	start := time.Now()
+	injectDiscoveryDelay("svc.ns:1000", p)
+	if d := time.Since(start); d < 20*time.Millisecond || d >= time.Second {
+		t.Errorf("discovery delay = %v, want the override of 20ms", d)
+	}
+	ClearFaultInjection("svc.ns:1000")
+	if f := injectedFaults("svc.ns:1000", p); f.DiscoveryDelay != time.Second {
+		t.Errorf("after ClearFaultInjection: %+v, want the pool option", f)
+	}
+}
@@ -0,0 +1,79 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// poolRefs - Open handles per service name, see Acquire. Protected by mutex.
+var poolRefs = make(map[string]int)
+
+// PoolHandle - Reference of a component of the process to the shared pool of a service, see Acquire. Safe for
+// concurrent use.
+type PoolHandle struct {
+	serviceName string
+	f           GrpcKubeBalancer
+	opts        []PoolOption
+	closed      int32 // atomic: 1 once Close was called
+}
+
+// Acquire - Returns a handle on the pool of the service, creating and populating the pool on first use like
+// ConnectWithOptions (the options only apply then). Components acquiring the same service share a single pool; every
+// handle holds a reference and the pool is closed once the last handle is closed, so components can be started and
+// stopped independently. Connect and Pool calls for the service use the same pool without holding a reference.
+func Acquire(serviceName string, f GrpcKubeBalancer, opts ...PoolOption) (*PoolHandle, error) {
+	if _, _, _, err := parseServiceName(serviceName); err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	poolRefs[serviceName]++
+	mutex.Unlock()
+	h := &PoolHandle{serviceName: serviceName, f: f, opts: opts}
+	if _, _, err := PoolWithOptions(serviceName, f, opts...); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// ServiceName - The service name the handle was acquired for
+func (h *PoolHandle) ServiceName() string {
+	return h.serviceName
+}
+
+// Connect - Returns a client of a connection picked from the pool, like Connect. A pool closed with ClosePool in the
+// mean time is built again. Returns ErrPoolClosed once the handle is closed.
+func (h *PoolHandle) Connect() (interface{}, error) {
+	if atomic.LoadInt32(&h.closed) == 1 {
+		return nil, ErrPoolClosed
+	}
+	return ConnectWithOptions(h.serviceName, h.f, h.opts...)
+}
+
+// Connections - The connections of the pool, like Connections. Empty once the handle is closed.
+func (h *PoolHandle) Connections() []*GrpcConnection {
+	if atomic.LoadInt32(&h.closed) == 1 {
+		return nil
+	}
+	return Connections(h.serviceName)
+}
+
+// Close - Releases the reference of the handle, closing the pool if it was the last one. Returns ErrPoolClosed if the
+// handle was closed already.
+func (h *PoolHandle) Close() error {
+	if !atomic.CompareAndSwapInt32(&h.closed, 0, 1) {
+		return ErrPoolClosed
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	poolRefs[h.serviceName]--
+	if poolRefs[h.serviceName] > 0 {
+		return nil
+	}
+	delete(poolRefs, h.serviceName)
+	if c := connectionCache[h.serviceName]; c != nil {
+		log.Printf("INFO: PoolHandle.Close(): Last handle of %s closed", h.serviceName)
+		closePool(h.serviceName, c)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAcquireSharesPool(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	defer ClosePool("svc.ns:1000")
+	a, err := Acquire("svc.ns:1000", okBalancer{})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	b, err := Acquire("svc.ns:1000", okBalancer{})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if stats, err := Stats("svc.ns:1000"); err != nil || stats.Handles != 2 || len(stats.Endpoints) != 1 {
+		t.Fatalf("Stats() = %+v, %v, want a single pool with 2 handles", stats, err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := a.Close(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("second Close() error = %v, want ErrPoolClosed", err)
+	}
+	if _, err := a.Connect(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Connect() of a closed handle error = %v, want ErrPoolClosed", err)
+	}
+	if _, err := b.Connect(); err != nil {
+		t.Errorf("Connect() of the remaining handle error = %v", err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := Stats("svc.ns:1000"); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("Stats() after the last handle error = %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestAcquireFailureReleasesReference(t *testing.T) {
+	useFakeClientset(t)
+	if _, err := Acquire("missing.ns:1000", okBalancer{}); !errors.Is(err, ErrServiceNotFound) {
+		t.Fatalf("Acquire() error = %v, want ErrServiceNotFound", err)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if n, found := poolRefs["missing.ns:1000"]; found || connectionCache["missing.ns:1000"] != nil {
+		t.Errorf("%d references and pool %v left after the failed Acquire", n, connectionCache["missing.ns:1000"])
+	}
+}
@@ -0,0 +1,100 @@
+package kubegrpc
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// addressAnnotation - Set on the pods standing in for endpoint addresses without a pod (headless services without
+// selector), their connections are not verified against k8s pods
+const addressAnnotation = "kube-grpc/endpoint-address"
+
+// WithNotReadyAddresses - For headless services with `publishNotReadyAddresses: true`, also connects to the addresses
+// which are not ready yet. Bootstrap protocols (etcd, Elasticsearch discovery) need to reach their peers before they
+// become ready. Without the option, or without publishNotReadyAddresses, only ready addresses are connected.
+func WithNotReadyAddresses() PoolOption {
+	return func(c *poolConfig) {
+		c.notReadyAddresses = true
+	}
+}
+
+// headless - True for services without cluster IP, whose members are taken from the Endpoints of the service
+func headless(svc *corev1.Service) bool {
+	return svc.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// endpointPods - The pods behind the addresses of the Endpoints of the headless service. Ready addresses are always
+// included, not ready addresses with notReady and publishNotReadyAddresses. Addresses without pod (Endpoints managed
+// by hand) are returned as pods carrying the address and the ports of the Endpoints.
+func endpointPods(svc *corev1.Service, pods []corev1.Pod, k8sClient typev1.CoreV1Interface, notReady bool) ([]corev1.Pod, error) {
+	endpoints, err := k8sClient.Endpoints(svc.Namespace).Get(context.Background(), svc.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return []corev1.Pod{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*corev1.Pod, len(pods))
+	byIP := make(map[string]*corev1.Pod, len(pods))
+	for k := range pods {
+		byName[pods[k].Name] = &pods[k]
+		byIP[pods[k].Status.PodIP] = &pods[k]
+	}
+	selected := make([]corev1.Pod, 0)
+	seen := make(map[string]bool)
+	for _, subset := range endpoints.Subsets {
+		addresses := subset.Addresses
+		if notReady && svc.Spec.PublishNotReadyAddresses {
+			addresses = append(addresses[:len(addresses):len(addresses)], subset.NotReadyAddresses...)
+		}
+		for _, address := range addresses {
+			if seen[address.IP] {
+				continue
+			}
+			seen[address.IP] = true
+			pod := byIP[address.IP]
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" && byName[address.TargetRef.Name] != nil {
+				pod = byName[address.TargetRef.Name]
+			}
+			if pod != nil && pod.Status.PodIP == address.IP {
+				selected = append(selected, *pod)
+				continue
+			}
+			selected = append(selected, addressPod(svc.Namespace, address, subset.Ports))
+		}
+	}
+	return selected, nil
+}
+
+// addressPod - A pod standing in for an endpoint address, with the ports of the endpoint as container ports
+func addressPod(namespace string, address corev1.EndpointAddress, ports []corev1.EndpointPort) corev1.Pod {
+	name := address.IP
+	if address.TargetRef != nil && address.TargetRef.Name != "" {
+		name = address.TargetRef.Name
+	} else if address.Hostname != "" {
+		name = address.Hostname
+	}
+	container := corev1.Container{Name: "endpoint"}
+	for _, p := range ports {
+		container.Ports = append(container.Ports, corev1.ContainerPort{Name: p.Name, ContainerPort: p.Port})
+	}
+	if len(ports) == 1 && ports[0].Name == "" {
+		// The only port of the Endpoints is the gRPC port
+		container.Ports[0].Name = grpcPortNames[0]
+	}
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace,
+			Annotations: map[string]string{addressAnnotation: strconv.FormatBool(true)}},
+		Spec:   corev1.PodSpec{Containers: []corev1.Container{container}},
+		Status: corev1.PodStatus{PodIP: address.IP},
+	}
+	if address.NodeName != nil {
+		pod.Spec.NodeName = *address.NodeName
+	}
+	return pod
+}
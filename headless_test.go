@@ -0,0 +1,92 @@
+package kubegrpc
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testHeadless - Headless service with publishNotReadyAddresses, and its Endpoints with ready pod svc-0 and not ready
+// pod svc-1
+func testHeadless(publishNotReady bool) (*corev1.Service, *corev1.Endpoints) {
+	svc := testService("svc", "ns")
+	svc.Spec.ClusterIP = corev1.ClusterIPNone
+	svc.Spec.PublishNotReadyAddresses = publishNotReady
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1",
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "svc-0"}}},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2",
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "svc-1"}}},
+		}},
+	}
+	return svc, endpoints
+}
+
+// connectedPods - Sorted pod names of the connections of the pool
+func connectedPods(c *connection) []string {
+	names := make([]string, 0, len(c.grpcConnection))
+	for _, gc := range c.grpcConnection {
+		names = append(names, gc.podName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestHeadlessEndpoints(t *testing.T) {
+	for _, tc := range []struct {
+		publish bool
+		opts    []PoolOption
+		want    int
+	}{
+		{false, nil, 1},
+		{false, []PoolOption{WithNotReadyAddresses()}, 1},
+		{true, nil, 1},
+		{true, []PoolOption{WithNotReadyAddresses()}, 2},
+	} {
+		svc, endpoints := testHeadless(tc.publish)
+		useFakeClientset(t, svc, endpoints, testPod("svc-0", "ns", "svc", "10.0.0.1"),
+			testPod("svc-1", "ns", "svc", "10.0.0.2"), testPod("svc-2", "ns", "svc", "10.0.0.3"))
+		c := newConnection(okBalancer{}, newPoolConfig(tc.opts))
+		if err := updateConnectionPool("svc.ns:1000", c, false); err != nil {
+			t.Fatal(err)
+		}
+		if got := connectedPods(c); len(got) != tc.want || got[0] != "svc-0" {
+			t.Errorf("publishNotReadyAddresses %v, %d options: connected %v, want %d of svc-0, svc-1", tc.publish,
+				len(tc.opts), got, tc.want)
+		}
+		for _, gc := range c.grpcConnection {
+			gc.conn.Close()
+		}
+	}
+}
+
+func TestHeadlessWithoutSelector(t *testing.T) {
+	svc := testService("external", "ns")
+	svc.Spec.ClusterIP = corev1.ClusterIPNone
+	svc.Spec.Selector = nil
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "external", Namespace: "ns"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.9.0.1", Hostname: "db-0"}},
+			Ports:     []corev1.EndpointPort{{Port: 7000}},
+		}},
+	}
+	useFakeClientset(t, svc, endpoints, testPod("unrelated-0", "ns", "unrelated", "10.0.0.1"))
+	c := newConnection(okBalancer{}, newPoolConfig(nil))
+	if err := updateConnectionPool("external.ns", c, false); err != nil {
+		t.Fatal(err)
+	}
+	defer c.grpcConnection[0].conn.Close()
+	gc := c.grpcConnection[0]
+	if len(c.grpcConnection) != 1 || gc.podName != "db-0" || gc.conn.Target() != "10.9.0.1:7000" || !gc.addressOnly {
+		t.Fatalf("connected %v, want db-0 at 10.9.0.1:7000", connectedPods(c))
+	}
+	if stale := staleConnections(c.grpcConnection, time.Nanosecond, time.Now().Add(time.Hour)); len(stale) != 0 {
+		t.Errorf("staleConnections() = %v, want endpoint addresses skipped", stale)
+	}
+}
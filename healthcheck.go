@@ -0,0 +1,157 @@
+package kubegrpc
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthCheckInterval           = time.Second
+	healthCheckSpread             = 0.5 // Fraction of the interval over which the checks of a round are spread
+	defaultHealthCheckConcurrency = 64
+	// Defaults and floor of WithAdaptiveHealthChecks
+	defaultMinCheckInterval = 250 * time.Millisecond
+	defaultMaxCheckInterval = 30 * time.Second
+	minCheckInterval        = 100 * time.Millisecond
+)
+
+var (
+	checkSlots      = make(chan struct{}, defaultHealthCheckConcurrency)
+	checkSlotsMutex = &sync.Mutex{}
+)
+
+// SetHealthCheckConcurrency - Sets the maximum number of health checks (pings) running at the same time over all pools,
+// default 64. Checks beyond the limit wait for a running one to complete. 0 or less restores the default.
+func SetHealthCheckConcurrency(n int) {
+	if n <= 0 {
+		n = defaultHealthCheckConcurrency
+	}
+	checkSlotsMutex.Lock()
+	defer checkSlotsMutex.Unlock()
+	checkSlots = make(chan struct{}, n)
+}
+
+// healthCheckSlots - Semaphore bounding the concurrent health checks
+func healthCheckSlots() chan struct{} {
+	checkSlotsMutex.Lock()
+	defer checkSlotsMutex.Unlock()
+	return checkSlots
+}
+
+// adaptiveChecks - Bounds of the health check interval of the connections of a pool, see WithAdaptiveHealthChecks
+type adaptiveChecks struct {
+	min time.Duration
+	max time.Duration
+}
+
+// WithAdaptiveHealthChecks - Adapts the interval of the health checks (pings) per connection instead of checking
+// every connection every second: new connections, and connections which recently failed an RPC or are recovering
+// from their circuit breaker, are checked every min (default 250ms, at least 100ms). Every successful check of a
+// healthy connection doubles its interval up to max (default 30s), so huge stable pools ping little while failing
+// endpoints are detected fast. Connections with a health Watch stream (WithHealthWatch) are not pinged.
+func WithAdaptiveHealthChecks(min, max time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		if min <= 0 {
+			min = defaultMinCheckInterval
+		}
+		if min < minCheckInterval {
+			min = minCheckInterval
+		}
+		if max <= 0 {
+			max = defaultMaxCheckInterval
+		}
+		if max < min {
+			max = min
+		}
+		c.adaptiveChecks = &adaptiveChecks{min: min, max: max}
+	}
+}
+
+// healthCheckTick - Interval of the health check rounds: a second, or the shortest minimum interval of the pools with
+// adaptive health checks. Caller must hold mutex.
+func healthCheckTick() time.Duration {
+	tick := healthCheckInterval
+	for _, v := range connectionCache {
+		if a := v.config.adaptiveChecks; a != nil && a.min < tick {
+			tick = a.min
+		}
+	}
+	return tick
+}
+
+// checkInterval - The current health check interval of the connection
+func (c *GrpcConnection) checkInterval(a *adaptiveChecks) time.Duration {
+	if a == nil {
+		return healthCheckInterval
+	}
+	if d := time.Duration(atomic.LoadInt64(&c.checkEvery)); d > 0 {
+		return d
+	}
+	return a.min
+}
+
+// checkDue - True if the connection is to be checked in the round at now, and schedules its next check. A connection
+// which failed an RPC since is due right away at the minimum interval.
+func (c *GrpcConnection) checkDue(a *adaptiveChecks, now time.Time) bool {
+	next := atomic.LoadInt64(&c.nextCheck)
+	if a != nil && c.recentlyFailed() && c.checkInterval(a) > a.min {
+		atomic.StoreInt64(&c.checkEvery, int64(a.min))
+		next = 0
+	}
+	if next > now.UnixNano() {
+		return false
+	}
+	atomic.StoreInt64(&c.nextCheck, now.Add(c.checkInterval(a)*maintenanceSlowdown()).UnixNano())
+	return true
+}
+
+// checkPassed - Adapts the interval after a successful check: back to the minimum while the connection is suspect,
+// doubled up to the maximum otherwise
+func (c *GrpcConnection) checkPassed(a *adaptiveChecks) {
+	if a == nil {
+		return
+	}
+	interval := 2 * c.checkInterval(a)
+	if interval > a.max {
+		interval = a.max
+	}
+	if c.recentlyFailed() || c.weight() < 1 {
+		interval = a.min
+	}
+	atomic.StoreInt64(&c.checkEvery, int64(interval))
+}
+
+// runHealthChecks - Runs a round of health checks: the start times are spread randomly over the spread duration, so
+// large pools do not burst their pings at the start of every interval, and at most cap(slots) checks run at the same
+// time. A connection whose previous check is still running (eg a ping waiting for its timeout) is skipped.
+// Returns once all checks were started, without waiting for them to complete, or when stop is closed. Shuffles checks
+// in place.
+func runHealthChecks(stop <-chan struct{}, checks []*connHealth, spread time.Duration, slots chan struct{},
+	check func(*connHealth)) {
+	offsets := make([]time.Duration, len(checks))
+	for i := range offsets {
+		offsets[i] = time.Duration(rand.Float64() * float64(spread))
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	rand.Shuffle(len(checks), func(i, j int) { checks[i], checks[j] = checks[j], checks[i] })
+	start := time.Now()
+	for i, h := range checks {
+		if d := time.Until(start.Add(offsets[i])); d > 0 && !sleep(stop, d) {
+			return
+		}
+		if !atomic.CompareAndSwapInt32(&h.grpcConn.checking, 0, 1) {
+			continue
+		}
+		slots <- struct{}{}
+		go func(h *connHealth) {
+			defer func() {
+				atomic.StoreInt32(&h.grpcConn.checking, 0)
+				<-slots
+			}()
+			check(h)
+		}(h)
+	}
+}
@@ -0,0 +1,127 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// healthChecks - n checks of distinct connections
+func healthChecks(n int) []*connHealth {
+	checks := make([]*connHealth, n)
+	for i := range checks {
+		checks[i] = &connHealth{grpcConn: &GrpcConnection{podName: fmt.Sprintf("svc-%d", i)}}
+	}
+	return checks
+}
+
+func TestHealthChecksBounded(t *testing.T) {
+	var running, peak int32
+	var wg sync.WaitGroup
+	wg.Add(20)
+	runHealthChecks(nil, healthChecks(20), 0, make(chan struct{}, 4), func(*connHealth) {
+		defer wg.Done()
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+	wg.Wait()
+	if peak > 4 {
+		t.Errorf("%d concurrent checks, want at most 4", peak)
+	}
+}
+
+func TestHealthChecksSpread(t *testing.T) {
+	var mutex sync.Mutex
+	var starts []time.Duration
+	start := time.Now()
+	runHealthChecks(nil, healthChecks(50), 100*time.Millisecond, make(chan struct{}, 50), func(*connHealth) {
+		mutex.Lock()
+		starts = append(starts, time.Since(start))
+		mutex.Unlock()
+	})
+	if d := time.Since(start); d < 50*time.Millisecond || d > time.Second {
+		t.Errorf("round took %v, want the checks spread over about 100ms", d)
+	}
+	time.Sleep(10 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	early := 0
+	for _, s := range starts {
+		if s < 10*time.Millisecond {
+			early++
+		}
+	}
+	if len(starts) != 50 || early > 25 {
+		t.Errorf("%d checks started, %d within the first 10ms; want 50 spread over the round", len(starts), early)
+	}
+}
+
+func TestHealthChecksSkipRunning(t *testing.T) {
+	checks := healthChecks(2)
+	running, idle := checks[0].grpcConn, checks[1].grpcConn
+	atomic.StoreInt32(&running.checking, 1)
+	var checked int32
+	done := make(chan struct{}, 2)
+	runHealthChecks(nil, checks, 0, make(chan struct{}, 2), func(h *connHealth) {
+		atomic.AddInt32(&checked, 1)
+		done <- struct{}{}
+	})
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&checked); n != 1 {
+		t.Errorf("%d checks ran, want 1: the connection with a running check is skipped", n)
+	}
+	if atomic.LoadInt32(&idle.checking) != 0 {
+		t.Error("checking flag not reset after the check")
+	}
+}
+
+func TestAdaptiveHealthChecks(t *testing.T) {
+	p := testPool(t, 1, WithAdaptiveHealthChecks(200*time.Millisecond, time.Second))
+	gc := p.grpcConnection[0]
+	a := p.config.adaptiveChecks
+	now := time.Now()
+	if !gc.checkDue(a, now) {
+		t.Fatal("new connection not due")
+	}
+	if gc.checkDue(a, now.Add(100*time.Millisecond)) {
+		t.Error("checked again before the minimum interval")
+	}
+	// Healthy connections back off up to the maximum
+	for _, want := range []time.Duration{400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		gc.checkPassed(a)
+		if got := gc.Stats().CheckInterval; got != want {
+			t.Errorf("interval after a passed check = %v, want %v", got, want)
+		}
+	}
+	now = now.Add(time.Second)
+	if !gc.checkDue(a, now) || gc.checkDue(a, now.Add(500*time.Millisecond)) {
+		t.Error("not checked at the maximum interval")
+	}
+	// A failed RPC makes the connection due right away at the minimum interval
+	gc.setLastError(errors.New("failed"))
+	if !gc.checkDue(a, now.Add(500*time.Millisecond)) || gc.Stats().CheckInterval != 200*time.Millisecond {
+		t.Errorf("failing connection not checked at the minimum interval, interval %v", gc.Stats().CheckInterval)
+	}
+	gc.checkPassed(a)
+	if got := gc.Stats().CheckInterval; got != 200*time.Millisecond {
+		t.Errorf("interval of a suspect connection = %v, want the minimum", got)
+	}
+
+	// Without the option every second
+	plain := testPool(t, 1).grpcConnection[0]
+	if !plain.checkDue(nil, now) || plain.checkDue(nil, now.Add(999*time.Millisecond)) ||
+		!plain.checkDue(nil, now.Add(time.Second)) {
+		t.Error("default connection not checked every second")
+	}
+}
@@ -0,0 +1,89 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// errNotInPool - The connection reported unhealthy is not in an open pool
+var errNotInPool = errors.New("connection not in pool")
+
+// healthWatchRetry - Delay before a broken health Watch stream is opened again; the connection is pinged meanwhile
+const healthWatchRetry = time.Second
+
+// WithHealthWatch - For services implementing grpc.health.v1.Health: every connection opens a Watch stream for the
+// health of service ("" for the server as a whole) instead of being pinged every second. Health transitions are pushed
+// by the server, a status other than SERVING removes the connection right away. While a stream is not established
+// (eg the connection is still dialing) the connection is pinged as usual; servers without the Watch method (Unimplemented)
+// are pinged for the lifetime of the connection.
+func WithHealthWatch(service string) PoolOption {
+	return func(c *poolConfig) {
+		c.healthWatch = true
+		c.healthService = service
+	}
+}
+
+// isWatched - True while the health of the connection is reported by a Watch stream
+func (c *GrpcConnection) isWatched() bool {
+	return atomic.LoadInt32(&c.watching) == 1
+}
+
+// watchHealth - Follows the health of the connection through the Watch stream until the connection fails its health,
+// shuts down or the pool is closed
+func (c *GrpcConnection) watchHealth(ctx context.Context, service string) {
+	client := healthpb.NewHealthClient(c.conn)
+	for ctx.Err() == nil && c.state() != connectivity.Shutdown {
+		err := c.watchStream(ctx, client, service)
+		atomic.StoreInt32(&c.watching, 0)
+		if err == nil {
+			// Reported unhealthy
+			return
+		}
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("INFO: watchHealth(): %s of %s does not implement the health Watch, pinging instead",
+				c.describe(), c.serviceName)
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(healthWatchRetry):
+		}
+	}
+}
+
+// watchStream - Runs a single Watch stream. Returns nil once the connection was reported unhealthy, otherwise the
+// error which ended the stream.
+func (c *GrpcConnection) watchStream(ctx context.Context, client healthpb.HealthClient, service string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(internalCall(ctx), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if resp.Status == healthpb.HealthCheckResponse_SERVING {
+			atomic.StoreInt32(&c.watching, 1)
+			continue
+		}
+		if c.health() == nil {
+			// Not yet or no longer in the pool, the watch ends once the connection is closed
+			return errNotInPool
+		}
+		atomic.AddUint64(&c.pingFailures, 1)
+		unhealthy(c, c.pool.pingBackoff(), fmt.Errorf("health watch: %v", resp.Status))
+		return nil
+	}
+}
@@ -0,0 +1,101 @@
+package kubegrpc
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// pingCounter - okBalancer counting the pings
+type pingCounter struct {
+	okBalancer
+	pings int64
+}
+
+func (b *pingCounter) Ping(interface{}) error {
+	atomic.AddInt64(&b.pings, 1)
+	return nil
+}
+
+// healthServer - Starts a grpc server on localhost, with the health service if hs is not nil. Returns the port.
+func healthServer(t *testing.T, hs *health.Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	if hs != nil {
+		healthpb.RegisterHealthServer(s, hs)
+	}
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// waitWatched - Waits until the health of the connection is reported by its Watch stream
+func waitWatched(gc *GrpcConnection, want bool) bool {
+	for i := 0; i < 200 && gc.isWatched() != want; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return gc.isWatched() == want
+}
+
+func TestHealthWatch(t *testing.T) {
+	hs := health.NewServer()
+	port := healthServer(t, hs)
+	serviceName := "svc.ns:" + port
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"))
+	b := &pingCounter{}
+	c := newConnection(b, newPoolConfig([]PoolOption{WithHealthWatch("")}))
+	mutex.Lock()
+	setPool(serviceName, c)
+	mutex.Unlock()
+	defer ClosePool(serviceName)
+	if err := updateConnectionPool(serviceName, c, true); err != nil {
+		t.Fatal(err)
+	}
+	gc := ListPool(serviceName)[0]
+	if !waitWatched(gc, true) {
+		t.Fatal("health Watch stream not established")
+	}
+	pings := atomic.LoadInt64(&b.pings)
+	time.Sleep(1200 * time.Millisecond)
+	if got := atomic.LoadInt64(&b.pings); got != pings {
+		t.Errorf("%d pings of a watched connection, want none", got-pings)
+	}
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if n := poolSize(c, 0); n != 0 {
+		t.Errorf("pool size after NOT_SERVING = %d, want 0", n)
+	}
+}
+
+func TestHealthWatchUnimplemented(t *testing.T) {
+	port := healthServer(t, nil)
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithHealthWatch("")}))
+	gc, err := newGrpcConnection("svc.ns:"+port, p, testPod("svc-0", "ns", "svc", "127.0.0.1"), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.conn.Close()
+	done := make(chan struct{})
+	go func() {
+		gc.watchHealth(p.poolContext(), "")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watchHealth() still running against a server without the health service")
+	}
+	if gc.isWatched() {
+		t.Error("connection reported as watched")
+	}
+}
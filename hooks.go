@@ -0,0 +1,133 @@
+package kubegrpc
+
+import (
+	"sync"
+	"time"
+)
+
+// hookRecheck - Interval at which an active OnPoolEmpty hook looks for the end of ejections and exclusions, which
+// end by time without an event
+const hookRecheck = time.Second
+
+// PoolHook - Called when a pool condition starts (active true) or ends (active false), with the number of connections
+// in the pool at that moment: the usable ones for OnPoolEmpty, all of them for OnDegraded
+type PoolHook func(serviceName string, active bool, connections int)
+
+// poolHook - Registered hook. Wake ups are coalesced: the hook always sees the latest state of the pool, short flaps in
+// between may be skipped.
+type poolHook struct {
+	serviceName string
+	condition   func(c *connection) (bool, int) // Evaluated with mutex held, returns the connections counted
+	f           PoolHook
+	recheck     time.Duration // Evaluated again after this while active, 0 only on wake ups
+	wake        chan struct{}
+	done        chan struct{}
+	once        sync.Once
+}
+
+var (
+	hooks      = make(map[string][]*poolHook)
+	hooksMutex = &sync.Mutex{}
+)
+
+// OnPoolEmpty - Registers f to be called when the pool of the service runs out of usable connections (all pods gone,
+// failing their health checks, draining, or ejected or excluded after failures) and when it has usable connections
+// again. Lets applications flip their readiness or shed load before RPCs start failing. Hooks run on their own go
+// routine, one call at a time. Call the returned function to unregister.
+func OnPoolEmpty(serviceName string, f PoolHook) (cancel func()) {
+	return addHook(serviceName, f, hookRecheck, func(c *connection) (bool, int) {
+		n := healthyConnections(c)
+		return n == 0, n
+	})
+}
+
+// OnDegraded - Registers f to be called when the pool of the service drops below its minimum healthy connections (see
+// WithMinHealthy) and when it recovers. Hooks run on their own go routine, one call at a time. Call the returned
+// function to unregister.
+func OnDegraded(serviceName string, f PoolHook) (cancel func()) {
+	return addHook(serviceName, f, 0, func(c *connection) (bool, int) {
+		return c.degraded, len(c.grpcConnection)
+	})
+}
+
+// addHook - Registers the hook and starts its go routine. The hook is woken once right away, so it is called if the
+// condition already holds.
+func addHook(serviceName string, f PoolHook, recheck time.Duration, condition func(c *connection) (bool, int)) func() {
+	h := &poolHook{
+		serviceName: serviceName,
+		condition:   condition,
+		f:           f,
+		recheck:     recheck,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	hooksMutex.Lock()
+	hooks[serviceName] = append(hooks[serviceName], h)
+	hooksMutex.Unlock()
+	go h.run()
+	h.notify()
+	return h.cancel
+}
+
+// notifyHooks - Wakes the hooks of the service after a change of the pool, never blocks
+func notifyHooks(serviceName string) {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+	for _, h := range hooks[serviceName] {
+		h.notify()
+	}
+}
+
+func (h *poolHook) notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run - Evaluates the condition on every wake up and calls the hook on transitions
+func (h *poolHook) run() {
+	active := false
+	for {
+		var recheck <-chan time.Time
+		if active && h.recheck > 0 {
+			recheck = time.After(h.recheck)
+		}
+		select {
+		case <-h.done:
+			return
+		case <-h.wake:
+		case <-recheck:
+		}
+		mutex.RLock()
+		c := connectionCache[h.serviceName]
+		now, n := false, 0
+		if c != nil {
+			now, n = h.condition(c)
+		}
+		mutex.RUnlock()
+		if now != active {
+			active = now
+			h.f(h.serviceName, active, n)
+		}
+	}
+}
+
+// cancel - Unregisters the hook and stops its go routine
+func (h *poolHook) cancel() {
+	h.once.Do(func() {
+		hooksMutex.Lock()
+		defer hooksMutex.Unlock()
+		registered := hooks[h.serviceName]
+		for k, v := range registered {
+			if v == h {
+				hooks[h.serviceName] = append(registered[:k], registered[k+1:]...)
+				break
+			}
+		}
+		if len(hooks[h.serviceName]) == 0 {
+			delete(hooks, h.serviceName)
+		}
+		close(h.done)
+	})
+}
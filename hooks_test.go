@@ -0,0 +1,94 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// hookCall - Arguments of a PoolHook call
+type hookCall struct {
+	active      bool
+	connections int
+}
+
+// recordHook - Returns a hook sending its calls on the channel
+func recordHook() (PoolHook, chan hookCall) {
+	calls := make(chan hookCall, 10)
+	return func(serviceName string, active bool, connections int) {
+		calls <- hookCall{active, connections}
+	}, calls
+}
+
+func waitHook(t *testing.T, calls chan hookCall) hookCall {
+	t.Helper()
+	select {
+	case c := <-calls:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("hook not called")
+	}
+	return hookCall{}
+}
+
+func TestOnPoolEmpty(t *testing.T) {
+	p := testPool(t, 1)
+	cachePool(t, p)
+	f, calls := recordHook()
+	cancel := OnPoolEmpty("svc.ns:1000", f)
+	defer cancel()
+	dirtyConnections.push(p.grpcConnection[0])
+	if c := waitHook(t, calls); !c.active || c.connections != 0 {
+		t.Errorf("hook call = %+v, want empty", c)
+	}
+	gc, err := newGrpcConnection("svc.ns:1000", p, testPod("svc-2", "ns", "svc", "10.0.0.2"), "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	p.grpcConnection = append(p.grpcConnection, gc)
+	updateDegraded("svc.ns:1000", p)
+	mutex.Unlock()
+	if c := waitHook(t, calls); c.active || c.connections != 1 {
+		t.Errorf("hook call = %+v, want not empty with 1 connection", c)
+	}
+}
+
+func TestOnDegradedCurrentState(t *testing.T) {
+	p := testPool(t, 1, WithMinHealthy(2))
+	cachePool(t, p)
+	mutex.Lock()
+	updateDegraded("svc.ns:1000", p)
+	mutex.Unlock()
+	f, calls := recordHook()
+	cancel := OnDegraded("svc.ns:1000", f)
+	if c := waitHook(t, calls); !c.active || c.connections != 1 {
+		t.Errorf("hook call = %+v, want degraded with 1 connection", c)
+	}
+	cancel()
+	cancel()
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+	if len(hooks["svc.ns:1000"]) != 0 {
+		t.Error("hook still registered after cancel")
+	}
+}
+
+func TestOnPoolEmptyUsable(t *testing.T) {
+	p := testPool(t, 2)
+	cachePool(t, p)
+	f, calls := recordHook()
+	cancel := OnPoolEmpty("svc.ns:1000", f)
+	defer cancel()
+	// Draining and excluded connections are still in the pool, but no longer picked
+	startDrain(p.grpcConnection[0])
+	select {
+	case c := <-calls:
+		t.Fatalf("hook call = %+v with a usable connection left", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.grpcConnection[1].ReportFailure(errors.New("corrupt response"))
+	if c := waitHook(t, calls); !c.active || c.connections != 0 {
+		t.Errorf("hook call = %+v, want empty without usable connections", c)
+	}
+}
@@ -0,0 +1,194 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+)
+
+var (
+	// informerFactory - Shared informers of the application the discovery of the local cluster reads from, nil
+	// without SetInformerFactory. Protected by informerMutex.
+	informerFactory informers.SharedInformerFactory
+	informerMutex   = &sync.RWMutex{}
+)
+
+// SetInformerFactory - Reuses the shared informers of an application which already runs them: the discovery of the
+// local cluster reads the services, pods and endpoints from the caches of the factory instead of listing them from
+// the API server, which saves the API load and the watch connections of a second copy. The informers are registered
+// with the factory right away, so call it before factory.Start (or call Start again). Until an informer synced, and
+// for lookups a cache can not answer (field selectors), the API server is asked. The factory must cover the
+// namespaces of the pools and must not filter the objects (NewSharedInformerFactory, or WithNamespace for pools of
+// one namespace). nil goes back to the API server.
+func SetInformerFactory(factory informers.SharedInformerFactory) {
+	if factory != nil {
+		core := factory.Core().V1()
+		core.Services().Informer()
+		core.Pods().Informer()
+		core.Endpoints().Informer()
+	}
+	informerMutex.Lock()
+	defer informerMutex.Unlock()
+	informerFactory = factory
+}
+
+// withInformers - The clientset reading services, pods and endpoints from the shared informers, if set
+func withInformers(k8s kubernetes.Interface) kubernetes.Interface {
+	informerMutex.RLock()
+	factory := informerFactory
+	informerMutex.RUnlock()
+	if factory == nil {
+		return k8s
+	}
+	return informerClientset{Interface: k8s, informers: factory.Core().V1()}
+}
+
+// informerClientset - Clientset whose core client reads from the shared informers
+type informerClientset struct {
+	kubernetes.Interface
+	informers coreinformers.Interface
+}
+
+func (c informerClientset) CoreV1() typev1.CoreV1Interface {
+	return informerCoreV1{CoreV1Interface: c.Interface.CoreV1(), informers: c.informers}
+}
+
+// informerCoreV1 - Core client answering the gets and lists of services, pods and endpoints from the synced caches,
+// all other calls go to the API server
+type informerCoreV1 struct {
+	typev1.CoreV1Interface
+	informers coreinformers.Interface
+}
+
+func (c informerCoreV1) Services(namespace string) typev1.ServiceInterface {
+	services := c.informers.Services()
+	if !services.Informer().HasSynced() {
+		return c.CoreV1Interface.Services(namespace)
+	}
+	return informerServices{ServiceInterface: c.CoreV1Interface.Services(namespace),
+		lister: services.Lister().Services(namespace)}
+}
+
+func (c informerCoreV1) Pods(namespace string) typev1.PodInterface {
+	pods := c.informers.Pods()
+	if !pods.Informer().HasSynced() {
+		return c.CoreV1Interface.Pods(namespace)
+	}
+	return informerPods{PodInterface: c.CoreV1Interface.Pods(namespace), lister: pods.Lister().Pods(namespace)}
+}
+
+func (c informerCoreV1) Endpoints(namespace string) typev1.EndpointsInterface {
+	endpoints := c.informers.Endpoints()
+	if !endpoints.Informer().HasSynced() {
+		return c.CoreV1Interface.Endpoints(namespace)
+	}
+	return informerEndpoints{EndpointsInterface: c.CoreV1Interface.Endpoints(namespace),
+		lister: endpoints.Lister().Endpoints(namespace)}
+}
+
+// cachedSelector - The label selector of the list options, false if a cache can not answer the list
+func cachedSelector(opts metav1.ListOptions) (labels.Selector, bool) {
+	if opts.FieldSelector != "" {
+		return nil, false
+	}
+	selector, err := labels.Parse(opts.LabelSelector)
+	return selector, err == nil
+}
+
+// informerServices - Services of a namespace from the cache. The objects of the cache are shared, callers get copies.
+type informerServices struct {
+	typev1.ServiceInterface
+	lister listersv1.ServiceNamespaceLister
+}
+
+func (s informerServices) Get(_ context.Context, name string, _ metav1.GetOptions) (*corev1.Service, error) {
+	svc, err := s.lister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return svc.DeepCopy(), nil
+}
+
+func (s informerServices) List(ctx context.Context, opts metav1.ListOptions) (*corev1.ServiceList, error) {
+	selector, cached := cachedSelector(opts)
+	if !cached {
+		return s.ServiceInterface.List(ctx, opts)
+	}
+	svcs, err := s.lister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &corev1.ServiceList{Items: make([]corev1.Service, 0, len(svcs))}
+	for _, svc := range svcs {
+		list.Items = append(list.Items, *svc.DeepCopy())
+	}
+	return list, nil
+}
+
+// informerPods - Pods of a namespace from the cache
+type informerPods struct {
+	typev1.PodInterface
+	lister listersv1.PodNamespaceLister
+}
+
+func (p informerPods) Get(_ context.Context, name string, _ metav1.GetOptions) (*corev1.Pod, error) {
+	pod, err := p.lister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return pod.DeepCopy(), nil
+}
+
+func (p informerPods) List(ctx context.Context, opts metav1.ListOptions) (*corev1.PodList, error) {
+	selector, cached := cachedSelector(opts)
+	if !cached {
+		return p.PodInterface.List(ctx, opts)
+	}
+	pods, err := p.lister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &corev1.PodList{Items: make([]corev1.Pod, 0, len(pods))}
+	for _, pod := range pods {
+		list.Items = append(list.Items, *pod.DeepCopy())
+	}
+	return list, nil
+}
+
+// informerEndpoints - Endpoints of a namespace from the cache
+type informerEndpoints struct {
+	typev1.EndpointsInterface
+	lister listersv1.EndpointsNamespaceLister
+}
+
+func (e informerEndpoints) Get(_ context.Context, name string, _ metav1.GetOptions) (*corev1.Endpoints, error) {
+	endpoints, err := e.lister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return endpoints.DeepCopy(), nil
+}
+
+func (e informerEndpoints) List(ctx context.Context, opts metav1.ListOptions) (*corev1.EndpointsList, error) {
+	selector, cached := cachedSelector(opts)
+	if !cached {
+		return e.EndpointsInterface.List(ctx, opts)
+	}
+	endpoints, err := e.lister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	list := &corev1.EndpointsList{Items: make([]corev1.Endpoints, 0, len(endpoints))}
+	for _, ep := range endpoints {
+		list.Items = append(list.Items, *ep.DeepCopy())
+	}
+	return list, nil
+}
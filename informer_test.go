@@ -0,0 +1,47 @@
+package kubegrpc
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSetInformerFactory(t *testing.T) {
+	useFakeClientset(t, testService("cached", "ns"), testPod("cached-0", "ns", "cached", "10.0.0.1"),
+		testPod("cached-1", "ns", "cached", "10.0.0.2"), testPod("other-0", "ns", "other", "10.0.0.3"))
+	cs := clientset.(*fake.Clientset)
+	factory := informers.NewSharedInformerFactory(cs, 0)
+	SetInformerFactory(factory)
+	defer SetInformerFactory(nil)
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	for informer, synced := range factory.WaitForCacheSync(stop) {
+		if !synced {
+			t.Fatalf("informer %v not synced", informer)
+		}
+	}
+
+	// From now on the discovery must not reach the API server
+	apiCalls := 0
+	cs.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() == "get" || action.GetVerb() == "list" {
+			apiCalls++
+		}
+		return false, nil, nil
+	})
+	defer ClosePool("cached.ns:1000")
+	if _, err := ConnectWithOptions("cached.ns:1000", okBalancer{}, WithRefreshInterval(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := targets(Connections("cached.ns:1000")); len(got) != 2 || got[0] != "10.0.0.1:1000" || got[1] != "10.0.0.2:1000" {
+		t.Errorf("pool = %v, want the pods of the service from the cache", got)
+	}
+	if apiCalls != 0 {
+		t.Errorf("%d reads from the API server, want all from the informers", apiCalls)
+	}
+}
@@ -0,0 +1,151 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// recentFailureWindow - Connections which failed a ping or RPC within this window are not used for retries and hedges
+const recentFailureWindow = 5 * time.Second
+
+// unaryInterceptor - Installed on every connection of the pool. Observes the RPC results of the endpoint and applies
+// the mirror, retry and hedging policies of the pool.
+func (c *GrpcConnection) unaryInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if endpoint := peerEndpoint(opts); endpoint != nil {
+		served := &servedEndpoint{}
+		ctx = context.WithValue(ctx, servedEndpointKey{}, served)
+		defer served.copyTo(endpoint)
+	}
+	if c.pool != nil && c.pool.config.mirrorPolicy != nil {
+		c.mirror(ctx, method, req, reply, invoker)
+	}
+	if c.pool != nil && c.pool.config.retryPolicy != nil {
+		p := c.pool.config.retryPolicy
+		if matchMethod(p.HedgedMethods, method) {
+			return c.hedge(ctx, method, req, reply, invoker, opts...)
+		}
+		if matchMethod(p.IdempotentMethods, method) {
+			return c.retry(ctx, method, req, reply, invoker, opts...)
+		}
+	}
+	return c.invoke(ctx, method, req, reply, invoker, opts...)
+}
+
+// internalCallKey - Marks the context of the streams the library opens itself (health and lameduck Watch, reflection
+// check), which are no streams of the application
+type internalCallKey struct{}
+
+// internalCall - The context for a stream opened by the library on a connection of the pool
+func internalCall(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalCallKey{}, true)
+}
+
+// isInternalCall - Whether the stream is opened by the library
+func isInternalCall(ctx context.Context) bool {
+	internal, _ := ctx.Value(internalCallKey{}).(bool)
+	return internal
+}
+
+// streamInterceptor - Installed on every connection of the pool, observes and traces the stream setup and tracks the
+// open streams. The streams of the library are not tracked, drained or moved.
+func (c *GrpcConnection) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if isInternalCall(ctx) {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	ctx, finish := c.startSpan(ctx, method)
+	ctx, cancel := context.WithCancel(ctx)
+	s, err := streamer(c.endpointMetadata(ctx), desc, cc, method, opts...)
+	finish(err)
+	c.record(err, -1)
+	c.observe(err)
+	if err != nil {
+		cancel()
+	} else {
+		c.trackStream(s, method, cancel)
+	}
+	if endpoint := peerEndpoint(opts); endpoint != nil {
+		*endpoint = c.Info()
+	}
+	return s, err
+}
+
+// invoke - Runs a single attempt of the RPC on this connection
+func (c *GrpcConnection) invoke(ctx context.Context, method string, req, reply interface{},
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var trailer metadata.MD
+	loadMetric := ""
+	if c.pool != nil {
+		loadMetric = c.pool.config.loadMetric
+	}
+	if loadMetric != "" {
+		opts = append(opts[:len(opts):len(opts)], grpc.Trailer(&trailer))
+	}
+	atomic.AddInt64(&c.inFlight, 1)
+	ctx, finish := c.startSpan(ctx, method)
+	start := time.Now()
+	err := invoker(c.endpointMetadata(ctx), method, req, reply, c.conn, opts...)
+	c.served(ctx, err)
+	c.record(err, time.Since(start))
+	if loadMetric != "" {
+		c.reportLoad(trailer, loadMetric)
+	}
+	finish(err)
+	atomic.AddInt64(&c.inFlight, -1)
+	c.observe(err)
+	return err
+}
+
+// observe - Feeds the RPC result to the circuit breaker and the failure tracking
+func (c *GrpcConnection) observe(err error) {
+	if isFailure(err) {
+		c.setLastError(err)
+	}
+	if c.breaker.record(err) {
+		decideEviction(c, "ejected by circuit breaker: "+err.Error())
+		emitEndpoint(EndpointUnhealthy, c, 0, "ejected by circuit breaker: "+err.Error())
+	}
+}
+
+// recentlyFailed - True if the connection failed a ping or RPC within the recentFailureWindow
+func (c *GrpcConnection) recentlyFailed() bool {
+	last := atomic.LoadInt64(&c.lastFailure)
+	return last != 0 && time.Since(time.Unix(0, last)) < recentFailureWindow
+}
+
+// alternative - Picks a connection of the pool for a retry or hedge: not yet tried in this call, not ejected and not
+// recently failed. Returns nil if there is none.
+func (p *connection) alternative(tried map[*GrpcConnection]bool) *GrpcConnection {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	candidates := make([]*GrpcConnection, 0, len(p.grpcConnection))
+	for _, gc := range p.grpcConnection {
+		if tried[gc] || gc.isDraining() || gc.recentlyFailed() || gc.weight() == 0 {
+			continue
+		}
+		candidates = append(candidates, gc)
+	}
+	candidates = leaderConnections(p, candidates)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return pickConnection(candidates[0].serviceName, candidates)
+}
+
+// endpointError - Last failure of a connection
+type endpointError struct {
+	message string
+	at      time.Time
+}
+
+// setLastError - Records the failed ping or RPC
+func (c *GrpcConnection) setLastError(err error) {
+	now := time.Now()
+	atomic.StoreInt64(&c.lastFailure, now.UnixNano())
+	c.lastError.Store(endpointError{message: err.Error(), at: now})
+}
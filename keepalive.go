@@ -0,0 +1,40 @@
+package kubegrpc
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// defaultKeepaliveTime - Idle time before a keepalive ping: below the idle timeouts of the common NAT gateways and
+	// load balancers (350s and up), and not below the 5 minutes a grpc-go server accepts by default
+	defaultKeepaliveTime = 5 * time.Minute
+	// defaultKeepaliveTimeout - Time to wait for the ack of a keepalive ping before the connection is closed
+	defaultKeepaliveTimeout = 20 * time.Second
+)
+
+// defaultKeepalive - Keepalive of the pools without WithKeepalive
+var defaultKeepalive = keepalive.ClientParameters{Time: defaultKeepaliveTime, Timeout: defaultKeepaliveTimeout}
+
+// WithKeepalive - Sets the HTTP/2 keepalive of the connections of the pool. Keepalive pings detect half-open
+// connections, eg dropped by a NAT or conntrack table, independent of the Ping of the balancer: a connection without
+// ack within Timeout goes to TRANSIENT_FAILURE, which triggers an immediate health check of the connection. The default
+// pings after 5 minutes without activity, with a timeout of 20 seconds, and only while RPCs are in progress
+// (PermitWithoutStream false). Servers with a relaxed keepalive enforcement policy (MinTime, PermitWithoutStream) allow
+// shorter times; a server with a stricter policy closes the connection with too_many_pings and the client doubles
+// Time. A zero Time disables the keepalive.
+func WithKeepalive(params keepalive.ClientParameters) PoolOption {
+	return func(c *poolConfig) {
+		c.keepalive = params
+	}
+}
+
+// keepaliveOption - Dial option of the keepalive of the pool, nil if disabled
+func (c poolConfig) keepaliveOption() grpc.DialOption {
+	if c.keepalive.Time <= 0 {
+		return nil
+	}
+	return grpc.WithKeepaliveParams(c.keepalive)
+}
@@ -0,0 +1,26 @@
+package kubegrpc
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestKeepalive(t *testing.T) {
+	c := newPoolConfig(nil)
+	if c.keepalive.Time != 5*time.Minute || c.keepalive.Timeout != 20*time.Second || c.keepalive.PermitWithoutStream {
+		t.Errorf("default keepalive = %+v", c.keepalive)
+	}
+	if c.keepaliveOption() == nil {
+		t.Error("no keepalive dial option by default")
+	}
+	params := keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 5 * time.Second, PermitWithoutStream: true}
+	if c := newPoolConfig([]PoolOption{WithKeepalive(params)}); c.keepalive != params {
+		t.Errorf("keepalive = %+v, want %+v", c.keepalive, params)
+	}
+	if c := newPoolConfig([]PoolOption{WithKeepalive(keepalive.ClientParameters{})}); c.keepaliveOption() != nil {
+		t.Error("keepalive dial option with a zero Time")
+	}
+	testPool(t, 1, WithKeepalive(params))
+}
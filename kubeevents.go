@@ -0,0 +1,203 @@
+package kubegrpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KubernetesEvents - Object the Kubernetes Events of the pools are recorded on, see SetKubernetesEvents
+type KubernetesEvents int32
+
+// Objects of the Kubernetes Events
+const (
+	NoKubernetesEvents KubernetesEvents = iota // No Events are recorded, the default
+	EventsOnPod                                // The pod running this code: POD_NAME (downward API) or the hostname
+	EventsOnService                            // The service of the pool, in the cluster of the pool
+)
+
+const (
+	// reasonPoolClosed - Reason of the EndpointRemoved events of ClosePool
+	reasonPoolClosed = "pool closed"
+	// kubeEventsBufferSize - Pool events waiting to be recorded, further events are dropped
+	kubeEventsBufferSize = 64
+	// kubeEventsInterval - The same state change of a pool is recorded at most once per interval
+	kubeEventsInterval = time.Minute
+	// kubeEventsComponent - Source of the recorded Events
+	kubeEventsComponent = "kube-grpc"
+)
+
+var (
+	kubeEventsTarget int32 // atomic KubernetesEvents
+	kubeEventsQueue  = make(chan PoolEvent, kubeEventsBufferSize)
+	kubeEventsMutex  = &sync.Mutex{}
+	// kubeEventsEmpty - Pools which lost all connections, protected by kubeEventsMutex
+	kubeEventsEmpty = make(map[string]bool)
+	// kubeEventsRecorded - Last recording per pool and reason, protected by kubeEventsMutex
+	kubeEventsRecorded = make(map[string]time.Time)
+	// createEvent - Creates the Event, replaced in tests
+	createEvent = func(serviceName string, event *corev1.Event) error {
+		k8s, err := kubeEventsClientset(serviceName, event)
+		if err != nil {
+			return err
+		}
+		_, err = k8s.CoreV1().Events(event.Namespace).Create(context.Background(), event, metav1.CreateOptions{})
+		return err
+	}
+)
+
+// SetKubernetesEvents - Records Kubernetes Events when a pool becomes empty (PoolEmpty), degrades below WithMinHealthy
+// (PoolDegraded) or recovers (PoolRecovered), so operators see client side connectivity problems in `kubectl describe`
+// of the consuming pod or of the target service. The same change of a pool is recorded at most once a minute. Requires
+// the RBAC permission to create events in the namespace of the object. NoKubernetesEvents stops the recording.
+func SetKubernetesEvents(target KubernetesEvents) {
+	atomic.StoreInt32(&kubeEventsTarget, int32(target))
+}
+
+// queueKubernetesEvent - Hands the pool event to recordKubernetesEvents without blocking, if Events are recorded
+func queueKubernetesEvent(e PoolEvent) {
+	if KubernetesEvents(atomic.LoadInt32(&kubeEventsTarget)) == NoKubernetesEvents {
+		return
+	}
+	switch e.Type {
+	case EndpointAdded, EndpointRemoved, PoolDegraded, PoolRecovered, PoolClosed:
+	default:
+		return
+	}
+	select {
+	case kubeEventsQueue <- e:
+	default:
+	}
+}
+
+// recordKubernetesEvents - Records the queued pool events until stop is closed
+func recordKubernetesEvents(stop <-chan struct{}) {
+	defer maintenance.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-kubeEventsQueue:
+			target := KubernetesEvents(atomic.LoadInt32(&kubeEventsTarget))
+			if event := kubernetesEvent(e, target); event != nil {
+				if err := createEvent(e.ServiceName, event); err != nil {
+					log.Printf("WARNING: recordKubernetesEvents(): Could not record %s of %s. Error: %v",
+						event.Reason, e.ServiceName, err)
+				}
+			}
+		}
+	}
+}
+
+// kubeEventReasons - Reasons of the recorded Events, the keys of kubeEventsRecorded per pool
+var kubeEventReasons = []string{"PoolEmpty", "PoolDegraded", "PoolRecovered"}
+
+// forgetKubernetesEvents - Drops the recording state of the service once its pool is closed
+func forgetKubernetesEvents(serviceName string) {
+	kubeEventsMutex.Lock()
+	defer kubeEventsMutex.Unlock()
+	dropKubernetesEvents(serviceName)
+}
+
+// dropKubernetesEvents - Drops the recording state of the service. Caller must hold kubeEventsMutex.
+func dropKubernetesEvents(serviceName string) {
+	delete(kubeEventsEmpty, serviceName)
+	for _, reason := range kubeEventReasons {
+		delete(kubeEventsRecorded, serviceName+"/"+reason)
+	}
+}
+
+// kubernetesEvent - The Event to record for the pool event, nil if the event is not recorded
+func kubernetesEvent(e PoolEvent, target KubernetesEvents) *corev1.Event {
+	var eventType, reason, message string
+	kubeEventsMutex.Lock()
+	switch e.Type {
+	case EndpointRemoved:
+		if e.Connections == 0 && e.Reason != reasonPoolClosed && !kubeEventsEmpty[e.ServiceName] {
+			kubeEventsEmpty[e.ServiceName] = true
+			eventType, reason = corev1.EventTypeWarning, "PoolEmpty"
+			message = fmt.Sprintf("Pool %s has no connections left", e.ServiceName)
+		}
+	case EndpointAdded:
+		if kubeEventsEmpty[e.ServiceName] {
+			delete(kubeEventsEmpty, e.ServiceName)
+			eventType, reason = corev1.EventTypeNormal, "PoolRecovered"
+			message = fmt.Sprintf("Pool %s recovered: %d connections", e.ServiceName, e.Connections)
+		}
+	case PoolDegraded:
+		eventType, reason = corev1.EventTypeWarning, "PoolDegraded"
+		message = fmt.Sprintf("Pool %s degraded: %d connections", e.ServiceName, e.Connections)
+	case PoolRecovered:
+		eventType, reason = corev1.EventTypeNormal, "PoolRecovered"
+		message = fmt.Sprintf("Pool %s recovered: %d connections", e.ServiceName, e.Connections)
+	case PoolClosed:
+		dropKubernetesEvents(e.ServiceName)
+	}
+	if reason == "" {
+		kubeEventsMutex.Unlock()
+		return nil
+	}
+	key := e.ServiceName + "/" + reason
+	if last, found := kubeEventsRecorded[key]; found && e.Time.Sub(last) < kubeEventsInterval {
+		kubeEventsMutex.Unlock()
+		return nil
+	}
+	kubeEventsRecorded[key] = e.Time
+	kubeEventsMutex.Unlock()
+
+	object, ok := kubeEventsObject(e.ServiceName, target)
+	if !ok {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	at := metav1.NewTime(e.Time)
+	return &corev1.Event{
+		ObjectMeta:          metav1.ObjectMeta{GenerateName: object.Name + ".", Namespace: object.Namespace},
+		InvolvedObject:      object,
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: kubeEventsComponent, Host: hostname},
+		FirstTimestamp:      at,
+		LastTimestamp:       at,
+		Count:               1,
+		ReportingController: kubeEventsComponent,
+		ReportingInstance:   hostname,
+	}
+}
+
+// kubeEventsObject - The object the Events of the pool are recorded on, false if it can not be determined
+func kubeEventsObject(serviceName string, target KubernetesEvents) (corev1.ObjectReference, bool) {
+	switch target {
+	case EventsOnPod:
+		name := os.Getenv("POD_NAME")
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		namespace := clientNamespace()
+		return corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Name: name, Namespace: namespace},
+			name != "" && namespace != ""
+	case EventsOnService:
+		name, namespace, _, err := parseServiceName(serviceName)
+		return corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Name: name, Namespace: namespace},
+			err == nil && namespace != ""
+	}
+	return corev1.ObjectReference{}, false
+}
+
+// kubeEventsClientset - The clientset recording the Event: Events on the service are recorded in the cluster of the
+// pool, Events on the pod in the local cluster
+func kubeEventsClientset(serviceName string, event *corev1.Event) (kubernetes.Interface, error) {
+	if event.InvolvedObject.Kind == "Service" {
+		return clientsetFor(serviceName)
+	}
+	return getClientset()
+}
@@ -0,0 +1,113 @@
+package kubegrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordedEvents - Records Kubernetes Events on the target for the test, returns the created Events
+func recordedEvents(t *testing.T, target KubernetesEvents) <-chan *corev1.Event {
+	t.Helper()
+	created := make(chan *corev1.Event, 10)
+	previous := createEvent
+	createEvent = func(_ string, event *corev1.Event) error {
+		created <- event
+		return nil
+	}
+	SetKubernetesEvents(target)
+	t.Cleanup(func() {
+		SetKubernetesEvents(NoKubernetesEvents)
+		time.Sleep(10 * time.Millisecond)
+		createEvent = previous
+		kubeEventsMutex.Lock()
+		kubeEventsEmpty = make(map[string]bool)
+		kubeEventsRecorded = make(map[string]time.Time)
+		kubeEventsMutex.Unlock()
+	})
+	return created
+}
+
+// nextEvent - The next created Event, nil if none is created within 200ms
+func nextEvent(created <-chan *corev1.Event) *corev1.Event {
+	select {
+	case e := <-created:
+		return e
+	case <-time.After(200 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestKubernetesEvents(t *testing.T) {
+	created := recordedEvents(t, EventsOnService)
+	emit(PoolEvent{Type: EndpointRemoved, ServiceName: "events.ns:1000", Connections: 1})
+	emit(PoolEvent{Type: EndpointRemoved, ServiceName: "events.ns:1000", Connections: 0})
+	e := nextEvent(created)
+	if e == nil || e.Reason != "PoolEmpty" || e.Type != corev1.EventTypeWarning {
+		t.Fatalf("Event = %+v, want PoolEmpty", e)
+	}
+	if o := e.InvolvedObject; o.Kind != "Service" || o.Name != "events" || o.Namespace != "ns" || e.Namespace != "ns" {
+		t.Errorf("involved object = %+v in %s, want the service", o, e.Namespace)
+	}
+	emit(PoolEvent{Type: EndpointAdded, ServiceName: "events.ns:1000", Connections: 1})
+	if e := nextEvent(created); e == nil || e.Reason != "PoolRecovered" || e.Type != corev1.EventTypeNormal {
+		t.Fatalf("Event = %+v, want PoolRecovered", e)
+	}
+	emit(PoolEvent{Type: EndpointAdded, ServiceName: "events.ns:1000", Connections: 2})
+	emit(PoolEvent{Type: PoolDegraded, ServiceName: "events.ns:1000", Connections: 2})
+	emit(PoolEvent{Type: PoolDegraded, ServiceName: "events.ns:1000", Connections: 1})
+	if e := nextEvent(created); e == nil || e.Reason != "PoolDegraded" {
+		t.Fatalf("Event = %+v, want PoolDegraded", e)
+	}
+	if e := nextEvent(created); e != nil {
+		t.Errorf("Event %s %q recorded twice within a minute", e.Reason, e.Message)
+	}
+}
+
+func TestKubernetesEventsPoolClosed(t *testing.T) {
+	created := recordedEvents(t, EventsOnService)
+	emit(PoolEvent{Type: EndpointRemoved, ServiceName: "events.ns:1000", Reason: reasonPoolClosed})
+	emit(PoolEvent{Type: PoolClosed, ServiceName: "events.ns:1000"})
+	if e := nextEvent(created); e != nil {
+		t.Errorf("Event %s recorded for a closed pool", e.Reason)
+	}
+
+	// Closing the pool forgets its recordings
+	emit(PoolEvent{Type: PoolDegraded, ServiceName: "events.ns:1000", Connections: 1, Time: time.Now()})
+	if e := nextEvent(created); e == nil || e.Reason != "PoolDegraded" {
+		t.Fatalf("Event = %+v, want PoolDegraded", e)
+	}
+	p := testPool(t, 1)
+	mutex.Lock()
+	setPool("events.ns:1000", p)
+	closePool("events.ns:1000", p)
+	mutex.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	kubeEventsMutex.Lock()
+	recorded := len(kubeEventsRecorded)
+	kubeEventsMutex.Unlock()
+	if recorded != 0 {
+		t.Errorf("%d recordings kept after the pool was closed", recorded)
+	}
+}
+
+func TestCreateEvent(t *testing.T) {
+	useFakeClientset(t, testService("events", "ns"))
+	event := kubernetesEvent(PoolEvent{Type: PoolDegraded, ServiceName: "events.ns:1000", Time: time.Now()},
+		EventsOnService)
+	defer func() {
+		kubeEventsMutex.Lock()
+		kubeEventsRecorded = make(map[string]time.Time)
+		kubeEventsMutex.Unlock()
+	}()
+	if err := createEvent("events.ns:1000", event); err != nil {
+		t.Fatal(err)
+	}
+	events, err := clientset.CoreV1().Events("ns").List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(events.Items) != 1 || events.Items[0].Source.Component != kubeEventsComponent {
+		t.Errorf("Events = %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package kubegrpctest - In memory k8s cluster for unit tests of code using kubegrpc. Services and pods are kept in a
+// fake clientset which replaces the discovery of kubegrpc; pods can be added, terminated and deleted at runtime, and
+// the Balancer fails the health checks of chosen pods.
+//
+// Connections are dialed to the fake pod IPs without blocking, so the returned clients are only useful when something
+// listens on those addresses; tests typically assert on the pools (kubegrpc.Connections, kubegrpc.Stats, events).
+package kubegrpctest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Cluster - Fake cluster serving the discovery of kubegrpc
+type Cluster struct {
+	Clientset *fake.Clientset
+}
+
+// NewCluster - Creates an empty cluster and installs it as the discovery of kubegrpc. Close it at the end of the test.
+func NewCluster() *Cluster {
+	c := &Cluster{Clientset: fake.NewSimpleClientset()}
+	kubegrpc.SetClientset(c.Clientset)
+	return c
+}
+
+// Close - Restores the in cluster discovery of kubegrpc
+func (c *Cluster) Close() {
+	kubegrpc.SetClientset(nil)
+}
+
+// AddService - Adds a service selecting the pods labeled app=name
+func (c *Cluster) AddService(name, namespace string) error {
+	_, err := c.Clientset.CoreV1().Services(namespace).Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": name}},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// AddPod - Adds a running pod of the service with the ip. Call kubegrpc.Refresh to apply it to an existing pool.
+func (c *Cluster) AddPod(service, namespace, name, ip string) error {
+	_, err := c.Clientset.CoreV1().Pods(namespace).Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": service},
+			UID: types.UID("uid-" + name)},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip, PodIPs: []corev1.PodIP{{IP: ip}}},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// TerminatePod - Marks the pod as being deleted, as during a rolling deploy: its connections are drained
+func (c *Cluster) TerminatePod(namespace, name string) error {
+	pods := c.Clientset.CoreV1().Pods(namespace)
+	pod, err := pods.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+	_, err = pods.Update(context.Background(), pod, metav1.UpdateOptions{})
+	return err
+}
+
+// DeletePod - Removes the pod, as after a crash or scale down
+func (c *Cluster) DeletePod(namespace, name string) error {
+	return c.Clientset.CoreV1().Pods(namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+}
+
+// Balancer - kubegrpc.GrpcKubeBalancer handing out the *grpc.ClientConn as client. Pings fail for the IPs marked
+// with SetHealthy(ip, false).
+type Balancer struct {
+	mutex     sync.Mutex
+	unhealthy map[string]bool
+}
+
+// NewGrpcClient - Returns the connection as client
+func (b *Balancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) {
+	return conn, nil
+}
+
+// Ping - Fails for unhealthy IPs
+func (b *Balancer) Ping(client interface{}) error {
+	host, _, err := net.SplitHostPort(client.(*grpc.ClientConn).Target())
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.unhealthy[host] {
+		return errUnhealthy
+	}
+	return nil
+}
+
+// SetHealthy - Lets the pings of the pod with the ip pass or fail. A failed ping removes the connection at the next
+// health check (about a second).
+func (b *Balancer) SetHealthy(ip string, healthy bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.unhealthy == nil {
+		b.unhealthy = make(map[string]bool)
+	}
+	b.unhealthy[ip] = !healthy
+}
+
+// errUnhealthy - Ping error of unhealthy pods
+var errUnhealthy = errors.New("kubegrpctest: pod unhealthy")
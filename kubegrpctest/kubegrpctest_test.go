@@ -0,0 +1,66 @@
+package kubegrpctest_test
+
+import (
+	"testing"
+	"time"
+
+	kubegrpc "github.com/norbertvannobelen/kube-grpc"
+	"github.com/norbertvannobelen/kube-grpc/kubegrpctest"
+)
+
+// waitConnections - Waits until the pool of the service holds n connections, returns the last count
+func waitConnections(serviceName string, n int) int {
+	for i := 0; i < 300; i++ {
+		if got := len(kubegrpc.Connections(serviceName)); got == n {
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return len(kubegrpc.Connections(serviceName))
+}
+
+func TestCluster(t *testing.T) {
+	c := kubegrpctest.NewCluster()
+	defer c.Close()
+	if err := c.AddService("echo", "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][2]string{{"echo-0", "10.1.0.1"}, {"echo-1", "10.1.0.2"}, {"echo-2", "10.1.0.3"}} {
+		if err := c.AddPod("echo", "test", p[0], p[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const serviceName = "echo.test:9000"
+	b := &kubegrpctest.Balancer{}
+	if _, err := kubegrpc.Connect(serviceName, b); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer kubegrpc.ClosePool(serviceName)
+	if n := waitConnections(serviceName, 3); n != 3 {
+		t.Fatalf("connections = %d, want 3", n)
+	}
+
+	if err := c.DeletePod("test", "echo-0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubegrpc.Refresh(serviceName); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if n := waitConnections(serviceName, 2); n != 2 {
+		t.Fatalf("connections after DeletePod = %d, want 2", n)
+	}
+
+	b.SetHealthy("10.1.0.2", false)
+	if n := waitConnections(serviceName, 1); n != 1 {
+		t.Fatalf("connections after failed pings = %d, want 1", n)
+	}
+	if got := kubegrpc.Connections(serviceName)[0].Info().IP; got != "10.1.0.3" {
+		t.Errorf("remaining connection = %s, want 10.1.0.3", got)
+	}
+}
+
+func TestRefreshUnknownPool(t *testing.T) {
+	if err := kubegrpc.Refresh("missing.test:9000"); err != kubegrpc.ErrPoolNotFound {
+		t.Errorf("Refresh() error = %v, want ErrPoolNotFound", err)
+	}
+}
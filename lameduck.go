@@ -0,0 +1,149 @@
+package kubegrpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// LameduckService - Service of grpc.health.v1.Health through which a server signals lameduck, see NewLameduck
+const LameduckService = "kubegrpc.lameduck"
+
+// Lameduck - Server side of the connection handoff of a terminating pod: it reports LameduckService SERVING on the
+// health server of the pod until Enter, and NOT_SERVING from then on. The pools with WithLameduck stop picking the pod
+// as soon as it is in lameduck, before kubelet sends SIGTERM, so a rolling deploy does not fail the RPCs picked in
+// between. The health of the server as a whole ("") is left alone.
+type Lameduck struct {
+	health  *health.Server
+	delay   time.Duration
+	entered int32 // atomic, 1 once Enter was called
+}
+
+// NewLameduck - Reports LameduckService SERVING on the health server, which must be registered on the grpc server of
+// the pod. delay is how long Handler holds the preStop hook after the lameduck was entered, for the clients to drain
+// their RPCs to the pod; it has to fit in the termination grace period of the pod.
+func NewLameduck(hs *health.Server, delay time.Duration) *Lameduck {
+	hs.SetServingStatus(LameduckService, healthpb.HealthCheckResponse_SERVING)
+	return &Lameduck{health: hs, delay: delay}
+}
+
+// Enter - Reports LameduckService NOT_SERVING: the pools with WithLameduck drain their connections to the pod. The
+// server keeps serving the RPCs in flight and those of clients without the option. Entering twice is a no-op.
+func (l *Lameduck) Enter() {
+	if atomic.CompareAndSwapInt32(&l.entered, 0, 1) {
+		log.Printf("INFO: Lameduck.Enter(): Reporting %s NOT_SERVING", LameduckService)
+		l.health.SetServingStatus(LameduckService, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Handler - HTTP handler for the preStop hook of the pod, e.g. mux.Handle("/lameduck", lameduck.Handler()) with
+// lifecycle.preStop.httpGet on its path: enters the lameduck and answers 200 after the delay of NewLameduck, so
+// kubelet sends SIGTERM once the clients stopped picking the pod
+func (l *Lameduck) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Enter()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(l.delay):
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "lameduck")
+	})
+}
+
+// WithLameduck - For servers using NewLameduck: every connection watches LameduckService on the health service of its
+// pod, and a pod entering lameduck is drained right away (see WithDrainTimeout) instead of when its termination is
+// seen by the next refresh or its connection fails. The pod is not dialed again while it is listed, and is not backed
+// off as a failure. Servers without the health service or the lameduck are used as usual.
+func WithLameduck() PoolOption {
+	return func(c *poolConfig) {
+		c.lameduck = true
+	}
+}
+
+// watchLameduck - Drains the connection once its pod enters lameduck, until the connection shuts down or is drained,
+// or the pool is closed
+func (c *GrpcConnection) watchLameduck(ctx context.Context) {
+	client := healthpb.NewHealthClient(c.conn)
+	for ctx.Err() == nil && c.state() != connectivity.Shutdown && !c.isDraining() {
+		err := c.lameduckStream(ctx, client)
+		if err == nil {
+			c.enterLameduck()
+			return
+		}
+		if status.Code(err) == codes.Unimplemented {
+			// No health service, the pod can not signal lameduck
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(healthWatchRetry):
+		}
+	}
+}
+
+// lameduckStream - Runs a single Watch stream of LameduckService. Returns nil once the pod of the connection, which is
+// in its pool, entered lameduck, otherwise the error which ended the stream.
+func (c *GrpcConnection) lameduckStream(ctx context.Context, client healthpb.HealthClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(internalCall(ctx), &healthpb.HealthCheckRequest{Service: LameduckService})
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		// SERVICE_UNKNOWN: the server does not use NewLameduck (yet)
+		if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+			continue
+		}
+		if c.health() == nil {
+			// Not yet in the pool, drained once it is
+			return errNotInPool
+		}
+		return nil
+	}
+}
+
+// enterLameduck - Stops picking the connection, drains it and keeps its pod from being dialed again while listed
+func (c *GrpcConnection) enterLameduck() {
+	p := c.pool
+	mutex.Lock()
+	if p.lameducks == nil {
+		p.lameducks = make(map[string]bool)
+	}
+	p.lameducks[c.connectionIP] = true
+	mutex.Unlock()
+	if !startDrain(c) {
+		return
+	}
+	log.Printf("INFO: watchLameduck(): Draining %s for %s: pod in lameduck", c.describe(), c.serviceName)
+	decideEviction(c, "pod in lameduck")
+	finishDrain(c, p.config.drainTimeout)
+}
+
+// inLameduck - Whether the pod of the ip entered lameduck. Caller must hold mutex.
+func (c *connection) inLameduck(ip string) bool {
+	return c.lameducks[ip]
+}
+
+// pruneLameducks - Forgets the pods in lameduck which are no longer listed. Caller must hold mutex.
+func (c *connection) pruneLameducks(listed map[string]bool) {
+	for ip := range c.lameducks {
+		if !listed[ip] {
+			delete(c.lameducks, ip)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package kubegrpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/health"
+)
+
+func TestLameduck(t *testing.T) {
+	hs := health.NewServer()
+	lameduck := NewLameduck(hs, 10*time.Millisecond)
+	port := healthServer(t, hs)
+	serviceName := "svc.ns:" + port
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithLameduck()}))
+	mutex.Lock()
+	setPool(serviceName, c)
+	mutex.Unlock()
+	defer ClosePool(serviceName)
+	if err := updateConnectionPool(serviceName, c, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := poolSize(c, 1); n != 1 {
+		t.Fatalf("pool size = %d, want 1", n)
+	}
+
+	// The preStop hook puts the pod in lameduck: it is drained and not dialed again while listed
+	w := httptest.NewRecorder()
+	lameduck.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lameduck", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler() = %d %q, want 200", w.Code, w.Body.String())
+	}
+	if n := poolSize(c, 0); n != 0 {
+		t.Fatalf("pool size after the lameduck = %d, want 0", n)
+	}
+	if err := updateConnectionPool(serviceName, c, true); err != nil && !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Fatal(err)
+	}
+	if n := poolSize(c, 0); n != 0 {
+		t.Errorf("pool size after a refresh = %d, the pod in lameduck was dialed again", n)
+	}
+	if c.backoff.get("127.0.0.1").Failures != 0 {
+		t.Error("pod in lameduck backed off as a failure")
+	}
+}
+
+func TestLameduckWithoutHelper(t *testing.T) {
+	port := healthServer(t, health.NewServer())
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithLameduck()}))
+	gc, err := newGrpcConnection("svc.ns:"+port, p, testPod("svc-0", "ns", "svc", "127.0.0.1"), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.conn.Close()
+	time.Sleep(200 * time.Millisecond)
+	if gc.isDraining() {
+		t.Error("connection to a server without the lameduck is drained")
+	}
+}
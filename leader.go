@@ -0,0 +1,146 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// defaultLeaderInterval - Poll interval of the leader, see LeaderElection
+const defaultLeaderInterval = 2 * time.Second
+
+// ErrNoLeader - The pool is in leader only mode and has no connection to the leader (no leader elected, or it is not
+// connected yet)
+var ErrNoLeader = errors.New("kubegrpc: no connection to the leader")
+
+// LeaderElection - Identifies the leader of a service where only the elected leader accepts the calls, see
+// WithLeaderOnly
+type LeaderElection struct {
+	Lease     string            // coordination.k8s.io Lease, its holderIdentity (up to a `_`) is the pod name of the leader
+	Namespace string            // Namespace of the Lease, default the namespace of the service
+	Selector  map[string]string // Without Lease: the pod of the service with these labels, eg {"role": "leader"}
+	Interval  time.Duration     // Poll interval of the Lease or the labels, default 2s
+}
+
+// WithLeaderOnly - Sends the picks of the pool exclusively to the elected leader of the service, identified by a Lease
+// or a pod label. The pool stays connected to all pods, so a leader change re-targets the picks at the next poll of
+// the leader without dialing; it emits a LeaderChanged event. Pool and Connect return ErrNoLeader while there is no
+// connection to the leader. Retries and hedges only go to other connections of the leader. An election without Lease
+// and Selector is ignored.
+func WithLeaderOnly(l LeaderElection) PoolOption {
+	return func(c *poolConfig) {
+		if l.Lease == "" && len(l.Selector) == 0 {
+			log.Printf("WARNING: WithLeaderOnly(): Leader election without Lease or Selector ignored")
+			return
+		}
+		if l.Interval <= 0 {
+			l.Interval = defaultLeaderInterval
+		}
+		c.leader = &l
+	}
+}
+
+// leaderName - Pod name of the current leader of the pool, empty if unknown
+func (c *connection) leaderName() string {
+	name, _ := c.leader.Load().(string)
+	return name
+}
+
+// leaderConnections - The connections to the leader of the pool; the connections unchanged if the pool is not in
+// leader only mode
+func leaderConnections(c *connection, conns []*GrpcConnection) []*GrpcConnection {
+	if c == nil || c.config.leader == nil {
+		return conns
+	}
+	leader := c.leaderName()
+	led := make([]*GrpcConnection, 0, 1)
+	for _, gc := range conns {
+		if leader != "" && gc.podName == leader {
+			led = append(led, gc)
+		}
+	}
+	return led
+}
+
+// noLeader - True if the pool is in leader only mode and has no connection to the leader. Caller must hold mutex.
+func (c *connection) noLeader() bool {
+	return c.config.leader != nil && len(leaderConnections(c, c.grpcConnection)) == 0
+}
+
+// lookupLeader - Pod name of the leader of the service, empty if there is none
+func lookupLeader(serviceName string, l *LeaderElection) (string, error) {
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		return "", err
+	}
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return "", err
+	}
+	if l.Lease != "" {
+		if l.Namespace != "" {
+			namespace = l.Namespace
+		}
+		lease, err := k8s.CoordinationV1().Leases(namespace).Get(context.Background(), l.Lease, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+		}
+		if lease.Spec.HolderIdentity == nil {
+			return "", nil
+		}
+		// Elections of controller-runtime append a unique suffix to the pod name
+		return strings.SplitN(*lease.Spec.HolderIdentity, "_", 2)[0], nil
+	}
+	pods, err := k8s.CoreV1().Pods(namespace).List(context.Background(),
+		metav1.ListOptions{LabelSelector: labels.SelectorFromSet(l.Selector).String()})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	leaders := make([]string, 0, 1)
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			leaders = append(leaders, pod.Name)
+		}
+	}
+	if len(leaders) == 0 {
+		return "", nil
+	}
+	sort.Strings(leaders)
+	if len(leaders) > 1 {
+		log.Printf("WARNING: lookupLeader(): %d pods of %s (%s) are labeled as leader, using %s", len(leaders), name,
+			strings.Join(leaders, ", "), leaders[0])
+	}
+	return leaders[0], nil
+}
+
+// refreshLeader - Looks up the leader of the pool and re-targets the picks when it changed. Errors keep the current
+// leader. lock false: the caller holds mutex.
+func refreshLeader(serviceName string, c *connection, lock bool) {
+	leader, err := lookupLeader(serviceName, c.config.leader)
+	if err != nil {
+		log.Printf("ERROR: refreshLeader(): Can not look up the leader of %s. Error %v", serviceName, err)
+		return
+	}
+	previous := c.leaderName()
+	if leader == previous {
+		return
+	}
+	c.leader.Store(leader)
+	log.Printf("INFO: refreshLeader(): Leader of %s changed from %q to %q", serviceName, previous, leader)
+	if lock {
+		mutex.RLock()
+	}
+	n := len(leaderConnections(c, c.grpcConnection))
+	if lock {
+		mutex.RUnlock()
+	}
+	emit(PoolEvent{Type: LeaderChanged, ServiceName: serviceName, Connections: n,
+		Reason: fmt.Sprintf("%q to %q", previous, leader), Version: c.snapshotVersion()})
+}
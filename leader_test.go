@@ -0,0 +1,90 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testLease - Lease held by the identity, nil for a lease without holder
+func testLease(holder *string) *coordinationv1.Lease {
+	return &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: "lead-lock", Namespace: "ns"},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: holder}}
+}
+
+func TestLeaderOnlyLease(t *testing.T) {
+	useFakeClientset(t, testService("lead", "ns"), testPod("lead-0", "ns", "lead", "10.0.0.1"),
+		testPod("lead-1", "ns", "lead", "10.0.0.2"))
+	holder := "lead-1_4b2f"
+	cs := clientset.(*fake.Clientset)
+	if err := cs.Tracker().Add(testLease(&holder)); err != nil {
+		t.Fatal(err)
+	}
+	defer ClosePool("lead.ns:1000")
+	opts := []PoolOption{WithLeaderOnly(LeaderElection{Lease: "lead-lock"})}
+	for i := 0; i < 20; i++ {
+		client, err := ConnectWithOptions("lead.ns:1000", okBalancer{}, opts...)
+		if err != nil || client.(*grpc.ClientConn).Target() != "10.0.0.2:1000" {
+			t.Fatalf("Connect() = %v, %v, want the leader lead-1", client, err)
+		}
+	}
+
+	events := Subscribe("lead.ns:1000")
+	defer Unsubscribe("lead.ns:1000", events)
+	holder = "lead-0"
+	if _, err := cs.CoordinationV1().Leases("ns").Update(context.Background(), testLease(&holder),
+		metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	mutex.RLock()
+	p := connectionCache["lead.ns:1000"]
+	mutex.RUnlock()
+	refreshLeader("lead.ns:1000", p, true)
+	if gc, err := PickConnection("lead.ns:1000"); err != nil || gc.podName != "lead-0" {
+		t.Fatalf("PickConnection() = %v, %v, want the new leader lead-0", gc, err)
+	}
+	if e := <-events; e.Type != LeaderChanged || e.Reason != `"lead-1" to "lead-0"` || e.Connections != 1 {
+		t.Errorf("event = %+v, want LeaderChanged", e)
+	}
+
+	if _, err := cs.CoordinationV1().Leases("ns").Update(context.Background(), testLease(nil),
+		metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	refreshLeader("lead.ns:1000", p, true)
+	if _, err := ConnectWithOptions("lead.ns:1000", okBalancer{}, opts...); !errors.Is(err, ErrNoLeader) {
+		t.Errorf("Connect() without leader error = %v, want ErrNoLeader", err)
+	}
+}
+
+func TestLookupLeaderSelector(t *testing.T) {
+	leader := testPod("lead-1", "ns", "lead", "10.0.0.2")
+	leader.Labels["role"] = "leader"
+	useFakeClientset(t, testService("lead", "ns"), testPod("lead-0", "ns", "lead", "10.0.0.1"), leader)
+	l := &LeaderElection{Selector: map[string]string{"role": "leader"}}
+	if name, err := lookupLeader("lead.ns:1000", l); err != nil || name != "lead-1" {
+		t.Errorf("lookupLeader() = %q, %v, want lead-1", name, err)
+	}
+	l.Selector["role"] = "none"
+	if name, err := lookupLeader("lead.ns:1000", l); err != nil || name != "" {
+		t.Errorf("lookupLeader() without labeled pod = %q, %v", name, err)
+	}
+}
+
+func TestLeaderAlternative(t *testing.T) {
+	p := testPool(t, 3, WithLeaderOnly(LeaderElection{Lease: "lock"}))
+	p.leader.Store("svc-2")
+	tried := map[*GrpcConnection]bool{}
+	if gc := p.alternative(tried); gc != p.grpcConnection[1] {
+		t.Fatalf("alternative() = %v, want the leader", gc)
+	}
+	tried[p.grpcConnection[1]] = true
+	if gc := p.alternative(tried); gc != nil {
+		t.Errorf("alternative() = %v after the leader was tried, want nil", gc)
+	}
+}
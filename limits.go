@@ -0,0 +1,67 @@
+package kubegrpc
+
+import (
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rankPods - Orders the pods by rendezvous hash of subset key and pod name. Every client with the same key gets the same
+// order, and adding or removing a pod does not change the relative order of the others, so subsets stay stable.
+func rankPods(pods []corev1.Pod, key string) []corev1.Pod {
+	if key == "" {
+		key, _ = os.Hostname()
+	}
+	ranked := make([]corev1.Pod, len(pods))
+	copy(ranked, pods)
+	scores := make(map[string]uint64, len(pods))
+	for _, pod := range ranked {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(pod.Name))
+		scores[pod.Name] = h.Sum64()
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].Name] > scores[ranked[j].Name]
+	})
+	return ranked
+}
+
+// poolFull - True if n connections reach the configured maximum number of connections of the pool
+func poolFull(c *connection, n int) bool {
+	limit := c.maxConnections()
+	return limit > 0 && n >= limit
+}
+
+// updateDegraded - Recomputes the degraded state of the pool, logs transitions and wakes the pool hooks. Caller must
+// hold mutex.
+func updateDegraded(serviceName string, c *connection) {
+	notifyHooks(serviceName)
+	degraded := c.config.minHealthy > 0 && len(c.grpcConnection) < c.config.minHealthy
+	if degraded == c.degraded {
+		return
+	}
+	c.degraded = degraded
+	if degraded {
+		log.Printf("WARNING: updateDegraded(): Pool %s degraded: %d connections, minimum %d",
+			serviceName, len(c.grpcConnection), c.config.minHealthy)
+		emit(PoolEvent{Type: PoolDegraded, ServiceName: serviceName, Connections: len(c.grpcConnection),
+			Version: c.snapshotVersion()})
+		return
+	}
+	log.Printf("INFO: updateDegraded(): Pool %s recovered: %d connections", serviceName, len(c.grpcConnection))
+	emit(PoolEvent{Type: PoolRecovered, ServiceName: serviceName, Connections: len(c.grpcConnection),
+		Version: c.snapshotVersion()})
+}
+
+// IsDegraded - Returns true if the pool of the service holds fewer connections than configured with WithMinHealthy
+func IsDegraded(serviceName string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	c := connectionCache[serviceName]
+	return c != nil && c.degraded
+}
@@ -0,0 +1,90 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRankPodsDeterministic(t *testing.T) {
+	pods := make([]corev1.Pod, 0)
+	for i := 0; i < 10; i++ {
+		pods = append(pods, *testPod(fmt.Sprintf("svc-%d", i), "ns", "svc", fmt.Sprintf("10.0.0.%d", i)))
+	}
+	a := rankPods(pods, "client-a")
+	b := rankPods(pods, "client-a")
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			t.Fatalf("rankPods() not deterministic at %d: %s != %s", i, a[i].Name, b[i].Name)
+		}
+	}
+	// Removing a pod keeps the relative order of the others
+	removed := a[0].Name
+	rest := make([]corev1.Pod, 0)
+	for _, p := range pods {
+		if p.Name != removed {
+			rest = append(rest, p)
+		}
+	}
+	c := rankPods(rest, "client-a")
+	for i := range c {
+		if c[i].Name != a[i+1].Name {
+			t.Fatalf("rankPods() order changed after removing %s: %s != %s", removed, c[i].Name, a[i+1].Name)
+		}
+	}
+	// Another client key gets another order
+	other := rankPods(pods, "client-b")
+	same := true
+	for i := range other {
+		same = same && other[i].Name == a[i].Name
+	}
+	if same {
+		t.Errorf("rankPods() gives the same order for different keys")
+	}
+}
+
+func TestMaxConnectionsAndDegraded(t *testing.T) {
+	objects := []interface{}{testService("svc", "ns")}
+	for i := 0; i < 5; i++ {
+		objects = append(objects, testPod(fmt.Sprintf("svc-%d", i), "ns", "svc", fmt.Sprintf("10.0.0.%d", i+1)))
+	}
+	useFakeClientset(t, objects...)
+	c := &connection{functions: okBalancer{}, config: newPoolConfig([]PoolOption{
+		WithMaxConnections(2), WithMinHealthy(2), WithSubsetKey("client-a"),
+	})}
+	if err := updateConnectionPool("svc.ns:1000", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if len(c.grpcConnection) != 2 {
+		t.Fatalf("pool size = %d, want 2", len(c.grpcConnection))
+	}
+	if c.degraded {
+		t.Errorf("pool degraded with 2 connections, minimum 2")
+	}
+	c.grpcConnection = c.grpcConnection[:1]
+	updateDegraded("svc.ns:1000", c)
+	if !c.degraded {
+		t.Errorf("pool not degraded with 1 connection, minimum 2")
+	}
+}
+
+func TestConnectionsPerEndpoint(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"),
+		testPod("svc-0", "ns", "svc", "10.0.0.1"), testPod("svc-1", "ns", "svc", "10.0.0.2"))
+	c := &connection{functions: okBalancer{}, config: newPoolConfig([]PoolOption{WithConnectionsPerEndpoint(3)})}
+	if err := updateConnectionPool("svc.ns:1000", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if countConnections(c.grpcConnection, "10.0.0.1") != 3 || countConnections(c.grpcConnection, "10.0.0.2") != 3 {
+		t.Fatalf("pool = %+v, want 3 connections per pod", c.grpcConnection)
+	}
+	// A refresh tops up, it does not add more
+	c.grpcConnection = c.grpcConnection[1:]
+	if err := updateConnectionPool("svc.ns:1000", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if len(c.grpcConnection) != 6 {
+		t.Errorf("pool size after refresh = %d, want 6", len(c.grpcConnection))
+	}
+}
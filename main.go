@@ -8,12 +8,14 @@ import (
 	"math/rand"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
@@ -29,12 +31,46 @@ type connection struct {
 	nConnections   int // The number of connections
 	functions      GrpcKubeBalancer
 	grpcConnection []*GrpcConnection
+	closed         bool // Set by ClosePool, stops background updates from re-populating the pool
+	degraded       bool // Fewer connections than config.minHealthy
+	failedOver     bool // Picks go to the secondary pool, see WithFailover
+	config         poolConfig
+	backoff        *dialBackoff
+	lastRefresh    time.Time // Start of the last scheduled refresh by updatePool
+	retryBudget    *retryBudget
+	bypass         *GrpcConnection // Connection through kube-proxy while the balancing is bypassed, see SetBypass
+	ctx            context.Context // Pool context handed to ContextBalancer, cancelled by ClosePool
+	cancel         context.CancelFunc
+	affinity       *affinityCache // nil without WithAffinity
+	version        uint64         // atomic, snapshot version of grpcConnection, see swapConnections
+	mirrorInFlight int64          // atomic, mirrored calls in flight
+	service        serviceConfig  // From the annotations of the service, see parseServiceConfig
+	leader         atomic.Value   // Pod name of the leader, see WithLeaderOnly
+	leaderChecked  time.Time      // Last lookup of the leader
+	rebalanced     time.Time      // Last rebalancing of the streams, see WithStreamRebalance
+	snapshot       atomic.Value   // *poolSnapshot: endpoint set for the picks without locking, see swapConnections
+	balancer       atomic.Value   // serviceScorer: balancer of the service annotation for the picks without locking
+	dnsFallback    bool           // The pods were resolved from DNS for lack of RBAC, see dnsFallback
+	rebuilding     bool           // Connections are rotated to a new balancer, see SetBalancer
+	changed        chan struct{}  // Closed by the next swap of the endpoint set, see endpointsChanged
+
+	created        time.Time       // Creation of the pool, the discovery age counts from it until the first discovery
+	discovered     time.Time       // End of the last successful discovery, zero before the first one
+	discoveryTime  time.Duration   // Duration of the last successful discovery
+	stale          bool            // No successful discovery within WithStaleAfter refresh intervals
+	serviceWatched int32           // atomic, the service is watched, see WithServiceWatch
+	lameducks      map[string]bool // IPs of the pods in lameduck, see WithLameduck. Protected by mutex.
+	roundRobin     uint64          // atomic, picks of BalancerRoundRobin so far
 }
 
 // connHealth - Used to decouple events to reduce locking
 type connHealth struct {
 	functions GrpcKubeBalancer
 	grpcConn  *GrpcConnection
+	backoff   *dialBackoff
+	ctx       context.Context
+	timeout   time.Duration
+	adaptive  *adaptiveChecks // nil: checked every healthCheckInterval
 }
 
 // connUpdate - Used to decouple events to reduce locking
@@ -47,119 +83,248 @@ type connUpdate struct {
 type GrpcConnection struct {
 	GrpcConnection interface{}
 	connectionIP   string
+	podName        string
+	namespace      string
 	serviceName    string
 	conn           *grpc.ClientConn
+	created        time.Time
+	picks          uint64 // atomic: number of times handed out by Pool/Connect
+	pingFailures   uint64 // atomic: total number of failed pings
+	lastPing       int64  // atomic: duration of the last successful ping in nanoseconds
+	breaker        *breaker
+	lastFailure    int64       // atomic: unix nanoseconds of the last failed ping or RPC
+	inFlight       int64       // atomic: number of unary RPCs in progress
+	draining       int32       // atomic: 1 once the connection is being drained, it is no longer picked
+	pool           *connection // Pool the connection belongs to, used by the interceptors
+	podUID         types.UID
+	verified       int64 // atomic: unix nanoseconds of the last time the pod was confirmed in k8s
+	port           string
+	expires        time.Time // Rotation time, zero without a maximum connection age or SetBalancer. Protected by mutex.
+	warmFrom       time.Time // Start of the slow start, see WithSlowStart. Set before the connection is added to its pool
+	labels         map[string]string
+	nodeName       string // Node of the pod, empty if unknown
+	zone           string // Zone of the pod or its node, empty if unknown
+	tls            bool
+	addressOnly    bool             // Endpoint address without pod, see addressAnnotation
+	watching       int32            // atomic: 1 while a health Watch stream reports the health, the connection is not pinged
+	checking       int32            // atomic: 1 while a health check of the connection is running
+	nextCheck      int64            // atomic: unix nanoseconds of the next health check, see checkDue
+	checkEvery     int64            // atomic: interval of the adaptive health checks, 0 for the minimum
+	streams        int64            // atomic: open streams
+	openStreams    streamSet        // Protected by streamsMutex
+	streamsMutex   sync.Mutex       // Protects openStreams
+	rpcAccount     *rpcAccount      // nil without WithRPCAccounting
+	lastError      atomic.Value     // endpointError: last failed ping or RPC
+	podWeightDelta uint64           // atomic: float64 bits of the pod weight - 1, so the zero value is weight 1
+	load           endpointLoad     // Utilization reported by the backend, see WithLoadReports
+	version        atomic.Value     // string: version advertised by the pod, see WithVersionProbe
+	excludedUntil  int64            // atomic: unix nanoseconds of the end of the exclusion by ReportFailure
+	functions      GrpcKubeBalancer // Balancer which created GrpcConnection, it pings the connection
 }
 
 var (
-	clientset        *kubernetes.Clientset
+	clientset        kubernetes.Interface
+	clientsetMutex   = &sync.Mutex{}
 	connectionCache  = make(map[string]*connection) // contains all managed connections
 	mutex            = &sync.RWMutex{}
-	dirtyConnections = make(chan *GrpcConnection)
+	dirtyConnections = newEvictQueue() // Connections to remove from their pool, see cleanConnections
 )
 
 func init() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	poolManager()
+}
+
+// getClientset - Returns the k8s clientset, creating it from the in cluster config on first use
+// Created lazily so that importing the package outside of a cluster (eg in unit tests) does not terminate the process
+func getClientset() (kubernetes.Interface, error) {
+	clientsetMutex.Lock()
+	defer clientsetMutex.Unlock()
+	if clientset != nil {
+		return clientset, nil
+	}
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		log.Fatalf("ERROR: init(): Could not get kube config in cluster. Error:" + err.Error())
+		log.Printf("ERROR: getClientset(): Could not get kube config in cluster. Error: %v", err)
+		return nil, err
 	}
-	clientset, err = kubernetes.NewForConfig(config)
+	cs, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Fatalf("ERROR: init(): Could not connect to kube cluster with config. Error:" + err.Error())
+		log.Printf("ERROR: getClientset(): Could not connect to kube cluster with config. Error: %v", err)
+		return nil, err
 	}
-	poolManager()
+	clientset = cs
+	return clientset, nil
+}
+
+// SetClientset - Sets the clientset used for the discovery of the local cluster, instead of the in cluster config.
+// Tests pass a fake clientset (k8s.io/client-go/kubernetes/fake, or see the kubegrpctest package) to run code calling
+// Connect without a cluster. nil restores the in cluster clientset.
+func SetClientset(cs kubernetes.Interface) {
+	clientsetMutex.Lock()
+	defer clientsetMutex.Unlock()
+	clientset = cs
+}
+
+// Clientset - Returns the clientset used for the discovery of the local cluster: the one set with SetClientset, or the
+// in cluster clientset
+func Clientset() (kubernetes.Interface, error) {
+	return getClientset()
 }
 
 // poolManager - Updates the existing connection pools, keeps the pools healthy
 // Runs once per second in which it pings existing connections.
 // If a connection has failed, the connection is removed from the pool and a scan is executed for new connections.
 // Every 60 seconds a full scan is done to check for new pods which might have been scaled into the pool
+// Stopped by Shutdown.
 func poolManager() {
-	go cleanConnections()
-	go healthCheck()
-	go updatePool()
+	stop := make(chan struct{})
+	shutdownMutex.Lock()
+	stopMaintenance, shutdownDone = stop, make(chan struct{})
+	atomic.StoreInt32(&shuttingDown, 0)
+	shutdownMutex.Unlock()
+	maintenance.Add(4)
+	go cleanConnections(stop)
+	go healthCheck(stop)
+	go updatePool(stop)
+	go recordKubernetesEvents(stop)
 }
 
 // healthCheck - Runs once per second in which it pings existing connections.
 // If a connection has failed, the connection is removed from the pool and a scan is executed for new connections.
-// Currently there is no
-func healthCheck() {
+// Rounds start on a fixed schedule, so slow rounds do not make the interval drift; a round which overran its interval
+// is followed by the next one right away. See runHealthChecks for the pacing within a round.
+func healthCheck(stop <-chan struct{}) {
+	defer maintenance.Done()
+	next := time.Now()
 	for {
-		time.Sleep(time.Second)
-		// To prevent conflicts in the loops checking the connections, we use a channel without a listener active
-		// The connections are a global variable
+		mutex.RLock()
+		interval := healthCheckTick() * maintenanceSlowdown()
+		mutex.RUnlock()
+		next = next.Add(interval)
+		d := time.Until(next)
+		if d <= 0 {
+			next = time.Now()
+		}
+		if !sleep(stop, d) {
+			return
+		}
+		// Failed connections are queued in dirtyConnections and removed by cleanConnections, so the checks never wait
+		// for mutex. The connections are a global variable
 		a := make([]*connHealth, 0)
 		mutex.RLock()
 		for _, v := range connectionCache {
 			// Iterate over the connections while calling the provided ping function
 			for _, c := range v.grpcConnection {
+				if c.isWatched() || !c.checkDue(v.config.adaptiveChecks, next) {
+					continue
+				}
 				// Decouple mutex lock from actual ping to reduce lock time by using intermediate array for the pointers
-				a = append(a, &connHealth{functions: v.functions, grpcConn: c})
+				a = append(a, &connHealth{functions: c.clientBalancer(v.functions), grpcConn: c, backoff: v.pingBackoff(),
+					ctx: v.poolContext(), timeout: v.config.pingTimeout, adaptive: v.config.adaptiveChecks})
 			}
 		}
 		mutex.RUnlock()
-		// Iterate over array of connection pointers
-		for _, v := range a {
-			go func(grpcConn *GrpcConnection, f GrpcKubeBalancer) {
-				err := f.Ping(grpcConn.GrpcConnection)
-				if err != nil {
-					// Add to dirtyConnections channel:
-					log.Printf("INFO: healthcheck(): Failed to ping %s at ip %s",
-						grpcConn.serviceName, grpcConn.connectionIP)
-					dirtyConnections <- grpcConn
-				}
-			}(v.grpcConn, v.functions)
-		}
+		runHealthChecks(stop, a, time.Duration(float64(interval)*healthCheckSpread), healthCheckSlots(), checkConnection)
 	}
 }
 
-// cleanConnections - Processes the connections which are stale/can not be reached and removes them from the cache
-func cleanConnections() {
-	// Not using a channel for this since we want unique services to be updated only (And the map deduplicates the list automatically
-	for {
-		v := <-dirtyConnections
-		mutex.Lock()
-		conns := connectionCache[v.serviceName]
-		// healthCheck and updatePool could both run this routine at the same time, leading to a change on range conns.grpcConnection
-		// and subsequent non-existent just found key. mutex.Lock should protect this code against race conditions.
-		for k, gc := range conns.grpcConnection {
-			if gc == v {
-				go v.conn.Close() // Close open connections just in case there is a non-implementation of the healthcheck or other failure making the connection not terminate
-				// Remove connection from slice of connections
-				conns.grpcConnection[k] = conns.grpcConnection[len(conns.grpcConnection)-1]
-				conns.grpcConnection = conns.grpcConnection[:len(conns.grpcConnection)-1]
-				conns.nConnections = len(conns.grpcConnection)
-				// Value found, so no need (and very unwanted) to continue iteration since we effectively changed the iterator of the for inner for loop
-				break
-			}
-		}
-		log.Printf("INFO: cleanConnections(): Pool %s after clean: %v", v.serviceName, conns)
-		mutex.Unlock()
+// checkConnection - Pings the connection and hands it to cleanConnections if the ping fails
+func checkConnection(h *connHealth) {
+	grpcConn := h.grpcConn
+	start := time.Now()
+	err := ping(h.functions, h.ctx, h.timeout, grpcConn)
+	if err != nil {
+		atomic.AddUint64(&grpcConn.pingFailures, 1)
+		unhealthy(grpcConn, h.backoff, err)
+		return
 	}
+	atomic.StoreInt64(&grpcConn.lastPing, int64(time.Since(start)))
+	grpcConn.checkPassed(h.adaptive)
+	h.backoff.success(grpcConn.connectionIP)
 }
 
-// updatePool - Every minute a full scan is done to check for new pods which might have been scaled into the pool
-func updatePool() {
-	for {
-		time.Sleep(time.Minute)
+// unhealthy - Hands the connection which failed its health check to cleanConnections
+func unhealthy(grpcConn *GrpcConnection, backoff *dialBackoff, err error) {
+	grpcConn.setLastError(err)
+	decideEviction(grpcConn, "failed health check: "+err.Error())
+	// A pod which dials but does not answer (eg crash looping) is backed off like a failed dial
+	delay := backoff.failure(grpcConn.connectionIP, grpcConn.podName)
+	log.Printf("INFO: healthcheck(): Failed health check of %s for %s. Next dial attempt in %v",
+		grpcConn.describe(), grpcConn.serviceName, delay)
+	e := PoolEvent{Type: EndpointUnhealthy, ServiceName: grpcConn.serviceName, Endpoint: grpcConn.Info(),
+		Reason: err.Error(), Version: grpcConn.pool.snapshotVersion()}
+	if backoff != nil {
+		state := backoff.get(grpcConn.connectionIP)
+		e.Backoff = &state
+	}
+	emit(e)
+	dirtyConnections.push(grpcConn)
+}
+
+// updatePool - Every refresh interval of a pool (default a minute) a full scan is done to check for new pods which might
+// have been scaled into the pool
+func updatePool(stop <-chan struct{}) {
+	defer maintenance.Done()
+	for sleep(stop, time.Second) {
 		a := make([]*connUpdate, 0)
-		mutex.RLock()
+		verify := make([]*connUpdate, 0)
+		rotate := make([]*connUpdate, 0)
+		leaders := make([]*connUpdate, 0)
+		rebalance := make([]*connUpdate, 0)
+		now := time.Now()
+		mutex.Lock()
 		// Make a non-blocking array for update purposes
 		for serviceName, v := range connectionCache {
+			if v.config.verifyInterval > 0 {
+				verify = append(verify, &connUpdate{serviceName: serviceName, conn: v})
+			}
+			if v.config.maxConnectionAge > 0 || v.rebuilding {
+				rotate = append(rotate, &connUpdate{serviceName: serviceName, conn: v})
+			}
+			if v.config.leader != nil && now.Sub(v.leaderChecked) >= v.config.leader.Interval {
+				v.leaderChecked = now
+				leaders = append(leaders, &connUpdate{serviceName: serviceName, conn: v})
+			}
+			if p := v.config.streamRebalance; p != nil && now.Sub(v.rebalanced) >= p.Interval {
+				v.rebalanced = now
+				rebalance = append(rebalance, &connUpdate{serviceName: serviceName, conn: v})
+			}
+			v.updateStale(serviceName, now)
+			if now.Sub(v.lastRefresh) < v.refreshInterval()*maintenanceSlowdown() {
+				continue
+			}
+			v.lastRefresh = now
 			a = append(a, &connUpdate{serviceName: serviceName, conn: v})
 		}
-		mutex.RUnlock()
+		mutex.Unlock()
 		for _, v := range a {
 			updateConnectionPool(v.serviceName, v.conn, true)
 		}
+		for _, v := range verify {
+			verifyPool(v.serviceName, v.conn)
+		}
+		for _, v := range rotate {
+			rotateConnections(v.serviceName, v.conn)
+		}
+		for _, v := range leaders {
+			refreshLeader(v.serviceName, v.conn, true)
+		}
+		for _, v := range rebalance {
+			rebalanceStreams(v.serviceName, v.conn)
+		}
 	}
 }
 
 // Connect - Call to get a connection to the given service and namespace. Will initialize a connection if not yet initialized
 // Function wraps Pool function fior backward compatibility. Locking is managed by the pool function
 func Connect(serviceName string, f GrpcKubeBalancer) (interface{}, error) {
-	_, grcpConn, err := Pool(serviceName, f)
+	return ConnectWithOptions(serviceName, f)
+}
+
+// ConnectWithOptions - Connect with pool options. The options are only applied when the call creates the pool.
+func ConnectWithOptions(serviceName string, f GrpcKubeBalancer, opts ...PoolOption) (interface{}, error) {
+	_, grcpConn, err := PoolWithOptions(serviceName, f, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -170,35 +335,134 @@ func Connect(serviceName string, f GrpcKubeBalancer) (interface{}, error) {
 // Returns an array of grpcConnections. This array should be locked before any actions are written against it.
 // Also returns a singular connection so that the Connect function can use the Pool function without having to implement its own locking
 func Pool(serviceName string, f GrpcKubeBalancer) ([]*GrpcConnection, interface{}, error) {
+	return PoolWithOptions(serviceName, f)
+}
+
+// PoolWithOptions - Pool with pool options. The options are only applied when the call creates the pool.
+func PoolWithOptions(serviceName string, f GrpcKubeBalancer, opts ...PoolOption) ([]*GrpcConnection, interface{}, error) {
+	return pool(serviceName, "", f, opts)
+}
+
+// pool - Implements PoolWithOptions, picking by affinity key when the key is not empty. Picks of an empty pool are
+// retried for the pick wait of the pool, see WithPickWait.
+func pool(serviceName, key string, f GrpcKubeBalancer, opts []PoolOption) ([]*GrpcConnection, interface{}, error) {
+	start := time.Now()
+	for {
+		conns, client, err := poolPick(serviceName, key, f, opts)
+		if !errors.Is(err, ErrNoHealthyEndpoints) || !awaitEndpoints(serviceName, start) {
+			return conns, client, err
+		}
+	}
+}
+
+// poolPick - A single try of pool: creates or updates the pool if needed and picks a connection
+func poolPick(serviceName, key string, f GrpcKubeBalancer, opts []PoolOption) ([]*GrpcConnection, interface{}, error) {
 	// Using Lock instead of RLock: Multiple connection requests can come in at high freq.
 	// Lock prevents trying to create multiple connections to the same target at once
+	if _, _, _, err := parseServiceName(serviceName); err != nil {
+		return nil, nil, err
+	}
+	if isShuttingDown() {
+		return nil, nil, ErrShutdown
+	}
+	if key == "" {
+		if conns, gc := fastPick(serviceName); gc != nil {
+			return conns, gc.GrpcConnection, nil
+		}
+	}
 	mutex.Lock()
 	defer mutex.Unlock()
-	currentConnection := connectionCache[serviceName]
-	if currentConnection == nil {
-		currentConnection = &connection{
-			nConnections:   0,
-			functions:      f,
-			grpcConnection: make([]*GrpcConnection, 0),
+	if bypassedFor(serviceName) {
+		currentConnection := connectionCache[serviceName]
+		if currentConnection == nil {
+			currentConnection = newConnection(f, newPoolConfig(opts))
+			setPool(serviceName, currentConnection)
 		}
-		connectionCache[serviceName] = currentConnection
-	}
-	if currentConnection.nConnections == 0 {
-		var err error
-		err = initCurrentConnection(serviceName, currentConnection)
+		gc, err := currentConnection.bypassConnection(serviceName)
 		if err != nil {
 			return nil, nil, err
 		}
+		return []*GrpcConnection{gc}, gc.GrpcConnection, nil
+	}
+	currentConnection, err := openPool(serviceName, f, opts)
+	pickName := serviceName
+	if primary := connectionCache[serviceName]; primary != nil && primary.config.failoverService != "" {
+		pickName, currentConnection, err = failover(serviceName, primary, f, opts, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if currentConnection.noLeader() {
+		return nil, nil, ErrNoLeader
 	}
 	// Not reaching this with 0 connections in the pool (still within the same lock)
-	grcpConn := currentConnection.grpcConnection[rand.Intn(currentConnection.nConnections)]
+	grcpConn := currentConnection.pick(pickName, key)
+	atomic.AddUint64(&grcpConn.picks, 1)
 	return currentConnection.grpcConnection, grcpConn.GrpcConnection, nil
 }
 
+// openPool - Returns the pool of the service, creating and populating it when needed. Caller must hold mutex, which is
+// released while an empty pool is populated, see initCurrentConnection.
+func openPool(serviceName string, f GrpcKubeBalancer, opts []PoolOption) (*connection, error) {
+	if isShuttingDown() {
+		return nil, ErrShutdown
+	}
+	currentConnection := connectionCache[serviceName]
+	if currentConnection == nil {
+		currentConnection = newConnection(f, newPoolConfig(opts))
+		setPool(serviceName, currentConnection)
+	}
+	if currentConnection.nConnections == 0 && !restorePool(serviceName, currentConnection) {
+		if err := initCurrentConnection(serviceName, currentConnection); err != nil {
+			return nil, err
+		}
+	}
+	if currentConnection.config.leader != nil && currentConnection.leaderChecked.IsZero() {
+		currentConnection.leaderChecked = time.Now()
+		refreshLeader(serviceName, currentConnection, false)
+	}
+	return currentConnection, nil
+}
+
+// Refresh - Updates the pool of the service from k8s right away instead of at its next refresh interval. Returns
+// ErrPoolNotFound if there is no pool.
+func Refresh(serviceName string) error {
+	return RefreshContext(context.Background(), serviceName)
+}
+
+// RefreshContext - Refresh bounded by ctx, eg right after triggering a scale-up. Returns ctx.Err() if ctx is done
+// before the re-discovery completed; the re-discovery then still completes in the background. The next scheduled
+// refresh of the pool is a full refresh interval later.
+func RefreshContext(ctx context.Context, serviceName string) error {
+	if isShuttingDown() {
+		return ErrShutdown
+	}
+	mutex.Lock()
+	currentConnection := connectionCache[serviceName]
+	if currentConnection != nil {
+		currentConnection.lastRefresh = time.Now()
+	}
+	mutex.Unlock()
+	if currentConnection == nil {
+		return ErrPoolNotFound
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- updateConnectionPool(serviceName, currentConnection, true)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // ListPool() - Returns the connections currently in the pool
 // Possible usages:
 // - Implement a secondary way to use connections initialized and managed by kube-grpc
-// usage: Unsafe if locking is not implemented correct: The returned value is a reference, not a copy!! Connections might be re-instantiated on crash or for other reasons.
+// usage: The returned slice is a snapshot of the endpoint set which the pool never modifies; changes swap in a new set.
+// Connections might be closed and re-instantiated on crash or for other reasons.
 // The developer has to manage failures and might have to call this functions again to get a new/updated connection pool.
 func ListPool(serviceName string) []*GrpcConnection {
 	mutex.RLock()
@@ -210,156 +474,626 @@ func ListPool(serviceName string) []*GrpcConnection {
 	return currentConnection.grpcConnection
 }
 
+// Connections - Returns a copy of the connections currently in the pool, nil if there is no pool. Unlike ListPool the
+// result is safe to use without locking; the connections themselves may be closed by the pool at any time.
+func Connections(serviceName string) []*GrpcConnection {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	currentConnection := connectionCache[serviceName]
+	if currentConnection == nil {
+		return nil
+	}
+	conns := make([]*GrpcConnection, len(currentConnection.grpcConnection))
+	copy(conns, currentConnection.grpcConnection)
+	return conns
+}
+
+// PickConnection - Picks a connection from the existing pool of the service the same way Pool does, without creating
+// the pool. Returns ErrPoolNotFound if there is no pool and ErrNoHealthyEndpoints if the pool is empty (after its
+// pick wait, see WithPickWait).
+func PickConnection(serviceName string) (*GrpcConnection, error) {
+	start := time.Now()
+	for {
+		gc, err := pickExisting(serviceName)
+		if !errors.Is(err, ErrNoHealthyEndpoints) || !awaitEndpoints(serviceName, start) {
+			return gc, err
+		}
+	}
+}
+
+// pickExisting - A single try of PickConnection
+func pickExisting(serviceName string) (*GrpcConnection, error) {
+	if isShuttingDown() {
+		return nil, ErrShutdown
+	}
+	if _, gc := fastPick(serviceName); gc != nil {
+		return gc, nil
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	currentConnection := connectionCache[serviceName]
+	if currentConnection == nil {
+		return nil, ErrPoolNotFound
+	}
+	if bypassedFor(serviceName) {
+		return currentConnection.bypassConnection(serviceName)
+	}
+	if len(currentConnection.grpcConnection) == 0 {
+		return nil, ErrNoHealthyEndpoints
+	}
+	if currentConnection.noLeader() {
+		return nil, ErrNoLeader
+	}
+	gc := pickConnection(serviceName, currentConnection.grpcConnection)
+	atomic.AddUint64(&gc.picks, 1)
+	return gc, nil
+}
+
+// Client - Returns the client created by NewGrpcClient of the balancer
+func (c *GrpcConnection) Client() interface{} {
+	return c.GrpcConnection
+}
+
+// newConnection - Creates an empty pool with the configuration
+func newConnection(f GrpcKubeBalancer, config poolConfig) *connection {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &connection{
+		ctx:            ctx,
+		cancel:         cancel,
+		nConnections:   0,
+		functions:      f,
+		grpcConnection: make([]*GrpcConnection, 0),
+		config:         config,
+		backoff:        newDialBackoff(config.backoffBase, config.backoffMax),
+		retryBudget:    newRetryBudget(config.retryPolicy),
+		lastRefresh:    time.Now(),
+		created:        time.Now(),
+		affinity:       newAffinityCache(config.affinityTTL, config.affinitySize),
+	}
+}
+
+// ClosePool - Closes all connections of the pool of the given service and removes the pool.
+// A later Connect/Pool call for the same service builds a new pool. Returns ErrPoolClosed if there is no open pool.
+func ClosePool(serviceName string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	currentConnection := connectionCache[serviceName]
+	if currentConnection == nil {
+		return ErrPoolClosed
+	}
+	closePool(serviceName, currentConnection)
+	return nil
+}
+
+// closePool - Closes all connections of the pool and removes it from the cache. Caller must hold mutex.
+func closePool(serviceName string, currentConnection *connection) {
+	currentConnection.closed = true
+	if currentConnection.cancel != nil {
+		currentConnection.cancel()
+	}
+	currentConnection.closeBypass()
+	for _, c := range currentConnection.grpcConnection {
+		go c.conn.Close()
+		emitEndpoint(EndpointRemoved, c, 0, reasonPoolClosed)
+	}
+	currentConnection.swapConnections(make([]*GrpcConnection, 0))
+	emit(PoolEvent{Type: PoolClosed, ServiceName: serviceName, Version: currentConnection.snapshotVersion()})
+	if connectionCache[serviceName] == currentConnection {
+		removePool(serviceName)
+		clearWeightOverrides(serviceName)
+		ClearTrafficSplit(serviceName)
+		forgetDiscoveries(serviceName)
+		forgetKubernetesEvents(serviceName)
+		unbindNamespace(serviceName)
+	}
+	log.Printf("INFO: closePool(): Closed pool %s", serviceName)
+}
+
 // initCurrentConnection - Tries to update the connection cache on connect.
-// If it fails, it will retry for max 3 times to see if the error encountered is transient in nature
+// If it fails, it will retry for max 3 times to see if the error encountered is transient in nature, once for pools
+// with a pick wait, whose waiting picks retry. The mutex of the caller is released while the pods are discovered and
+// dialed and during the retry sleeps, so the first discovery of a pool blocks neither the picks nor the other pools;
+// concurrent callers share its discovery, see limitedDiscovery.
+// Caller must hold mutex.
 func initCurrentConnection(serviceName string, currentConnection *connection) error {
+	tries := 3
+	if currentConnection.config.pickWait > 0 {
+		// The waiting picks try again at their own pace, see awaitEndpoints
+		tries = 1
+	}
 	var err error
-	for i := 0; i < 3; i++ {
-		err = updateConnectionPool(serviceName, currentConnection, false)
-		if err != nil {
-			switch err.Error() {
-			case "K8S interaction not possible, non-retryable":
-				return err
-			case "No connections made, retry later":
-				// Sleep a second (which is about a lifetime in well configured system)
-				time.Sleep(time.Second)
-				continue
-			}
+	for i := 0; i < tries; i++ {
+		mutex.Unlock()
+		err = updateConnectionPool(serviceName, currentConnection, true)
+		mutex.Lock()
+		if err == nil && currentConnection.nConnections == 0 {
+			// Emptied again while mutex was released
+			err = ErrNoHealthyEndpoints
+		}
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrNoHealthyEndpoints) {
+			// k8s and naming errors are not transient
 			return err
 		}
+		if i == tries-1 {
+			break
+		}
+		// Sleep a second (which is about a lifetime in well configured system)
+		mutex.Unlock()
+		time.Sleep(time.Second)
+		mutex.Lock()
 	}
-	return nil
+	return err
 }
 
 // updateConnectionPool - Sets up the actual connections in the connectionpool
 // Also capable of refreshing the pool
 // Depending on the access path, a sync.Lock might already be in place, lock (bool) false will skip locking in this function
 func updateConnectionPool(serviceName string, currentConnection *connection, lock bool) error {
-	// Chat with k8s for service and pod information, slow not blocking action
-	svc, namespace, err := getService(serviceName, clientset.CoreV1())
+	_, _, port, err := parseServiceName(serviceName)
 	if err != nil {
-		log.Printf("ERROR: updateConnectionPool(): Problem updating pool for service %s. Error %v", serviceName, err)
-		return errors.New("K8S interaction not possible, non-retryable")
+		return err
 	}
-	pods, podErr := getPodsForSvc(svc, namespace, clientset.CoreV1())
-	if podErr != nil {
-		log.Printf("ERROR: updateConnectionPool(): Problem updating pool for service %s. Can not get pods. Error %v",
-			serviceName, err)
-		return errors.New("K8S interaction not possible, non-retryable")
+	// Chat with k8s for service and pod information, slow not blocking action
+	start := time.Now()
+	svc, pods, err := limitedDiscovery(serviceName, port, currentConnection)
+	discoveryTime := time.Since(start)
+	recordDiscovery(serviceName, discoveryTime, err)
+	if err != nil {
+		return err
 	}
 
 	log.Printf("INFO: updateConnectionPool(): %d pods listed by k8s for service %s", len(pods.Items), serviceName)
-
-	// Evict from pool
-	// Disconnect locking reads and eviction channel:
-	a := make([]*GrpcConnection, 0)
-	// bool lock prevents deadlocks
-	if lock {
-		// Use a read lock since we do not care if a connection is evicted multiple times (will just do nothing)
-		mutex.RLock()
+	listed := len(pods.Items)
+	completed := workloadCompleted(pods.Items)
+	pods.Items = activePods(pods.Items)
+	if pod := podTarget(serviceName); pod != "" {
+		pods.Items = namedPods(pods.Items, pod)
 	}
-	for _, p := range currentConnection.grpcConnection {
-		evict := true
-		for _, pod := range pods.Items {
-			if p.connectionIP == pod.Status.PodIP {
-				log.Printf("INFO: updateConnectionPool(): Not evicting %s for %s", p.connectionIP, p.serviceName)
-				evict = false
-				break
-			}
-		}
-		if evict {
-			log.Printf("INFO: updateConnectionPool(): Evicting %s for %s", p.connectionIP, p.serviceName)
-			// decouple mutex
-			a = append(a, p)
-		}
+	if len(pods.Items) != 1 || !passthroughPod(&pods.Items[0]) {
+		pods.Items = selectPods(pods.Items, currentConnection.config.podSelector)
 	}
-	if lock {
-		mutex.RUnlock()
+	if selector := subsetSelector(serviceName); selector != nil {
+		pods.Items = selectPods(pods.Items, selector)
 	}
-	// since channel dirtyConnections locks and a lock might already be in place, let cleanup run from go routine
-	// go routine will block until lock is released from either end of this function and fallback to caller,
-	// or no lock is in place in which case it might or might not lock until the next lock is called in this function
-	go func() {
-		for _, p := range a {
-			dirtyConnections <- p
-		}
-	}()
+	// Governance: a vetoed pool leaves no allowed pods, so all existing connections are evicted below
+	allowed, policyErr := validatePods(serviceName, svc, pods.Items)
+	allowed = expandPodIPs(allowed, currentConnection.config.ipFamily, currentConnection.config.dualStack)
+	service := parseServiceConfig(serviceName, svc)
+	resolveZones(serviceName, allowed)
 
-	// Lock only if required and at the last moment to prevent slow k8s query from locking all actions
+	// The k8s state is applied in one step under the write lock: evictions start to drain and new connections are
+	// added in a single swap of the endpoint set, so concurrent picks see either the old or the new set.
+	// Lock only at the last moment to prevent slow k8s query from locking all actions
 	if lock {
 		mutex.Lock()
 		defer mutex.Unlock()
 	}
-	// Add new connections to pool
-	for _, pod := range pods.Items {
-		// Check pool for  presense of podIP to prevent duplicate connections:
-		ipFound := false
-		for _, p := range currentConnection.grpcConnection {
-			if p.connectionIP == pod.Status.PodIP {
-				ipFound = true
-				break
-			}
+	if currentConnection.closed {
+		return ErrPoolClosed
+	}
+	previous, rediscovered := currentConnection.service, !currentConnection.discovered.IsZero()
+	currentConnection.setDiscovered(serviceName, start.Add(discoveryTime), discoveryTime)
+	currentConnection.setService(service)
+	currentConnection.setDNSFallback(serviceName, svc)
+	// Terminating pods (rolling deploy) are drained and evicted, as are connections whose IP was reused by another pod.
+	// Evicted connections are no longer picked, in flight RPCs get the drain timeout to complete.
+	evicted := evictions(currentConnection.grpcConnection, allowed)
+	// Connections on a port the service no longer targets are replaced by connections on the new port
+	var retarget []*GrpcConnection
+	if rediscovered && portsChanged(previous, service) {
+		retarget = retargeted(currentConnection, allowed, port, evicted)
+		evicted = append(evicted, retarget...)
+	}
+	refreshPodWeights(currentConnection.grpcConnection, allowed, currentConnection.config.podWeights)
+	if policyErr != nil || (completed && currentConnection.config.autoClose) {
+		if len(evicted) > 0 {
+			currentConnection.swapConnections(currentConnection.grpcConnection)
+			startDrains(evicted, currentConnection.config.drainTimeout)
 		}
-		if ipFound {
-			// Ip found, connection alreay present, continue with the next pod:
-			continue
+		if policyErr != nil {
+			return policyErr
 		}
+		log.Printf("INFO: updateConnectionPool(): All pods of %s completed, closing pool", serviceName)
+		closePool(serviceName, currentConnection)
+		return ErrPoolClosed
+	}
+	// Add new connections, with a maximum pool size in the order of the deterministic subset
+	if size := currentConnection.config.subsetSize; size > 0 {
+		allowed = subsetPods(allowed, size, currentConnection.config.clientID)
+	} else if currentConnection.maxConnections() > 0 {
+		allowed = rankPods(allowed, currentConnection.config.subsetKey)
+	}
+	next := make([]*GrpcConnection, len(currentConnection.grpcConnection), len(currentConnection.grpcConnection)+len(allowed))
+	copy(next, currentConnection.grpcConnection)
+	added := make([]*GrpcConnection, 0)
+	var lastDialErr *ErrDialFailed
+	failedDials := 0
+	discovered := make(map[string]bool, len(allowed))
+	dials := make([]*corev1.Pod, 0)
+	for _, pod := range allowed {
 		// Pod fully initialized? (k8s connected it to the network?), if not, skip
-		if pod.Status.PodIP == "" {
+		if pod.Status.PodIP == "" || podTerminating(&pod) {
 			continue
 		}
-		portSlice := strings.Split(serviceName, ":")
-		if len(portSlice) < 2 {
-			log.Fatalf("updateConnectionPool(): No port number supplied in service as stated in README")
+		discovered[pod.Status.PodIP] = true
+		if !currentConnection.backoff.allow(pod.Status.PodIP) || currentConnection.inLameduck(pod.Status.PodIP) {
+			continue
 		}
-		conn, err := grpc.Dial(pod.Status.PodIP+":"+portSlice[1], grpc.WithInsecure())
-		grpcConn, err := currentConnection.functions.NewGrpcClient(conn)
-		if err != nil {
-			// Connection could not be made, so abort, but still try next pods in list
-			if conn != nil {
-				conn.Close()
+		// Check pool for presense of podIP to prevent duplicate connections, top up to the connections per endpoint
+		pod := pod
+		n := countConnections(next, pod.Status.PodIP) - countConnections(retarget, pod.Status.PodIP)
+		for ; n < currentConnection.config.perEndpoint(); n++ {
+			if poolFull(currentConnection, len(next)+len(dials)) {
+				break
+			}
+			dials = append(dials, &pod)
+		}
+	}
+	backedOff := make(map[string]bool)
+	for _, r := range dialPods(serviceName, currentConnection, dials, port) {
+		if r.err != nil {
+			// Connection could not be made, the other pods are still added
+			lastDialErr = r.err
+			failedDials++
+			if !backedOff[r.err.IP] {
+				backedOff[r.err.IP] = true
+				delay := currentConnection.backoff.failure(r.err.IP, r.err.Pod)
+				log.Printf("INFO: updateConnectionPool(): %v. Next attempt in %v", r.err, delay)
+				emitBackoff(serviceName, currentConnection, EndpointInfo{ServiceName: serviceName, Namespace: svc.Namespace,
+					PodName: r.err.Pod, IP: r.err.IP}, r.err.Error())
 			}
 			continue
 		}
-		// add to connection cache
-		currentConnection.grpcConnection = append(currentConnection.grpcConnection, &GrpcConnection{
-			connectionIP:   pod.Status.PodIP,
-			GrpcConnection: grpcConn,
-			serviceName:    serviceName, // Added to make use of channel for cleaning up connections easier (compare on key)
-			conn:           conn,
-		})
-		currentConnection.nConnections = len(currentConnection.grpcConnection)
-		log.Printf("INFO: updateConnectionPool(): Created connection for service %s in namespace %s. Connection pool status %+v",
-			serviceName, namespace, currentConnection)
+		next = append(next, r.gc)
+		added = append(added, r.gc)
+	}
+	currentConnection.backoff.prune(discovered)
+	currentConnection.pruneLameducks(discovered)
+	var pending []*GrpcConnection
+	if (currentConnection.config.connectTimeout > 0 || currentConnection.config.preflights()) && len(added) > 0 {
+		// Only the connections reaching READY and passing their checks are admitted, see WithConnectTimeout
+		next = next[:len(next)-len(added)]
+		pending, added = added, nil
+	}
+	if len(added) > 0 || len(evicted) > 0 {
+		version := currentConnection.swapConnections(validSnapshot(next))
+		startDrains(evicted, currentConnection.config.drainTimeout)
+		for _, gc := range added {
+			emitEndpoint(EndpointAdded, gc, currentConnection.nConnections, "")
+		}
+		log.Printf("INFO: updateConnectionPool(): Pool %s version %d: %d connections added, %d draining. Connection pool status %+v",
+			serviceName, version, len(added), len(evicted), currentConnection)
+	}
+	if len(pending) > 0 {
+		if lock {
+			mutex.Unlock()
+		}
+		ready, dialErr := pending, (*ErrDialFailed)(nil)
+		if currentConnection.config.connectTimeout > 0 {
+			ready, dialErr = awaitReady(currentConnection, pending)
+		}
+		if currentConnection.config.preflights() {
+			var checkErr *ErrDialFailed
+			if ready, checkErr = preflight(currentConnection, ready); checkErr != nil {
+				dialErr = checkErr
+			}
+		}
+		if lock {
+			mutex.Lock()
+		}
+		if dialErr != nil {
+			lastDialErr = dialErr
+			failedDials += len(pending) - len(ready)
+		}
+		added = admitConnections(currentConnection, ready)
+		if currentConnection.closed {
+			return ErrPoolClosed
+		}
+		for _, gc := range added {
+			emitEndpoint(EndpointAdded, gc, currentConnection.nConnections, "")
+		}
+		log.Printf("INFO: updateConnectionPool(): Pool %s version %d: %d of %d connections ready",
+			serviceName, currentConnection.snapshotVersion(), len(added), len(pending))
 	}
+	decideRefresh(serviceName, fmt.Sprintf("%d pods listed, %d allowed, %d connections added, %d draining, %d dials failed",
+		listed, len(allowed), len(added), len(evicted), failedDials))
+	updateDegraded(serviceName, currentConnection)
 	// Connection pool update might have lead to no connections at all, return appropriate error:
 	if currentConnection.nConnections == 0 {
-		return errors.New("No connections made, retry later")
+		if lastDialErr != nil {
+			return &noEndpointsError{dialErr: lastDialErr, failed: failedDials}
+		}
+		return ErrNoHealthyEndpoints
 	}
 	return nil
 }
 
+// evictions - The connections which are not draining yet and whose pod is not allowed, terminating or replaced
+func evictions(conns []*GrpcConnection, allowed []corev1.Pod) []*GrpcConnection {
+	evicted := make([]*GrpcConnection, 0)
+	for _, p := range conns {
+		if p.isDraining() {
+			continue
+		}
+		reason := "pod gone or not allowed"
+		for _, pod := range allowed {
+			if p.connectionIP == pod.Status.PodIP {
+				reason = podMismatch(p, &pod, nil)
+				if podTerminating(&pod) {
+					reason = "pod terminating"
+				}
+				if reason == "" {
+					p.markVerified(time.Now())
+				}
+				break
+			}
+		}
+		if reason != "" {
+			log.Printf("INFO: updateConnectionPool(): Evicting %s for %s: %s", p.describe(), p.serviceName, reason)
+			decideEviction(p, reason)
+			evicted = append(evicted, p)
+		}
+	}
+	return evicted
+}
+
+// discoverPods - Looks up the service and the pods backing it: the static addresses, the endpoints of the discoverers
+// of WithDiscovery, or the Kubernetes service, see discoverService
+func discoverPods(serviceName, port string, currentConnection *connection) (*corev1.Service, *corev1.PodList, error) {
+	injectDiscoveryDelay(serviceName, currentConnection)
+	if addresses, static := staticAddresses(serviceName); static {
+		return staticDiscovery(serviceName, addresses)
+	}
+	if len(currentConnection.config.discoverers) > 0 {
+		return discoverEndpoints(serviceName, port, currentConnection)
+	}
+	return discoverService(serviceName, port, currentConnection)
+}
+
+// discoverService - Looks up the Kubernetes service and the pods backing it: the pods matching the selector, the
+// addresses of the Endpoints for headless services or the resolved external name for ExternalName services
+func discoverService(serviceName, port string, currentConnection *connection) (*corev1.Service, *corev1.PodList, error) {
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		if errors.Is(err, ErrUnknownCluster) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	svc, namespace, err := getService(serviceName, k8s.CoreV1())
+	if (errors.Is(err, ErrServiceNotFound) || forbidden(err)) && currentConnection.config.searchesNamespaces() &&
+		rebindNamespace(serviceName, currentConnection, k8s.CoreV1()) {
+		svc, namespace, err = getService(serviceName, k8s.CoreV1())
+	}
+	if forbidden(err) {
+		return dnsFallback(serviceName, port, nil, err)
+	}
+	if err != nil {
+		log.Printf("ERROR: updateConnectionPool(): Problem updating pool for service %s. Error %v", serviceName, err)
+		return nil, nil, err
+	}
+	if currentConnection.config.serviceWatch {
+		currentConnection.watchService(serviceName, k8s, svc)
+	}
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		pods, err := externalNamePods(svc, port)
+		if err != nil {
+			log.Printf("ERROR: updateConnectionPool(): Can not resolve %s for service %s. Error %v",
+				svc.Spec.ExternalName, serviceName, err)
+		}
+		return svc, pods, err
+	}
+	if xdsDeferred(serviceName, currentConnection) {
+		pods, err := xdsPods(svc, port, currentConnection.config.xdsListener)
+		if err != nil {
+			log.Printf("ERROR: updateConnectionPool(): No port for the xDS listener of service %s. Error %v", serviceName, err)
+		}
+		return svc, pods, err
+	}
+	if passthrough(serviceName, svc, currentConnection) {
+		pods, err := passthroughPods(svc, port)
+		if err != nil {
+			log.Printf("ERROR: updateConnectionPool(): No port for passthrough to service %s. Error %v", serviceName, err)
+		}
+		return svc, pods, err
+	}
+	pods, err := getPodsForSvc(svc, namespace, k8s.CoreV1())
+	if err != nil {
+		err = kubernetesError(err, "list", "pods", namespace)
+	} else if headless(svc) {
+		// Members of headless services are the addresses of their Endpoints
+		pods.Items, err = endpointPods(svc, pods.Items, k8s.CoreV1(), currentConnection.config.notReadyAddresses)
+		if err != nil {
+			err = kubernetesError(err, "get", "endpoints", namespace)
+		}
+	}
+	if forbidden(err) {
+		// The service is kept for its annotations
+		return dnsFallback(serviceName, port, svc, err)
+	}
+	if err != nil {
+		log.Printf("ERROR: updateConnectionPool(): Problem updating pool for service %s. Can not get pods. Error %v",
+			serviceName, err)
+		return nil, nil, err
+	}
+	return svc, pods, nil
+}
+
+// newGrpcConnection - Dials the pod and creates the client with the user provided factory. Caller must hold mutex.
+func newGrpcConnection(serviceName string, c *connection, pod *corev1.Pod, port string) (*GrpcConnection, *ErrDialFailed) {
+	tlsCredentials, tlsRequired := c.transportCredentials()
+	dialPort, useTLS, err := dialTarget(c.annotatedPort(port, pod), pod, tlsCredentials != nil)
+	if err != nil {
+		return nil, &ErrDialFailed{Pod: pod.Name, IP: pod.Status.PodIP, Err: err}
+	}
+	useTLS = useTLS || tlsRequired
+	gc := &GrpcConnection{
+		connectionIP: pod.Status.PodIP,
+		podName:      pod.Name,
+		namespace:    pod.Namespace,
+		serviceName:  serviceName, // Added to make use of channel for cleaning up connections easier (compare on key)
+		created:      time.Now(),
+		breaker:      newBreaker(c.config.outlierDetection, serviceName+"/"+pod.Name),
+		pool:         c,
+		podUID:       pod.UID,
+		port:         dialPort,
+		labels:       pod.Labels,
+		nodeName:     pod.Spec.NodeName,
+		zone:         podZone(serviceName, pod),
+		tls:          useTLS,
+		addressOnly:  pod.Annotations[addressAnnotation] == "true",
+		rpcAccount:   newRPCAccount(c.config.rpcAccounting),
+	}
+	gc.markVerified(gc.created)
+	gc.warmFrom = gc.created
+	gc.setPodWeight(podWeight(pod, c.config.podWeights))
+	if c.config.maxConnectionAge > 0 {
+		gc.expires = gc.created.Add(jitterAge(c.config.maxConnectionAge, rand.Float64()))
+	}
+	if err := injectDialFault(serviceName, c, pod.Name); err != nil {
+		return nil, &ErrDialFailed{Pod: pod.Name, IP: pod.Status.PodIP, Err: err}
+	}
+	transport := grpc.WithInsecure()
+	if useTLS {
+		transport = grpc.WithTransportCredentials(tlsCredentials)
+	}
+	dialOpts := []grpc.DialOption{transport,
+		grpc.WithUnaryInterceptor(gc.unaryInterceptor), grpc.WithStreamInterceptor(gc.streamInterceptor)}
+	if keepalive := c.config.keepaliveOption(); keepalive != nil {
+		dialOpts = append(dialOpts, keepalive)
+	}
+	if compression := c.config.compressionOption(); compression != nil {
+		dialOpts = append(dialOpts, compression)
+	}
+	if creds := c.config.perRPCCredentials; creds != nil {
+		if useTLS || !creds.RequireTransportSecurity() {
+			dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(creds))
+		} else {
+			log.Printf("WARNING: newGrpcConnection(): Plaintext connection to %s, dialed without the per RPC credentials",
+				pod.Name)
+		}
+	}
+	gc.conn, err = grpc.Dial(grpcTarget(pod, dialPort), dialOpts...)
+	if err != nil {
+		return nil, &ErrDialFailed{Pod: pod.Name, IP: pod.Status.PodIP, Err: err}
+	}
+	gc.GrpcConnection, err = c.newClient(gc)
+	if err != nil {
+		gc.conn.Close()
+		return nil, &ErrDialFailed{Pod: pod.Name, IP: pod.Status.PodIP, Err: err}
+	}
+	go gc.watchState(c.poolContext())
+	if c.config.healthWatch {
+		go gc.watchHealth(c.poolContext(), c.config.healthService)
+	}
+	if c.config.lameduck {
+		go gc.watchLameduck(c.poolContext())
+	}
+	return gc, nil
+}
+
+// countConnections - Returns the number of connections to the ip
+func countConnections(conns []*GrpcConnection, ip string) int {
+	n := 0
+	for _, p := range conns {
+		if p.connectionIP == ip {
+			n++
+		}
+	}
+	return n
+}
+
+// parseServiceName - Splits a service name of the form `service[.namespace[.svc.cluster.local]][:port]` in its components
+// The namespace defaults to the namespace of the pod, see SetDefaultNamespace. A pool searching several namespaces
+// (see WithNamespaces) is in the namespace it is bound to instead.
+// The port is a number or a port name, empty when omitted; it is then inferred per pod (see podPort). A `/pod` suffix
+// (see ConnectPod) is ignored.
+func parseServiceName(serviceName string) (name, namespace, port string, err error) {
+	name, namespace, port, err = splitServiceName(serviceName)
+	if bound := boundNamespace(serviceName); bound != "" && err == nil {
+		namespace = bound
+	}
+	return name, namespace, port, err
+}
+
+// splitServiceName - parseServiceName with the namespace of the service name itself
+func splitServiceName(serviceName string) (name, namespace, port string, err error) {
+	// Cluster suffix, see AddCluster
+	if strings.HasSuffix(serviceName, "@") || strings.Count(serviceName, "@") > 1 {
+		return "", "", "", fmt.Errorf("%w: invalid cluster. Service name: %s", ErrInvalidServiceName, serviceName)
+	}
+	serviceName, _ = splitCluster(serviceName)
+	if i := strings.Index(serviceName, "?"); i >= 0 {
+		// Subset pool, see ConnectSubset
+		if _, err := labels.ConvertSelectorToLabelsMap(serviceName[i+1:]); err != nil || i == len(serviceName)-1 {
+			return "", "", "", fmt.Errorf("%w: invalid subset selector. Service name: %s", ErrInvalidServiceName, serviceName)
+		}
+		serviceName = serviceName[:i]
+	}
+	if i := strings.Index(serviceName, "/"); i >= 0 {
+		// Pod target, see ConnectPod
+		if i == len(serviceName)-1 {
+			return "", "", "", fmt.Errorf("%w: empty pod name. Service name: %s", ErrInvalidServiceName, serviceName)
+		}
+		serviceName = serviceName[:i]
+	}
+	hostPort := strings.Split(serviceName, ":")
+	if len(hostPort) > 2 || (len(hostPort) == 2 && hostPort[1] == "") {
+		return "", "", "", fmt.Errorf("%w: invalid port. Service name: %s", ErrInvalidServiceName, serviceName)
+	}
+	if len(hostPort) == 2 {
+		port = hostPort[1]
+	}
+	serviceSlice := strings.Split(hostPort[0], ".")
+	if serviceSlice[0] == "" || (len(serviceSlice) > 1 && serviceSlice[1] == "") {
+		return "", "", "", fmt.Errorf("%w: not according to convention defined in README. Service name: %s", ErrInvalidServiceName, serviceName)
+	}
+	if len(serviceSlice) == 1 {
+		// No namespace: the namespace of the pod, see SetDefaultNamespace
+		namespace = defaultNamespace()
+		if namespace == "" {
+			return "", "", "", fmt.Errorf("%w: no namespace and the namespace of this pod is unknown. Service name: %s",
+				ErrInvalidServiceName, serviceName)
+		}
+		return serviceSlice[0], namespace, port, nil
+	}
+	return serviceSlice[0], serviceSlice[1], port, nil
+}
+
 func getService(serviceName string, k8sClient typev1.CoreV1Interface) (*corev1.Service, string, error) {
-	listOptions := metav1.ListOptions{}
-	serviceSlice := strings.Split(serviceName, ".")
-	if len(serviceSlice) < 2 {
-		return nil, "", fmt.Errorf("Service name not according to convention defined in README. Service name: %s", serviceName)
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, "", err
 	}
-	namespace := serviceSlice[1]
-	svcs, err := k8sClient.Services(namespace).List(context.Background(), listOptions)
+	if svc := selectorService(name, namespace); svc != nil {
+		return svc, namespace, nil
+	}
+	svc, err := serviceIn(name, namespace, k8sClient)
+	return svc, namespace, err
+}
+
+// serviceIn - Looks up the service with the name in the namespace
+func serviceIn(name, namespace string, k8sClient typev1.CoreV1Interface) (*corev1.Service, error) {
+	svcs, err := k8sClient.Services(namespace).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
-		log.Fatal(err)
+		return nil, kubernetesError(err, "list", "services", namespace)
 	}
-	svcComponents := strings.Split(serviceName, ".")
 	for _, svc := range svcs.Items {
-		if svc.Name == svcComponents[0] {
-			return &svc, namespace, nil
+		if svc.Name == name {
+			return &svc, nil
 		}
 	}
-	return nil, namespace, errors.New("cannot find service")
+	return nil, fmt.Errorf("%w: %s in namespace %s", ErrServiceNotFound, name, namespace)
 }
 
 func getPodsForSvc(svc *corev1.Service, namespace string, k8sClient typev1.CoreV1Interface) (*corev1.PodList, error) {
+	if len(svc.Spec.Selector) == 0 && headless(svc) {
+		// Endpoints managed by hand, an empty selector would list every pod of the namespace
+		return &corev1.PodList{}, nil
+	}
 	set := labels.Set(svc.Spec.Selector)
 	listOptions := metav1.ListOptions{LabelSelector: set.AsSelector().String()}
 	pods, err := k8sClient.Pods(namespace).List(context.Background(), listOptions)
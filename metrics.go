@@ -0,0 +1,104 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync"
+)
+
+// Metric names reported to the Metrics sink
+const (
+	// MetricMaintenanceDegraded - Gauge, 1 while background maintenance is reduced because the process is CPU throttled
+	MetricMaintenanceDegraded = "kubegrpc_maintenance_degraded"
+	// MetricMirroredCalls - Counter of the mirrored calls by service and result (ok, error, dropped)
+	MetricMirroredCalls = "kubegrpc_mirrored_calls"
+	// MetricDiscoveries - Counter of the pod discoveries by service and result (called, coalesced), see SetAPIRateLimit
+	MetricDiscoveries = "kubegrpc_discoveries"
+	// MetricDiscoverySeconds - Histogram of the duration of the discoveries of a pool by service and result (ok, error)
+	MetricDiscoverySeconds = "kubegrpc_discovery_seconds"
+	// MetricDiscoveryAge - Gauge, seconds since the last successful discovery of a pool by service, see WithStaleAfter
+	MetricDiscoveryAge = "kubegrpc_discovery_age_seconds"
+)
+
+// Metrics - Receives the metrics of the package, eg to forward them to Prometheus or OpenCensus.
+// Labels are passed as a map which must not be retained. Implementations must be safe for concurrent use.
+type Metrics interface {
+	Gauge(name string, labels map[string]string, value float64)
+	Counter(name string, labels map[string]string, delta float64)
+	Histogram(name string, labels map[string]string, value float64)
+}
+
+// noMetrics - Default sink, discards everything
+type noMetrics struct{}
+
+func (noMetrics) Gauge(string, map[string]string, float64)     {}
+func (noMetrics) Counter(string, map[string]string, float64)   {}
+func (noMetrics) Histogram(string, map[string]string, float64) {}
+
+// Labels identifying the endpoint in the per endpoint metrics, see SetEndpointMetricLabels
+const (
+	EndpointLabelPod  = "pod"
+	EndpointLabelNode = "node"
+	EndpointLabelZone = "zone"
+	EndpointLabelIP   = "ip"
+)
+
+var (
+	metrics        Metrics = noMetrics{}
+	endpointLabels         = []string{EndpointLabelPod}
+	metricsMutex           = &sync.RWMutex{}
+)
+
+// SetMetrics - Sets the sink for the metrics of the package
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = noMetrics{}
+	}
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	metrics = m
+}
+
+// getMetrics - Returns the current metrics sink
+func getMetrics() Metrics {
+	metricsMutex.RLock()
+	defer metricsMutex.RUnlock()
+	return metrics
+}
+
+// SetEndpointMetricLabels - Selects the labels identifying the endpoint in the per endpoint metrics (eg
+// MetricEndpointRequests), to control their cardinality: EndpointLabelPod (default), EndpointLabelNode,
+// EndpointLabelZone and EndpointLabelIP. Every pod restart creates new pod and ip series; EndpointLabelZone alone keeps
+// a few series per service. Without labels the metrics are reported per service only.
+func SetEndpointMetricLabels(labels ...string) {
+	selected := make([]string, 0, len(labels))
+	for _, label := range labels {
+		switch label {
+		case EndpointLabelPod, EndpointLabelNode, EndpointLabelZone, EndpointLabelIP:
+			selected = append(selected, label)
+		default:
+			log.Printf("WARNING: SetEndpointMetricLabels(): Unknown endpoint label %q ignored", label)
+		}
+	}
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	endpointLabels = selected
+}
+
+// metricLabels - The labels of a per endpoint metric: the given labels and the selected endpoint labels
+func (c *GrpcConnection) metricLabels(labels map[string]string) map[string]string {
+	metricsMutex.RLock()
+	defer metricsMutex.RUnlock()
+	for _, label := range endpointLabels {
+		switch label {
+		case EndpointLabelPod:
+			labels[label] = c.podName
+		case EndpointLabelNode:
+			labels[label] = c.nodeName
+		case EndpointLabelZone:
+			labels[label] = c.zone
+		case EndpointLabelIP:
+			labels[label] = c.connectionIP
+		}
+	}
+	return labels
+}
@@ -0,0 +1,150 @@
+package kubegrpc
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// mirrorHeader - Metadata key set on mirrored calls, so the servers can tell shadow traffic apart
+const mirrorHeader = "kube-grpc-mirror"
+
+// MirrorPolicy - Copies a share of the unary RPCs of a pool to a secondary target, eg a new version of the service,
+// to validate it with production traffic. Mirrored calls are sent in the background with the metadata of the original
+// call plus `kube-grpc-mirror: true`; their responses and errors are discarded and never affect the original call.
+// Only protobuf requests are mirrored, call options are not copied.
+type MirrorPolicy struct {
+	ServiceName string            // Pool receiving the copies, eg "svc-v2.ns:50051"; must be connected by the application
+	Selector    map[string]string // Without ServiceName: the pods of this pool with these labels receive the copies and no regular picks
+	Percent     float64           // Share of the calls mirrored, 0-100
+	Methods     []string          // Methods mirrored, matched as in RetryPolicy, default all
+	Timeout     time.Duration     // Deadline of a mirrored call, default 1s
+	MaxInFlight int               // Mirrored calls in flight per pool, further copies are dropped, default 100
+}
+
+// WithMirror - Mirrors a share of the unary RPCs of the pool, see MirrorPolicy. A policy without ServiceName and
+// Selector is ignored.
+func WithMirror(m MirrorPolicy) PoolOption {
+	return func(c *poolConfig) {
+		if m.ServiceName == "" && len(m.Selector) == 0 {
+			log.Printf("WARNING: WithMirror(): Mirror policy without ServiceName or Selector ignored")
+			return
+		}
+		if m.Percent > 100 {
+			m.Percent = 100
+		}
+		if len(m.Methods) == 0 {
+			m.Methods = []string{"*"}
+		}
+		if m.Timeout <= 0 {
+			m.Timeout = time.Second
+		}
+		if m.MaxInFlight <= 0 {
+			m.MaxInFlight = 100
+		}
+		c.mirrorPolicy = &m
+	}
+}
+
+// matchLabels - True if the labels contain all labels of the selector
+func matchLabels(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if value, found := labels[k]; !found || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// isShadow - True if the connection only receives mirrored calls of its pool
+func (c *GrpcConnection) isShadow() bool {
+	if c.pool == nil || c.pool.config.mirrorPolicy == nil || c.pool.config.mirrorPolicy.ServiceName != "" {
+		return false
+	}
+	return matchLabels(c.pool.config.mirrorPolicy.Selector, c.labels)
+}
+
+// withoutShadows - The connections which receive regular picks. Returns the connections unchanged if all are shadows.
+func withoutShadows(conns []*GrpcConnection) []*GrpcConnection {
+	if len(conns) == 0 || conns[0].pool == nil || conns[0].pool.config.mirrorPolicy == nil {
+		return conns
+	}
+	regular := make([]*GrpcConnection, 0, len(conns))
+	for _, c := range conns {
+		if !c.isShadow() {
+			regular = append(regular, c)
+		}
+	}
+	if len(regular) == 0 {
+		return conns
+	}
+	return regular
+}
+
+// mirrorTarget - Picks the connection receiving the copy of a call, nil if there is none
+func (c *GrpcConnection) mirrorTarget(m *MirrorPolicy) *GrpcConnection {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if m.ServiceName != "" {
+		secondary := connectionCache[m.ServiceName]
+		if secondary == nil || len(secondary.grpcConnection) == 0 {
+			return nil
+		}
+		return pickConnection(m.ServiceName, secondary.grpcConnection)
+	}
+	shadows := make([]*GrpcConnection, 0)
+	for _, gc := range c.pool.grpcConnection {
+		if gc.isShadow() && !gc.isDraining() && gc.weight() > 0 {
+			shadows = append(shadows, gc)
+		}
+	}
+	if len(shadows) == 0 {
+		return nil
+	}
+	return shadows[randomOf(c.pool).Intn(len(shadows))]
+}
+
+// mirror - Sends a copy of the call in the background if the policy of the pool selects it
+func (c *GrpcConnection) mirror(ctx context.Context, method string, req, reply interface{}, invoker grpc.UnaryInvoker) {
+	m := c.pool.config.mirrorPolicy
+	if m.Percent <= 0 || randomOf(c.pool).Float64()*100 >= m.Percent || !matchMethod(m.Methods, method) {
+		return
+	}
+	reqMessage, ok := req.(proto.Message)
+	replyMessage, ok2 := reply.(proto.Message)
+	if !ok || !ok2 {
+		return
+	}
+	labels := map[string]string{"service": c.serviceName}
+	target := c.mirrorTarget(m)
+	if target == nil || atomic.AddInt64(&c.pool.mirrorInFlight, 1) > int64(m.MaxInFlight) {
+		if target != nil {
+			atomic.AddInt64(&c.pool.mirrorInFlight, -1)
+		}
+		labels["result"] = "dropped"
+		getMetrics().Counter(MetricMirroredCalls, labels, 1)
+		return
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(mirrorHeader, "true")
+	// The copy must outlive the original call, and the caller may reuse the request once the call returned
+	mctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), m.Timeout)
+	r := proto.Clone(replyMessage)
+	r.Reset()
+	copied := proto.Clone(reqMessage)
+	go func() {
+		defer cancel()
+		defer atomic.AddInt64(&c.pool.mirrorInFlight, -1)
+		labels["result"] = "ok"
+		if err := target.invoke(mctx, method, copied, r, invoker); err != nil {
+			labels["result"] = "error"
+		}
+		getMetrics().Counter(MetricMirroredCalls, labels, 1)
+	}()
+}
@@ -0,0 +1,121 @@
+package kubegrpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// mirroredTargets - Targets of the calls carrying the mirror header, waits up to a second for want of them
+func mirroredTargets(inv *recordingInvoker, mirrored map[string]bool, want int) int {
+	for i := 0; i < 100; i++ {
+		inv.mutex.Lock()
+		n := len(mirrored)
+		inv.mutex.Unlock()
+		if n >= want {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	return len(mirrored)
+}
+
+func TestWithMirrorWithoutTarget(t *testing.T) {
+	if c := newPoolConfig([]PoolOption{WithMirror(MirrorPolicy{Percent: 10})}); c.mirrorPolicy != nil {
+		t.Error("mirror policy without target applied")
+	}
+}
+
+func TestMirrorToShadowSubset(t *testing.T) {
+	p := testPool(t, 3, WithMirror(MirrorPolicy{Selector: map[string]string{"version": "v2"}, Percent: 100}))
+	p.grpcConnection[2].labels = map[string]string{"version": "v2"}
+	mirrored := make(map[string]bool)
+	var inv *recordingInvoker
+	inv = &recordingInvoker{answer: func(ctx context.Context, target string, reply interface{}) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if len(md.Get(mirrorHeader)) == 0 {
+			reply.(*wrappers.StringValue).Value = "primary"
+			return nil
+		}
+		if md.Get("x-trace")[0] != "abc" {
+			t.Errorf("mirrored call metadata = %v, want original metadata", md)
+		}
+		inv.mutex.Lock()
+		mirrored[target] = true
+		inv.mutex.Unlock()
+		reply.(*wrappers.StringValue).Value = "shadow"
+		return status.Error(codes.Internal, "shadow failure")
+	}}
+	first := p.grpcConnection[0]
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-trace", "abc")
+	reply := &wrappers.StringValue{}
+	if err := first.unaryInterceptor(ctx, "/pkg.Svc/Get", &wrappers.StringValue{}, reply, first.conn, inv.invoke); err != nil ||
+		reply.Value != "primary" {
+		t.Fatalf("call = %q, %v, want primary result", reply.Value, err)
+	}
+	if n := mirroredTargets(inv, mirrored, 1); n != 1 || !mirrored["10.0.0.3:1000"] {
+		t.Errorf("mirrored to %v, want the shadow pod only", mirrored)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for i := 0; i < 50; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection) == p.grpcConnection[2] {
+			t.Fatal("shadow pod picked")
+		}
+	}
+}
+
+func TestMirrorToSecondaryPool(t *testing.T) {
+	secondary := newConnection(okBalancer{}, newPoolConfig(nil))
+	pod := testPod("v2-1", "ns", "svc-v2", "10.0.1.1")
+	gc, err := newGrpcConnection("svc-v2.ns:1000", secondary, pod, "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.conn.Close()
+	secondary.grpcConnection = []*GrpcConnection{gc}
+	mutex.Lock()
+	setPool("svc-v2.ns:1000", secondary)
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		removePool("svc-v2.ns:1000")
+		mutex.Unlock()
+	}()
+	p := testPool(t, 2, WithMirror(MirrorPolicy{ServiceName: "svc-v2.ns:1000", Percent: 100,
+		Methods: []string{"/pkg.Svc/Get"}}))
+	mirrored := make(map[string]bool)
+	var inv *recordingInvoker
+	inv = &recordingInvoker{answer: func(ctx context.Context, target string, _ interface{}) error {
+		if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(mirrorHeader)) > 0 {
+			inv.mutex.Lock()
+			mirrored[target] = true
+			inv.mutex.Unlock()
+		}
+		return nil
+	}}
+	first := p.grpcConnection[0]
+	for i, method := range []string{"/pkg.Svc/Put", "/pkg.Svc/Get"} {
+		first.unaryInterceptor(context.Background(), method, &wrappers.StringValue{}, &wrappers.StringValue{}, first.conn,
+			inv.invoke)
+		if n := mirroredTargets(inv, mirrored, i); n != i {
+			t.Errorf("%s mirrored to %v", method, mirrored)
+		}
+	}
+	if !mirrored["10.0.1.1:1000"] {
+		t.Errorf("mirrored to %v, want the secondary pool", mirrored)
+	}
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	if n := len(inv.targets); n != 3 {
+		t.Errorf("calls = %d (%s), want 2 originals and 1 copy", n, fmt.Sprint(inv.targets))
+	}
+}
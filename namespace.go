@@ -0,0 +1,153 @@
+package kubegrpc
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+var (
+	defaultNamespaceValue string
+	defaultNamespaceMutex = &sync.RWMutex{}
+
+	// namespaceBindings - Namespace the pools searching several namespaces are bound to by service name
+	// (map[string]string), copied on write under namespacesMutex so parseServiceName reads it without locking
+	namespaceBindings atomic.Value
+	namespacesMutex   = &sync.Mutex{}
+)
+
+// SetDefaultNamespace - Sets the namespace of service names without namespace (`service[:port]`). Without it (or
+// after setting ""), the namespace of the pod running this code is used: the POD_NAMESPACE environment variable
+// (downward API) or the service account mount. Mostly useful outside of a cluster.
+func SetDefaultNamespace(namespace string) {
+	defaultNamespaceMutex.Lock()
+	defer defaultNamespaceMutex.Unlock()
+	defaultNamespaceValue = namespace
+}
+
+// defaultNamespace - The namespace for service names without namespace, empty if it can not be determined
+func defaultNamespace() string {
+	defaultNamespaceMutex.RLock()
+	namespace := defaultNamespaceValue
+	defaultNamespaceMutex.RUnlock()
+	if namespace != "" {
+		return namespace
+	}
+	return clientNamespace()
+}
+
+// WithNamespaces - For a shared service which lives in one of several namespaces depending on the environment: the
+// service is looked up in the namespace of the service name first, then in the namespaces in the order given, and the
+// pool binds to the first namespace the service exists in. The pool stays bound while the service exists there; when
+// it moves (is deleted and created in another candidate namespace) the next refresh binds the pool to the new namespace
+// and replaces the pods. The pool keeps the service name it was created with. Needs `list` on services in all
+// candidate namespaces.
+func WithNamespaces(namespaces ...string) PoolOption {
+	return func(c *poolConfig) {
+		c.namespaces = append(c.namespaces, namespaces...)
+	}
+}
+
+// WithNamespaceSelector - WithNamespaces for all namespaces with the labels, eg {"team": "payments"}, in the order of
+// their names; an empty selector searches all namespaces. The namespaces are listed whenever the service is not found
+// in the namespace the pool is bound to, which needs `list` on namespaces (a ClusterRole).
+func WithNamespaceSelector(selector map[string]string) PoolOption {
+	return func(c *poolConfig) {
+		c.namespaceSelector = selector
+		c.namespaceSearch = true
+	}
+}
+
+// searchesNamespaces - Whether the service of the pool is looked up in more than one namespace
+func (c poolConfig) searchesNamespaces() bool {
+	return len(c.namespaces) > 0 || c.namespaceSearch
+}
+
+// boundNamespace - The namespace the pool of the service name is bound to, empty if it is not bound
+func boundNamespace(serviceName string) string {
+	bindings, _ := namespaceBindings.Load().(map[string]string)
+	return bindings[serviceName]
+}
+
+// bindNamespace - Binds the pool of the service name to the namespace, unbinds it for an empty namespace
+func bindNamespace(serviceName, namespace string) {
+	namespacesMutex.Lock()
+	defer namespacesMutex.Unlock()
+	current, _ := namespaceBindings.Load().(map[string]string)
+	next := make(map[string]string, len(current)+1)
+	for name, bound := range current {
+		next[name] = bound
+	}
+	if namespace == "" {
+		delete(next, serviceName)
+	} else {
+		next[serviceName] = namespace
+	}
+	namespaceBindings.Store(next)
+}
+
+// unbindNamespace - Forgets the namespace of a closed pool
+func unbindNamespace(serviceName string) {
+	if boundNamespace(serviceName) != "" {
+		bindNamespace(serviceName, "")
+	}
+}
+
+// candidateNamespaces - The namespaces the service of the pool is looked up in, in order: the namespace of the
+// service name, the namespaces of WithNamespaces and the ones matching WithNamespaceSelector
+func candidateNamespaces(serviceName string, c *connection, k8s typev1.CoreV1Interface) ([]string, error) {
+	_, own, _, err := splitServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	candidates := append([]string{own}, c.config.namespaces...)
+	if c.config.namespaceSearch {
+		selector := labels.Set(c.config.namespaceSelector).AsSelector().String()
+		list, err := k8s.Namespaces().List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, kubernetesError(err, "list", "namespaces", "")
+		}
+		matching := make([]string, 0, len(list.Items))
+		for _, ns := range list.Items {
+			matching = append(matching, ns.Name)
+		}
+		sort.Strings(matching)
+		candidates = append(candidates, matching...)
+	}
+	return candidates, nil
+}
+
+// rebindNamespace - Looks for the service in the candidate namespaces of the pool after it was not found (or not
+// accessible) in the namespace the pool is bound to, and binds the pool to the first one it exists in. Returns false
+// if the service exists in none of them.
+func rebindNamespace(serviceName string, c *connection, k8s typev1.CoreV1Interface) bool {
+	name, current, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return false
+	}
+	candidates, err := candidateNamespaces(serviceName, c, k8s)
+	if err != nil {
+		log.Printf("ERROR: rebindNamespace(): Can not list the namespaces for %s. Error %v", serviceName, err)
+		return false
+	}
+	for _, namespace := range candidates {
+		if namespace == current {
+			continue
+		}
+		if _, err := serviceIn(name, namespace, k8s); err != nil {
+			continue
+		}
+		bindNamespace(serviceName, namespace)
+		log.Printf("INFO: rebindNamespace(): Pool %s bound to namespace %s, the service is not in namespace %s",
+			serviceName, namespace, current)
+		return true
+	}
+	log.Printf("WARNING: rebindNamespace(): Service of %s found in none of the namespaces %v", serviceName, candidates)
+	return false
+}
@@ -0,0 +1,117 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// useDefaultNamespace - Sets the default namespace for the test
+func useDefaultNamespace(t *testing.T, namespace string) {
+	SetDefaultNamespace(namespace)
+	t.Cleanup(func() { SetDefaultNamespace("") })
+}
+
+// noClientNamespace - Runs the test as outside of a pod, whatever POD_NAMESPACE or the service account mount say
+func noClientNamespace(t *testing.T) {
+	namespace := clientNamespace()
+	clientNamespaceValue = ""
+	t.Cleanup(func() { clientNamespaceValue = namespace })
+}
+
+func TestParseServiceNameDefaultNamespace(t *testing.T) {
+	noClientNamespace(t)
+	if _, _, _, err := parseServiceName("abc:1000"); !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("parseServiceName() without known namespace error = %v, want ErrInvalidServiceName", err)
+	}
+	useDefaultNamespace(t, "team")
+	name, namespace, port, err := parseServiceName("abc:1000")
+	if err != nil || name != "abc" || namespace != "team" || port != "1000" {
+		t.Errorf("parseServiceName() = %q, %q, %q, %v, want the default namespace", name, namespace, port, err)
+	}
+	if _, namespace, _, _ := parseServiceName("abc.other:1000"); namespace != "other" {
+		t.Errorf("parseServiceName() namespace = %q, want the explicit namespace", namespace)
+	}
+	for _, s := range []string{".ns:1000", "abc.:1000"} {
+		if _, _, _, err := parseServiceName(s); !errors.Is(err, ErrInvalidServiceName) {
+			t.Errorf("parseServiceName(%s) error = %v, want ErrInvalidServiceName", s, err)
+		}
+	}
+	if key := podKey("abc:1000", "", "abc-0"); key != "abc:1000/abc-0" {
+		t.Errorf("podKey() = %q, want the key without namespace", key)
+	}
+}
+
+func TestConnectDefaultNamespace(t *testing.T) {
+	useDefaultNamespace(t, "team")
+	useFakeClientset(t, testService("local", "team"), testPod("local-0", "team", "local", "10.0.0.1"))
+	defer ClosePool("local:1000")
+	if _, err := Connect("local:1000", okBalancer{}); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if conns := Connections("local:1000"); len(conns) != 1 || conns[0].namespace != "team" {
+		t.Errorf("Connections() = %v, want the pod in the default namespace", conns)
+	}
+}
+
+// namespaceOf - Namespaces of the connections of the pool which are not draining
+func namespaceOf(serviceName string) []string {
+	namespaces := make([]string, 0)
+	for _, gc := range Connections(serviceName) {
+		if !gc.isDraining() {
+			namespaces = append(namespaces, gc.Info().Namespace)
+		}
+	}
+	return namespaces
+}
+
+func TestWithNamespaces(t *testing.T) {
+	dev := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": "dev"}}}
+	}
+	useFakeClientset(t, testService("shared", "team-b"), testPod("shared-0", "team-b", "shared", "10.0.0.1"),
+		dev("dev-1"), dev("dev-2"), testService("moving", "dev-1"), testPod("moving-0", "dev-1", "moving", "10.0.0.2"))
+
+	defer ClosePool("shared.team-a:1000")
+	if _, err := ConnectWithOptions("shared.team-a:1000", okBalancer{}, WithNamespaces("team-c", "team-b")); err != nil {
+		t.Fatal(err)
+	}
+	if got := namespaceOf("shared.team-a:1000"); len(got) != 1 || got[0] != "team-b" {
+		t.Errorf("connections in namespaces %v, want team-b", got)
+	}
+	if _, namespace, _, _ := parseServiceName("shared.team-a:1000"); namespace != "team-b" {
+		t.Errorf("pool bound to namespace %q, want team-b", namespace)
+	}
+
+	// The service moves to another namespace matching the selector
+	defer ClosePool("moving.prod:1000")
+	if _, err := ConnectWithOptions("moving.prod:1000", okBalancer{},
+		WithNamespaceSelector(map[string]string{"env": "dev"})); err != nil {
+		t.Fatal(err)
+	}
+	cs := clientset.(*fake.Clientset)
+	if err := cs.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("services"), "dev-1", "moving"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Tracker().Add(testService("moving", "dev-2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Tracker().Add(testPod("moving-0", "dev-2", "moving", "10.0.0.3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Refresh("moving.prod:1000"); err != nil {
+		t.Fatal(err)
+	}
+	// The pod in the old namespace drains
+	if got := namespaceOf("moving.prod:1000"); len(got) != 1 || got[0] != "dev-2" {
+		t.Errorf("connections in namespaces %v after the move, want dev-2", got)
+	}
+
+	ClosePool("moving.prod:1000")
+	if namespace := boundNamespace("moving.prod:1000"); namespace != "" {
+		t.Errorf("closed pool still bound to %s", namespace)
+	}
+}
@@ -0,0 +1,184 @@
+package kubegrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Defaults of NewNodeScorer
+const (
+	defaultNodeMetricsInterval = 30 * time.Second
+	defaultNodeCPUThreshold    = 0.8
+	// nodeScoreFloor - Score of an endpoint on a fully saturated node, which is down-weighted but still picked
+	nodeScoreFloor = 0.1
+	// nodeMetricsMaxAge - Refresh intervals after which the utilization of a failing source is no longer used
+	nodeMetricsMaxAge = 3
+)
+
+// nodeMetricsPath - The node metrics of metrics-server
+const nodeMetricsPath = "/apis/metrics.k8s.io/v1beta1/nodes"
+
+// fetchNodeMetrics - Reads the NodeMetricsList of metrics-server, replaced in tests
+var fetchNodeMetrics = func(ctx context.Context, k8s kubernetes.Interface) ([]byte, error) {
+	return k8s.CoreV1().RESTClient().Get().AbsPath(nodeMetricsPath).DoRaw(ctx)
+}
+
+// NodeMetricsSource - Source of the CPU utilization of the nodes: the fraction [0-1] of the allocatable CPU in use, by
+// node name
+type NodeMetricsSource interface {
+	NodeUtilization(ctx context.Context) (map[string]float64, error)
+}
+
+// NodeMetricsFunc - Adapter to use an ordinary function as NodeMetricsSource, eg to read a Prometheus query
+type NodeMetricsFunc func(ctx context.Context) (map[string]float64, error)
+
+// NodeUtilization - Implements NodeMetricsSource
+func (f NodeMetricsFunc) NodeUtilization(ctx context.Context) (map[string]float64, error) {
+	return f(ctx)
+}
+
+// metricsServerSource - NodeMetricsSource of MetricsServerSource
+type metricsServerSource struct{}
+
+// MetricsServerSource - The CPU usage of the nodes reported by metrics-server (`metrics.k8s.io`) divided by their
+// allocatable CPU. The service account needs `list` on `nodes` and on `nodes` of the API group `metrics.k8s.io`.
+func MetricsServerSource() NodeMetricsSource {
+	return metricsServerSource{}
+}
+
+// nodeMetricsList - The fields of the metrics.k8s.io NodeMetricsList used by metricsServerSource
+type nodeMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Usage struct {
+			CPU string `json:"cpu"`
+		} `json:"usage"`
+	} `json:"items"`
+}
+
+func (metricsServerSource) NodeUtilization(ctx context.Context) (map[string]float64, error) {
+	k8s, err := getClientset()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	nodes, err := k8s.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, kubernetesError(err, "list", "nodes", "")
+	}
+	raw, err := fetchNodeMetrics(ctx, k8s)
+	if err != nil {
+		return nil, kubernetesError(err, "list", "nodes.metrics.k8s.io", "")
+	}
+	var metrics nodeMetricsList
+	if err := json.Unmarshal(raw, &metrics); err != nil {
+		return nil, fmt.Errorf("invalid node metrics: %v", err)
+	}
+	allocatable := make(map[string]int64, len(nodes.Items))
+	for _, node := range nodes.Items {
+		allocatable[node.Name] = node.Status.Allocatable.Cpu().MilliValue()
+	}
+	utilization := make(map[string]float64, len(metrics.Items))
+	for _, m := range metrics.Items {
+		usage, err := resource.ParseQuantity(m.Usage.CPU)
+		if err != nil || allocatable[m.Metadata.Name] <= 0 {
+			continue
+		}
+		utilization[m.Metadata.Name] = float64(usage.MilliValue()) / float64(allocatable[m.Metadata.Name])
+	}
+	return utilization, nil
+}
+
+// nodeUtilization - Utilization of the nodes as of the last successful refresh
+type nodeUtilization struct {
+	nodes   map[string]float64
+	updated time.Time
+}
+
+// NodeScorer - Scorer down-weighting the endpoints on CPU-saturated nodes, for clusters whose servers do not report
+// their load (see WithLoadReports). Register it for the pools with RegisterScorer; one NodeScorer can serve many pools.
+type NodeScorer struct {
+	source      NodeMetricsSource
+	interval    time.Duration
+	threshold   float64
+	utilization atomic.Value // nodeUtilization, read by the picks without locking
+}
+
+// NewNodeScorer - Reads the utilization of the nodes from the source (nil for MetricsServerSource) every interval
+// (default 30s) until ctx is done. Endpoints on nodes up to the threshold utilization (default 0.8) score 1, above it
+// the score falls linearly to 0.1 at full utilization. Endpoints on unknown nodes score 1, as do all endpoints while
+// the source failed for three intervals in a row.
+func NewNodeScorer(ctx context.Context, source NodeMetricsSource, interval time.Duration, threshold float64) *NodeScorer {
+	if source == nil {
+		source = MetricsServerSource()
+	}
+	if interval <= 0 {
+		interval = defaultNodeMetricsInterval
+	}
+	if threshold <= 0 || threshold >= 1 {
+		threshold = defaultNodeCPUThreshold
+	}
+	s := &NodeScorer{source: source, interval: interval, threshold: threshold}
+	s.utilization.Store(nodeUtilization{})
+	s.refresh(ctx)
+	go s.run(ctx)
+	return s
+}
+
+// run - Refreshes the utilization every interval until ctx is done
+func (s *NodeScorer) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refresh(ctx)
+		}
+	}
+}
+
+// refresh - Reads the utilization from the source, the last one is kept if it fails
+func (s *NodeScorer) refresh(ctx context.Context) {
+	nodes, err := s.source.NodeUtilization(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("WARNING: NodeScorer.refresh(): No node metrics. Error %v", err)
+		}
+		return
+	}
+	s.utilization.Store(nodeUtilization{nodes: nodes, updated: time.Now()})
+}
+
+// Score - Implements Scorer
+func (s *NodeScorer) Score(ep EndpointInfo, _ EndpointStats) float64 {
+	u, ok := s.nodeUtilization(ep.NodeName)
+	if !ok || u <= s.threshold {
+		return 1
+	}
+	score := (1 - u) / (1 - s.threshold)
+	if score < nodeScoreFloor {
+		return nodeScoreFloor
+	}
+	return score
+}
+
+// nodeUtilization - The utilization of the node, false if unknown or outdated
+func (s *NodeScorer) nodeUtilization(node string) (float64, bool) {
+	current := s.utilization.Load().(nodeUtilization)
+	if node == "" || time.Since(current.updated) > nodeMetricsMaxAge*s.interval {
+		return 0, false
+	}
+	u, ok := current.nodes[node]
+	return u, ok
+}
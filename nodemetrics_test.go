@@ -0,0 +1,60 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestNodeScorer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failing := false
+	s := NewNodeScorer(ctx, NodeMetricsFunc(func(context.Context) (map[string]float64, error) {
+		if failing {
+			return nil, errors.New("metrics unavailable")
+		}
+		return map[string]float64{"idle": 0.2, "busy": 0.95, "full": 1}, nil
+	}), time.Hour, 0.8)
+	for node, want := range map[string]float64{"idle": 1, "busy": 0.25, "full": nodeScoreFloor, "unknown": 1, "": 1} {
+		if got := s.Score(EndpointInfo{NodeName: node}, EndpointStats{}); math.Abs(got-want) > 1e-9 {
+			t.Errorf("Score(%q) = %v, want %v", node, got, want)
+		}
+	}
+	failing = true
+	s.refresh(ctx)
+	if got := s.Score(EndpointInfo{NodeName: "busy"}, EndpointStats{}); math.Abs(got-0.25) > 1e-9 {
+		t.Errorf("Score() after a failed refresh = %v, want the last utilization", got)
+	}
+	current := s.utilization.Load().(nodeUtilization)
+	current.updated = time.Now().Add(-nodeMetricsMaxAge * time.Hour)
+	s.utilization.Store(current)
+	if got := s.Score(EndpointInfo{NodeName: "busy"}, EndpointStats{}); got != 1 {
+		t.Errorf("Score() with outdated metrics = %v, want 1", got)
+	}
+}
+
+func TestMetricsServerSource(t *testing.T) {
+	node := func(name, cpu string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}}
+	}
+	useFakeClientset(t, node("a", "4"), node("b", "2"))
+	previous := fetchNodeMetrics
+	t.Cleanup(func() { fetchNodeMetrics = previous })
+	fetchNodeMetrics = func(context.Context, kubernetes.Interface) ([]byte, error) {
+		return []byte(`{"items": [{"metadata": {"name": "a"}, "usage": {"cpu": "1"}},
+			{"metadata": {"name": "b"}, "usage": {"cpu": "1900m"}}, {"metadata": {"name": "gone"}, "usage": {"cpu": "1"}}]}`), nil
+	}
+	utilization, err := MetricsServerSource().NodeUtilization(context.Background())
+	if err != nil || len(utilization) != 2 || utilization["a"] != 0.25 || utilization["b"] != 0.95 {
+		t.Errorf("NodeUtilization() = %v, %v, want a at 0.25 and b at 0.95", utilization, err)
+	}
+}
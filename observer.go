@@ -0,0 +1,105 @@
+package kubegrpc
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolNotFound - There is no pool for the service (Connect/Pool was not called yet, or the pool was closed)
+var ErrPoolNotFound = errors.New("kubegrpc: pool not found")
+
+// EndpointSnapshot - Description and statistics of a single connection
+type EndpointSnapshot struct {
+	Info  EndpointInfo
+	Stats EndpointStats
+}
+
+// PoolStats - Point in time snapshot of a pool
+type PoolStats struct {
+	ServiceName   string
+	Degraded      bool
+	Version       uint64 // Snapshot version of the endpoint set, incremented by every change; events carry the same version
+	Endpoints     []EndpointSnapshot
+	BackingOff    []BackoffState // Pods which failed to dial or their health check, sorted by IP, see WithDialBackoff
+	Handles       int            // Open handles sharing the pool, see Acquire
+	LastDiscovery time.Time      // End of the last successful discovery of the pods, zero before the first one
+	DiscoveryTime time.Duration  // Duration of the last successful discovery
+	Staleness     time.Duration  // Time since the last successful discovery, or since the creation of the pool
+	Stale         bool           // Not discovered within the WithStaleAfter refresh intervals
+}
+
+// Stats - Returns a snapshot of the pool of the service
+func Stats(serviceName string) (PoolStats, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	c := connectionCache[serviceName]
+	if c == nil {
+		return PoolStats{}, ErrPoolNotFound
+	}
+	return poolStats(serviceName, c), nil
+}
+
+// poolStats - Builds the snapshot of the pool. Caller must hold mutex.
+func poolStats(serviceName string, c *connection) PoolStats {
+	s := PoolStats{
+		ServiceName:   serviceName,
+		Degraded:      c.degraded,
+		Version:       c.snapshotVersion(),
+		Endpoints:     make([]EndpointSnapshot, 0, len(c.grpcConnection)),
+		BackingOff:    c.backoff.snapshot(),
+		Handles:       poolRefs[serviceName],
+		LastDiscovery: c.discovered,
+		DiscoveryTime: c.discoveryTime,
+		Staleness:     c.discoveryAge(time.Now()),
+		Stale:         c.stale,
+	}
+	for _, gc := range c.grpcConnection {
+		s.Endpoints = append(s.Endpoints, EndpointSnapshot{Info: gc.Info(), Stats: gc.Stats()})
+	}
+	return s
+}
+
+// Observer - Read only handle to an existing pool: receives the membership and health events and can read the
+// statistics, but can not pick connections. Intended for dashboards and sidecars which want visibility without the
+// risk of making calls.
+type Observer struct {
+	serviceName string
+	listener    *eventListener
+	once        sync.Once
+}
+
+// Observe - Attaches an observer to the existing pool of the service. Returns ErrPoolNotFound if there is no pool.
+// The observer must be closed when no longer needed.
+func Observe(serviceName string) (*Observer, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if connectionCache[serviceName] == nil {
+		return nil, ErrPoolNotFound
+	}
+	return &Observer{serviceName: serviceName, listener: addListener(serviceName)}, nil
+}
+
+// Events - Membership and health events of the pool. Events are dropped when the channel is not drained fast enough
+// (see Dropped). The channel is closed by Close.
+func (o *Observer) Events() <-chan PoolEvent {
+	return o.listener.ch
+}
+
+// Dropped - Number of events dropped because the observer did not keep up
+func (o *Observer) Dropped() uint64 {
+	return atomic.LoadUint64(&o.listener.dropped)
+}
+
+// Stats - Snapshot of the observed pool
+func (o *Observer) Stats() (PoolStats, error) {
+	return Stats(o.serviceName)
+}
+
+// Close - Detaches the observer and closes the event channel
+func (o *Observer) Close() {
+	o.once.Do(func() {
+		removeListener(o.serviceName, o.listener)
+	})
+}
@@ -0,0 +1,103 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestObserveUnknownPool(t *testing.T) {
+	if _, err := Observe("unknown.ns:1000"); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("Observe() error = %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestObserverReceivesEvents(t *testing.T) {
+	const svc = "observed.ns:1000"
+	useFakeClientset(t, testService("observed", "ns"), testPod("observed-0", "ns", "observed", "10.0.0.1"))
+	c := &connection{functions: okBalancer{}, config: newPoolConfig([]PoolOption{WithMinHealthy(2)})}
+	mutex.Lock()
+	setPool(svc, c)
+	mutex.Unlock()
+	defer ClosePool(svc)
+
+	o, err := Observe(svc)
+	if err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	defer o.Close()
+	if err := updateConnectionPool(svc, c, true); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	e := <-o.Events()
+	if e.Type != EndpointAdded || e.Endpoint.PodName != "observed-0" || e.Connections != 1 {
+		t.Errorf("first event = %+v, want EndpointAdded for observed-0", e)
+	}
+	if e = <-o.Events(); e.Type != PoolDegraded {
+		t.Errorf("second event = %v, want PoolDegraded", e.Type)
+	}
+	stats, err := o.Stats()
+	if err != nil || len(stats.Endpoints) != 1 || !stats.Degraded || stats.Endpoints[0].Info.IP != "10.0.0.1" {
+		t.Errorf("Stats() = %+v, %v", stats, err)
+	}
+
+	o.Close()
+	for range o.Events() {
+	}
+	if o.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", o.Dropped())
+	}
+}
+
+func TestEmitDoesNotBlock(t *testing.T) {
+	l := addListener("slow.ns:1000")
+	defer removeListener("slow.ns:1000", l)
+	for i := 0; i < eventBufferSize+10; i++ {
+		emit(PoolEvent{Type: EndpointAdded, ServiceName: "slow.ns:1000"})
+	}
+	if l.dropped != 10 {
+		t.Errorf("dropped = %d, want 10", l.dropped)
+	}
+}
+
+func TestSubscribeBeforeConnect(t *testing.T) {
+	const svc = "subscribed.ns:1000"
+	useFakeClientset(t, testService("subscribed", "ns"), testPod("subscribed-0", "ns", "subscribed", "10.0.0.1"))
+	ch := Subscribe(svc)
+	if _, err := Connect(svc, okBalancer{}); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if e := <-ch; e.Type != EndpointAdded || e.Endpoint.PodName != "subscribed-0" {
+		t.Errorf("first event = %+v, want EndpointAdded for subscribed-0", e)
+	}
+	if err := ClosePool(svc); err != nil {
+		t.Fatalf("ClosePool() error = %v", err)
+	}
+	if e := <-ch; e.Type != EndpointRemoved {
+		t.Errorf("event = %v, want EndpointRemoved", e.Type)
+	}
+	if e := <-ch; e.Type != PoolClosed {
+		t.Errorf("event = %v, want PoolClosed", e.Type)
+	}
+	Unsubscribe(svc, ch)
+	if _, open := <-ch; open {
+		t.Error("channel open after Unsubscribe")
+	}
+	Unsubscribe(svc, ch)
+}
+
+func TestPickConnection(t *testing.T) {
+	if _, err := PickConnection("svc.ns:1000"); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("PickConnection() error = %v, want ErrPoolNotFound", err)
+	}
+	p := testPool(t, 2)
+	cachePool(t, p)
+	gc, err := PickConnection("svc.ns:1000")
+	if err != nil || gc.Stats().Picks != 1 || gc.Client() != gc.GrpcConnection {
+		t.Errorf("PickConnection() = %v, %v, want a picked connection", gc, err)
+	}
+	conns := Connections("svc.ns:1000")
+	conns[0] = nil
+	if len(conns) != 2 || Connections("svc.ns:1000")[0] == nil {
+		t.Error("Connections() does not return a copy")
+	}
+}
@@ -0,0 +1,159 @@
+package kubegrpc
+
+import (
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// PoolOption - Configures a pool. Options are applied when the pool is created by the first
+// ConnectWithOptions/PoolWithOptions call for a service; later calls reuse the existing pool and its configuration.
+type PoolOption func(*poolConfig)
+
+// poolConfig - Per pool configuration, set through PoolOptions
+type poolConfig struct {
+	connectionsPerEndpoint int    // Read through perEndpoint()
+	maxConnections         int    // 0: one connection per pod
+	minHealthy             int    // Below this number of connections the pool is degraded, 0 disables
+	subsetKey              string // Key for the deterministic subset selection, defaults to the hostname
+	backoffBase            time.Duration
+	backoffMax             time.Duration
+	refreshInterval        time.Duration
+	ephemeral              bool // Short lived pods (Jobs, batch workers), see WithEphemeralMembership
+	autoClose              bool
+	outlierDetection       *OutlierDetection // nil: no circuit breaker
+	retryPolicy            *RetryPolicy      // nil: no retries or hedging
+	drainTimeout           time.Duration
+	verifyInterval         time.Duration // 0: endpoints are only verified by the pool refresh
+	maxConnectionAge       time.Duration // 0: connections are not rotated
+	pingTimeout            time.Duration
+	affinityTTL            time.Duration // 0: no affinity
+	affinitySize           int
+	podSelector            map[string]string                // Labels the pods must have, nil for all pods of the service
+	tlsCredentials         credentials.TransportCredentials // nil: all pods are dialed in plaintext
+	tlsRequired            bool                             // All pods are dialed with tlsCredentials, see WithSPIFFE
+	mirrorPolicy           *MirrorPolicy                    // nil: no traffic mirroring
+	notReadyAddresses      bool                             // Headless services: include not ready addresses
+	ipFamily               IPFamily                         // Preferred family of the pod addresses
+	dualStack              bool                             // Connect to every address of the pods
+	faults                 *FaultInjection                  // nil: no injected faults, see WithFaultInjection
+	healthWatch            bool                             // Health Watch streams instead of pings, see WithHealthWatch
+	healthService          string
+	rpcAccounting          bool // Per endpoint RPC accounting, see WithRPCAccounting
+	warmupMin              int  // Ready connections Register waits for, see WithWarmup
+	warmupTimeout          time.Duration
+	perRPCCredentials      credentials.PerRPCCredentials // nil: no per call credentials
+	passthrough            bool                          // Dial the service instead of the pods, see WithPassthrough
+	xds                    bool                          // Defer to the xDS control plane if available, see WithXDS
+	xdsListener            string                        // xDS listener resource, empty for the DNS name of the service, see WithXDS
+	pickWait               time.Duration                 // Wait of the picks of an empty pool, see WithPickWait
+	staleAfter             int                           // Refresh intervals without discovery until the pool is stale, see WithStaleAfter
+	endpointMetadata       bool                          // Endpoint of the call in the outgoing metadata, see WithEndpointMetadata
+	adaptiveChecks         *adaptiveChecks               // nil: health checks every second, see WithAdaptiveHealthChecks
+	streamDrain            *StreamDrain                  // nil: the drain does not wait for streams, see WithStreamDrain
+	streamRebalance        *StreamRebalance              // nil: streams stay where they were opened, see WithStreamRebalance
+	podWeights             PodWeightSource               // Per pod pick weights, see WithPodWeights
+	loadMetric             string                        // Utilization to balance by, empty without WithLoadReports
+	subsetSize             int                           // Pods per client, 0 without WithDeterministicSubset
+	clientID               int
+	failoverService        string // Secondary pool, empty without WithFailover
+	failoverMinHealthy     int
+	leader                 *LeaderElection            // nil: picks go to all pods, see WithLeaderOnly
+	reflectionCheck        []string                   // Services the pods must expose, see WithReflectionCheck
+	versionProbe           VersionProbe               // nil: the versions of the pods are unknown, see WithVersionProbe
+	keepalive              keepalive.ClientParameters // Zero Time: no keepalive, see WithKeepalive
+	compression            string                     // Compressor of the calls, empty without WithCompression
+	required               bool                       // Required for the readiness of the process, see WithRequired
+	connectTimeout         time.Duration              // 0: connections are admitted right after the dial
+	dialParallelism        int                        // Connections dialed at once, see WithDialParallelism
+	failureExclusion       time.Duration              // 0: the default exclusion of ReportFailure
+	picker                 string                     // Registered picker, empty without WithPicker
+	discoverers            []Discoverer               // Sources of the endpoints, empty for the Kubernetes service
+	random                 *lockedRand                // nil: the source of SetRandomSource, see WithRandomSource
+	slowStart              time.Duration              // 0: new endpoints get their full weight, see WithSlowStart
+	namespaces             []string                   // Further namespaces of the service, see WithNamespaces
+	namespaceSelector      map[string]string          // Labels of the namespaces searched, see WithNamespaceSelector
+	namespaceSearch        bool                       // Search the namespaces matching namespaceSelector
+	serviceWatch           bool                       // Refresh on changes of the service, see WithServiceWatch
+	lameduck               bool                       // Drain the pods in lameduck, see WithLameduck
+}
+
+// preflights - Whether new connections are checked before they are admitted to the pool, see preflight
+func (c poolConfig) preflights() bool {
+	return len(c.reflectionCheck) > 0 || c.versionProbe != nil
+}
+
+// newPoolConfig - Returns the configuration with the defaults and the options applied
+func newPoolConfig(opts []PoolOption) poolConfig {
+	c := poolConfig{
+		connectionsPerEndpoint: 1,
+		backoffBase:            defaultBackoffBase,
+		backoffMax:             defaultBackoffMax,
+		refreshInterval:        defaultRefreshInterval,
+		drainTimeout:           defaultDrainTimeout,
+		verifyInterval:         defaultVerifyInterval,
+		pingTimeout:            defaultPingTimeout,
+		keepalive:              defaultKeepalive,
+		dialParallelism:        defaultDialParallelism,
+		staleAfter:             defaultStaleAfter,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.ephemeral && c.refreshInterval == defaultRefreshInterval {
+		c.refreshInterval = ephemeralRefreshInterval
+	}
+	return c
+}
+
+// perEndpoint - Number of connections per pod, at least 1
+func (c poolConfig) perEndpoint() int {
+	if c.connectionsPerEndpoint < 1 {
+		return 1
+	}
+	return c.connectionsPerEndpoint
+}
+
+// WithMaxConnections - Caps the number of connections in the pool. With more pods than the maximum, a deterministic
+// subset of the pods (based on the subset key) is connected, so large services do not exhaust file descriptors.
+func WithMaxConnections(n int) PoolOption {
+	return func(c *poolConfig) {
+		c.maxConnections = n
+	}
+}
+
+// WithMinHealthy - Marks the pool as degraded when it holds fewer than n connections
+func WithMinHealthy(n int) PoolOption {
+	return func(c *poolConfig) {
+		c.minHealthy = n
+	}
+}
+
+// WithSubsetKey - Sets the key used to select the subset of pods with WithMaxConnections. Clients with different keys
+// connect to different subsets, spreading the connections over all pods. Defaults to the hostname (pod name).
+func WithSubsetKey(key string) PoolOption {
+	return func(c *poolConfig) {
+		c.subsetKey = key
+	}
+}
+
+// WithRefreshInterval - Interval of the full re-discovery of the pods of the service, picking up scaled pods. Defaults
+// to a minute, or 5 seconds with WithEphemeralMembership. Refresh re-discovers right away, eg after a scale-up.
+func WithRefreshInterval(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		if d > 0 {
+			c.refreshInterval = d
+		}
+	}
+}
+
+// WithConnectionsPerEndpoint - Maintains n connections per pod. A single HTTP/2 connection is limited in its number of
+// concurrent streams (typically 100); with multiple connections per pod picks are spread over all of them.
+func WithConnectionsPerEndpoint(n int) PoolOption {
+	return func(c *poolConfig) {
+		if n > 0 {
+			c.connectionsPerEndpoint = n
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package kubegrpc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// orcaTrailer - Trailer of the per RPC ORCA load report, a serialized xds.data.orca.v3.OrcaLoadReport
+	orcaTrailer = "endpoint-load-metrics-bin"
+	// orcaTextTrailer - Trailer of the per RPC load report in the text format (`TEXT cpu_utilization=0.5, ...`)
+	orcaTextTrailer = "endpoint-load-metrics"
+	// loadSmoothing - Weight of a new report in the smoothed utilization
+	loadSmoothing = 0.3
+	// loadReportExpiry - Reports older than this are ignored, the endpoint is picked as if it did not report
+	loadReportExpiry = 30 * time.Second
+	// minLoadWeight - Pick weight of a fully utilized endpoint, so it still receives a trickle of traffic and reports
+	minLoadWeight = 0.05
+)
+
+// Utilization metrics of the load reports, see WithLoadReports. Other names select an entry of the `utilization` or
+// `named_metrics` maps of the report, e.g. a queue utilization of the application.
+const (
+	LoadCPU         = "cpu_utilization"
+	LoadMemory      = "mem_utilization"
+	LoadApplication = "application_utilization"
+)
+
+// WithLoadReports - Balances by the utilization the backends report per RPC in ORCA load reports (trailer
+// `endpoint-load-metrics-bin`, as sent by gRPC servers with ORCA enabled, or the text format `endpoint-load-metrics`),
+// for workloads with highly variable request costs. metric selects the utilization to balance by, LoadCPU when empty.
+// The reported utilization is smoothed per endpoint, and an endpoint at utilization u is picked with weight 1-u (at
+// least 0.05). Endpoints without a report within 30 seconds are picked with full weight. Only unary RPCs report.
+func WithLoadReports(metric string) PoolOption {
+	if metric == "" {
+		metric = LoadCPU
+	}
+	return func(c *poolConfig) {
+		c.loadMetric = metric
+	}
+}
+
+// orcaLoadReport - The fields of xds.data.orca.v3.OrcaLoadReport used for balancing
+type orcaLoadReport struct {
+	CPUUtilization         float64            `protobuf:"fixed64,1,opt,name=cpu_utilization,json=cpuUtilization,proto3"`
+	MemUtilization         float64            `protobuf:"fixed64,2,opt,name=mem_utilization,json=memUtilization,proto3"`
+	Utilization            map[string]float64 `protobuf:"bytes,5,rep,name=utilization,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"fixed64,2,opt,name=value,proto3"`
+	NamedMetrics           map[string]float64 `protobuf:"bytes,8,rep,name=named_metrics,json=namedMetrics,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"fixed64,2,opt,name=value,proto3"`
+	ApplicationUtilization float64            `protobuf:"fixed64,9,opt,name=application_utilization,json=applicationUtilization,proto3"`
+}
+
+func (m *orcaLoadReport) Reset()         { *m = orcaLoadReport{} }
+func (m *orcaLoadReport) String() string { return proto.CompactTextString(m) }
+func (*orcaLoadReport) ProtoMessage()    {}
+
+// metric - The utilization of the report, false if the report does not carry it
+func (m *orcaLoadReport) metric(name string) (float64, bool) {
+	switch name {
+	case LoadCPU:
+		return m.CPUUtilization, true
+	case LoadMemory:
+		return m.MemUtilization, true
+	case LoadApplication:
+		return m.ApplicationUtilization, true
+	}
+	if v, ok := m.Utilization[name]; ok {
+		return v, true
+	}
+	v, ok := m.NamedMetrics[name]
+	return v, ok
+}
+
+// parseLoadReport - The load report of the trailer, nil if there is none or it does not parse
+func parseLoadReport(trailer metadata.MD) *orcaLoadReport {
+	if v := trailer.Get(orcaTrailer); len(v) > 0 {
+		report := &orcaLoadReport{}
+		if proto.Unmarshal([]byte(v[0]), report) != nil {
+			return nil
+		}
+		return report
+	}
+	v := trailer.Get(orcaTextTrailer)
+	if len(v) == 0 || !strings.HasPrefix(v[0], "TEXT ") {
+		return nil
+	}
+	report := &orcaLoadReport{Utilization: make(map[string]float64), NamedMetrics: make(map[string]float64)}
+	for _, field := range strings.Split(strings.TrimPrefix(v[0], "TEXT "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			continue
+		}
+		switch key := kv[0]; {
+		case key == LoadCPU:
+			report.CPUUtilization = value
+		case key == LoadMemory:
+			report.MemUtilization = value
+		case key == LoadApplication:
+			report.ApplicationUtilization = value
+		case strings.HasPrefix(key, "utilization."):
+			report.Utilization[strings.TrimPrefix(key, "utilization.")] = value
+		case strings.HasPrefix(key, "named_metrics."):
+			report.NamedMetrics[strings.TrimPrefix(key, "named_metrics.")] = value
+		}
+	}
+	return report
+}
+
+// endpointLoad - Smoothed utilization reported by an endpoint
+type endpointLoad struct {
+	mutex       sync.Mutex
+	utilization float64
+	reported    time.Time
+}
+
+// reportLoad - Feeds the load report of the trailer into the utilization of the connection
+func (c *GrpcConnection) reportLoad(trailer metadata.MD, metric string) {
+	report := parseLoadReport(trailer)
+	if report == nil {
+		return
+	}
+	u, ok := report.metric(metric)
+	if !ok || math.IsNaN(u) || u < 0 {
+		return
+	}
+	now := time.Now()
+	l := &c.load
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.reported.IsZero() || now.Sub(l.reported) > loadReportExpiry {
+		l.utilization = u
+	} else {
+		l.utilization += loadSmoothing * (u - l.utilization)
+	}
+	l.reported = now
+}
+
+// loadStats - The smoothed utilization of the connection, false without a recent report
+func (c *GrpcConnection) loadStats() (float64, bool) {
+	l := &c.load
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.reported.IsZero() || time.Since(l.reported) > loadReportExpiry {
+		return 0, false
+	}
+	return l.utilization, true
+}
+
+// loadWeight - Pick weight of the connection by its reported utilization, 1 without a recent report
+func (c *GrpcConnection) loadWeight() float64 {
+	u, ok := c.loadStats()
+	if !ok {
+		return 1
+	}
+	return math.Max(minLoadWeight, 1-u)
+}
@@ -0,0 +1,96 @@
+package kubegrpc
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// loadTrailer - Trailer with the binary load report
+func loadTrailer(t *testing.T, report *orcaLoadReport) metadata.MD {
+	t.Helper()
+	b, err := proto.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.Pairs(orcaTrailer, string(b))
+}
+
+func TestParseLoadReport(t *testing.T) {
+	report := parseLoadReport(loadTrailer(t, &orcaLoadReport{CPUUtilization: 0.5,
+		Utilization: map[string]float64{"queue": 0.25}}))
+	if report == nil || report.CPUUtilization != 0.5 || report.Utilization["queue"] != 0.25 {
+		t.Fatalf("binary report = %+v", report)
+	}
+	text := parseLoadReport(metadata.Pairs(orcaTextTrailer, "TEXT cpu_utilization=0.3, utilization.queue=0.7"))
+	if text == nil || text.CPUUtilization != 0.3 {
+		t.Fatalf("text report = %+v", text)
+	}
+	if u, ok := text.metric("queue"); !ok || u != 0.7 {
+		t.Errorf("queue utilization = %v, %v", u, ok)
+	}
+	if _, ok := text.metric("missing"); ok {
+		t.Error("metric() of a missing utilization reported")
+	}
+	if parseLoadReport(metadata.Pairs(orcaTrailer, "\xff\xff")) != nil || parseLoadReport(metadata.MD{}) != nil {
+		t.Error("parseLoadReport() of an invalid or missing report not nil")
+	}
+}
+
+func TestLoadWeight(t *testing.T) {
+	p := testPool(t, 1)
+	gc := p.grpcConnection[0]
+	if w := gc.loadWeight(); w != 1 {
+		t.Fatalf("loadWeight() without report = %v, want 1", w)
+	}
+	gc.reportLoad(loadTrailer(t, &orcaLoadReport{CPUUtilization: 0.5}), LoadCPU)
+	if w := gc.loadWeight(); w != 0.5 {
+		t.Errorf("loadWeight() = %v, want 0.5", w)
+	}
+	gc.reportLoad(loadTrailer(t, &orcaLoadReport{CPUUtilization: 1}), LoadCPU)
+	if u := gc.Stats().Load; math.Abs(u-0.65) > 1e-9 {
+		t.Errorf("smoothed load = %v, want 0.65", u)
+	}
+	gc.reportLoad(loadTrailer(t, &orcaLoadReport{CPUUtilization: 3}), LoadCPU)
+	gc.reportLoad(loadTrailer(t, &orcaLoadReport{CPUUtilization: 3}), LoadCPU)
+	if w := gc.loadWeight(); w != minLoadWeight {
+		t.Errorf("loadWeight() when overloaded = %v, want %v", w, minLoadWeight)
+	}
+}
+
+func TestLoadReports(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := proto.Marshal(&orcaLoadReport{CPUUtilization: 0.8})
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		grpc.SetTrailer(ctx, metadata.Pairs(orcaTrailer, string(b)))
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithLoadReports("")}))
+	gc, dialErr := newGrpcConnection("svc.ns:"+port, p, testPod("svc-1", "ns", "svc", "127.0.0.1"), port)
+	if dialErr != nil {
+		t.Fatal(dialErr)
+	}
+	defer gc.conn.Close()
+	if _, err := healthpb.NewHealthClient(gc.conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if u := gc.Stats().Load; u != 0.8 {
+		t.Errorf("Load = %v after the RPC, want the reported 0.8", u)
+	}
+}
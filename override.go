@@ -0,0 +1,100 @@
+package kubegrpc
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrInvalidOverride - The weight override is negative or not a number, or its TTL is not positive
+var ErrInvalidOverride = errors.New("kubegrpc: invalid weight override")
+
+// weightOverride - Manual pick weight of an endpoint, valid until expires
+type weightOverride struct {
+	weight  float64
+	expires time.Time
+}
+
+var (
+	// weightOverrides - Overrides per service per pod name. Keyed by pod name so overrides survive connection rotation.
+	weightOverrides = make(map[string]map[string]weightOverride)
+	overridesMutex  = &sync.RWMutex{}
+	overridesNow    = time.Now
+)
+
+// SetWeightOverride - Temporarily multiplies the pick weight of all connections to the pod by weight, for ttl. A weight
+// of 0 takes the pod out of the picks (unless all endpoints are at 0), 0.01 sends it about 1% of the traffic of a normal
+// endpoint, 2 doubles its share. Setting an override for the same pod replaces the previous one. Intended for operators,
+// for example to send a trickle of traffic to a debug pod or to drain a suspect pod without deleting it.
+// Returns ErrPoolNotFound if there is no pool for the service.
+func SetWeightOverride(serviceName, podName string, weight float64, ttl time.Duration) error {
+	if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 || ttl <= 0 {
+		return ErrInvalidOverride
+	}
+	mutex.RLock()
+	found := connectionCache[serviceName] != nil
+	mutex.RUnlock()
+	if !found {
+		return ErrPoolNotFound
+	}
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	now := overridesNow()
+	overrides := weightOverrides[serviceName]
+	if overrides == nil {
+		overrides = make(map[string]weightOverride)
+		weightOverrides[serviceName] = overrides
+	}
+	for pod, o := range overrides {
+		if !now.Before(o.expires) {
+			delete(overrides, pod)
+		}
+	}
+	overrides[podName] = weightOverride{weight: weight, expires: now.Add(ttl)}
+	log.Printf("INFO: SetWeightOverride(): Weight of %s in %s set to %v for %v", podName, serviceName, weight, ttl)
+	return nil
+}
+
+// ClearWeightOverride - Removes the override of the pod before it expires
+func ClearWeightOverride(serviceName, podName string) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	delete(weightOverrides[serviceName], podName)
+	if len(weightOverrides[serviceName]) == 0 {
+		delete(weightOverrides, serviceName)
+	}
+}
+
+// WeightOverrides - Returns the active overrides of the service by pod name
+func WeightOverrides(serviceName string) map[string]float64 {
+	overridesMutex.RLock()
+	defer overridesMutex.RUnlock()
+	now := overridesNow()
+	active := make(map[string]float64)
+	for pod, o := range weightOverrides[serviceName] {
+		if now.Before(o.expires) {
+			active[pod] = o.weight
+		}
+	}
+	return active
+}
+
+// clearWeightOverrides - Drops all overrides of the service, on pool close
+func clearWeightOverrides(serviceName string) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	delete(weightOverrides, serviceName)
+}
+
+// overrideWeight - Active override multiplier of the connection, 1 without override
+func (c *GrpcConnection) overrideWeight() float64 {
+	overridesMutex.RLock()
+	defer overridesMutex.RUnlock()
+	o, found := weightOverrides[c.serviceName][c.podName]
+	if !found || !overridesNow().Before(o.expires) {
+		return 1
+	}
+	return o.weight
+}
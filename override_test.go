@@ -0,0 +1,80 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// useOverrideClock - Replaces the clock of the weight overrides for the test
+func useOverrideClock(t *testing.T, clock *fakeClock) {
+	overridesNow = clock.Now
+	t.Cleanup(func() {
+		overridesNow = time.Now
+		clearWeightOverrides("svc.ns:1000")
+	})
+}
+
+func TestSetWeightOverrideInvalid(t *testing.T) {
+	if err := SetWeightOverride("svc.ns:1000", "svc-1", -1, time.Minute); !errors.Is(err, ErrInvalidOverride) {
+		t.Errorf("negative weight: error = %v, want ErrInvalidOverride", err)
+	}
+	if err := SetWeightOverride("svc.ns:1000", "svc-1", 1, 0); !errors.Is(err, ErrInvalidOverride) {
+		t.Errorf("zero ttl: error = %v, want ErrInvalidOverride", err)
+	}
+	if err := SetWeightOverride("missing.ns:1000", "svc-1", 1, time.Minute); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("missing pool: error = %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestWeightOverrideExcludesAndExpires(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	useOverrideClock(t, clock)
+	p := testPool(t, 2)
+	cachePool(t, p)
+	if err := SetWeightOverride("svc.ns:1000", "svc-1", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := WeightOverrides("svc.ns:1000"); len(got) != 1 || got["svc-1"] != 0 {
+		t.Errorf("WeightOverrides() = %v", got)
+	}
+	mutex.RLock()
+	for i := 0; i < 50; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection).podName == "svc-1" {
+			t.Fatal("pod with weight 0 picked")
+		}
+	}
+	mutex.RUnlock()
+	clock.Advance(time.Minute)
+	if got := WeightOverrides("svc.ns:1000"); len(got) != 0 {
+		t.Errorf("WeightOverrides() after ttl = %v, want none", got)
+	}
+	if o := p.grpcConnection[0].Stats().Override; o != 1 {
+		t.Errorf("Stats().Override after ttl = %v, want 1", o)
+	}
+}
+
+func TestWeightOverrideShare(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	useOverrideClock(t, clock)
+	p := testPool(t, 2)
+	cachePool(t, p)
+	if err := SetWeightOverride("svc.ns:1000", "svc-1", 0.01, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	picks := 0
+	mutex.RLock()
+	for i := 0; i < 10000; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection).podName == "svc-1" {
+			picks++
+		}
+	}
+	mutex.RUnlock()
+	if picks == 0 || picks > 300 {
+		t.Errorf("debug pod picked %d of 10000 times, want about 100", picks)
+	}
+	ClearWeightOverride("svc.ns:1000", "svc-1")
+	if got := WeightOverrides("svc.ns:1000"); len(got) != 0 {
+		t.Errorf("WeightOverrides() after clear = %v, want none", got)
+	}
+}
@@ -0,0 +1,61 @@
+package kubegrpc
+
+import (
+	"log"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// passthroughAnnotation - Service annotation enabling the passthrough mode for all pools of the service ("true")
+const passthroughAnnotation = "kube-grpc/passthrough"
+
+// WithPassthrough - Service mesh passthrough mode: the pool holds connections to the service DNS name
+// (`name.namespace.svc`) instead of the pods, so the sidecar (Istio, Linkerd) balances the requests and applies the
+// mesh policy. Health checks, statistics and metrics work on these connections as on pod connections. Also enabled by
+// the service annotation `kube-grpc/passthrough: "true"`; changing the annotation switches running pools at their next
+// refresh. Ignored for headless and ExternalName services, pod targets (ConnectPod), static pools and other clusters.
+func WithPassthrough() PoolOption {
+	return func(c *poolConfig) {
+		c.passthrough = true
+	}
+}
+
+// passthrough - True if the pool of the service dials the service instead of its pods
+func passthrough(serviceName string, svc *corev1.Service, c *connection) bool {
+	enabled, _ := strconv.ParseBool(svc.Annotations[passthroughAnnotation])
+	if !enabled && !c.config.passthrough {
+		return false
+	}
+	if _, cluster := splitCluster(serviceName); cluster != "" || podTarget(serviceName) != "" ||
+		subsetSelector(serviceName) != nil {
+		return false
+	}
+	if headless(svc) || svc.Spec.Type == corev1.ServiceTypeExternalName {
+		log.Printf("WARNING: passthrough(): Passthrough ignored for %s, the service has no cluster IP", serviceName)
+		return false
+	}
+	return true
+}
+
+// passthroughPods - The pod standing in for the service: its DNS name as address, with the service port as gRPC port
+func passthroughPods(svc *corev1.Service, explicit string) (*corev1.PodList, error) {
+	port, err := servicePort(explicit, svc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	host := svc.Name + "." + svc.Namespace + ".svc"
+	pod := addressPod(svc.Namespace, corev1.EndpointAddress{IP: host},
+		[]corev1.EndpointPort{{Name: grpcPortNames[0], Port: int32(p)}})
+	pod.Annotations[passthroughAnnotation] = strconv.FormatBool(true)
+	return &corev1.PodList{Items: []corev1.Pod{pod}}, nil
+}
+
+// passthroughPod - True for the pod standing in for the service, see passthroughPods
+func passthroughPod(pod *corev1.Pod) bool {
+	return pod.Annotations[passthroughAnnotation] == "true"
+}
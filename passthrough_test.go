@@ -0,0 +1,73 @@
+package kubegrpc
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// activeConnections - The addresses of the connections of the pool which are not draining
+func activeConnections(c *connection) []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	active := make([]string, 0)
+	for _, gc := range c.grpcConnection {
+		if !gc.isDraining() {
+			active = append(active, gc.connectionIP+":"+gc.port)
+		}
+	}
+	return active
+}
+
+func TestPassthroughAnnotation(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Annotations = map[string]string{passthroughAnnotation: "true"}
+	svc.Spec.Ports = []corev1.ServicePort{{Name: "grpc", Port: 9000}}
+	useFakeClientset(t, svc, testPod("svc-1", "ns", "svc", "10.0.0.1"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithPodSelector(map[string]string{"track": "canary"})}))
+	mutex.Lock()
+	setPool("svc.ns:9000", c)
+	mutex.Unlock()
+	defer ClosePool("svc.ns:9000")
+
+	if err := updateConnectionPool("svc.ns:9000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	if active := activeConnections(c); len(active) != 1 || active[0] != "svc.ns.svc:9000" {
+		t.Fatalf("connections = %v, want the service", active)
+	}
+
+	// Removing the annotation switches the pool back to the pods
+	k8s, _ := getClientset()
+	svc.Annotations = nil
+	if _, err := k8s.CoreV1().Services("ns").Update(context.Background(), svc, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.config.podSelector = nil
+	if err := updateConnectionPool("svc.ns:9000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	if active := activeConnections(c); len(active) != 1 || active[0] != "10.0.0.1:9000" {
+		t.Errorf("connections = %v, want the pod", active)
+	}
+}
+
+func TestPassthroughIgnored(t *testing.T) {
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithPassthrough()}))
+	svc := testService("svc", "ns")
+	if !passthrough("svc.ns", svc, c) {
+		t.Error("WithPassthrough() not applied")
+	}
+	if passthrough("svc.ns/svc-1", svc, c) || passthrough("svc.ns@east", svc, c) {
+		t.Error("passthrough applied to a pod target or another cluster")
+	}
+	svc.Spec.ClusterIP = corev1.ClusterIPNone
+	if passthrough("svc.ns", svc, c) {
+		t.Error("passthrough applied to a headless service")
+	}
+	if passthrough("svc.ns", testService("svc", "ns"), newConnection(okBalancer{}, newPoolConfig(nil))) {
+		t.Error("passthrough applied without option or annotation")
+	}
+}
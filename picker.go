@@ -0,0 +1,159 @@
+package kubegrpc
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancers selectable with WithPicker or the service annotation `kube-grpc/balancer`, in addition to BalancerRandom
+// and BalancerLeastRequests
+const (
+	BalancerRoundRobin = "round-robin" // Picks the endpoints in turn
+	BalancerHash       = "hash"        // Picks by rendezvous hash of the key of ConnectWithKey, random without key
+)
+
+// CallInfo - Description of the call a connection is picked for, handed to the pickers
+type CallInfo struct {
+	ServiceName string
+	Key         string // Key of ConnectWithKey, empty otherwise
+}
+
+// Picker - Balancing strategy: selects the connection for a call, eg pinning tenants to pods or preferring pods with
+// free GPUs. conns is never empty and holds the usable connections of the pool: draining, ejected and excluded
+// connections and connections weighted to 0 are left out, unless no connection is usable. The picker is called
+// concurrently and without locking; it must not modify conns. Returning nil, or a connection which is not in conns,
+// falls back to the default selection.
+type Picker interface {
+	Pick(conns []*GrpcConnection, call CallInfo) *GrpcConnection
+}
+
+// PickerFunc - Adapter to use an ordinary function as Picker
+type PickerFunc func(conns []*GrpcConnection, call CallInfo) *GrpcConnection
+
+// Pick - Implements Picker
+func (f PickerFunc) Pick(conns []*GrpcConnection, call CallInfo) *GrpcConnection {
+	return f(conns, call)
+}
+
+// pickers - Registered pickers by name (map[string]Picker), copied on write under pickersMutex so the picks read it
+// without locking
+var (
+	pickers      atomic.Value
+	pickersMutex sync.Mutex
+)
+
+func init() {
+	RegisterPicker(BalancerRandom, PickerFunc(pickRandom))
+	RegisterPicker(BalancerRoundRobin, &roundRobin{})
+	RegisterPicker(BalancerLeastRequests, PickerFunc(pickLeastRequests))
+	RegisterPicker(BalancerHash, PickerFunc(pickHash))
+}
+
+// RegisterPicker - Makes the picker selectable by name with WithPicker, the service annotation `kube-grpc/balancer` or
+// the balancer of a v2 configuration. Registering a name again replaces the picker, also for the existing pools.
+func RegisterPicker(name string, p Picker) {
+	pickersMutex.Lock()
+	defer pickersMutex.Unlock()
+	current, _ := pickers.Load().(map[string]Picker)
+	next := make(map[string]Picker, len(current)+1)
+	for n, registered := range current {
+		next[n] = registered
+	}
+	next[name] = p
+	pickers.Store(next)
+}
+
+// LookupPicker - The picker registered under the name, nil if none. Custom pickers can delegate to the built in ones.
+func LookupPicker(name string) Picker {
+	registered, _ := pickers.Load().(map[string]Picker)
+	return registered[name]
+}
+
+// WithPicker - Selects the connections of the pool with the picker registered under the name, eg BalancerRoundRobin,
+// instead of the default weighted random selection. The picker is looked up on every pick, so it can be registered
+// after the pool was created; until then the default selection is used. Takes precedence over the balancer of the
+// service annotation.
+func WithPicker(name string) PoolOption {
+	if LookupPicker(name) == nil {
+		log.Printf("WARNING: WithPicker(): No picker registered as %q yet, using the default selection", name)
+	}
+	return func(c *poolConfig) {
+		c.picker = name
+	}
+}
+
+// picker - The picker of the pool: the one of WithPicker, or else the one of the service annotation. nil for the
+// default selection.
+func (c *connection) picker() Picker {
+	if c == nil {
+		return nil
+	}
+	if c.config.picker != "" {
+		return LookupPicker(c.config.picker)
+	}
+	if s, _ := c.balancer.Load().(serviceScorer); s.picker != "" {
+		return LookupPicker(s.picker)
+	}
+	return nil
+}
+
+// pickRandom - Picker of BalancerRandom: uniform random picks among the usable connections
+func pickRandom(conns []*GrpcConnection, _ CallInfo) *GrpcConnection {
+	return conns[randomOf(conns[0].pool).Intn(len(conns))]
+}
+
+// roundRobin - Picker of BalancerRoundRobin. Counts the picks on the pool, so the count is dropped with the pool.
+type roundRobin struct{}
+
+func (r *roundRobin) Pick(conns []*GrpcConnection, _ CallInfo) *GrpcConnection {
+	p := conns[0].pool
+	if p == nil {
+		return conns[0]
+	}
+	n := atomic.AddUint64(&p.roundRobin, 1) - 1
+	return conns[n%uint64(len(conns))]
+}
+
+// pickLeastRequests - Picker of BalancerLeastRequests: the connection with the fewest RPCs in flight, ties broken
+// randomly
+func pickLeastRequests(conns []*GrpcConnection, _ CallInfo) *GrpcConnection {
+	var best *GrpcConnection
+	var least int64
+	ties := 0
+	for _, gc := range conns {
+		inFlight := atomic.LoadInt64(&gc.inFlight)
+		switch {
+		case best == nil || inFlight < least:
+			best, least, ties = gc, inFlight, 1
+		case inFlight == least:
+			ties++
+			if randomOf(gc.pool).Intn(ties) == 0 {
+				best = gc
+			}
+		}
+	}
+	return best
+}
+
+// pickHash - Picker of BalancerHash: the connection with the highest rendezvous hash of key and pod, so a key keeps
+// its pod while the pod stays usable and only the keys of a leaving pod move
+func pickHash(conns []*GrpcConnection, call CallInfo) *GrpcConnection {
+	if call.Key == "" {
+		return pickRandom(conns, call)
+	}
+	var best *GrpcConnection
+	var highest uint64
+	for _, gc := range conns {
+		h := fnv.New64a()
+		h.Write([]byte(call.Key))
+		h.Write([]byte{0})
+		h.Write([]byte(gc.podName))
+		h.Write([]byte(gc.connectionIP))
+		if score := h.Sum64(); best == nil || score > highest {
+			best, highest = gc, score
+		}
+	}
+	return best
+}
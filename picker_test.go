@@ -0,0 +1,120 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRoundRobinPicker(t *testing.T) {
+	p := testPool(t, 3, WithPicker(BalancerRoundRobin))
+	seen := make(map[*GrpcConnection]int)
+	for i := 0; i < 9; i++ {
+		seen[pickConnection("rr-test", p.grpcConnection)]++
+	}
+	for _, gc := range p.grpcConnection {
+		if seen[gc] != 3 {
+			t.Errorf("%s picked %d times of 9, want 3", gc.connectionIP, seen[gc])
+		}
+	}
+}
+
+func TestLeastRequestsPicker(t *testing.T) {
+	p := testPool(t, 3, WithPicker(BalancerLeastRequests))
+	atomic.StoreInt64(&p.grpcConnection[0].inFlight, 4)
+	atomic.StoreInt64(&p.grpcConnection[1].inFlight, 1)
+	atomic.StoreInt64(&p.grpcConnection[2].inFlight, 2)
+	for i := 0; i < 10; i++ {
+		if gc := pickConnection("svc.ns:1000", p.grpcConnection); gc != p.grpcConnection[1] {
+			t.Fatalf("picked %s, want the connection with the fewest requests", gc.connectionIP)
+		}
+	}
+}
+
+func TestHashPicker(t *testing.T) {
+	p := testPool(t, 4, WithPicker(BalancerHash))
+	picked := make(map[*GrpcConnection]bool)
+	for k := 0; k < 50; k++ {
+		key := fmt.Sprintf("tenant-%d", k)
+		gc := p.pick("svc.ns:1000", key)
+		for i := 0; i < 3; i++ {
+			if again := p.pick("svc.ns:1000", key); again != gc {
+				t.Fatalf("key %s moved from %s to %s", key, gc.connectionIP, again.connectionIP)
+			}
+		}
+		picked[gc] = true
+	}
+	if len(picked) != 4 {
+		t.Errorf("50 keys spread over %d of 4 connections", len(picked))
+	}
+
+	// An excluded connection gives up its keys, the other keys stay
+	before := make(map[string]*GrpcConnection)
+	for k := 0; k < 50; k++ {
+		key := fmt.Sprintf("tenant-%d", k)
+		before[key] = p.pick("svc.ns:1000", key)
+	}
+	excluded := p.grpcConnection[0]
+	excluded.ReportFailure(errors.New("corrupt response"))
+	for key, gc := range before {
+		after := p.pick("svc.ns:1000", key)
+		if after == excluded || (gc != excluded && after != gc) {
+			t.Errorf("key %s picked %s after the exclusion, was %s", key, after.connectionIP, gc.connectionIP)
+		}
+	}
+}
+
+func TestCustomPicker(t *testing.T) {
+	var calls int64
+	var candidates int64
+	RegisterPicker("custom-test", PickerFunc(func(conns []*GrpcConnection, call CallInfo) *GrpcConnection {
+		atomic.AddInt64(&calls, 1)
+		atomic.StoreInt64(&candidates, int64(len(conns)))
+		if call.Key == "foreign" {
+			return &GrpcConnection{}
+		}
+		return conns[len(conns)-1]
+	}))
+	if LookupPicker("custom-test") == nil {
+		t.Fatal("LookupPicker() of the registered picker = nil")
+	}
+	p := testPool(t, 3, WithPicker("custom-test"))
+	p.grpcConnection[2].ReportFailure(errors.New("corrupt response"))
+	if gc := p.pick("svc.ns:1000", ""); gc != p.grpcConnection[1] {
+		t.Errorf("picked %s, want the last usable connection", gc.connectionIP)
+	}
+	if n := atomic.LoadInt64(&candidates); n != 2 {
+		t.Errorf("picker got %d connections, want the 2 usable ones", n)
+	}
+	// Connections which are not in the pool fall back to the default selection
+	if gc := p.pick("svc.ns:1000", "foreign"); gc == nil || gc.pool != p {
+		t.Errorf("pick() with a foreign connection = %v, want a connection of the pool", gc)
+	}
+	if atomic.LoadInt64(&calls) != 2 {
+		t.Errorf("picker called %d times, want 2", calls)
+	}
+}
+
+func TestPickerOfServiceAnnotation(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Annotations = map[string]string{balancerAnnotation: BalancerRoundRobin}
+	cfg := parseServiceConfig("svc.ns", svc)
+	if cfg.picker != BalancerRoundRobin || cfg.balancer != nil {
+		t.Fatalf("parseServiceConfig() = %+v, want the round robin picker", cfg)
+	}
+	p := testPool(t, 2)
+	p.setService(cfg)
+	if p.picker() == nil {
+		t.Fatal("picker() = nil, want the picker of the annotation")
+	}
+	first := pickConnection("annotation-test", p.grpcConnection)
+	if second := pickConnection("annotation-test", p.grpcConnection); second == first {
+		t.Errorf("round robin picked %s twice in a row", first.connectionIP)
+	}
+	// The option takes precedence over the annotation
+	p.config.picker = BalancerHash
+	if _, ok := p.picker().(*roundRobin); ok {
+		t.Error("picker() = annotation picker, want the one of WithPicker")
+	}
+}
@@ -0,0 +1,57 @@
+package kubegrpc
+
+import "time"
+
+// pickWaitPoll - Longest wait for a change of the endpoint set before a waiting pick tries again, the picks of Pool
+// re-discover the pods of an empty pool on every try
+const pickWaitPoll = 500 * time.Millisecond
+
+// WithPickWait - Rides out brief total outages, eg a rolling restart of all replicas of a small service: the picks
+// of an empty pool (Pool, Connect, PickConnection and the calls built on them) wait up to d for an endpoint before
+// returning ErrNoHealthyEndpoints, instead of failing right away. The picks try again whenever the endpoint set
+// changes and at least twice a second; a try in progress when d runs out (Pool re-discovers the pods of an empty pool)
+// is completed. Default 0: no wait.
+func WithPickWait(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		if d < 0 {
+			d = 0
+		}
+		c.pickWait = d
+	}
+}
+
+// endpointsChanged - Closed by the next swap of the endpoint set of the pool. Caller must hold mutex for writing.
+func (c *connection) endpointsChanged() <-chan struct{} {
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return c.changed
+}
+
+// awaitEndpoints - Waits for the empty pool of the service to change, for at most the remainder of its pick wait
+// since start. False if the wait is over: no pool, no pick wait, the pick wait ran out or a shutdown started.
+func awaitEndpoints(serviceName string, start time.Time) bool {
+	mutex.Lock()
+	c := connectionCache[serviceName]
+	if c == nil || c.closed || c.config.pickWait <= 0 || isShuttingDown() {
+		mutex.Unlock()
+		return false
+	}
+	left := c.config.pickWait - time.Since(start)
+	if left <= 0 {
+		mutex.Unlock()
+		return false
+	}
+	changed := c.endpointsChanged()
+	mutex.Unlock()
+	if left > pickWaitPoll {
+		left = pickWaitPoll
+	}
+	t := time.NewTimer(left)
+	defer t.Stop()
+	select {
+	case <-changed:
+	case <-t.C:
+	}
+	return !isShuttingDown()
+}
@@ -0,0 +1,69 @@
+package kubegrpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithPickWait(t *testing.T) {
+	p := testPool(t, 1, WithPickWait(2*time.Second))
+	gc := p.grpcConnection[0]
+	p.grpcConnection, p.nConnections = nil, 0
+	cachePool(t, p)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		mutex.Lock()
+		p.swapConnections([]*GrpcConnection{gc})
+		mutex.Unlock()
+	}()
+	start := time.Now()
+	picked, err := PickConnection("svc.ns:1000")
+	if err != nil || picked != gc {
+		t.Fatalf("PickConnection() = %v, %v, want the endpoint which came back", picked, err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("pick waited %v, want woken by the new endpoint", waited)
+	}
+
+	mutex.Lock()
+	p.swapConnections(nil)
+	p.config.pickWait = 50 * time.Millisecond
+	mutex.Unlock()
+	start = time.Now()
+	if _, err := PickConnection("svc.ns:1000"); !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Errorf("PickConnection() error = %v, want ErrNoHealthyEndpoints after the wait", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("pick failed after %v, want the pick wait of 50ms", waited)
+	}
+
+	mutex.Lock()
+	p.config.pickWait = 0
+	mutex.Unlock()
+	start = time.Now()
+	if _, err := PickConnection("svc.ns:1000"); !errors.Is(err, ErrNoHealthyEndpoints) || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("PickConnection() without pick wait = %v after %v, want ErrNoHealthyEndpoints right away", err,
+			time.Since(start))
+	}
+}
+
+func TestPickWaitRediscovers(t *testing.T) {
+	useFakeClientset(t, testService("late", "ns"))
+	defer forgetDiscoveries("late.ns:1000")
+	lists := countPodLists(t)
+	defer ClosePool("late.ns:1000")
+	start := time.Now()
+	_, _, err := PoolWithOptions("late.ns:1000", okBalancer{}, WithPickWait(1500*time.Millisecond))
+	if !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Fatalf("PoolWithOptions() error = %v, want ErrNoHealthyEndpoints", err)
+	}
+	// One discovery per try of the waiting pick, at least twice a second
+	if waited := time.Since(start); waited > 1800*time.Millisecond {
+		t.Errorf("pick failed after %v, want about the pick wait of 1.5s", waited)
+	}
+	if n := atomic.LoadInt32(lists); n < 3 {
+		t.Errorf("%d discoveries during the pick wait of 1.5s, want at least 3", n)
+	}
+}
@@ -0,0 +1,158 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ErrNoPort - No port in the service name and the pod has no containerPort named after the grpc naming convention
+var ErrNoPort = errors.New("kubegrpc: no port to dial")
+
+// grpcPortNames - Container port names which are used as dial port when the service name has no port, in order of preference
+var grpcPortNames = []string{"grpc", "grpc-web"}
+
+// podPort - Returns the port to dial on the pod: the port from the service name if given, a port name being looked up
+// among the containerPorts, otherwise the containerPort named `grpc` (or `grpc-web`) following the standard naming
+// convention
+func podPort(explicit string, pod *corev1.Pod) (string, error) {
+	if explicit != "" {
+		if numericPort(explicit) {
+			return explicit, nil
+		}
+		if port, ok := namedContainerPort(pod, explicit); ok {
+			return strconv.Itoa(int(port)), nil
+		}
+		return "", fmt.Errorf("%w: no port named %s", ErrNoPort, explicit)
+	}
+	if port, ok := namedContainerPort(pod, grpcPortNames...); ok {
+		return strconv.Itoa(int(port)), nil
+	}
+	return "", ErrNoPort
+}
+
+// numericPort - True for a port number, false for a port name
+func numericPort(port string) bool {
+	_, err := strconv.Atoi(port)
+	return err == nil
+}
+
+// namedContainerPort - Looks up the first containerPort matching one of the names (in order of the names)
+func namedContainerPort(pod *corev1.Pod, names ...string) (int32, bool) {
+	for _, name := range names {
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == name && p.ContainerPort > 0 {
+					return p.ContainerPort, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// servicePort - Returns the port to dial on the service: the port from the service name if given, a port name being
+// looked up among the service ports, otherwise the service port named after the grpc naming convention, or the first
+// port of the service
+func servicePort(explicit string, svc *corev1.Service) (string, error) {
+	if explicit != "" {
+		if numericPort(explicit) {
+			return explicit, nil
+		}
+		for _, p := range svc.Spec.Ports {
+			if p.Name == explicit {
+				return strconv.Itoa(int(p.Port)), nil
+			}
+		}
+		return "", fmt.Errorf("%w: no port named %s", ErrNoPort, explicit)
+	}
+	for _, name := range grpcPortNames {
+		for _, p := range svc.Spec.Ports {
+			if p.Name == name {
+				return strconv.Itoa(int(p.Port)), nil
+			}
+		}
+	}
+	if len(svc.Spec.Ports) > 0 {
+		return strconv.Itoa(int(svc.Spec.Ports[0].Port)), nil
+	}
+	return "", ErrNoPort
+}
+
+// targetPort - The port on the pod which the service port of the given name forwards to: its targetPort as number, or
+// as the containerPort it names. false if the service has no such port or the pod not the named containerPort.
+func targetPort(name string, ports []corev1.ServicePort, pod *corev1.Pod) (string, bool) {
+	for _, p := range ports {
+		if p.Name != name {
+			continue
+		}
+		switch {
+		case p.TargetPort.Type == intstr.String && p.TargetPort.StrVal != "":
+			if port, ok := namedContainerPort(pod, p.TargetPort.StrVal); ok {
+				return strconv.Itoa(int(port)), true
+			}
+			return "", false
+		case p.TargetPort.IntVal > 0:
+			return strconv.Itoa(int(p.TargetPort.IntVal)), true
+		default:
+			// Without targetPort the service port is the pod port
+			return strconv.Itoa(int(p.Port)), true
+		}
+	}
+	return "", false
+}
+
+// numberedTargetPort - The containerPort which the service port of the given number forwards to by name (a string
+// targetPort), for service names and annotations with the port number of the service rather than of the pod. Without
+// targetPort (0) the service port is the pod port, so the number itself. false if the pod declares the port number
+// itself, the service has no port of the number, or its targetPort is a number: port numbers of service names are
+// dialed on the pods as given.
+func numberedTargetPort(number string, ports []corev1.ServicePort, pod *corev1.Pod) (string, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil || containerPortNumber(pod, int32(n)) {
+		return "", false
+	}
+	for _, p := range ports {
+		if int(p.Port) != n {
+			continue
+		}
+		switch {
+		case p.TargetPort.Type == intstr.String && p.TargetPort.StrVal != "":
+			if port, ok := namedContainerPort(pod, p.TargetPort.StrVal); ok {
+				return strconv.Itoa(int(port)), true
+			}
+		case p.TargetPort.IntVal == 0:
+			return number, true
+		}
+	}
+	return "", false
+}
+
+// containerPortNumber - True if a container of the pod declares the port number
+func containerPortNumber(pod *corev1.Pod, number int32) bool {
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.ContainerPort == number {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// defaultTargetPort - The pod port of the service port named after the grpc naming convention, or else of the first
+// service port. Used for pods without grpc or TLS containerPort, eg pods with unnamed ports.
+func defaultTargetPort(ports []corev1.ServicePort, pod *corev1.Pod) (string, bool) {
+	if len(ports) == 0 {
+		return "", false
+	}
+	for _, name := range grpcPortNames {
+		if port, ok := targetPort(name, ports, pod); ok {
+			return port, true
+		}
+	}
+	return targetPort(ports[0].Name, ports[:1], pod)
+}
@@ -0,0 +1,157 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func podWithPorts(ports ...corev1.ContainerPort) *corev1.Pod {
+	pod := testPod("svc-0", "ns", "svc", "10.0.0.1")
+	pod.Spec.Containers = []corev1.Container{{Name: "app", Ports: ports}}
+	return pod
+}
+
+func TestPodPort(t *testing.T) {
+	cases := []struct {
+		name     string
+		explicit string
+		pod      *corev1.Pod
+		want     string
+		wantErr  error
+	}{
+		{"explicit port wins", "9000", podWithPorts(corev1.ContainerPort{Name: "grpc", ContainerPort: 8080}), "9000", nil},
+		{"grpc named port", "", podWithPorts(
+			corev1.ContainerPort{Name: "http", ContainerPort: 80},
+			corev1.ContainerPort{Name: "grpc", ContainerPort: 8080}), "8080", nil},
+		{"grpc preferred over grpc-web", "", podWithPorts(
+			corev1.ContainerPort{Name: "grpc-web", ContainerPort: 8081},
+			corev1.ContainerPort{Name: "grpc", ContainerPort: 8080}), "8080", nil},
+		{"grpc-web fallback", "", podWithPorts(corev1.ContainerPort{Name: "grpc-web", ContainerPort: 8081}), "8081", nil},
+		{"no named port", "", podWithPorts(corev1.ContainerPort{Name: "http", ContainerPort: 80}), "", ErrNoPort},
+		{"port name", "admin", podWithPorts(
+			corev1.ContainerPort{Name: "grpc", ContainerPort: 8080},
+			corev1.ContainerPort{Name: "admin", ContainerPort: 8090}), "8090", nil},
+		{"unknown port name", "admin", podWithPorts(corev1.ContainerPort{Name: "grpc", ContainerPort: 8080}), "", ErrNoPort},
+	}
+	for _, c := range cases {
+		got, err := podPort(c.explicit, c.pod)
+		if got != c.want || !errors.Is(err, c.wantErr) {
+			t.Errorf("%s: podPort() = %q, %v, want %q, %v", c.name, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestUpdateConnectionPoolInfersPort(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), podWithPorts(corev1.ContainerPort{Name: "grpc", ContainerPort: 8080}))
+	c := &connection{functions: okBalancer{}}
+	if err := updateConnectionPool("svc.ns", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if target := c.grpcConnection[0].conn.Target(); target != "10.0.0.1:8080" {
+		t.Errorf("dialed %s, want 10.0.0.1:8080", target)
+	}
+}
+
+func TestServicePort(t *testing.T) {
+	svc := func(ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{Spec: corev1.ServiceSpec{Ports: ports}}
+	}
+	for _, tc := range []struct {
+		name     string
+		explicit string
+		svc      *corev1.Service
+		want     string
+		err      error
+	}{
+		{"explicit", "1000", svc(corev1.ServicePort{Name: "grpc", Port: 9000}), "1000", nil},
+		{"named", "", svc(corev1.ServicePort{Name: "http", Port: 80}, corev1.ServicePort{Name: "grpc", Port: 9000}), "9000", nil},
+		{"single", "", svc(corev1.ServicePort{Name: "api", Port: 8080}), "8080", nil},
+		{"first", "", svc(corev1.ServicePort{Name: "a", Port: 1}, corev1.ServicePort{Name: "b", Port: 2}), "1", nil},
+		{"port name", "b", svc(corev1.ServicePort{Name: "a", Port: 1}, corev1.ServicePort{Name: "b", Port: 2}), "2", nil},
+		{"unknown port name", "c", svc(corev1.ServicePort{Name: "a", Port: 1}), "", ErrNoPort},
+		{"no ports", "", svc(), "", ErrNoPort},
+	} {
+		got, err := servicePort(tc.explicit, tc.svc)
+		if got != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("%s: servicePort() = %q, %v, want %q, %v", tc.name, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestPoolsPerNamedPort(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Spec.Ports = []corev1.ServicePort{
+		{Name: "grpc", Port: 80, TargetPort: intstr.FromInt(8080)},
+		{Name: "grpc-admin", Port: 81, TargetPort: intstr.FromString("admin")},
+	}
+	useFakeClientset(t, svc, podWithPorts(
+		corev1.ContainerPort{Name: "grpc", ContainerPort: 8080},
+		corev1.ContainerPort{Name: "admin", ContainerPort: 8090}))
+	for serviceName, want := range map[string]string{"svc.ns:grpc": "10.0.0.1:8080", "svc.ns:grpc-admin": "10.0.0.1:8090",
+		"svc.ns:admin": "10.0.0.1:8090", "svc.ns": "10.0.0.1:8080"} {
+		c := &connection{functions: okBalancer{}}
+		if err := updateConnectionPool(serviceName, c, false); err != nil {
+			t.Fatalf("updateConnectionPool(%s) error = %v", serviceName, err)
+		}
+		if target := c.grpcConnection[0].conn.Target(); target != want {
+			t.Errorf("%s dialed %s, want %s", serviceName, target, want)
+		}
+		c.grpcConnection[0].conn.Close()
+	}
+}
+
+func TestDefaultTargetPort(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Spec.Ports = []corev1.ServicePort{{Name: "api", Port: 80, TargetPort: intstr.FromInt(7000)}}
+	useFakeClientset(t, svc, podWithPorts(corev1.ContainerPort{ContainerPort: 7000}))
+	c := &connection{functions: okBalancer{}}
+	if err := updateConnectionPool("svc.ns", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	defer c.grpcConnection[0].conn.Close()
+	if target := c.grpcConnection[0].conn.Target(); target != "10.0.0.1:7000" {
+		t.Errorf("dialed %s, want the target port of the first service port", target)
+	}
+}
+
+func TestNumberedTargetPort(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Spec.Ports = []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromString("grpc")}}
+	// The port number changes during a rollout, the pods resolve the name each
+	old := podWithPorts(corev1.ContainerPort{Name: "grpc", ContainerPort: 9000})
+	fresh := testPod("svc-1", "ns", "svc", "10.0.0.2")
+	fresh.Spec.Containers = []corev1.Container{{Name: "app", Ports: []corev1.ContainerPort{{Name: "grpc", ContainerPort: 9001}}}}
+	useFakeClientset(t, svc, old, fresh)
+	c := &connection{functions: okBalancer{}}
+	if err := updateConnectionPool("svc.ns:80", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	got := targets(c.grpcConnection)
+	for _, gc := range c.grpcConnection {
+		gc.conn.Close()
+	}
+	if len(got) != 2 || got[0] != "10.0.0.1:9000" || got[1] != "10.0.0.2:9001" {
+		t.Errorf("dialed %v, want the containerPorts named by the targetPort", got)
+	}
+
+	// Port numbers of the pod are dialed as given
+	pod := podWithPorts(corev1.ContainerPort{Name: "grpc", ContainerPort: 9000}, corev1.ContainerPort{ContainerPort: 80})
+	if port, ok := numberedTargetPort("80", svc.Spec.Ports, pod); ok {
+		t.Errorf("numberedTargetPort() = %s, want the port declared by the pod", port)
+	}
+	if port, ok := numberedTargetPort("81", svc.Spec.Ports, pod); ok {
+		t.Errorf("numberedTargetPort() = %s for a port the service does not have", port)
+	}
+
+	// Without targetPort the service port is the pod port
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Port: 81}, corev1.ServicePort{Port: 82,
+		TargetPort: intstr.FromInt(0)})
+	for _, number := range []string{"81", "82"} {
+		if port, ok := numberedTargetPort(number, svc.Spec.Ports, pod); !ok || port != number {
+			t.Errorf("numberedTargetPort(%s) = %s, %v, want the service port", number, port, ok)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package kubegrpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// pushbackTrailer - Trailer with which an overloaded server tells the client when to retry (milliseconds), or not to
+// retry at all (negative or invalid value), see the gRPC retry design (A6)
+const pushbackTrailer = "grpc-retry-pushback-ms"
+
+// serverPushback - Reads the pushback from the trailer of an attempt. Returns the delay before the next attempt, 0
+// without pushback, and false if the server asked not to retry.
+func serverPushback(trailer metadata.MD) (time.Duration, bool) {
+	values := trailer.Get(pushbackTrailer)
+	if len(values) == 0 {
+		return 0, true
+	}
+	ms, err := strconv.Atoi(values[0])
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// invokeWithPushback - Runs a single attempt of the RPC on this connection and returns the pushback of the server
+func (c *GrpcConnection) invokeWithPushback(ctx context.Context, method string, req, reply interface{},
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (time.Duration, bool, error) {
+	var trailer metadata.MD
+	err := c.invoke(ctx, method, req, reply, invoker, append(opts[:len(opts):len(opts)], grpc.Trailer(&trailer))...)
+	if err == nil {
+		return 0, true, nil
+	}
+	delay, retry := serverPushback(trailer)
+	return delay, retry, err
+}
+
+// waitPushback - Waits for the pushback delay. Returns false if the context ends first or its deadline does not leave
+// room for another attempt after the delay.
+func waitPushback(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// pushbackInvoker - Fake invoker failing every target in fail with the pushback trailer, records the call times
+type pushbackInvoker struct {
+	mutex    sync.Mutex
+	fail     map[string]bool
+	pushback string
+	calls    []time.Time
+}
+
+func (r *pushbackInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	opts ...grpc.CallOption) error {
+	r.mutex.Lock()
+	r.calls = append(r.calls, time.Now())
+	r.mutex.Unlock()
+	if !r.fail[cc.Target()] {
+		return nil
+	}
+	for _, o := range opts {
+		if t, ok := o.(grpc.TrailerCallOption); ok {
+			*t.TrailerAddr = metadata.Pairs(pushbackTrailer, r.pushback)
+		}
+	}
+	return status.Error(codes.Unavailable, "overloaded")
+}
+
+func TestServerPushback(t *testing.T) {
+	for value, want := range map[string]struct {
+		delay time.Duration
+		retry bool
+	}{
+		"":    {0, true},
+		"250": {250 * time.Millisecond, true},
+		"-1":  {0, false},
+		"abc": {0, false},
+	} {
+		md := metadata.MD{}
+		if value != "" {
+			md = metadata.Pairs(pushbackTrailer, value)
+		}
+		if delay, retry := serverPushback(md); delay != want.delay || retry != want.retry {
+			t.Errorf("serverPushback(%q) = %v, %v, want %v, %v", value, delay, retry, want.delay, want.retry)
+		}
+	}
+}
+
+func TestRetryHonorsPushback(t *testing.T) {
+	p := testPool(t, 2, WithRetryPolicy(RetryPolicy{IdempotentMethods: []string{"*"}}))
+	first := p.grpcConnection[0]
+	inv := &pushbackInvoker{fail: map[string]bool{"10.0.0.1:1000": true}, pushback: "100"}
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke); err != nil {
+		t.Fatalf("call error = %v, want retried successfully", err)
+	}
+	if len(inv.calls) != 2 || inv.calls[1].Sub(inv.calls[0]) < 100*time.Millisecond {
+		t.Errorf("retry after %v, want 2 calls 100ms apart", inv.calls)
+	}
+
+	inv = &pushbackInvoker{fail: map[string]bool{"10.0.0.1:1000": true}, pushback: "-1"}
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke); status.Code(err) != codes.Unavailable {
+		t.Errorf("call error = %v, want Unavailable without retry", err)
+	}
+	if len(inv.calls) != 1 {
+		t.Errorf("calls = %d, want no retry after negative pushback", len(inv.calls))
+	}
+
+	inv = &pushbackInvoker{fail: map[string]bool{"10.0.0.1:1000": true}, pushback: "1000"}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := first.unaryInterceptor(ctx, "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke); status.Code(err) != codes.Unavailable {
+		t.Errorf("call error = %v, want Unavailable when the pushback exceeds the deadline", err)
+	}
+	if len(inv.calls) != 1 {
+		t.Errorf("calls = %d, want no retry beyond the deadline", len(inv.calls))
+	}
+}
+
+func TestHedgeHonorsPushback(t *testing.T) {
+	p := testPool(t, 3, WithRetryPolicy(RetryPolicy{HedgedMethods: []string{"*"}, HedgeDelay: time.Second}))
+	first := p.grpcConnection[0]
+	inv := &pushbackInvoker{fail: map[string]bool{"10.0.0.1:1000": true}, pushback: "100"}
+	start := time.Now()
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", &wrappers.StringValue{},
+		&wrappers.StringValue{}, first.conn, inv.invoke); err != nil {
+		t.Fatalf("call error = %v, want hedged successfully", err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond || d >= time.Second {
+		t.Errorf("hedged call took %v, want after the 100ms pushback", d)
+	}
+
+	inv = &pushbackInvoker{fail: map[string]bool{"10.0.0.1:1000": true}, pushback: "-1"}
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", &wrappers.StringValue{},
+		&wrappers.StringValue{}, first.conn, inv.invoke); status.Code(err) != codes.Unavailable {
+		t.Errorf("call error = %v, want Unavailable without hedge", err)
+	}
+	if len(inv.calls) != 1 {
+		t.Errorf("calls = %d, want no hedge after negative pushback", len(inv.calls))
+	}
+}
@@ -0,0 +1,75 @@
+package kubegrpc
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand - Random numbers of a rand.Source, which is not safe for concurrent use on its own
+type lockedRand struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newLockedRand(src rand.Source) *lockedRand {
+	return &lockedRand{rand: rand.New(src)}
+}
+
+// Float64 - A random number in [0,1)
+func (r *lockedRand) Float64() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Float64()
+}
+
+// Intn - A random number in [0,n)
+func (r *lockedRand) Intn(n int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Intn(n)
+}
+
+var (
+	// defaultRandom - Randomness of the pools without WithRandomSource, seeded at start up unless set with
+	// SetRandomSource
+	defaultRandom = newLockedRand(rand.NewSource(time.Now().UnixNano()))
+	randomMutex   = &sync.RWMutex{}
+)
+
+// SetRandomSource - Sets the source of the randomness of the picks of all pools without WithRandomSource. By default
+// the picks use a source seeded with the start up time. nil restores such a source.
+func SetRandomSource(src rand.Source) {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	randomMutex.Lock()
+	defer randomMutex.Unlock()
+	defaultRandom = newLockedRand(src)
+}
+
+// WithRandomSource - Draws the random picks of the pool (uniform, weighted and fallback picks, the traffic split and the
+// built in random and least-requests pickers) from the source instead of the source of SetRandomSource. With a
+// rand.NewSource(seed) tests can assert the sequence of the picks; concurrent picks are serialized on the source. The
+// pools created with the same option share the source.
+func WithRandomSource(src rand.Source) PoolOption {
+	var r *lockedRand
+	if src != nil {
+		r = newLockedRand(src)
+	}
+	return func(c *poolConfig) {
+		if r != nil {
+			c.random = r
+		}
+	}
+}
+
+// randomOf - The randomness of the picks of the pool
+func randomOf(c *connection) *lockedRand {
+	if c != nil && c.config.random != nil {
+		return c.config.random
+	}
+	randomMutex.RLock()
+	defer randomMutex.RUnlock()
+	return defaultRandom
+}
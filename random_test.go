@@ -0,0 +1,44 @@
+package kubegrpc
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// pickSequence - The pods of n picks of the pool
+func pickSequence(p *connection, n int) []string {
+	pods := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		pods = append(pods, pickConnection("svc.ns:1000", p.grpcConnection).podName)
+	}
+	return pods
+}
+
+func TestRandomSource(t *testing.T) {
+	first := pickSequence(testPool(t, 5, WithRandomSource(rand.NewSource(42))), 20)
+	second := pickSequence(testPool(t, 5, WithRandomSource(rand.NewSource(42))), 20)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("picks %v and %v differ with the same seed", first, second)
+		}
+	}
+	seen := map[string]bool{}
+	for _, pod := range first {
+		seen[pod] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("picks %v, want spread over the pods", first)
+	}
+
+	// Pools without their own source use the one of SetRandomSource
+	SetRandomSource(rand.NewSource(7))
+	defer SetRandomSource(nil)
+	first = pickSequence(testPool(t, 5), 20)
+	SetRandomSource(rand.NewSource(7))
+	second = pickSequence(testPool(t, 5, WithPicker(BalancerRandom)), 20)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("picks %v and %v differ with the same default source", first, second)
+		}
+	}
+}
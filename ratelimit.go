@@ -0,0 +1,131 @@
+package kubegrpc
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// Defaults of the shared limit of the discoveries, see SetAPIRateLimit
+const (
+	defaultAPIQPS          = 20
+	defaultAPIBurst        = 40
+	defaultDiscoveryWindow = 200 * time.Millisecond
+)
+
+var (
+	apiLimitMutex   = &sync.Mutex{}
+	apiLimiter      = flowcontrol.NewTokenBucketRateLimiter(defaultAPIQPS, defaultAPIBurst)
+	discoveryWindow = defaultDiscoveryWindow
+	// discoveries - Discovery state per service name, protected by apiLimitMutex
+	discoveries = make(map[string]*serviceDiscovery)
+)
+
+// SetAPIRateLimit - Limits the discoveries of all pools together to qps per second with bursts of burst (defaults 20
+// and 40), and the discoveries of a single service to one per window (default 200ms), so refreshes of many pools do
+// not stampede the k8s API server. Refreshes of a service triggered while its discovery waits for the limits (health
+// induced refreshes, Refresh, the refresh interval) collapse into that single discovery. qps <= 0 removes the shared
+// limit.
+func SetAPIRateLimit(qps float64, burst int, window time.Duration) {
+	var limiter flowcontrol.RateLimiter
+	if qps > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst)
+	}
+	apiLimitMutex.Lock()
+	defer apiLimitMutex.Unlock()
+	apiLimiter, discoveryWindow = limiter, window
+}
+
+// acceptAPICall - Waits for the shared limit of the k8s API calls, see SetAPIRateLimit. Do not hold mutex.
+func acceptAPICall() {
+	apiLimitMutex.Lock()
+	limiter := apiLimiter
+	apiLimitMutex.Unlock()
+	if limiter != nil {
+		limiter.Accept()
+	}
+}
+
+// serviceDiscovery - The discovery of a service waiting for the limits and the start of the last one
+type serviceDiscovery struct {
+	pending     *discoveryCall // nil while no discovery waits
+	lastStarted time.Time
+}
+
+// discoveryCall - A discovery shared by all refreshes of the service triggered while it waited
+type discoveryCall struct {
+	done chan struct{}
+	svc  *corev1.Service
+	pods *corev1.PodList
+	err  error
+}
+
+// limitedDiscovery - discoverPods within the API limits, static addresses and discoverers without k8s are not
+// limited. A refresh triggered while a discovery of the service waits shares that discovery; otherwise it starts one
+// once the window of the service passed and the shared limiter admits it. Every caller gets a discovery which started
+// after its call, and its own copy of the pods.
+func limitedDiscovery(serviceName, port string, c *connection) (*corev1.Service, *corev1.PodList, error) {
+	_, static := staticAddresses(serviceName)
+	if static || (len(c.config.discoverers) > 0 && !usesKubernetes(c.config.discoverers)) {
+		return discoverPods(serviceName, port, c)
+	}
+	// The subset pools of a service share its discoveries, see ConnectSubset
+	key, _ := splitSubset(serviceName)
+	apiLimitMutex.Lock()
+	d := discoveries[key]
+	if d == nil {
+		d = &serviceDiscovery{}
+		discoveries[key] = d
+	}
+	call := d.pending
+	if call != nil {
+		apiLimitMutex.Unlock()
+		getMetrics().Counter(MetricDiscoveries, map[string]string{"service": serviceName, "result": "coalesced"}, 1)
+		<-call.done
+		return call.result()
+	}
+	call = &discoveryCall{done: make(chan struct{})}
+	d.pending = call
+	wait := time.Until(d.lastStarted.Add(discoveryWindow))
+	limiter := apiLimiter
+	apiLimitMutex.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	if limiter != nil {
+		limiter.Accept()
+	}
+	// Refreshes triggered from now on may need pods this discovery does not see yet: they start the next one
+	apiLimitMutex.Lock()
+	d.pending = nil
+	d.lastStarted = time.Now()
+	apiLimitMutex.Unlock()
+	getMetrics().Counter(MetricDiscoveries, map[string]string{"service": serviceName, "result": "called"}, 1)
+	call.svc, call.pods, call.err = discoverPods(serviceName, port, c)
+	close(call.done)
+	return call.result()
+}
+
+// result - Copy of the result of the discovery
+func (call *discoveryCall) result() (*corev1.Service, *corev1.PodList, error) {
+	if call.err != nil {
+		return nil, nil, call.err
+	}
+	return call.svc.DeepCopy(), call.pods.DeepCopy(), nil
+}
+
+// forgetDiscoveries - Drops the discovery state of the service once its pool is closed
+func forgetDiscoveries(serviceName string) {
+	apiLimitMutex.Lock()
+	defer apiLimitMutex.Unlock()
+	key, _ := splitSubset(serviceName)
+	if d := discoveries[key]; d != nil && d.pending == nil {
+		delete(discoveries, key)
+	}
+}
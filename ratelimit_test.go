@@ -0,0 +1,110 @@
+package kubegrpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// countPodLists - Counts the pod list calls of the fake clientset of the test
+func countPodLists(t *testing.T) *int32 {
+	t.Helper()
+	var lists int32
+	clientset.(*fake.Clientset).PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&lists, 1)
+		return false, nil, nil
+	})
+	return &lists
+}
+
+// withAPIRateLimit - Applies the limits for the test
+func withAPIRateLimit(t *testing.T, qps float64, burst int, window time.Duration) {
+	t.Helper()
+	SetAPIRateLimit(qps, burst, window)
+	t.Cleanup(func() {
+		SetAPIRateLimit(defaultAPIQPS, defaultAPIBurst, defaultDiscoveryWindow)
+	})
+}
+
+func TestLimitedDiscoveryCoalesces(t *testing.T) {
+	useFakeClientset(t, testService("storm", "ns"), testPod("storm-0", "ns", "storm", "10.0.0.1"))
+	defer forgetDiscoveries("storm.ns:1000")
+	lists := countPodLists(t)
+	withAPIRateLimit(t, 0, 0, 300*time.Millisecond)
+	p := newConnection(okBalancer{}, newPoolConfig(nil))
+	if _, _, err := limitedDiscovery("storm.ns:1000", "1000", p); err != nil {
+		t.Fatal(err)
+	}
+	// Within the window: the refreshes wait for the next discovery and share it
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, pods, err := limitedDiscovery("storm.ns:1000", "1000", p)
+			if err != nil || len(pods.Items) != 1 {
+				t.Errorf("limitedDiscovery() = %v, %v", pods, err)
+				return
+			}
+			pods.Items[0].Name = "modified"
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(lists); n != 2 {
+		t.Errorf("%d pod lists for 11 refreshes, want 2", n)
+	}
+}
+
+func TestLimitedDiscoveryRateLimit(t *testing.T) {
+	useFakeClientset(t, testService("a", "ns"), testService("b", "ns"), testService("c", "ns"))
+	defer forgetDiscoveries("a.ns:1000")
+	defer forgetDiscoveries("b.ns:1000")
+	defer forgetDiscoveries("c.ns:1000")
+	withAPIRateLimit(t, 10, 1, 0)
+	p := newConnection(okBalancer{}, newPoolConfig(nil))
+	start := time.Now()
+	for _, s := range []string{"a.ns:1000", "b.ns:1000", "c.ns:1000"} {
+		limitedDiscovery(s, "1000", p)
+	}
+	// The burst admits the first discovery, the others wait 100ms each
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("3 discoveries at 10 per second took %v", d)
+	}
+}
+
+func TestFirstDiscoveryWaitsOutsideLock(t *testing.T) {
+	useFakeClientset(t, testService("slow", "ns"), testPod("slow-0", "ns", "slow", "10.0.0.1"))
+	defer forgetDiscoveries("slow.ns:1000")
+	withAPIRateLimit(t, 0, 0, 800*time.Millisecond)
+	p := newConnection(okBalancer{}, newPoolConfig(nil))
+	if _, _, err := limitedDiscovery("slow.ns:1000", "1000", p); err != nil {
+		t.Fatal(err)
+	}
+	// The first Connect waits for the window of the discovery above without holding the pool lock
+	defer ClosePool("slow.ns:1000")
+	done := make(chan error, 1)
+	go func() {
+		_, err := Connect("slow.ns:1000", okBalancer{})
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		mutex.Lock()
+		mutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(300 * time.Millisecond):
+		t.Error("mutex held while the first discovery waits for the API limits")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Connect() error = %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrNotReady - A pool marked with WithRequired has no healthy endpoints
+var ErrNotReady = errors.New("kubegrpc: required pool without healthy endpoints")
+
+// WithRequired - Marks the pool as required for the readiness of the process: Ready and ReadinessHandler report
+// not ready while the pool has no healthy endpoints
+func WithRequired() PoolOption {
+	return func(c *poolConfig) {
+		c.required = true
+	}
+}
+
+// Ready - Returns ErrNotReady, with the names of the pools, if a pool marked with WithRequired has no healthy
+// endpoint: none which is not draining or ejected by its circuit breaker, counting the secondary service of a pool with
+// WithFailover. Returns ErrShutdown once Shutdown started, so the pod leaves the endpoints of its own service. In
+// bypass mode the bypassed pools are not used and not checked.
+func Ready() error {
+	if isShuttingDown() {
+		return ErrShutdown
+	}
+	mutex.RLock()
+	failed := make([]string, 0)
+	for serviceName, c := range connectionCache {
+		if !c.config.required || bypassedFor(serviceName) || healthyConnections(c) > 0 {
+			continue
+		}
+		if secondary := connectionCache[c.config.failoverService]; secondary != nil && healthyConnections(secondary) > 0 {
+			continue
+		}
+		failed = append(failed, serviceName)
+	}
+	mutex.RUnlock()
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("%w: %s", ErrNotReady, strings.Join(failed, ", "))
+}
+
+// ReadinessHandler - HTTP handler for the readiness probe of the pod, e.g.
+// mux.Handle("/ready", kubegrpc.ReadinessHandler()): answers 200 while Ready returns nil, 503 with the error
+// otherwise
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,45 @@
+package kubegrpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	p := testPool(t, 2, WithRequired())
+	cachePool(t, p)
+	optional := newConnection(okBalancer{}, newPoolConfig(nil))
+	mutex.Lock()
+	setPool("optional.ns:1000", optional)
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		removePool("optional.ns:1000")
+		mutex.Unlock()
+	}()
+	if err := Ready(); err != nil {
+		t.Fatalf("Ready() = %v with healthy endpoints", err)
+	}
+	for _, gc := range p.grpcConnection {
+		atomic.StoreInt32(&gc.draining, 1)
+	}
+	err := Ready()
+	if !errors.Is(err, ErrNotReady) || !strings.Contains(err.Error(), "svc.ns:1000") {
+		t.Fatalf("Ready() = %v with all endpoints draining, want ErrNotReady for svc.ns:1000", err)
+	}
+	w := httptest.NewRecorder()
+	ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "svc.ns:1000") {
+		t.Errorf("ReadinessHandler() = %d %q, want 503", w.Code, w.Body.String())
+	}
+	atomic.StoreInt32(&p.grpcConnection[0].draining, 0)
+	w = httptest.NewRecorder()
+	ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("ReadinessHandler() = %d %q, want 200", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,118 @@
+package kubegrpc
+
+import (
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of WithStreamRebalance
+const (
+	defaultRebalanceInterval = time.Minute
+	defaultRebalanceFraction = 0.1
+)
+
+// StreamRebalance - Rebalancing of the long-lived streams of a pool, see WithStreamRebalance
+type StreamRebalance struct {
+	Interval time.Duration // Between two rebalancing rounds, default a minute
+	Fraction float64       // Share of the open streams of the pool moved per round at most, default 0.1
+	// Move - Asked to re-establish the stream on the target connection, eg by signaling the subscription to reconnect.
+	// Called from the pool maintenance, so it must return quickly.
+	Move func(StreamMove)
+}
+
+// StreamMove - A stream to move from a loaded connection to an under-utilized one
+type StreamMove struct {
+	Stream StreamInfo      // The stream to move, cancel it once the replacement is established
+	Target *GrpcConnection // The connection to open the replacement stream on
+}
+
+// WithStreamRebalance - Spreads the long-lived streams (eg server-streaming subscriptions) over the pods added to the
+// pool: streams stay on the connection they were opened on, so new pods stay idle while the old ones carry all
+// subscriptions. Every Interval the open streams of the connections are compared, and while they differ by more than
+// one, the oldest streams of the most loaded connections are handed to Move together with the least loaded connection
+// to reopen them on, at most Fraction of the streams per round. Only streams opened through the pool are counted.
+func WithStreamRebalance(policy StreamRebalance) PoolOption {
+	return func(c *poolConfig) {
+		if policy.Interval <= 0 {
+			policy.Interval = defaultRebalanceInterval
+		}
+		if policy.Fraction <= 0 || policy.Fraction > 1 {
+			policy.Fraction = defaultRebalanceFraction
+		}
+		c.streamRebalance = &policy
+	}
+}
+
+// rebalanceStreams - Runs a rebalancing round of the pool
+func rebalanceStreams(serviceName string, c *connection) {
+	policy := c.config.streamRebalance
+	if policy == nil || policy.Move == nil {
+		return
+	}
+	mutex.RLock()
+	if c.closed {
+		mutex.RUnlock()
+		return
+	}
+	moves := planStreamMoves(c.grpcConnection, policy.Fraction)
+	mutex.RUnlock()
+	if len(moves) > 0 {
+		log.Printf("INFO: rebalanceStreams(): Moving %d streams of %s", len(moves), serviceName)
+	}
+	for _, m := range moves {
+		policy.Move(m)
+	}
+}
+
+// planStreamMoves - The streams to move, one at a time from the most to the least loaded connection until they differ
+// by at most one stream or the fraction of the streams is reached. Draining and ejected connections take no part.
+// Caller must hold mutex.
+func planStreamMoves(conns []*GrpcConnection, fraction float64) []StreamMove {
+	candidates := make([]*GrpcConnection, 0, len(conns))
+	counts := make([]int, 0, len(conns))
+	total := 0
+	for _, gc := range conns {
+		if gc.isDraining() || gc.weight() == 0 {
+			continue
+		}
+		n := int(atomic.LoadInt64(&gc.streams))
+		candidates = append(candidates, gc)
+		counts = append(counts, n)
+		total += n
+	}
+	if len(candidates) < 2 || total == 0 {
+		return nil
+	}
+	budget := int(math.Ceil(fraction * float64(total)))
+	streams := make(map[int][]StreamInfo)
+	moves := make([]StreamMove, 0)
+	for len(moves) < budget {
+		most, least := 0, 0
+		for i, n := range counts {
+			if n > counts[most] {
+				most = i
+			}
+			if n < counts[least] {
+				least = i
+			}
+		}
+		if counts[most]-counts[least] <= 1 {
+			break
+		}
+		if _, listed := streams[most]; !listed {
+			streams[most] = candidates[most].openStreamInfos()
+		}
+		if len(streams[most]) == 0 {
+			// Ended since they were counted
+			counts[most] = counts[least]
+			continue
+		}
+		moves = append(moves, StreamMove{Stream: streams[most][0], Target: candidates[least]})
+		streams[most] = streams[most][1:]
+		counts[most]--
+		counts[least]++
+	}
+	return moves
+}
@@ -0,0 +1,122 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// ErrServiceNotExposed - The pod does not expose a service or method expected with WithReflectionCheck
+var ErrServiceNotExposed = errors.New("kubegrpc: expected service not exposed")
+
+// WithReflectionCheck - Verifies when a pod is dialed that it exposes the services, given as `package.Service` or
+// `package.Service/Method`, using the gRPC server reflection service of the pod. A pod which does not expose them, or
+// does not serve reflection, is rejected like a failed dial (ErrDialFailed wrapping ErrServiceNotExposed, with a
+// description of what is missing) and backed off, instead of failing the first calls picking it, eg after a wrong port
+// or target service in the configuration. The new connections of a refresh are checked concurrently, up to the ping
+// timeout, without blocking the picks and the other pools. Pools with the check are not restored by RestorePools.
+func WithReflectionCheck(services ...string) PoolOption {
+	return func(c *poolConfig) {
+		c.reflectionCheck = append(c.reflectionCheck, services...)
+	}
+}
+
+// expectedMethods - The methods expected per service, an empty list for services without expected methods
+func expectedMethods(expected []string) (map[string][]string, []string) {
+	methods := make(map[string][]string)
+	order := make([]string, 0, len(expected))
+	for _, e := range expected {
+		// Full method names like /package.Service/Method are accepted too
+		service, method := strings.TrimPrefix(e, "/"), ""
+		if i := strings.Index(service, "/"); i >= 0 {
+			service, method = service[:i], service[i+1:]
+		}
+		if _, found := methods[service]; !found {
+			order = append(order, service)
+			methods[service] = nil
+		}
+		if method != "" {
+			methods[service] = append(methods[service], method)
+		}
+	}
+	return methods, order
+}
+
+// checkReflection - Checks the services of the pool on the new connection within the ping timeout
+func (c *GrpcConnection) checkReflection(p *connection) error {
+	timeout := p.config.pingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(p.poolContext(), timeout)
+	defer cancel()
+	return checkReflection(ctx, c.conn, p.config.reflectionCheck)
+}
+
+// checkReflection - Returns ErrServiceNotExposed if the server of the connection does not expose the expected services
+// and methods
+func checkReflection(ctx context.Context, conn *grpc.ClientConn, expected []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(internalCall(ctx))
+	if err != nil {
+		return fmt.Errorf("%w: reflection not available: %v", ErrServiceNotExposed, err)
+	}
+	methods, order := expectedMethods(expected)
+	for _, service := range order {
+		req := &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service}}
+		if err := stream.Send(req); err != nil {
+			return fmt.Errorf("%w: reflection not available: %v", ErrServiceNotExposed, err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("%w: reflection not available: %v", ErrServiceNotExposed, err)
+		}
+		files := resp.GetFileDescriptorResponse()
+		if files == nil {
+			return fmt.Errorf("%w: service %s is not exposed", ErrServiceNotExposed, service)
+		}
+		exposed, found := exposedMethods(files.FileDescriptorProto, service)
+		if !found {
+			return fmt.Errorf("%w: service %s is not exposed", ErrServiceNotExposed, service)
+		}
+		for _, method := range methods[service] {
+			if !exposed[method] {
+				return fmt.Errorf("%w: service %s has no method %s", ErrServiceNotExposed, service, method)
+			}
+		}
+	}
+	return stream.CloseSend()
+}
+
+// exposedMethods - The methods of the service in the serialized file descriptors, false if no file defines it
+func exposedMethods(files [][]byte, service string) (map[string]bool, bool) {
+	for _, b := range files {
+		fd := &descpb.FileDescriptorProto{}
+		if proto.Unmarshal(b, fd) != nil {
+			continue
+		}
+		prefix := ""
+		if fd.GetPackage() != "" {
+			prefix = fd.GetPackage() + "."
+		}
+		for _, s := range fd.Service {
+			if prefix+s.GetName() != service {
+				continue
+			}
+			methods := make(map[string]bool, len(s.Method))
+			for _, m := range s.Method {
+				methods[m.GetName()] = true
+			}
+			return methods, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,134 @@
+package kubegrpc
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// reflectionServer - Serves the health service, with reflection if reflect, returns the port
+func reflectionServer(t *testing.T, reflect bool) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	if reflect {
+		reflection.Register(s)
+	}
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// dialChecked - Dials the pod on the port and runs the checks of the pool on the connection
+func dialChecked(p *connection, port string) (*GrpcConnection, error) {
+	gc, dialErr := newGrpcConnection("svc.ns:"+port, p, testPod("svc-1", "ns", "svc", "127.0.0.1"), port)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	if _, dialErr = preflight(p, []*GrpcConnection{gc}); dialErr != nil {
+		return nil, dialErr
+	}
+	return gc, nil
+}
+
+func TestReflectionCheck(t *testing.T) {
+	port := reflectionServer(t, true)
+	for _, tc := range []struct {
+		expected []string
+		ok       bool
+	}{
+		{[]string{"grpc.health.v1.Health"}, true},
+		{[]string{"grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Watch"}, true},
+		{[]string{"grpc.health.v1.Health/Check", "grpc.health.v1.Health/Missing"}, false},
+		{[]string{"grpc.health.v1.Health", "example.Missing"}, false},
+	} {
+		p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithReflectionCheck(tc.expected...)}))
+		gc, err := dialChecked(p, port)
+		if tc.ok {
+			if err != nil {
+				t.Errorf("%v: %v", tc.expected, err)
+				continue
+			}
+			gc.conn.Close()
+			continue
+		}
+		var dialErr *ErrDialFailed
+		if !errors.As(err, &dialErr) || !errors.Is(err, ErrServiceNotExposed) {
+			t.Errorf("%v: error %v, want ErrDialFailed wrapping ErrServiceNotExposed", tc.expected, err)
+		}
+	}
+}
+
+func TestReflectionCheckWithoutReflection(t *testing.T) {
+	port := reflectionServer(t, false)
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithReflectionCheck("grpc.health.v1.Health")}))
+	_, err := dialChecked(p, port)
+	if !errors.Is(err, ErrServiceNotExposed) {
+		t.Errorf("error %v without reflection, want ErrServiceNotExposed", err)
+	}
+}
+
+func TestReflectionCheckOutsideLock(t *testing.T) {
+	// A pod accepting connections without answering keeps the check waiting for the ping timeout
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conns := make([]net.Conn, 0)
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	serviceName := "svc.ns:" + port
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithReflectionCheck("grpc.health.v1.Health"),
+		WithPingTimeout(time.Second)}))
+	mutex.Lock()
+	setPool(serviceName, c)
+	mutex.Unlock()
+	defer ClosePool(serviceName)
+	done := make(chan error, 1)
+	go func() { done <- updateConnectionPool(serviceName, c, true) }()
+
+	time.Sleep(200 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		mutex.Lock()
+		mutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("mutex held during the reflection check")
+	}
+	if err := <-done; !errors.Is(err, ErrServiceNotExposed) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrServiceNotExposed", err)
+	}
+	if n := poolSize(c, 0); n != 0 {
+		t.Errorf("pool size = %d, want the pod rejected", n)
+	}
+}
@@ -0,0 +1,55 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWithRefreshInterval(t *testing.T) {
+	if c := newPoolConfig([]PoolOption{WithRefreshInterval(10 * time.Second)}); c.refreshInterval != 10*time.Second {
+		t.Errorf("refreshInterval = %v, want 10s", c.refreshInterval)
+	}
+	if c := newPoolConfig([]PoolOption{WithRefreshInterval(0)}); c.refreshInterval != defaultRefreshInterval {
+		t.Errorf("refreshInterval = %v, want the default", c.refreshInterval)
+	}
+}
+
+func TestRefreshContext(t *testing.T) {
+	useFakeClientset(t, testService("refresh", "ns"), testPod("refresh-0", "ns", "refresh", "10.0.0.1"))
+	defer ClosePool("refresh.ns:1000")
+	if err := RefreshContext(context.Background(), "refresh.ns:1000"); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("RefreshContext() error = %v, want ErrPoolNotFound", err)
+	}
+	if _, err := ConnectWithOptions("refresh.ns:1000", okBalancer{}, WithRefreshInterval(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	cs := clientset.(*fake.Clientset)
+	if err := cs.Tracker().Add(testPod("refresh-1", "ns", "refresh", "10.0.0.2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RefreshContext(context.Background(), "refresh.ns:1000"); err != nil {
+		t.Fatalf("RefreshContext() = %v", err)
+	}
+	if n := len(Connections("refresh.ns:1000")); n != 2 {
+		t.Errorf("%d connections after the refresh, want the scaled up 2", n)
+	}
+
+	// A discovery which does not complete in time
+	release := make(chan struct{})
+	defer close(release)
+	cs.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := RefreshContext(ctx, "refresh.ns:1000"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RefreshContext() error = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,57 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFailureExclusion - Time an endpoint is excluded from the picks after a reported failure
+const defaultFailureExclusion = 30 * time.Second
+
+// WithFailureExclusion - Time an endpoint is excluded from the picks after the application reported a failure with
+// ReportFailure, default 30 seconds
+func WithFailureExclusion(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.failureExclusion = d
+	}
+}
+
+// ReportFailure - Reports an application level failure of the endpoint which the ping can not detect, eg corrupt or
+// inconsistent responses. The endpoint is excluded from the picks for the failure exclusion of the pool (see
+// WithFailureExclusion), like an endpoint ejected by the circuit breaker: it is only picked if all endpoints are
+// excluded or ejected. Every report restarts the exclusion. Emits an EndpointUnhealthy event.
+func (c *GrpcConnection) ReportFailure(err error) {
+	if c == nil || err == nil {
+		return
+	}
+	exclusion := defaultFailureExclusion
+	if c.pool != nil && c.pool.config.failureExclusion > 0 {
+		exclusion = c.pool.config.failureExclusion
+	}
+	until := time.Now().Add(exclusion)
+	atomic.StoreInt64(&c.excludedUntil, until.UnixNano())
+	c.setLastError(err)
+	log.Printf("INFO: ReportFailure(): Excluding %s of %s until %s. Error: %v", c.describe(), c.serviceName,
+		until.Format(time.RFC3339), err)
+	decideEviction(c, "excluded by reported failure: "+err.Error())
+	emitEndpoint(EndpointUnhealthy, c, 0, "reported failure: "+err.Error())
+}
+
+// exclusionEnd - End of the exclusion by ReportFailure, zero if the endpoint is not excluded
+func (c *GrpcConnection) exclusionEnd() time.Time {
+	until := atomic.LoadInt64(&c.excludedUntil)
+	if until == 0 || time.Now().UnixNano() >= until {
+		return time.Time{}
+	}
+	return time.Unix(0, until)
+}
+
+// weight - Pick weight of the connection from its health: 0 while excluded by ReportFailure, otherwise the weight of
+// the circuit breaker
+func (c *GrpcConnection) weight() float64 {
+	if !c.exclusionEnd().IsZero() {
+		return 0
+	}
+	return c.breaker.weight()
+}
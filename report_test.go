@@ -0,0 +1,55 @@
+package kubegrpc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportFailureExcludesEndpoint(t *testing.T) {
+	p := testPool(t, 2, WithFailureExclusion(100*time.Millisecond))
+	bad, good := p.grpcConnection[0], p.grpcConnection[1]
+	events := Subscribe("svc.ns:1000")
+	defer Unsubscribe("svc.ns:1000", events)
+
+	bad.ReportFailure(errors.New("corrupt response"))
+	for i := 0; i < 20; i++ {
+		if gc := pickConnection("svc.ns:1000", p.grpcConnection); gc != good {
+			t.Fatalf("pickConnection() picked the excluded %s", gc.connectionIP)
+		}
+	}
+	stats := bad.Stats()
+	if stats.Weight != 0 || stats.Excluded.IsZero() || stats.LastError != "corrupt response" {
+		t.Errorf("Stats() of the excluded endpoint = weight %v, excluded %v, last error %q", stats.Weight,
+			stats.Excluded, stats.LastError)
+	}
+	select {
+	case e := <-events:
+		if e.Type != EndpointUnhealthy || !strings.Contains(e.Reason, "corrupt response") {
+			t.Errorf("event = %v %q, want EndpointUnhealthy with the reported error", e.Type, e.Reason)
+		}
+	case <-time.After(time.Second):
+		t.Error("no event for the reported failure")
+	}
+
+	// All excluded: still hand out a connection
+	good.ReportFailure(errors.New("corrupt response"))
+	if gc := pickConnection("svc.ns:1000", p.grpcConnection); gc == nil {
+		t.Fatal("pickConnection() returned nil with all connections excluded")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if stats := bad.Stats(); stats.Weight != 1 || !stats.Excluded.IsZero() {
+		t.Errorf("Stats() after the exclusion = weight %v, excluded %v", stats.Weight, stats.Excluded)
+	}
+}
+
+func TestReportFailureIgnoresNil(t *testing.T) {
+	p := testPool(t, 1)
+	p.grpcConnection[0].ReportFailure(nil)
+	(*GrpcConnection)(nil).ReportFailure(errors.New("ignored"))
+	if w := p.grpcConnection[0].weight(); w != 1 {
+		t.Errorf("weight() after a nil error = %v, want 1", w)
+	}
+}
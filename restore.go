@@ -0,0 +1,299 @@
+package kubegrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// defaultRestoreMaxAge - Age after which saved endpoint sets are no longer restored, see RestorePools
+	defaultRestoreMaxAge = 15 * time.Minute
+	// poolStoreKey - Key of the saved endpoint sets in the ConfigMap of ConfigMapPoolStore
+	poolStoreKey = "pools.json"
+)
+
+var (
+	// poolStore - Store the endpoint sets are saved to, nil if they are not saved. Protected by poolStoreMutex.
+	poolStore PoolStore
+	// restoredPools - Saved endpoint sets not restored yet, by service name. Protected by poolStoreMutex.
+	restoredPools  = make(map[string][]savedEndpoint)
+	poolStoreMutex = &sync.Mutex{}
+)
+
+// PoolStore - Storage of the endpoint sets saved by SavePools. Load returns nil data if nothing was saved yet.
+type PoolStore interface {
+	Save(ctx context.Context, data []byte) error
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// savedPools - The endpoint sets of the pools as saved by SavePools
+type savedPools struct {
+	Saved time.Time                  `json:"saved"`
+	Pools map[string][]savedEndpoint `json:"pools"`
+}
+
+// savedEndpoint - An endpoint of a saved pool, enough to dial it again
+type savedEndpoint struct {
+	Pod         string            `json:"pod"`
+	Namespace   string            `json:"namespace"`
+	UID         types.UID         `json:"uid,omitempty"`
+	IP          string            `json:"ip"`
+	Port        string            `json:"port"`
+	TLS         bool              `json:"tls,omitempty"`
+	AddressOnly bool              `json:"addressOnly,omitempty"`
+	Node        string            `json:"node,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// filePoolStore - PoolStore of FilePoolStore
+type filePoolStore struct {
+	path string
+}
+
+// FilePoolStore - Saves the endpoint sets to the file, eg on an emptyDir or persistent volume surviving the restart
+// of the container
+func FilePoolStore(path string) PoolStore {
+	return filePoolStore{path: path}
+}
+
+// Save - Implements PoolStore, replaces the file atomically
+func (s filePoolStore) Save(_ context.Context, data []byte) error {
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Load - Implements PoolStore
+func (s filePoolStore) Load(_ context.Context) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// configMapPoolStore - PoolStore of ConfigMapPoolStore
+type configMapPoolStore struct {
+	namespace string
+	name      string
+}
+
+// ConfigMapPoolStore - Saves the endpoint sets to the ConfigMap, created if missing, for pods without a volume. An
+// empty namespace is the namespace of the pod running this code. The service account needs `get`, `create` and
+// `update` on `configmaps`; a ConfigMap holds at most 1MiB, some thousand endpoints.
+func ConfigMapPoolStore(namespace, name string) PoolStore {
+	return configMapPoolStore{namespace: namespace, name: name}
+}
+
+// Save - Implements PoolStore
+func (s configMapPoolStore) Save(ctx context.Context, data []byte) error {
+	k8s, err := getClientset()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	namespace := s.configMapNamespace()
+	configMaps := k8s.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: namespace},
+			Data: map[string]string{poolStoreKey: string(data)}}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return kubernetesError(err, "create", "configmaps", namespace)
+		}
+		return nil
+	}
+	if err != nil {
+		return kubernetesError(err, "get", "configmaps", namespace)
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[poolStoreKey] = string(data)
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return kubernetesError(err, "update", "configmaps", namespace)
+	}
+	return nil
+}
+
+// Load - Implements PoolStore
+func (s configMapPoolStore) Load(ctx context.Context) ([]byte, error) {
+	k8s, err := getClientset()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	namespace := s.configMapNamespace()
+	cm, err := k8s.CoreV1().ConfigMaps(namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, kubernetesError(err, "get", "configmaps", namespace)
+	}
+	if data, found := cm.Data[poolStoreKey]; found {
+		return []byte(data), nil
+	}
+	return nil, nil
+}
+
+// configMapNamespace - The namespace of the ConfigMap, defaults to the namespace of the pod
+func (s configMapPoolStore) configMapNamespace() string {
+	if s.namespace != "" {
+		return s.namespace
+	}
+	return defaultNamespace()
+}
+
+// RestorePools - Fast restarts of large pools: loads the endpoint sets the previous process saved to the store (see
+// SavePools; Shutdown saves them too), if not older than maxAge (default 15 minutes). A pool created afterwards dials
+// its saved endpoints right away instead of waiting for the discovery, which runs in the background and then adds
+// the new pods and drains the gone ones, as a refresh does. Each saved set is restored once; pools without a saved
+// set are discovered as usual. Call it before the first pool; a nil store stops the saving and restoring.
+func RestorePools(ctx context.Context, store PoolStore, maxAge time.Duration) error {
+	poolStoreMutex.Lock()
+	poolStore = store
+	restoredPools = make(map[string][]savedEndpoint)
+	poolStoreMutex.Unlock()
+	if store == nil {
+		return nil
+	}
+	if maxAge <= 0 {
+		maxAge = defaultRestoreMaxAge
+	}
+	data, err := store.Load(ctx)
+	if err != nil || data == nil {
+		return err
+	}
+	var saved savedPools
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid saved pools: %v", err)
+	}
+	if age := time.Since(saved.Saved); age > maxAge {
+		log.Printf("INFO: RestorePools(): Saved pools are %v old, discovering the pools", age.Round(time.Second))
+		return nil
+	}
+	poolStoreMutex.Lock()
+	restoredPools = saved.Pools
+	poolStoreMutex.Unlock()
+	log.Printf("INFO: RestorePools(): %d saved pools from %v", len(saved.Pools), saved.Saved.Format(time.RFC3339))
+	return nil
+}
+
+// SavePools - Saves the endpoints of the pools to the store of RestorePools, eg periodically in case the process does
+// not get to its Shutdown. Stand-ins of WithPassthrough and WithXDS are not saved. Does nothing without store.
+func SavePools(ctx context.Context) error {
+	poolStoreMutex.Lock()
+	store := poolStore
+	poolStoreMutex.Unlock()
+	if store == nil {
+		return nil
+	}
+	mutex.RLock()
+	saved := savedPools{Saved: time.Now(), Pools: make(map[string][]savedEndpoint, len(connectionCache))}
+	for serviceName, c := range connectionCache {
+		if endpoints := saveEndpoints(c.grpcConnection); !c.closed && len(endpoints) > 0 {
+			saved.Pools[serviceName] = endpoints
+		}
+	}
+	mutex.RUnlock()
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return store.Save(ctx, data)
+}
+
+// saveEndpoints - The endpoints of the connections which are not draining, one per address. Caller must hold mutex.
+func saveEndpoints(conns []*GrpcConnection) []savedEndpoint {
+	endpoints := make([]savedEndpoint, 0, len(conns))
+	seen := make(map[string]bool, len(conns))
+	for _, gc := range conns {
+		address := net.JoinHostPort(gc.connectionIP, gc.port)
+		if gc.isDraining() || seen[address] || net.ParseIP(gc.connectionIP) == nil {
+			// Stand-ins for a service (passthrough, xDS) have no endpoint address
+			continue
+		}
+		seen[address] = true
+		endpoints = append(endpoints, savedEndpoint{Pod: gc.podName, Namespace: gc.namespace, UID: gc.podUID,
+			IP: gc.connectionIP, Port: gc.port, TLS: gc.tls, AddressOnly: gc.addressOnly, Node: gc.nodeName,
+			Labels: gc.labels})
+	}
+	return endpoints
+}
+
+// takeRestored - The saved endpoints of the pool, removed so they are restored once
+func takeRestored(serviceName string) []savedEndpoint {
+	poolStoreMutex.Lock()
+	defer poolStoreMutex.Unlock()
+	endpoints := restoredPools[serviceName]
+	delete(restoredPools, serviceName)
+	return endpoints
+}
+
+// restorePool - Dials the saved endpoints of the empty pool and starts its discovery in the background, false if
+// there are no saved endpoints or none could be dialed. Pools checking their new connections (see preflight) are not
+// restored, as the checks can not run under mutex. Caller must hold mutex.
+func restorePool(serviceName string, c *connection) bool {
+	endpoints := takeRestored(serviceName)
+	if len(endpoints) == 0 || c.config.preflights() {
+		return false
+	}
+	if poolFull(c, len(endpoints)) {
+		endpoints = endpoints[:c.maxConnections()]
+	}
+	ports := make([]string, 0)
+	pods := make(map[string][]*corev1.Pod)
+	for _, e := range endpoints {
+		if pods[e.Port] == nil {
+			ports = append(ports, e.Port)
+		}
+		pods[e.Port] = append(pods[e.Port], &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: e.Pod, Namespace: e.Namespace, UID: e.UID, Labels: e.Labels,
+				Annotations: map[string]string{tlsAnnotation: strconv.FormatBool(e.TLS),
+					addressAnnotation: strconv.FormatBool(e.AddressOnly)}},
+			Spec:   corev1.PodSpec{NodeName: e.Node},
+			Status: corev1.PodStatus{PodIP: e.IP},
+		})
+	}
+	added := make([]*GrpcConnection, 0, len(endpoints))
+	for _, port := range ports {
+		for _, r := range dialPods(serviceName, c, pods[port], port) {
+			if r.err != nil {
+				log.Printf("INFO: restorePool(): %v", r.err)
+				continue
+			}
+			added = append(added, r.gc)
+		}
+	}
+	if len(added) == 0 {
+		return false
+	}
+	version := c.swapConnections(validSnapshot(append(c.grpcConnection, added...)))
+	for _, gc := range added {
+		emitEndpoint(EndpointAdded, gc, c.nConnections, "")
+	}
+	updateDegraded(serviceName, c)
+	log.Printf("INFO: restorePool(): Pool %s version %d: %d saved connections restored, discovering in the background",
+		serviceName, version, len(added))
+	go func() {
+		if err := updateConnectionPool(serviceName, c, true); err != nil && !errors.Is(err, ErrPoolClosed) {
+			log.Printf("WARNING: restorePool(): Discovery of the restored pool %s failed. Error %v", serviceName, err)
+		}
+	}()
+	return true
+}
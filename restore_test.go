@@ -0,0 +1,101 @@
+package kubegrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useRestorePools - RestorePools from the store, stopped when the test ends
+func useRestorePools(t *testing.T, store PoolStore) {
+	t.Helper()
+	if err := RestorePools(context.Background(), store, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RestorePools(context.Background(), nil, 0) })
+}
+
+// activeTargets - Targets of the connections of the pool which are not draining
+func activeTargets(serviceName string) []string {
+	active := make([]*GrpcConnection, 0)
+	for _, gc := range Connections(serviceName) {
+		if !gc.isDraining() {
+			active = append(active, gc)
+		}
+	}
+	return targets(active)
+}
+
+func TestSavePools(t *testing.T) {
+	store := FilePoolStore(filepath.Join(t.TempDir(), "pools.json"))
+	useRestorePools(t, store)
+	p := testPool(t, 2)
+	cachePool(t, p)
+	startDrain(p.grpcConnection[1])
+	if err := SavePools(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	useRestorePools(t, store)
+	restored := takeRestored("svc.ns:1000")
+	if len(restored) != 1 || restored[0].Pod != "svc-1" || restored[0].IP != "10.0.0.1" || restored[0].Port != "1000" ||
+		!reflect.DeepEqual(restored[0].Labels, map[string]string{"app": "svc"}) {
+		t.Errorf("restored endpoints = %+v, want svc-1 without the draining svc-2", restored)
+	}
+	if again := takeRestored("svc.ns:1000"); len(again) != 0 {
+		t.Errorf("endpoints restored twice: %+v", again)
+	}
+
+	if err := RestorePools(context.Background(), store, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if outdated := takeRestored("svc.ns:1000"); len(outdated) != 0 {
+		t.Errorf("endpoints restored beyond the maximum age: %+v", outdated)
+	}
+}
+
+func TestRestorePool(t *testing.T) {
+	useFakeClientset(t, testService("restore", "ns"), testPod("restore-2", "ns", "restore", "10.0.0.2"),
+		testPod("restore-3", "ns", "restore", "10.0.0.3"))
+	path := filepath.Join(t.TempDir(), "pools.json")
+	saved, err := json.Marshal(savedPools{Saved: time.Now(), Pools: map[string][]savedEndpoint{"restore.ns:1000": {
+		{Pod: "restore-1", Namespace: "ns", IP: "10.0.0.1", Port: "1000"},
+		{Pod: "restore-2", Namespace: "ns", IP: "10.0.0.2", Port: "1000"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, saved, 0600); err != nil {
+		t.Fatal(err)
+	}
+	useRestorePools(t, FilePoolStore(path))
+	defer ClosePool("restore.ns:1000")
+
+	// The discovery is held back, the pool starts with the saved endpoints
+	release := make(chan struct{})
+	clientset.(*fake.Clientset).PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	if _, err := ConnectWithOptions("restore.ns:1000", okBalancer{}, WithRefreshInterval(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := activeTargets("restore.ns:1000"), []string{"10.0.0.1:1000", "10.0.0.2:1000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("restored pool = %v, want %v", got, want)
+	}
+	close(release)
+	want := []string{"10.0.0.2:1000", "10.0.0.3:1000"}
+	for i := 0; i < 100 && !reflect.DeepEqual(activeTargets("restore.ns:1000"), want); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := activeTargets("restore.ns:1000"); !reflect.DeepEqual(got, want) {
+		t.Errorf("pool after the discovery = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,254 @@
+package kubegrpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy - Retries and hedging of unary RPCs made through the connections of a pool. Retries and hedges always go
+// to a different endpoint than the attempts before, skipping endpoints which failed recently or are ejected.
+// Methods are matched by full name (`/pkg.Service/Method`), by service prefix (`/pkg.Service/`) or `*` for all methods.
+// Only list methods which are safe to execute more than once. Server pushback (the `grpc-retry-pushback-ms` trailer) is
+// honored: a retry or hedge waits the pushback delay, and a negative pushback stops further attempts for the call.
+type RetryPolicy struct {
+	IdempotentMethods []string      // Methods which are retried on a retryable error
+	HedgedMethods     []string      // Methods for which hedged requests are sent, implies retries on errors
+	MaxAttempts       int           // Maximum attempts per call including the first one, default 3
+	RetryableCodes    []codes.Code  // Status codes which are retried, default Unavailable
+	HedgeDelay        time.Duration // Delay after which a hedged request is sent when no response arrived, default 50ms
+	BudgetRatio       float64       // Retries and hedges as fraction of the calls, default 0.2
+	BudgetMin         int           // Retries and hedges always allowed in a burst regardless of the ratio, default 10
+	AttemptDeadline   bool          // Splits the deadline of a retried call over its attempts, see AttemptContext
+}
+
+// WithRetryPolicy - Enables retries and hedging for the unary RPCs through the connections of the pool
+func WithRetryPolicy(p RetryPolicy) PoolOption {
+	return func(c *poolConfig) {
+		if p.MaxAttempts <= 0 {
+			p.MaxAttempts = 3
+		}
+		if len(p.RetryableCodes) == 0 {
+			p.RetryableCodes = []codes.Code{codes.Unavailable}
+		}
+		if p.HedgeDelay <= 0 {
+			p.HedgeDelay = 50 * time.Millisecond
+		}
+		if p.BudgetRatio <= 0 {
+			p.BudgetRatio = 0.2
+		}
+		if p.BudgetMin <= 0 {
+			p.BudgetMin = 10
+		}
+		c.retryPolicy = &p
+	}
+}
+
+// matchMethod - True if the full method name matches one of the patterns
+func matchMethod(patterns []string, method string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == method || (strings.HasSuffix(p, "/") && strings.HasPrefix(method, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable - True if the error may be retried according to the policy
+func (p *RetryPolicy) retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := status.Code(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBudget - Token bucket limiting retries and hedges per pool, so retries can not multiply the load during an outage.
+// Every call deposits ratio tokens, every retry or hedge withdraws one. A nil *retryBudget allows nothing.
+type retryBudget struct {
+	mutex  sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+func newRetryBudget(p *RetryPolicy) *retryBudget {
+	if p == nil {
+		return nil
+	}
+	return &retryBudget{tokens: float64(p.BudgetMin), max: float64(p.BudgetMin), ratio: p.BudgetRatio}
+}
+
+// deposit - Records a call
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw - True if a retry or hedge is allowed
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retry - Runs the call and retries retryable errors on other endpoints of the pool
+func (c *GrpcConnection) retry(ctx context.Context, method string, req, reply interface{},
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	p := c.pool.config.retryPolicy
+	c.pool.retryBudget.deposit()
+	tried := map[*GrpcConnection]bool{c: true}
+	delay, allowed, err := c.invokeAttempt(ctx, 1, method, req, reply, invoker, opts...)
+	for attempt := 1; attempt < p.MaxAttempts && allowed && p.retryableAttempt(ctx, err) && ctx.Err() == nil; attempt++ {
+		next := c.pool.alternative(tried)
+		if next == nil || !waitPushback(ctx, delay) || !c.pool.retryBudget.withdraw() {
+			break
+		}
+		tried[next] = true
+		if m, ok := reply.(proto.Message); ok {
+			// Drop partial results of the failed attempt
+			m.Reset()
+		}
+		delay, allowed, err = next.invokeAttempt(ctx, attempt+1, method, req, reply, invoker, opts...)
+	}
+	return err
+}
+
+// invokeAttempt - invokeWithPushback for the attempt of a retried call, with its share of the deadline of ctx if the
+// policy asks for AttemptDeadline
+func (c *GrpcConnection) invokeAttempt(ctx context.Context, attempt int, method string, req, reply interface{},
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (time.Duration, bool, error) {
+	p := c.pool.config.retryPolicy
+	if !p.AttemptDeadline {
+		return c.invokeWithPushback(ctx, method, req, reply, invoker, opts...)
+	}
+	attemptCtx, cancel := attemptContext(ctx, p.MaxAttempts, attempt)
+	defer cancel()
+	return c.invokeWithPushback(attemptCtx, method, req, reply, invoker, opts...)
+}
+
+// retryableAttempt - True if the attempt may be retried: a retryable error, or with AttemptDeadline an attempt which
+// ran out of its share of the deadline
+func (p *RetryPolicy) retryableAttempt(ctx context.Context, err error) bool {
+	return p.retryable(err) || (p.AttemptDeadline && attemptExpired(ctx, err))
+}
+
+// hedgeResult - Outcome of a single hedged attempt
+type hedgeResult struct {
+	reply   proto.Message
+	err     error
+	delay   time.Duration // Server pushback
+	allowed bool          // False if the server asked not to retry
+}
+
+// hedge - Sends the call, and when no response arrived within the hedge delay (or the attempt failed with a retryable
+// error) sends the same call to another endpoint. The first successful response wins, the other attempts are cancelled.
+// Requires protobuf replies since every attempt needs its own reply message; other replies fall back to retries.
+// A server pushback delays the next hedge by the pushback delay, a negative pushback stops further hedges.
+func (c *GrpcConnection) hedge(ctx context.Context, method string, req, reply interface{},
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	replyMessage, ok := reply.(proto.Message)
+	if !ok {
+		return c.retry(ctx, method, req, reply, invoker, opts...)
+	}
+	p := c.pool.config.retryPolicy
+	c.pool.retryBudget.deposit()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, p.MaxAttempts)
+	launch := func(gc *GrpcConnection) {
+		r := proto.Clone(replyMessage)
+		go func() {
+			delay, allowed, err := gc.invokeWithPushback(ctx, method, req, r, invoker, opts...)
+			results <- hedgeResult{reply: r, err: err, delay: delay, allowed: allowed}
+		}()
+	}
+	tried := map[*GrpcConnection]bool{c: true}
+	// launchNext - Sends the call to another endpoint if the attempts and budget allow
+	throttled := false
+	launchNext := func() bool {
+		if throttled || len(tried) >= p.MaxAttempts {
+			return false
+		}
+		next := c.pool.alternative(tried)
+		if next == nil || !c.pool.retryBudget.withdraw() {
+			return false
+		}
+		tried[next] = true
+		launch(next)
+		return true
+	}
+	launch(c)
+	inflight := 1
+	pushedBack := false // A hedge is scheduled by a server pushback
+	timer := time.NewTimer(p.HedgeDelay)
+	defer timer.Stop()
+	var lastErr error
+	for inflight > 0 || pushedBack {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				replyMessage.Reset()
+				proto.Merge(replyMessage, r.reply)
+				return nil
+			}
+			lastErr = r.err
+			if !p.retryable(r.err) {
+				return r.err
+			}
+			if deadline, ok := ctx.Deadline(); !r.allowed || (ok && time.Until(deadline) <= r.delay) {
+				throttled = true
+				pushedBack = false
+				continue
+			}
+			if r.delay > 0 {
+				// The next hedge goes out after the pushback delay instead of now
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(r.delay)
+				pushedBack = true
+				continue
+			}
+			if launchNext() {
+				inflight++
+			}
+		case <-timer.C:
+			pushedBack = false
+			if launchNext() {
+				inflight++
+				timer.Reset(p.HedgeDelay)
+			}
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,143 @@
+package kubegrpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testPool - Pool with n connections to 10.0.0.1..n, the connections are not actually used by the fake invokers
+func testPool(t *testing.T, n int, opts ...PoolOption) *connection {
+	t.Helper()
+	p := newConnection(okBalancer{}, newPoolConfig(opts))
+	for i := 1; i <= n; i++ {
+		pod := testPod(fmt.Sprintf("svc-%d", i), "ns", "svc", fmt.Sprintf("10.0.0.%d", i))
+		gc, err := newGrpcConnection("svc.ns:1000", p, pod, "1000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.grpcConnection = append(p.grpcConnection, gc)
+	}
+	p.nConnections = n
+	t.Cleanup(func() {
+		for _, gc := range p.grpcConnection {
+			gc.conn.Close()
+		}
+	})
+	return p
+}
+
+// recordingInvoker - Fake invoker answering per target, records the targets called
+type recordingInvoker struct {
+	mutex   sync.Mutex
+	targets []string
+	answer  func(ctx context.Context, target string, reply interface{}) error
+}
+
+func (r *recordingInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	opts ...grpc.CallOption) error {
+	r.mutex.Lock()
+	r.targets = append(r.targets, cc.Target())
+	r.mutex.Unlock()
+	return r.answer(ctx, cc.Target(), reply)
+}
+
+func TestMatchMethod(t *testing.T) {
+	patterns := []string{"/pkg.Svc/Get", "/pkg.Other/"}
+	for method, want := range map[string]bool{
+		"/pkg.Svc/Get":    true,
+		"/pkg.Svc/Put":    false,
+		"/pkg.Other/Any":  true,
+		"/pkg.OtherX/Any": false,
+	} {
+		if got := matchMethod(patterns, method); got != want {
+			t.Errorf("matchMethod(%s) = %v, want %v", method, got, want)
+		}
+	}
+	if !matchMethod([]string{"*"}, "/x.Y/Z") {
+		t.Error("matchMethod() with * does not match")
+	}
+}
+
+func TestRetryOnDifferentEndpoint(t *testing.T) {
+	p := testPool(t, 3, WithRetryPolicy(RetryPolicy{IdempotentMethods: []string{"/pkg.Svc/Get"}}))
+	inv := &recordingInvoker{answer: func(_ context.Context, target string, _ interface{}) error {
+		if target == "10.0.0.1:1000" {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	}}
+	first := p.grpcConnection[0]
+	if err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke); err != nil {
+		t.Fatalf("call error = %v, want retried successfully", err)
+	}
+	if len(inv.targets) != 2 || inv.targets[1] == "10.0.0.1:1000" {
+		t.Errorf("targets = %v, want a retry on another endpoint", inv.targets)
+	}
+	// The failed endpoint is skipped for retries of other calls
+	if !first.recentlyFailed() {
+		t.Error("failed endpoint not marked as recently failed")
+	}
+}
+
+func TestNoRetryForNonIdempotentOrNonRetryable(t *testing.T) {
+	p := testPool(t, 3, WithRetryPolicy(RetryPolicy{IdempotentMethods: []string{"/pkg.Svc/Get"}}))
+	inv := &recordingInvoker{answer: func(context.Context, string, interface{}) error {
+		return status.Error(codes.Unavailable, "down")
+	}}
+	first := p.grpcConnection[0]
+	first.unaryInterceptor(context.Background(), "/pkg.Svc/Put", nil, nil, first.conn, inv.invoke)
+	if len(inv.targets) != 1 {
+		t.Errorf("non idempotent method attempted %d times, want 1", len(inv.targets))
+	}
+	inv.targets = nil
+	inv.answer = func(context.Context, string, interface{}) error { return status.Error(codes.NotFound, "no") }
+	first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, first.conn, inv.invoke)
+	if len(inv.targets) != 1 {
+		t.Errorf("non retryable error attempted %d times, want 1", len(inv.targets))
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(&RetryPolicy{BudgetMin: 2, BudgetRatio: 0.5})
+	if !b.withdraw() || !b.withdraw() || b.withdraw() {
+		t.Fatal("budget does not allow exactly BudgetMin retries")
+	}
+	b.deposit()
+	if b.withdraw() {
+		t.Error("half a token allows a retry")
+	}
+	b.deposit()
+	if !b.withdraw() {
+		t.Error("two calls at ratio 0.5 do not allow a retry")
+	}
+	if (*retryBudget)(nil).withdraw() {
+		t.Error("nil budget allows retries")
+	}
+}
+
+func TestHedgeFirstResponseWins(t *testing.T) {
+	p := testPool(t, 2, WithRetryPolicy(RetryPolicy{HedgedMethods: []string{"/pkg.Svc/Get"}, HedgeDelay: 10 * time.Millisecond}))
+	inv := &recordingInvoker{answer: func(ctx context.Context, target string, reply interface{}) error {
+		if target == "10.0.0.1:1000" {
+			// Slow endpoint, only returns when the hedge won
+			<-ctx.Done()
+			return status.Error(codes.Canceled, "cancelled")
+		}
+		reply.(*wrappers.StringValue).Value = "from " + target
+		return nil
+	}}
+	first := p.grpcConnection[0]
+	reply := &wrappers.StringValue{}
+	err := first.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, reply, first.conn, inv.invoke)
+	if err != nil || reply.Value != "from 10.0.0.2:1000" {
+		t.Errorf("hedged call = %q, %v, want the response of the hedge", reply.Value, err)
+	}
+}
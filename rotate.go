@@ -0,0 +1,120 @@
+package kubegrpc
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// maxAgeJitter - Connection ages are spread by +/- this fraction, so connections created together do not rotate together
+	maxAgeJitter = 0.1
+	// rotationRetry - Delay before a failed rotation is tried again
+	rotationRetry = 10 * time.Second
+)
+
+// WithMaxConnectionAge - Rebuilds every connection after d (+/- 10%). Long lived HTTP/2 connections pin the traffic to
+// the pods which existed when they were made, and defeat balancing by L4 load balancers in front of the service. The
+// replacement connection is added to the pool before the old one is drained, so picks never fail during the rotation.
+func WithMaxConnectionAge(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.maxConnectionAge = d
+	}
+}
+
+// jitterAge - Spreads the age by maxAgeJitter, random in [0,1)
+func jitterAge(age time.Duration, random float64) time.Duration {
+	return time.Duration(float64(age) * (1 - maxAgeJitter + 2*maxAgeJitter*random))
+}
+
+// expiredConnections - Connections which passed their maximum age. Caller must hold mutex.
+func expiredConnections(conns []*GrpcConnection, now time.Time) []*GrpcConnection {
+	expired := make([]*GrpcConnection, 0)
+	for _, gc := range conns {
+		if !gc.expires.IsZero() && !now.Before(gc.expires) && !gc.isDraining() {
+			expired = append(expired, gc)
+		}
+	}
+	return expired
+}
+
+// redial - Makes a new connection to the same pod and port
+func (c *GrpcConnection) redial() (*GrpcConnection, error) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: c.podName, Namespace: c.namespace, UID: c.podUID, Labels: c.labels,
+			Annotations: map[string]string{tlsAnnotation: strconv.FormatBool(c.tls),
+				addressAnnotation: strconv.FormatBool(c.addressOnly)}},
+		Spec:   corev1.PodSpec{NodeName: c.nodeName},
+		Status: corev1.PodStatus{PodIP: c.connectionIP},
+	}
+	fresh, err := newGrpcConnection(c.serviceName, c.pool, pod, c.port)
+	if err != nil {
+		return nil, err
+	}
+	fresh.markVerified(c.verifiedAt())
+	fresh.setPodWeight(c.podWeight())
+	return fresh, nil
+}
+
+// rotateConnections - Replaces the connections of the pool which passed their maximum age: the replacement is added
+// first, then the old connection is drained
+func rotateConnections(serviceName string, c *connection) {
+	now := time.Now()
+	mutex.RLock()
+	expired := expiredConnections(c.grpcConnection, now)
+	mutex.RUnlock()
+	defer func() {
+		mutex.Lock()
+		c.rebuildDone()
+		mutex.Unlock()
+	}()
+	for _, gc := range expired {
+		// The service annotations of the pool are read under mutex
+		mutex.RLock()
+		fresh, err := gc.redial()
+		mutex.RUnlock()
+		if err == nil && c.config.preflights() {
+			if _, checkErr := preflight(c, []*GrpcConnection{fresh}); checkErr != nil {
+				err = checkErr
+			}
+		}
+		mutex.Lock()
+		if err != nil {
+			gc.expires = now.Add(rotationRetry)
+			mutex.Unlock()
+			log.Printf("ERROR: rotateConnections(): Can not rotate connection to %s for %s. Error %v",
+				gc.describe(), serviceName, err)
+			continue
+		}
+		if c.closed || !containsConnection(c.grpcConnection, gc) {
+			// Removed in the mean time, the refresh adds connections where needed
+			mutex.Unlock()
+			fresh.conn.Close()
+			continue
+		}
+		// Same pod: the replacement is as warm as the rotated connection
+		fresh.warmFrom = gc.warmFrom
+		next := make([]*GrpcConnection, len(c.grpcConnection), len(c.grpcConnection)+1)
+		copy(next, c.grpcConnection)
+		c.swapConnections(append(next, fresh))
+		emitEndpoint(EndpointAdded, fresh, c.nConnections, "rotation")
+		mutex.Unlock()
+		log.Printf("INFO: rotateConnections(): Rotating connection to %s for %s", gc.describe(), serviceName)
+		if startDrain(gc) {
+			go finishDrain(gc, c.config.drainTimeout)
+		}
+	}
+}
+
+// containsConnection - True if the connection is in the slice
+func containsConnection(conns []*GrpcConnection, gc *GrpcConnection) bool {
+	for _, v := range conns {
+		if v == gc {
+			return true
+		}
+	}
+	return false
+}
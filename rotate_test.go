@@ -0,0 +1,57 @@
+package kubegrpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterAge(t *testing.T) {
+	for random, want := range map[float64]time.Duration{0: 90 * time.Second, 0.5: 100 * time.Second, 1: 110 * time.Second} {
+		if got := jitterAge(100*time.Second, random); got != want {
+			t.Errorf("jitterAge(100s, %v) = %v, want %v", random, got, want)
+		}
+	}
+}
+
+func TestRotateConnections(t *testing.T) {
+	p := testPool(t, 2, WithDrainTimeout(0), WithMaxConnectionAge(time.Hour))
+	cachePool(t, p)
+	mutex.Lock()
+	old := p.grpcConnection[0]
+	if old.expires.IsZero() {
+		t.Fatal("connection without rotation time")
+	}
+	old.expires = time.Now().Add(-time.Second)
+	mutex.Unlock()
+	rotateConnections("svc.ns:1000", p)
+	if n := poolSize(p, 2); n != 2 {
+		t.Fatalf("pool size = %d after rotation, want 2", n)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if containsConnection(p.grpcConnection, old) {
+		t.Fatal("expired connection still in the pool")
+	}
+	for _, gc := range p.grpcConnection {
+		if gc.podName == old.podName && gc.connectionIP == old.connectionIP && gc.port == old.port {
+			return
+		}
+	}
+	t.Errorf("no replacement connection to %s", old.podName)
+}
+
+func TestRotateClosedPool(t *testing.T) {
+	p := testPool(t, 1, WithMaxConnectionAge(time.Hour))
+	cachePool(t, p)
+	mutex.Lock()
+	gc := p.grpcConnection[0]
+	gc.expires = time.Now().Add(-time.Second)
+	p.closed = true
+	mutex.Unlock()
+	rotateConnections("svc.ns:1000", p)
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if len(p.grpcConnection) != 1 || gc.isDraining() {
+		t.Errorf("closed pool rotated: %d connections, draining %v", len(p.grpcConnection), gc.isDraining())
+	}
+}
@@ -0,0 +1,257 @@
+package kubegrpc
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// EndpointInfo - Read only description of a connection in a pool, handed to the scorers
+type EndpointInfo struct {
+	ServiceName string
+	Namespace   string
+	PodName     string
+	IP          string
+	Created     time.Time
+	Labels      map[string]string // Labels of the pod, do not modify
+	TLS         bool              // Dialed with TLS, see WithTLSMigration
+	NodeName    string            // Node of the pod, empty if unknown
+	Zone        string            // Zone of the pod or its node, empty if unknown
+}
+
+// EndpointStats - Runtime statistics of a connection in a pool, handed to the scorers
+type EndpointStats struct {
+	Picks        uint64             // Number of times the connection has been handed out
+	PingFailures uint64             // Total number of failed pings
+	LastPing     time.Duration      // Duration of the last successful ping, 0 if not yet pinged
+	Weight       float64            // Health weight: 0 while ejected or excluded, between 0 and 1 while recovering, 1 otherwise
+	InFlight     int64              // Unary RPCs in progress
+	Streams      int64              // Open streams, see WithStreamDrain
+	Draining     bool               // Being drained, no longer picked
+	Override     float64            // Manual weight multiplier set with SetWeightOverride, 1 without override
+	PodWeight    float64            // Weight of the pod, see WithPodWeights. 1 without pod weights
+	Load         float64            // Smoothed utilization reported by the backend, see WithLoadReports. 0 without report
+	Connectivity connectivity.State // State of the grpc connection, TRANSIENT_FAILURE triggers an immediate ping
+	RPC          *RPCStats          // RPC accounting, nil without WithRPCAccounting
+	Version      string             // Version advertised by the pod, see WithVersionProbe. Empty if unknown
+	LastError    string             // Last failed ping or RPC, empty if none
+	LastErrorAt  time.Time
+	Excluded     time.Time // End of the exclusion by ReportFailure, zero if not excluded
+	SlowStart    float64   // Share of its full weight a new endpoint is picked with, see WithSlowStart. 1 once warm
+	// CheckInterval - Interval of the health checks of the connection, adapted with WithAdaptiveHealthChecks
+	CheckInterval time.Duration
+}
+
+// Scorer - Extension point to mix custom signals (business priority, cross-AZ cost, throughput, ...) into the selection
+// of a connection from the pool. Score returns a weight >= 0; the picker multiplies the weights of all scorers registered
+// for a pool and selects a connection with a probability proportional to the combined weight.
+// A combined weight of 0 excludes the connection, unless all connections in the pool end up at 0.
+type Scorer interface {
+	Score(ep EndpointInfo, stats EndpointStats) float64
+}
+
+// ScorerFunc - Adapter to use an ordinary function as Scorer
+type ScorerFunc func(ep EndpointInfo, stats EndpointStats) float64
+
+// Score - Implements Scorer
+func (f ScorerFunc) Score(ep EndpointInfo, stats EndpointStats) float64 {
+	return f(ep, stats)
+}
+
+// scorers - Registered scorers per service name (map[string][]Scorer), copied on write under mutex so the picks read
+// it without locking
+var scorers atomic.Value
+
+// RegisterScorer - Adds a scorer to the pool of the given service (same service name as used in Connect).
+// Can be called before or after the pool is created. Multiple scorers are combined by multiplying their scores.
+func RegisterScorer(serviceName string, s Scorer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current, _ := scorers.Load().(map[string][]Scorer)
+	next := make(map[string][]Scorer, len(current)+1)
+	for name, registered := range current {
+		next[name] = registered
+	}
+	next[serviceName] = append(next[serviceName][:len(next[serviceName]):len(next[serviceName])], s)
+	scorers.Store(next)
+}
+
+// scorersFor - The scorers registered for the service
+func scorersFor(serviceName string) []Scorer {
+	registered, _ := scorers.Load().(map[string][]Scorer)
+	return registered[serviceName]
+}
+
+// Info - Returns the description of the connection as handed to scorers
+func (c *GrpcConnection) Info() EndpointInfo {
+	return EndpointInfo{
+		ServiceName: c.serviceName,
+		Namespace:   c.namespace,
+		PodName:     c.podName,
+		IP:          c.connectionIP,
+		Created:     c.created,
+		Labels:      c.labels,
+		TLS:         c.tls,
+		NodeName:    c.nodeName,
+		Zone:        c.zone,
+	}
+}
+
+// Stats - Returns a snapshot of the runtime statistics of the connection
+func (c *GrpcConnection) Stats() EndpointStats {
+	s := EndpointStats{
+		Picks:        atomic.LoadUint64(&c.picks),
+		PingFailures: atomic.LoadUint64(&c.pingFailures),
+		LastPing:     time.Duration(atomic.LoadInt64(&c.lastPing)),
+		Weight:       c.weight(),
+		InFlight:     atomic.LoadInt64(&c.inFlight),
+		Streams:      atomic.LoadInt64(&c.streams),
+		Draining:     c.isDraining(),
+		Override:     c.overrideWeight(),
+		PodWeight:    c.podWeight(),
+		Connectivity: c.state(),
+		RPC:          c.rpcAccount.rpcStats(),
+	}
+	s.Load, _ = c.loadStats()
+	s.Version = c.advertisedVersion()
+	s.Excluded = c.exclusionEnd()
+	s.SlowStart = 1
+	if c.pool != nil {
+		s.CheckInterval = c.checkInterval(c.pool.config.adaptiveChecks)
+		s.SlowStart = slowStartWeight(c.pool.config.slowStart, time.Since(c.warmFrom))
+	}
+	if e, ok := c.lastError.Load().(endpointError); ok {
+		s.LastError = e.message
+		s.LastErrorAt = e.at
+	}
+	return s
+}
+
+// pickWeight - The weight of the connection before the scorers: health, override, pod annotation and slow start. Reads
+// only what the weight needs, the pick does not take a Stats snapshot per candidate unless scorers are registered.
+func (c *GrpcConnection) pickWeight() float64 {
+	w := c.weight() * c.overrideWeight() * c.podWeight()
+	if c.pool != nil {
+		w *= slowStartWeight(c.pool.config.slowStart, time.Since(c.warmFrom))
+	}
+	return w
+}
+
+// pickConnection - Selects a connection from the (non empty) slice. With a traffic split the subset is chosen first,
+// see SetTrafficSplit. Draining connections are skipped, unless all are
+// draining. Connections ejected by their circuit breaker are skipped, unless all are ejected. Without scorers and
+// recovering connections or weight overrides the pick is uniformly random. The balancer of the service annotation
+// `kube-grpc/balancer` counts as additional scorer. The picker of the pool, see WithPicker, selects among the
+// remaining connections instead.
+// Safe without holding mutex.
+func pickConnection(serviceName string, conns []*GrpcConnection) *GrpcConnection {
+	return pickConnectionFor(CallInfo{ServiceName: serviceName}, conns)
+}
+
+// pickConnectionFor - pickConnection for the call. Safe without holding mutex.
+func pickConnectionFor(call CallInfo, conns []*GrpcConnection) *GrpcConnection {
+	serviceName := call.ServiceName
+	c := conns[0].pool
+	if led := leaderConnections(c, conns); len(led) > 0 {
+		conns = led
+	}
+	random := randomOf(c)
+	conns = splitConnections(serviceName, withoutShadows(conns), random.Float64)
+	s := scorersFor(serviceName)
+	if balancer := c.serviceBalancer(); balancer != nil {
+		s = append(s[:len(s):len(s)], balancer)
+	}
+	candidates := make([]*GrpcConnection, 0, len(conns))
+	weights := make([]float64, 0, len(conns))
+	weighted := len(s) > 0
+	active := conns
+	if anyDraining(conns) {
+		active = make([]*GrpcConnection, 0, len(conns))
+		for _, c := range conns {
+			if !c.isDraining() {
+				active = append(active, c)
+			}
+		}
+		if len(active) == 0 {
+			active = conns
+		}
+	}
+	for _, c := range active {
+		w := c.pickWeight() * c.loadWeight()
+		if w <= 0 {
+			continue
+		}
+		weighted = weighted || w != 1
+		if len(s) > 0 {
+			w *= combineScores(s, c.Info(), c.Stats())
+		}
+		candidates = append(candidates, c)
+		weights = append(weights, w)
+	}
+	recorder := decisionLogFor(serviceName)
+	if p := c.picker(); p != nil {
+		usable := candidates
+		if len(usable) == 0 {
+			usable = active
+		}
+		if gc := p.Pick(usable, call); gc != nil && containsConnection(usable, gc) {
+			return decidePick(recorder, serviceName, gc, StrategyPicker, active, candidates, weights)
+		}
+	}
+	if len(candidates) == 0 {
+		// Everything ejected, excluded or overridden to 0: better to try a connection than to fail the pick
+		return decidePick(recorder, serviceName, active[random.Intn(len(active))], StrategyFallback, active, candidates,
+			weights)
+	}
+	if !weighted {
+		return decidePick(recorder, serviceName, candidates[random.Intn(len(candidates))], StrategyUniform, active,
+			candidates, weights)
+	}
+	return decidePick(recorder, serviceName, candidates[pickWeighted(weights, random.Float64)], StrategyWeighted, active,
+		candidates, weights)
+}
+
+// combineScores - Multiplies the scores of all scorers. Negative and NaN scores count as 0, infinite scores are ignored
+// (treated as neutral) since they would swamp every other endpoint.
+func combineScores(s []Scorer, info EndpointInfo, stats EndpointStats) float64 {
+	total := 1.0
+	for _, scorer := range s {
+		score := scorer.Score(info, stats)
+		switch {
+		case math.IsNaN(score) || score <= 0:
+			return 0
+		case math.IsInf(score, 1):
+			continue
+		}
+		total *= score
+	}
+	return total
+}
+
+// pickWeighted - Returns an index with a probability proportional to its weight.
+// Falls back to a uniform pick when no weight is positive. random returns values in [0,1).
+func pickWeighted(weights []float64, random func() float64) int {
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	if sum <= 0 {
+		return int(random() * float64(len(weights)))
+	}
+	target := random() * sum
+	last := 0
+	for k, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		last = k
+		if target < w {
+			return k
+		}
+		target -= w
+	}
+	// Floating point rounding can leave target just above the last weight
+	return last
+}
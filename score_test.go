@@ -0,0 +1,105 @@
+package kubegrpc
+
+import (
+	"math"
+	"testing"
+)
+
+func constScorer(v float64) Scorer {
+	return ScorerFunc(func(EndpointInfo, EndpointStats) float64 { return v })
+}
+
+func TestCombineScores(t *testing.T) {
+	cases := []struct {
+		name   string
+		scores []float64
+		want   float64
+	}{
+		{"no scorers is neutral", nil, 1},
+		{"single", []float64{0.5}, 0.5},
+		{"multiplied", []float64{0.5, 4}, 2},
+		{"zero excludes", []float64{3, 0}, 0},
+		{"negative excludes", []float64{-1, 3}, 0},
+		{"nan excludes", []float64{math.NaN()}, 0},
+		{"infinity ignored", []float64{math.Inf(1), 2}, 2},
+	}
+	for _, c := range cases {
+		s := make([]Scorer, 0)
+		for _, v := range c.scores {
+			s = append(s, constScorer(v))
+		}
+		if got := combineScores(s, EndpointInfo{}, EndpointStats{}); got != c.want {
+			t.Errorf("%s: combineScores() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCombineScoresPassesEndpoint(t *testing.T) {
+	s := []Scorer{ScorerFunc(func(ep EndpointInfo, stats EndpointStats) float64 {
+		if ep.IP == "10.0.0.1" && stats.Picks == 3 {
+			return 7
+		}
+		return 1
+	})}
+	if got := combineScores(s, EndpointInfo{IP: "10.0.0.1"}, EndpointStats{Picks: 3}); got != 7 {
+		t.Errorf("combineScores() = %v, want 7", got)
+	}
+}
+
+func TestPickWeighted(t *testing.T) {
+	weights := []float64{1, 0, 3}
+	cases := []struct {
+		random float64
+		want   int
+	}{
+		{0, 0},
+		{0.24, 0},
+		{0.25, 2},
+		{0.99, 2},
+	}
+	for _, c := range cases {
+		if got := pickWeighted(weights, func() float64 { return c.random }); got != c.want {
+			t.Errorf("pickWeighted(%v) = %d, want %d", c.random, got, c.want)
+		}
+	}
+}
+
+func TestPickWeightedAllZeroIsUniform(t *testing.T) {
+	weights := []float64{0, 0, 0, 0}
+	if got := pickWeighted(weights, func() float64 { return 0.6 }); got != 2 {
+		t.Errorf("pickWeighted() = %d, want 2", got)
+	}
+}
+
+func TestPickConnectionUsesScorers(t *testing.T) {
+	const svc = "score-test.ns:1000"
+	conns := []*GrpcConnection{
+		{connectionIP: "10.0.0.1", serviceName: svc},
+		{connectionIP: "10.0.0.2", serviceName: svc},
+	}
+	RegisterScorer(svc, ScorerFunc(func(ep EndpointInfo, _ EndpointStats) float64 {
+		if ep.IP == "10.0.0.2" {
+			return 1
+		}
+		return 0
+	}))
+	defer func() {
+		mutex.Lock()
+		next := make(map[string][]Scorer)
+		for name, registered := range scorers.Load().(map[string][]Scorer) {
+			if name != svc {
+				next[name] = registered
+			}
+		}
+		scorers.Store(next)
+		mutex.Unlock()
+	}()
+	for i := 0; i < 20; i++ {
+		mutex.Lock()
+		c := pickConnection(svc, conns)
+		mutex.Unlock()
+		if c.connectionIP != "10.0.0.2" {
+			t.Fatalf("pickConnection() picked %s, want 10.0.0.2", c.connectionIP)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// selectorServices - Label selectors of the pools without Service by `name.namespace`, see ConnectSelector
+	selectorServices = make(map[string]map[string]string)
+	selectorMutex    = &sync.RWMutex{}
+)
+
+// ConnectSelector - Connects to the pods in the namespace matching the label selector, for workloads which expose gRPC
+// without a Service. The Service lookup is skipped, everything else (health checks, balancing, options, events) works
+// as for service pools. name identifies the pool, which is addressed as `name.namespace[:port]` in Pool, Stats and the
+// other functions; with an empty port the port is taken from the pods. The selector registered for a name replaces
+// a Service of the same name. Bypassing the balancing (SetBypass) is not possible for these pools.
+func ConnectSelector(name, namespace string, selector map[string]string, port string, f GrpcKubeBalancer,
+	opts ...PoolOption) (interface{}, error) {
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("%w: empty label selector for %s", ErrInvalidServiceName, name)
+	}
+	serviceName := name + "." + namespace
+	if port != "" {
+		serviceName += ":" + port
+	}
+	name, namespace, _, err := parseServiceName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	s := make(map[string]string, len(selector))
+	for k, v := range selector {
+		s[k] = v
+	}
+	selectorMutex.Lock()
+	selectorServices[name+"."+namespace] = s
+	selectorMutex.Unlock()
+	return ConnectWithOptions(serviceName, f, opts...)
+}
+
+// selectorService - A Service standing in for the selector pool with the name, nil if there is none
+func selectorService(name, namespace string) *corev1.Service {
+	selectorMutex.RLock()
+	defer selectorMutex.RUnlock()
+	selector := selectorServices[name+"."+namespace]
+	if selector == nil {
+		return nil
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1.ServiceSpec{Selector: selector},
+	}
+}
@@ -0,0 +1,35 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectSelectorInvalid(t *testing.T) {
+	if _, err := ConnectSelector("workers", "ns", nil, "1000", okBalancer{}); !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("ConnectSelector() without selector error = %v, want ErrInvalidServiceName", err)
+	}
+}
+
+func TestConnectSelector(t *testing.T) {
+	useFakeClientset(t, testPod("worker-0", "ns", "worker", "10.0.0.1"), testPod("worker-1", "ns", "worker", "10.0.0.2"),
+		testPod("other-0", "ns", "other", "10.0.0.3"))
+	defer func() {
+		ClosePool("workers.ns:1000")
+		selectorMutex.Lock()
+		delete(selectorServices, "workers.ns")
+		selectorMutex.Unlock()
+	}()
+	if _, err := ConnectSelector("workers", "ns", map[string]string{"app": "worker"}, "1000", okBalancer{}); err != nil {
+		t.Fatalf("ConnectSelector() error = %v", err)
+	}
+	conns := Connections("workers.ns:1000")
+	if len(conns) != 2 {
+		t.Fatalf("Connections() = %v, want the 2 worker pods", conns)
+	}
+	for _, gc := range conns {
+		if gc.labels["app"] != "worker" {
+			t.Errorf("connected to %s, which does not match the selector", gc.podName)
+		}
+	}
+}
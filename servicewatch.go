@@ -0,0 +1,158 @@
+package kubegrpc
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// serviceWatchRetry - Delay before a failed or ended watch of the Service is started again
+var serviceWatchRetry = 5 * time.Second
+
+// WithServiceWatch - Watches the Service of the pool and refreshes the pool right away when its selector or its ports
+// change, eg on a blue/green flip by switching the selector labels: the connections to the pods no longer selected
+// are drained and the newly selected pods are dialed. Connections dialed on a port the service no longer targets are
+// replaced by connections on the new port. Without the option the changes apply at the next refresh of the pool, see
+// WithRefreshInterval. Needs `watch` on services; without the permission the pool is refreshed at its refresh
+// interval only.
+func WithServiceWatch() PoolOption {
+	return func(c *poolConfig) {
+		c.serviceWatch = true
+	}
+}
+
+// watchService - Watches the service for the pool until the pool is closed, unless already watched
+func (c *connection) watchService(serviceName string, k8s kubernetes.Interface, svc *corev1.Service) {
+	if !atomic.CompareAndSwapInt32(&c.serviceWatched, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.serviceWatched, 0)
+		watchServiceChanges(c.ctx, k8s, serviceName, svc)
+	}()
+}
+
+// watchServiceChanges - Refreshes the pool on every change of the selector or the ports of the service until ctx is
+// done, watching is forbidden or the service was deleted. The next discovery watches the service again, in the
+// namespace the pool is bound to then.
+func watchServiceChanges(ctx context.Context, k8s kubernetes.Interface, serviceName string, svc *corev1.Service) {
+	selector := fields.OneTermEqualSelector("metadata.name", svc.Name).String()
+	resourceVersion := svc.ResourceVersion
+	last := svc
+	for ctx.Err() == nil {
+		w, err := k8s.CoreV1().Services(svc.Namespace).Watch(ctx,
+			metav1.ListOptions{FieldSelector: selector, ResourceVersion: resourceVersion})
+		if apierrors.IsForbidden(err) {
+			log.Printf("WARNING: watchServiceChanges(): %v. %s is refreshed at its refresh interval only",
+				kubernetesError(err, "watch", "services", svc.Namespace), serviceName)
+			return
+		}
+		if err != nil {
+			log.Printf("WARNING: watchServiceChanges(): Can not watch the service of %s. Error %v", serviceName, err)
+		} else {
+			var deleted bool
+			last, resourceVersion, deleted = consumeServiceChanges(ctx, w, serviceName, last)
+			w.Stop()
+			if deleted {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(serviceWatchRetry):
+		}
+	}
+}
+
+// consumeServiceChanges - Refreshes the pool on the changes of the service seen by the watch until it ends, ctx is
+// done or the service was deleted. Returns the last state of the service and the resource version to watch from next.
+func consumeServiceChanges(ctx context.Context, w watch.Interface, serviceName string,
+	last *corev1.Service) (*corev1.Service, string, bool) {
+	resourceVersion := last.ResourceVersion
+	for {
+		select {
+		case <-ctx.Done():
+			return last, resourceVersion, false
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return last, resourceVersion, false
+			}
+			if event.Type == watch.Error {
+				// Eg the resource version expired, the next watch starts from the current state
+				return last, "", false
+			}
+			svc, ok := event.Object.(*corev1.Service)
+			if !ok || svc.Name != last.Name {
+				continue
+			}
+			resourceVersion = svc.ResourceVersion
+			deleted := event.Type == watch.Deleted
+			if !deleted && !serviceChanged(last, svc) {
+				continue
+			}
+			change := "selector or ports changed"
+			if deleted {
+				change = "deleted"
+			}
+			log.Printf("INFO: consumeServiceChanges(): Service of %s %s, refreshing the pool", serviceName, change)
+			last = svc
+			if err := RefreshContext(ctx, serviceName); err != nil && ctx.Err() == nil {
+				log.Printf("WARNING: consumeServiceChanges(): Refresh of %s failed. Error %v", serviceName, err)
+			}
+			if deleted {
+				return last, resourceVersion, true
+			}
+		}
+	}
+}
+
+// serviceChanged - Whether the selector or the ports of the service changed
+func serviceChanged(before, after *corev1.Service) bool {
+	return !reflect.DeepEqual(before.Spec.Selector, after.Spec.Selector) ||
+		!reflect.DeepEqual(before.Spec.Ports, after.Spec.Ports)
+}
+
+// portsChanged - Whether the port of the pool may resolve to another port of the pods than before
+func portsChanged(before, after serviceConfig) bool {
+	return before.port != after.port || !reflect.DeepEqual(before.ports, after.ports)
+}
+
+// retargeted - The connections dialed on another port than the one their pod is dialed on now, after the ports of the
+// service changed. The connections already evicted are skipped. Caller must hold mutex.
+func retargeted(c *connection, allowed []corev1.Pod, port string, evicted []*GrpcConnection) []*GrpcConnection {
+	tlsCredentials, _ := c.transportCredentials()
+	skip := make(map[*GrpcConnection]bool, len(evicted))
+	for _, gc := range evicted {
+		skip[gc] = true
+	}
+	stale := make([]*GrpcConnection, 0)
+	for _, gc := range c.grpcConnection {
+		if skip[gc] || gc.isDraining() {
+			continue
+		}
+		for i := range allowed {
+			pod := &allowed[i]
+			if pod.Status.PodIP != gc.connectionIP {
+				continue
+			}
+			if want, _, err := dialTarget(c.annotatedPort(port, pod), pod, tlsCredentials != nil); err == nil &&
+				want != gc.port {
+				reason := "service port changed to " + want
+				log.Printf("INFO: updateConnectionPool(): Evicting %s for %s: %s", gc.describe(), gc.serviceName, reason)
+				decideEviction(gc, reason)
+				stale = append(stale, gc)
+			}
+			break
+		}
+	}
+	return stale
+}
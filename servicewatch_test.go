@@ -0,0 +1,116 @@
+package kubegrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// watchedServices - Signals the watches of services started on the fake clientset
+func watchedServices() <-chan struct{} {
+	watching := make(chan struct{}, 1)
+	clientset.(*fake.Clientset).PrependWatchReactor("services", func(k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case watching <- struct{}{}:
+		default:
+		}
+		return false, nil, nil
+	})
+	return watching
+}
+
+// updateService - Updates the service once it is watched, and waits for the pool to match
+func updateService(t *testing.T, watching <-chan struct{}, svc *corev1.Service, done func() bool) {
+	t.Helper()
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the service is not watched")
+	}
+	if _, err := clientset.CoreV1().Services(svc.Namespace).Update(context.Background(), svc,
+		metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if done() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServiceWatchSelector(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Spec.Selector = map[string]string{"app": "blue"}
+	useFakeClientset(t, svc, testPod("blue-0", "ns", "blue", "10.0.0.1"), testPod("green-0", "ns", "green", "10.0.0.2"))
+	watching := watchedServices()
+	defer ClosePool("svc.ns:1000")
+	if _, err := ConnectWithOptions("svc.ns:1000", okBalancer{}, WithServiceWatch(),
+		WithRefreshInterval(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blue/green flip: the pool follows the selector without waiting for the refresh interval
+	flipped := svc.DeepCopy()
+	flipped.Spec.Selector = map[string]string{"app": "green"}
+	serving := func() []string {
+		pods := make([]string, 0)
+		for _, gc := range Connections("svc.ns:1000") {
+			if !gc.isDraining() {
+				pods = append(pods, gc.podName)
+			}
+		}
+		return pods
+	}
+	updateService(t, watching, flipped, func() bool {
+		pods := serving()
+		return len(pods) == 1 && pods[0] == "green-0"
+	})
+	if pods := serving(); len(pods) != 1 || pods[0] != "green-0" {
+		t.Errorf("pods %v after the flip of the selector, want green-0", pods)
+	}
+}
+
+func TestServiceWatchPorts(t *testing.T) {
+	svc := testService("svc", "ns")
+	svc.Spec.Ports = []corev1.ServicePort{{Name: "grpc", Port: 80, TargetPort: intstr.FromString("grpc")}}
+	useFakeClientset(t, svc, podWithPorts(corev1.ContainerPort{Name: "grpc", ContainerPort: 1000},
+		corev1.ContainerPort{Name: "alt", ContainerPort: 2000}))
+	watching := watchedServices()
+	defer ClosePool("svc.ns:grpc")
+	if _, err := ConnectWithOptions("svc.ns:grpc", okBalancer{}, WithServiceWatch(),
+		WithRefreshInterval(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := targets(Connections("svc.ns:grpc")); len(got) != 1 || got[0] != "10.0.0.1:1000" {
+		t.Fatalf("targets = %v, want the grpc port", got)
+	}
+
+	// The service targets another port of the same pod: the connection is replaced
+	retargeted := svc.DeepCopy()
+	retargeted.Spec.Ports[0].TargetPort = intstr.FromString("alt")
+	serving := func() []string {
+		ports := make([]string, 0)
+		for _, gc := range Connections("svc.ns:grpc") {
+			if !gc.isDraining() {
+				ports = append(ports, gc.port)
+			}
+		}
+		return ports
+	}
+	updateService(t, watching, retargeted, func() bool {
+		ports := serving()
+		return len(ports) == 1 && ports[0] == "2000"
+	})
+	if ports := serving(); len(ports) != 1 || ports[0] != "2000" {
+		t.Errorf("ports %v after the change of the target port, want 2000", ports)
+	}
+}
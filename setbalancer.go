@@ -0,0 +1,66 @@
+package kubegrpc
+
+import (
+	"log"
+	"time"
+)
+
+// balancerRebuildWindow - Period over which SetBalancer spreads the rebuild of the existing connections
+var balancerRebuildWindow = 30 * time.Second
+
+// SetBalancer - Replaces the GrpcKubeBalancer of the live pool of the service, eg after a feature flag changed the
+// client constructor, without restarting the process. Connections dialed from now on get their client from f. The
+// existing connections keep their client and are rebuilt with f one by one over the next 30 seconds: like with
+// WithMaxConnectionAge the replacement is added before the old connection drains, so picks never fail during the swap.
+// Every connection is pinged by the balancer which created its client. The bypass connection, if any, is redialed on
+// its next pick. Returns ErrPoolNotFound if there is no open pool for the service.
+func SetBalancer(serviceName string, f GrpcKubeBalancer) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	c := connectionCache[serviceName]
+	if c == nil || c.closed {
+		return ErrPoolNotFound
+	}
+	c.functions = f
+	c.closeBypass()
+	now := time.Now()
+	rebuild := make([]*GrpcConnection, 0, len(c.grpcConnection))
+	for _, gc := range c.grpcConnection {
+		if !gc.isDraining() {
+			rebuild = append(rebuild, gc)
+		}
+	}
+	for i, gc := range rebuild {
+		at := now.Add(balancerRebuildWindow * time.Duration(i) / time.Duration(len(rebuild)))
+		if gc.expires.IsZero() || at.Before(gc.expires) {
+			gc.expires = at
+		}
+	}
+	c.rebuilding = len(rebuild) > 0
+	log.Printf("INFO: SetBalancer(): New balancer for %s, rebuilding %d connections within %v", serviceName,
+		len(rebuild), balancerRebuildWindow)
+	return nil
+}
+
+// clientBalancer - The balancer which created the client of the connection, the one of the pool for connections made
+// before it was recorded
+func (c *GrpcConnection) clientBalancer(pool GrpcKubeBalancer) GrpcKubeBalancer {
+	if c.functions != nil {
+		return c.functions
+	}
+	return pool
+}
+
+// rebuildDone - Ends the rebuild of SetBalancer once no connection waits for its rotation anymore. Pools with a
+// maximum connection age keep rotating. Caller must hold mutex.
+func (c *connection) rebuildDone() {
+	if !c.rebuilding {
+		return
+	}
+	for _, gc := range c.grpcConnection {
+		if !gc.expires.IsZero() && !gc.isDraining() {
+			return
+		}
+	}
+	c.rebuilding = false
+}
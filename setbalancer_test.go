@@ -0,0 +1,88 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// taggedBalancer - GrpcKubeBalancer whose clients carry its tag
+type taggedBalancer string
+
+func (b taggedBalancer) NewGrpcClient(*grpc.ClientConn) (interface{}, error) { return string(b), nil }
+
+func (b taggedBalancer) Ping(client interface{}) error {
+	if client != string(b) {
+		return errors.New("client of another balancer")
+	}
+	return nil
+}
+
+func TestSetBalancer(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"),
+		testPod("svc-1", "ns", "svc", "10.0.0.2"))
+	previous := balancerRebuildWindow
+	balancerRebuildWindow = 0
+	defer func() { balancerRebuildWindow = previous }()
+	c := newConnection(taggedBalancer("v1"), newPoolConfig(nil))
+	cachePool(t, c)
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	old := ListPool("svc.ns:1000")
+	defer func() {
+		for _, gc := range append(old, ListPool("svc.ns:1000")...) {
+			gc.conn.Close()
+		}
+	}()
+
+	if err := SetBalancer("svc.ns:1000", taggedBalancer("v2")); err != nil {
+		t.Fatalf("SetBalancer() error = %v", err)
+	}
+	// Until rebuilt the connections are pinged by the balancer which created their client
+	if h := old[0].health(); h == nil || ping(h.functions, h.ctx, h.timeout, old[0]) != nil {
+		t.Errorf("health() of an old connection = %+v, want the ping of its own balancer", h)
+	}
+	rotateConnections("svc.ns:1000", c)
+	for _, gc := range old {
+		if !gc.isDraining() {
+			t.Errorf("connection to %s is not drained after the rebuild", gc.podName)
+		}
+	}
+	fresh := 0
+	for _, gc := range ListPool("svc.ns:1000") {
+		if !gc.isDraining() && gc.Client() == "v2" {
+			fresh++
+		}
+	}
+	mutex.RLock()
+	rebuilding := c.rebuilding
+	mutex.RUnlock()
+	if fresh != 2 || rebuilding {
+		t.Errorf("%d connections with the new client, rebuilding %v, want 2 and done", fresh, rebuilding)
+	}
+
+	if err := SetBalancer("missing.ns:1000", taggedBalancer("v2")); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("SetBalancer() of a missing pool error = %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestSetBalancerSpreadsRebuild(t *testing.T) {
+	p := testPool(t, 4)
+	cachePool(t, p)
+	start := time.Now()
+	if err := SetBalancer("svc.ns:1000", okBalancer{}); err != nil {
+		t.Fatal(err)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for i, gc := range p.grpcConnection {
+		want := start.Add(balancerRebuildWindow * time.Duration(i) / 4)
+		if d := gc.expires.Sub(want); d < 0 || d > time.Second {
+			t.Errorf("connection %d expires %v after the swap, want %v", i, gc.expires.Sub(start),
+				want.Sub(start))
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package kubegrpc
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	shuttingDown  int32 // atomic, 1 once Shutdown was called
+	shutdownMutex = &sync.Mutex{}
+	// stopMaintenance - Closed by Shutdown to stop the background maintenance. Protected by shutdownMutex.
+	stopMaintenance chan struct{}
+	// shutdownDone - Closed once Shutdown completed. Protected by shutdownMutex.
+	shutdownDone chan struct{}
+	// maintenance - The running background maintenance go routines
+	maintenance sync.WaitGroup
+)
+
+// isShuttingDown - True once Shutdown was called: no new pools and no new picks
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// Shutdown - Shuts the balancing down for the termination of the process, intended for SIGTERM handlers: from now on
+// Pool, Connect and PickConnection return ErrShutdown, the background maintenance stops, and the connections of all
+// pools are drained and closed once their in flight RPCs completed. When ctx is done first, the connections are closed
+// right away and ctx.Err() is returned. With RestorePools, the endpoints are saved for the next process first.
+// ShutdownDone is closed when Shutdown completed; further calls wait for the first one. The package can not be used
+// after a shutdown.
+func Shutdown(ctx context.Context) error {
+	shutdownMutex.Lock()
+	stop, done := stopMaintenance, shutdownDone
+	first := atomic.CompareAndSwapInt32(&shuttingDown, 0, 1)
+	shutdownMutex.Unlock()
+	if !first {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	log.Printf("INFO: Shutdown(): Shutting down")
+	close(stop)
+	stopped := make(chan struct{})
+	go func() {
+		maintenance.Wait()
+		close(stopped)
+	}()
+	var err error
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// The endpoints are saved before the drains, which exclude them, see RestorePools
+	if saveErr := SavePools(ctx); saveErr != nil {
+		log.Printf("WARNING: Shutdown(): Unable to save the pools. Error: %v", saveErr)
+	}
+
+	// Nothing picks or refreshes the connections anymore: wait for their RPCs and close them
+	mutex.Lock()
+	conns := make([]*GrpcConnection, 0)
+	for _, c := range connectionCache {
+		for _, gc := range c.grpcConnection {
+			startDrain(gc)
+			conns = append(conns, gc)
+		}
+	}
+	mutex.Unlock()
+	if err == nil {
+		err = waitIdle(ctx, conns)
+	}
+	mutex.Lock()
+	for serviceName, c := range connectionCache {
+		closePool(serviceName, c)
+	}
+	mutex.Unlock()
+	if err != nil {
+		log.Printf("WARNING: Shutdown(): Closed the connections with RPCs in flight. Error: %v", err)
+	}
+	log.Printf("INFO: Shutdown(): Shut down")
+	close(done)
+	return err
+}
+
+// ShutdownDone - Closed once Shutdown completed, so the application can sequence its own shutdown
+func ShutdownDone() <-chan struct{} {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	return shutdownDone
+}
+
+// waitIdle - Waits until the connections have no RPCs in flight, returns ctx.Err() if ctx is done first
+func waitIdle(ctx context.Context, conns []*GrpcConnection) error {
+	for _, gc := range conns {
+		for atomic.LoadInt64(&gc.inFlight) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(drainPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// sleep - Waits for d, false if the background maintenance was stopped in the mean time
+func sleep(stop <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
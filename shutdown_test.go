@@ -0,0 +1,79 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// restartAfterShutdown - Restarts the background maintenance once the test shut it down
+func restartAfterShutdown(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		<-ShutdownDone()
+		poolManager()
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	restartAfterShutdown(t)
+	p := testPool(t, 2)
+	cachePool(t, p)
+	busy := p.grpcConnection[0]
+	atomic.StoreInt64(&busy.inFlight, 1)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- Shutdown(context.Background())
+	}()
+	for !isShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := PickConnection("svc.ns:1000"); !errors.Is(err, ErrShutdown) {
+		t.Errorf("PickConnection() error = %v, want ErrShutdown", err)
+	}
+	if _, err := Connect("svc.ns:1000", okBalancer{}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Connect() error = %v, want ErrShutdown", err)
+	}
+	select {
+	case <-ShutdownDone():
+		t.Fatal("shut down with an RPC in flight")
+	case <-time.After(3 * drainPollInterval):
+	}
+	if !busy.isDraining() {
+		t.Error("connection with an RPC in flight not draining")
+	}
+
+	atomic.StoreInt64(&busy.inFlight, 0)
+	if err := <-result; err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	select {
+	case <-ShutdownDone():
+	default:
+		t.Error("ShutdownDone() not closed after Shutdown returned")
+	}
+	if conns := Connections("svc.ns:1000"); conns != nil {
+		t.Errorf("pool still open after the shutdown: %v", conns)
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown() = %v", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	restartAfterShutdown(t)
+	p := testPool(t, 1)
+	cachePool(t, p)
+	atomic.StoreInt64(&p.grpcConnection[0].inFlight, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want DeadlineExceeded", err)
+	}
+	if conns := Connections("svc.ns:1000"); conns != nil {
+		t.Errorf("pool still open after the shutdown timeout: %v", conns)
+	}
+}
@@ -0,0 +1,31 @@
+package kubegrpc
+
+import (
+	"time"
+)
+
+// minSlowStartWeight - Share of its full weight an endpoint is picked with right after it was added
+const minSlowStartWeight = 0.1
+
+// WithSlowStart - Ramps up the traffic of the endpoints added to the pool, eg by a scale up or a rolling deploy, whose
+// caches and JIT are still cold: a new endpoint starts at a tenth of its pick weight, which grows linearly to the full
+// weight over the window. Applies to the weighted random selection, not to the pickers of WithPicker. A connection
+// rebuilt by WithMaxConnectionAge or SetBalancer keeps the ramp of the connection it replaces, since the pod is warm.
+func WithSlowStart(window time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		if window > 0 {
+			c.slowStart = window
+		}
+	}
+}
+
+// slowStartWeight - Share of the full weight of an endpoint added age ago, 1 without slow start
+func slowStartWeight(window, age time.Duration) float64 {
+	if window <= 0 || age >= window {
+		return 1
+	}
+	if age <= 0 {
+		return minSlowStartWeight
+	}
+	return minSlowStartWeight + (1-minSlowStartWeight)*float64(age)/float64(window)
+}
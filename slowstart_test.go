@@ -0,0 +1,45 @@
+package kubegrpc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSlowStartWeight(t *testing.T) {
+	cases := []struct {
+		window, age time.Duration
+		want        float64
+	}{
+		{0, 0, 1},
+		{time.Minute, 0, minSlowStartWeight},
+		{time.Minute, 30 * time.Second, 0.55},
+		{time.Minute, time.Minute, 1},
+		{time.Minute, time.Hour, 1},
+	}
+	for _, c := range cases {
+		if got := slowStartWeight(c.window, c.age); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("slowStartWeight(%v, %v) = %v, want %v", c.window, c.age, got, c.want)
+		}
+	}
+}
+
+func TestSlowStart(t *testing.T) {
+	p := testPool(t, 2, WithSlowStart(time.Minute), WithRandomSource(rand.NewSource(1)))
+	// svc-1 was added long ago, svc-2 just now
+	p.grpcConnection[0].warmFrom = time.Now().Add(-time.Hour)
+	if s := p.grpcConnection[1].Stats().SlowStart; s > 0.11 {
+		t.Fatalf("slow start weight of the new endpoint = %v, want about %v", s, minSlowStartWeight)
+	}
+	picks := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		picks[pickConnection("svc.ns:1000", p.grpcConnection).podName]++
+	}
+	if picks["svc-2"] == 0 || picks["svc-2"] > 150 {
+		t.Errorf("new endpoint picked %d of 1000 times, want about 90", picks["svc-2"])
+	}
+	if s := testPool(t, 1).grpcConnection[0].Stats().SlowStart; s != 1 {
+		t.Errorf("slow start weight = %v without WithSlowStart, want 1", s)
+	}
+}
@@ -0,0 +1,139 @@
+package kubegrpc
+
+import (
+	"sort"
+)
+
+// HealthState - Health of a connection as seen by the picks
+type HealthState int
+
+// Health states
+const (
+	Healthy    HealthState = iota // Picked with full weight
+	Recovering                    // Re-admitted by the circuit breaker, picked with reduced weight
+	Ejected                       // Ejected by the circuit breaker, not picked
+	Draining                      // Closing, not picked
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case Healthy:
+		return "Healthy"
+	case Recovering:
+		return "Recovering"
+	case Ejected:
+		return "Ejected"
+	case Draining:
+		return "Draining"
+	}
+	return "Unknown"
+}
+
+// State - Health state of the connection the statistics belong to
+func (s EndpointStats) State() HealthState {
+	switch {
+	case s.Draining:
+		return Draining
+	case s.Weight <= 0:
+		return Ejected
+	case s.Weight < 1:
+		return Recovering
+	}
+	return Healthy
+}
+
+// defaultSnapshotLimit - Page size of Snapshot when the query sets no limit
+const defaultSnapshotLimit = 100
+
+// SnapshotQuery - Selects the endpoints returned by Snapshot. Zero fields select everything.
+type SnapshotQuery struct {
+	Pools        []string      // Service names of the pools, empty for all pools
+	States       []HealthState // Health states, empty for all states
+	DegradedOnly bool          // Only endpoints of degraded pools
+	Offset       int           // Index of the first endpoint of the page, NextOffset of the previous page
+	Limit        int           // Page size, default 100
+}
+
+// SnapshotPage - A page of endpoints across pools
+type SnapshotPage struct {
+	Endpoints  []EndpointSnapshot // Ordered by service name, pod name, ip and creation time
+	Total      int                // Endpoints matching the query over all pages
+	NextOffset int                // Offset of the next page, 0 on the last page
+}
+
+// Snapshot - Returns a filtered page of the endpoints of all pools. For processes with thousands of endpoints, where
+// a full Stats of every pool gets too large for a debug endpoint or admin API. Pages are taken from separate snapshots,
+// so endpoints may shift between pages when pools change in the mean time.
+func Snapshot(q SnapshotQuery) SnapshotPage {
+	if q.Limit <= 0 {
+		q.Limit = defaultSnapshotLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	states := make(map[HealthState]bool, len(q.States))
+	for _, s := range q.States {
+		states[s] = true
+	}
+	matched := make([]EndpointSnapshot, 0)
+	mutex.RLock()
+	for _, serviceName := range snapshotPools(q.Pools) {
+		c := connectionCache[serviceName]
+		if c == nil || (q.DegradedOnly && !c.degraded) {
+			continue
+		}
+		for _, gc := range c.grpcConnection {
+			stats := gc.Stats()
+			if len(states) > 0 && !states[stats.State()] {
+				continue
+			}
+			matched = append(matched, EndpointSnapshot{Info: gc.Info(), Stats: stats})
+		}
+	}
+	mutex.RUnlock()
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i].Info, matched[j].Info
+		if a.ServiceName != b.ServiceName {
+			return a.ServiceName < b.ServiceName
+		}
+		if a.PodName != b.PodName {
+			return a.PodName < b.PodName
+		}
+		if a.IP != b.IP {
+			return a.IP < b.IP
+		}
+		return a.Created.Before(b.Created)
+	})
+	page := SnapshotPage{Total: len(matched)}
+	if q.Offset >= len(matched) {
+		return page
+	}
+	end := q.Offset + q.Limit
+	if end < len(matched) {
+		page.NextOffset = end
+	} else {
+		end = len(matched)
+	}
+	page.Endpoints = matched[q.Offset:end]
+	return page
+}
+
+// snapshotPools - The service names to include, all pools when none are given. Caller must hold mutex.
+func snapshotPools(pools []string) []string {
+	if len(pools) == 0 {
+		all := make([]string, 0, len(connectionCache))
+		for serviceName := range connectionCache {
+			all = append(all, serviceName)
+		}
+		return all
+	}
+	seen := make(map[string]bool, len(pools))
+	unique := make([]string, 0, len(pools))
+	for _, serviceName := range pools {
+		if !seen[serviceName] {
+			seen[serviceName] = true
+			unique = append(unique, serviceName)
+		}
+	}
+	return unique
+}
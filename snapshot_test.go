@@ -0,0 +1,75 @@
+package kubegrpc
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestEndpointStatsState(t *testing.T) {
+	for _, tc := range []struct {
+		stats EndpointStats
+		want  HealthState
+	}{
+		{EndpointStats{Weight: 1}, Healthy},
+		{EndpointStats{Weight: 0.5}, Recovering},
+		{EndpointStats{Weight: 0}, Ejected},
+		{EndpointStats{Weight: 1, Draining: true}, Draining},
+	} {
+		if got := tc.stats.State(); got != tc.want {
+			t.Errorf("State() of %+v = %v, want %v", tc.stats, got, tc.want)
+		}
+	}
+}
+
+func TestSnapshotPages(t *testing.T) {
+	p := testPool(t, 5)
+	cachePool(t, p)
+	var offsets []int
+	var pods []string
+	q := SnapshotQuery{Pools: []string{"svc.ns:1000", "svc.ns:1000"}, Limit: 2}
+	for {
+		page := Snapshot(q)
+		if page.Total != 5 {
+			t.Fatalf("Total = %d, want 5", page.Total)
+		}
+		for _, e := range page.Endpoints {
+			pods = append(pods, e.Info.PodName)
+		}
+		if page.NextOffset == 0 {
+			break
+		}
+		offsets = append(offsets, page.NextOffset)
+		q.Offset = page.NextOffset
+	}
+	want := []string{"svc-1", "svc-2", "svc-3", "svc-4", "svc-5"}
+	if len(pods) != len(want) || len(offsets) != 2 {
+		t.Fatalf("pages returned %v with offsets %v, want %v", pods, offsets, want)
+	}
+	for i := range want {
+		if pods[i] != want[i] {
+			t.Errorf("endpoint %d = %s, want %s", i, pods[i], want[i])
+		}
+	}
+	if page := Snapshot(SnapshotQuery{Pools: []string{"svc.ns:1000"}, Offset: 10}); len(page.Endpoints) != 0 {
+		t.Errorf("page past the end = %v, want empty", page.Endpoints)
+	}
+}
+
+func TestSnapshotFilters(t *testing.T) {
+	p := testPool(t, 3, WithMinHealthy(5))
+	cachePool(t, p)
+	atomic.StoreInt32(&p.grpcConnection[1].draining, 1)
+	page := Snapshot(SnapshotQuery{Pools: []string{"svc.ns:1000"}, States: []HealthState{Draining}})
+	if page.Total != 1 || page.Endpoints[0].Info.PodName != "svc-2" {
+		t.Errorf("draining endpoints = %+v, want svc-2", page.Endpoints)
+	}
+	if page = Snapshot(SnapshotQuery{Pools: []string{"svc.ns:1000"}, DegradedOnly: true}); page.Total != 0 {
+		t.Errorf("degraded only before the pool degraded = %d endpoints, want 0", page.Total)
+	}
+	mutex.Lock()
+	updateDegraded("svc.ns:1000", p)
+	mutex.Unlock()
+	if page = Snapshot(SnapshotQuery{Pools: []string{"svc.ns:1000"}, DegradedOnly: true}); page.Total != 3 {
+		t.Errorf("degraded only = %d endpoints, want 3", page.Total)
+	}
+}
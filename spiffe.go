@@ -0,0 +1,285 @@
+package kubegrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrSPIFFE - The workload identity could not be obtained, or the server presented an unacceptable SVID
+var ErrSPIFFE = errors.New("kubegrpc: spiffe")
+
+const (
+	// spiffeSocketEnv - Environment variable with the address of the Workload API, set by SPIRE
+	spiffeSocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+	// spiffeRetry - Delay before the Workload API stream is opened again after it failed
+	spiffeRetry = time.Second
+	// spiffeWait - Time a TLS handshake waits for the first SVID of the Workload API
+	spiffeWait = 10 * time.Second
+)
+
+// SPIFFE - Workload identity of the pool, see WithSPIFFE
+type SPIFFE struct {
+	SocketPath  string   // Workload API socket (`unix:///run/spire/sockets/agent.sock`), default $SPIFFE_ENDPOINT_SOCKET
+	TrustDomain string   // Trust domain of the servers, default the trust domain of the own SVID
+	ServerIDs   []string // Accepted SPIFFE IDs of the servers (`spiffe://example.org/backend`), empty for all of the domain
+}
+
+// WithSPIFFE - Dials all pods of the pool with mutual TLS using the X.509 SVID of the workload, obtained and rotated
+// through the SPIFFE Workload API (e.g. the SPIRE agent socket), so the pool takes part in a zero-trust mesh without
+// a sidecar. Servers are verified against the trust bundle of the Workload API and must present a SPIFFE ID of the
+// trust domain, or one of the ServerIDs. Federated trust domains are not supported.
+func WithSPIFFE(s SPIFFE) PoolOption {
+	return func(c *poolConfig) {
+		c.tlsCredentials = spiffeCredentials(s)
+		c.tlsRequired = true
+	}
+}
+
+// spiffeCredentials - TLS credentials presenting the SVID of the workload and verifying the SVID of the server
+func spiffeCredentials(s SPIFFE) credentials.TransportCredentials {
+	socket := s.SocketPath
+	if socket == "" {
+		socket = os.Getenv(spiffeSocketEnv)
+	}
+	source := spiffeSource(strings.TrimPrefix(socket, "unix://"))
+	ids := make(map[string]bool, len(s.ServerIDs))
+	for _, id := range s.ServerIDs {
+		ids[id] = true
+	}
+	return credentials.NewTLS(&tls.Config{
+		// The server name is the pod IP, the server is verified by its SPIFFE ID in VerifyPeerCertificate instead
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			svid, err := source.current(info.Context())
+			if err != nil {
+				return nil, err
+			}
+			return svid.cert, nil
+		},
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			ctx, cancel := context.WithTimeout(context.Background(), spiffeWait)
+			defer cancel()
+			svid, err := source.current(ctx)
+			if err != nil {
+				return err
+			}
+			return svid.verify(raw, s.TrustDomain, ids)
+		},
+	})
+}
+
+// svid - An X.509 SVID of the workload with the trust bundle of its domain
+type svid struct {
+	id     *url.URL
+	cert   *tls.Certificate
+	bundle *x509.CertPool
+}
+
+// verify - Verifies the certificate chain of a server against the bundle, and its SPIFFE ID
+func (s *svid) verify(raw [][]byte, trustDomain string, ids map[string]bool) error {
+	if len(raw) == 0 {
+		return fmt.Errorf("%w: server presented no certificate", ErrSPIFFE)
+	}
+	certs := make([]*x509.Certificate, 0, len(raw))
+	for _, r := range raw {
+		cert, err := x509.ParseCertificate(r)
+		if err != nil {
+			return fmt.Errorf("%w: invalid server certificate: %v", ErrSPIFFE, err)
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{Roots: s.bundle, Intermediates: intermediates,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("%w: untrusted server certificate: %v", ErrSPIFFE, err)
+	}
+	id, err := spiffeID(certs[0])
+	if err != nil {
+		return err
+	}
+	if trustDomain == "" {
+		trustDomain = s.id.Host
+	}
+	if id.Host != trustDomain {
+		return fmt.Errorf("%w: server %s is not in trust domain %s", ErrSPIFFE, id, trustDomain)
+	}
+	if len(ids) > 0 && !ids[id.String()] {
+		return fmt.Errorf("%w: server %s is not accepted", ErrSPIFFE, id)
+	}
+	return nil
+}
+
+// spiffeID - The SPIFFE ID of an SVID, its only URI SAN
+func spiffeID(cert *x509.Certificate) (*url.URL, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" || cert.URIs[0].Host == "" {
+		return nil, fmt.Errorf("%w: certificate of %s carries no SPIFFE ID", ErrSPIFFE, cert.Subject)
+	}
+	return cert.URIs[0], nil
+}
+
+// svidSource - Follows the X.509 SVIDs of a Workload API socket
+type svidSource struct {
+	socket    string
+	mutex     sync.RWMutex
+	svid      *svid
+	ready     chan struct{} // Closed with the first SVID
+	readyOnce sync.Once
+}
+
+var (
+	spiffeSources = make(map[string]*svidSource) // By socket, shared by the pools and kept for the process lifetime
+	spiffeMutex   = &sync.Mutex{}
+)
+
+// spiffeSource - The source of the socket, started on first use
+func spiffeSource(socket string) *svidSource {
+	spiffeMutex.Lock()
+	defer spiffeMutex.Unlock()
+	s := spiffeSources[socket]
+	if s == nil {
+		s = &svidSource{socket: socket, ready: make(chan struct{})}
+		spiffeSources[socket] = s
+		go s.run()
+	}
+	return s
+}
+
+// current - The current SVID, waits for the first one until the context is done
+func (s *svidSource) current(ctx context.Context) (*svid, error) {
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: no SVID from the Workload API at %s: %v", ErrSPIFFE, s.socket, ctx.Err())
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.svid, nil
+}
+
+// run - Follows the Workload API stream, opening it again when it fails
+func (s *svidSource) run() {
+	for {
+		if err := s.fetch(context.Background()); err != nil {
+			log.Printf("WARNING: svidSource.run(): Workload API at %s failed: %v", s.socket, err)
+		}
+		time.Sleep(spiffeRetry)
+	}
+}
+
+// fetch - Streams the SVIDs of the workload until the stream fails
+func (s *svidSource) fetch(ctx context.Context) error {
+	if s.socket == "" {
+		return fmt.Errorf("%w: no Workload API socket, set %s", ErrSPIFFE, spiffeSocketEnv)
+	}
+	dialer := func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}
+	conn, err := grpc.Dial(s.socket, grpc.WithInsecure(), grpc.WithDialer(dialer))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true"))
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/SpiffeWorkloadAPI/FetchX509SVID")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&x509SVIDRequest{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		resp := &x509SVIDResponse{}
+		if err := stream.RecvMsg(resp); err != nil {
+			return err
+		}
+		if err := s.update(resp); err != nil {
+			log.Printf("ERROR: svidSource.fetch(): Ignoring the SVID update: %v", err)
+		}
+	}
+}
+
+// update - Replaces the SVID with the first SVID of the response
+func (s *svidSource) update(resp *x509SVIDResponse) error {
+	if len(resp.Svids) == 0 {
+		return fmt.Errorf("%w: response without SVID", ErrSPIFFE)
+	}
+	r := resp.Svids[0]
+	certs, err := x509.ParseCertificates(r.X509Svid)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("%w: invalid SVID of %s: %v", ErrSPIFFE, r.SpiffeId, err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(r.X509SvidKey)
+	if err != nil {
+		return fmt.Errorf("%w: invalid SVID key of %s: %v", ErrSPIFFE, r.SpiffeId, err)
+	}
+	bundle, err := x509.ParseCertificates(r.Bundle)
+	if err != nil || len(bundle) == 0 {
+		return fmt.Errorf("%w: invalid bundle of %s: %v", ErrSPIFFE, r.SpiffeId, err)
+	}
+	id, err := spiffeID(certs[0])
+	if err != nil {
+		return err
+	}
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	pool := x509.NewCertPool()
+	for _, c := range bundle {
+		pool.AddCert(c)
+	}
+	s.mutex.Lock()
+	s.svid = &svid{id: id, cert: cert, bundle: pool}
+	s.mutex.Unlock()
+	s.readyOnce.Do(func() { close(s.ready) })
+	return nil
+}
+
+// Messages of the SPIFFE Workload API (workload.proto) used by svidSource
+
+type x509SVIDRequest struct{}
+
+func (m *x509SVIDRequest) Reset()         { *m = x509SVIDRequest{} }
+func (m *x509SVIDRequest) String() string { return proto.CompactTextString(m) }
+func (*x509SVIDRequest) ProtoMessage()    {}
+
+type x509SVIDResponse struct {
+	Svids []*x509SVID `protobuf:"bytes,1,rep,name=svids,proto3"`
+}
+
+func (m *x509SVIDResponse) Reset()         { *m = x509SVIDResponse{} }
+func (m *x509SVIDResponse) String() string { return proto.CompactTextString(m) }
+func (*x509SVIDResponse) ProtoMessage()    {}
+
+type x509SVID struct {
+	SpiffeId    string `protobuf:"bytes,1,opt,name=spiffe_id,json=spiffeId,proto3"`
+	X509Svid    []byte `protobuf:"bytes,2,opt,name=x509_svid,json=x509Svid,proto3"`        // DER certificates, leaf first
+	X509SvidKey []byte `protobuf:"bytes,3,opt,name=x509_svid_key,json=x509SvidKey,proto3"` // PKCS#8 DER
+	Bundle      []byte `protobuf:"bytes,4,opt,name=bundle,proto3"`                         // DER certificates of the trust domain
+}
+
+func (m *x509SVID) Reset()         { *m = x509SVID{} }
+func (m *x509SVID) String() string { return proto.CompactTextString(m) }
+func (*x509SVID) ProtoMessage()    {}
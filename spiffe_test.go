@@ -0,0 +1,165 @@
+package kubegrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// testIdentity - Certificate with the SPIFFE ID, signed by parent (self-signed without parent)
+type testIdentity struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestIdentity(t *testing.T, id string, parent *testIdentity) *testIdentity {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse(id)
+	template := &x509.Certificate{SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: pkix.Name{CommonName: id},
+		URIs: []*url.URL{uri}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature, BasicConstraintsValid: true,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testIdentity{cert: cert, key: key}
+}
+
+// workloadAPI - Fake Workload API on a unix socket handing out the SVID, returns the socket address
+func workloadAPI(t *testing.T, client, ca *testIdentity) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := x509.MarshalPKCS8PrivateKey(client.key)
+	resp := &x509SVIDResponse{Svids: []*x509SVID{{SpiffeId: client.cert.URIs[0].String(), X509Svid: client.cert.Raw,
+		X509SvidKey: key, Bundle: ca.cert.Raw}}}
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{ServiceName: "SpiffeWorkloadAPI", HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{StreamName: "FetchX509SVID", ServerStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				if len(md["workload.spiffe.io"]) == 0 {
+					return errors.New("missing security header")
+				}
+				if err := stream.RecvMsg(&x509SVIDRequest{}); err != nil {
+					return err
+				}
+				if err := stream.SendMsg(resp); err != nil {
+					return err
+				}
+				<-stream.Context().Done()
+				return nil
+			}}}}, struct{}{})
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	return "unix://" + socket
+}
+
+func TestSPIFFE(t *testing.T) {
+	ca := newTestIdentity(t, "spiffe://example.org", nil)
+	client := newTestIdentity(t, "spiffe://example.org/client", ca)
+	server := newTestIdentity(t, "spiffe://example.org/server", ca)
+	socket := workloadAPI(t, client, ca)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientIDs := make(chan string, 4)
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs: roots, Certificates: []tls.Certificate{{Certificate: [][]byte{server.cert.Raw}, PrivateKey: server.key}}})),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			p, _ := peer.FromContext(ctx)
+			state := p.AuthInfo.(credentials.TLSInfo).State
+			clientIDs <- state.PeerCertificates[0].URIs[0].String()
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	check := func(cfg SPIFFE) error {
+		p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithSPIFFE(cfg)}))
+		gc, dialErr := newGrpcConnection("svc.ns:"+port, p, testPod("svc-1", "ns", "svc", "127.0.0.1"), port)
+		if dialErr != nil {
+			t.Fatal(dialErr)
+		}
+		defer gc.conn.Close()
+		if !gc.tls {
+			t.Error("connection not dialed with TLS")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := healthpb.NewHealthClient(gc.conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+	if err := check(SPIFFE{SocketPath: socket, ServerIDs: []string{"spiffe://example.org/server"}}); err != nil {
+		t.Fatalf("Check() with the server ID accepted = %v", err)
+	}
+	if id := <-clientIDs; id != "spiffe://example.org/client" {
+		t.Errorf("server saw client %s", id)
+	}
+	if err := check(SPIFFE{SocketPath: socket, ServerIDs: []string{"spiffe://example.org/other"}}); err == nil {
+		t.Error("Check() succeeded with the server ID not accepted")
+	}
+	if err := check(SPIFFE{SocketPath: socket, TrustDomain: "other.org"}); err == nil {
+		t.Error("Check() succeeded with a server of another trust domain")
+	}
+}
+
+func TestSPIFFEVerify(t *testing.T) {
+	ca := newTestIdentity(t, "spiffe://example.org", nil)
+	client := newTestIdentity(t, "spiffe://example.org/client", ca)
+	other := newTestIdentity(t, "spiffe://example.org", nil)
+	foreign := newTestIdentity(t, "spiffe://example.org/server", other)
+	bundle := x509.NewCertPool()
+	bundle.AddCert(ca.cert)
+	s := &svid{id: client.cert.URIs[0], bundle: bundle}
+	if err := s.verify([][]byte{foreign.cert.Raw}, "", nil); !errors.Is(err, ErrSPIFFE) {
+		t.Errorf("verify() of a certificate of another CA = %v, want ErrSPIFFE", err)
+	}
+	if err := s.verify(nil, "", nil); !errors.Is(err, ErrSPIFFE) {
+		t.Errorf("verify() without certificate = %v, want ErrSPIFFE", err)
+	}
+	if err := s.verify([][]byte{client.cert.Raw}, "", nil); err != nil {
+		t.Errorf("verify() of the own trust domain = %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package kubegrpc
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ErrInvalidSplit - The traffic split has no label, no subsets, or a negative, infinite or NaN percentage
+var ErrInvalidSplit = errors.New("kubegrpc: invalid traffic split")
+
+// WithPodSelector - Connects only to the pods of the service which have all the labels, eg `version=v2` to talk to a
+// canary only
+func WithPodSelector(selector map[string]string) PoolOption {
+	return func(c *poolConfig) {
+		c.podSelector = selector
+	}
+}
+
+// selectPods - The pods matching the selector, all pods for an empty selector
+func selectPods(pods []corev1.Pod, selector map[string]string) []corev1.Pod {
+	if len(selector) == 0 {
+		return pods
+	}
+	s := labels.SelectorFromSet(selector)
+	selected := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if s.Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected
+}
+
+// trafficSplit - Share of the picks per value of a pod label
+type trafficSplit struct {
+	label   string
+	weights map[string]float64
+	values  []string // Sorted keys of weights, for a deterministic pick
+}
+
+var (
+	trafficSplits = make(map[string]*trafficSplit)
+	splitsMutex   = &sync.RWMutex{}
+)
+
+// SetTrafficSplit - Splits the picks of the pool of the service between subsets of its pods by the value of a label,
+// eg label `version` with {"v1": 95, "v2": 5} sends 5% of the picks to the canary pods labeled version=v2. The
+// percentages are relative to each other. Pods without the label or with a value not in the split are not picked, unless
+// no subset has a usable endpoint. A subset without usable endpoints (none, all draining or ejected) gets no picks,
+// its share goes to the other subsets. The split applies until it is replaced, cleared with ClearTrafficSplit or the
+// pool is closed; it can be set before the pool is created.
+func SetTrafficSplit(serviceName, label string, percentages map[string]float64) error {
+	if label == "" || len(percentages) == 0 {
+		return ErrInvalidSplit
+	}
+	split := &trafficSplit{label: label, weights: make(map[string]float64, len(percentages))}
+	for value, p := range percentages {
+		if math.IsNaN(p) || math.IsInf(p, 0) || p < 0 {
+			return ErrInvalidSplit
+		}
+		split.weights[value] = p
+		split.values = append(split.values, value)
+	}
+	sort.Strings(split.values)
+	splitsMutex.Lock()
+	defer splitsMutex.Unlock()
+	trafficSplits[serviceName] = split
+	log.Printf("INFO: SetTrafficSplit(): Picks of %s split by %s: %v", serviceName, label, percentages)
+	return nil
+}
+
+// ClearTrafficSplit - Removes the traffic split of the service
+func ClearTrafficSplit(serviceName string) {
+	splitsMutex.Lock()
+	defer splitsMutex.Unlock()
+	delete(trafficSplits, serviceName)
+}
+
+// splitConnections - Restricts the connections to the subset chosen by the traffic split of the service. Returns the
+// connections unchanged without a split or without usable subsets. random returns values in [0,1).
+func splitConnections(serviceName string, conns []*GrpcConnection, random func() float64) []*GrpcConnection {
+	splitsMutex.RLock()
+	split := trafficSplits[serviceName]
+	splitsMutex.RUnlock()
+	if split == nil {
+		return conns
+	}
+	subsets := make(map[string][]*GrpcConnection, len(split.values))
+	usable := make(map[string]bool, len(split.values))
+	for _, gc := range conns {
+		value, found := gc.labels[split.label]
+		if _, inSplit := split.weights[value]; !found || !inSplit {
+			continue
+		}
+		subsets[value] = append(subsets[value], gc)
+		if !gc.isDraining() && gc.weight() > 0 {
+			usable[value] = true
+		}
+	}
+	values := make([]string, 0, len(usable))
+	weights := make([]float64, 0, len(usable))
+	for _, value := range split.values {
+		if usable[value] && split.weights[value] > 0 {
+			values = append(values, value)
+			weights = append(weights, split.weights[value])
+		}
+	}
+	if len(values) == 0 {
+		return conns
+	}
+	return subsets[values[pickWeighted(weights, random)]]
+}
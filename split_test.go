@@ -0,0 +1,90 @@
+package kubegrpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// labelPool - Test pool whose connections carry the version label
+func labelPool(t *testing.T, versions ...string) *connection {
+	p := testPool(t, len(versions))
+	for k, v := range versions {
+		p.grpcConnection[k].labels = map[string]string{"version": v}
+	}
+	t.Cleanup(func() { ClearTrafficSplit("svc.ns:1000") })
+	return p
+}
+
+func TestSelectPods(t *testing.T) {
+	v1, v2 := testPod("a", "ns", "svc", "10.0.0.1"), testPod("b", "ns", "svc", "10.0.0.2")
+	v1.Labels["version"], v2.Labels["version"] = "v1", "v2"
+	pods := []corev1.Pod{*v1, *v2}
+	if got := selectPods(pods, map[string]string{"version": "v2"}); len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("selectPods() = %v, want b", got)
+	}
+	if got := selectPods(pods, nil); len(got) != 2 {
+		t.Errorf("selectPods() without selector = %d pods, want 2", len(got))
+	}
+}
+
+func TestSetTrafficSplitInvalid(t *testing.T) {
+	for _, split := range []map[string]float64{nil, {"v1": -1}} {
+		if err := SetTrafficSplit("svc.ns:1000", "version", split); !errors.Is(err, ErrInvalidSplit) {
+			t.Errorf("SetTrafficSplit(%v) error = %v, want ErrInvalidSplit", split, err)
+		}
+	}
+}
+
+func TestSplitConnections(t *testing.T) {
+	p := labelPool(t, "v1", "v1", "v2", "")
+	if err := SetTrafficSplit("svc.ns:1000", "version", map[string]float64{"v1": 90, "v2": 10}); err != nil {
+		t.Fatal(err)
+	}
+	// Weights v1 90, v2 10: random below 0.9 picks v1
+	if got := splitConnections("svc.ns:1000", p.grpcConnection, func() float64 { return 0.5 }); len(got) != 2 ||
+		got[0].labels["version"] != "v1" {
+		t.Errorf("splitConnections(0.5) = %v, want the v1 subset", got)
+	}
+	if got := splitConnections("svc.ns:1000", p.grpcConnection, func() float64 { return 0.95 }); len(got) != 1 ||
+		got[0] != p.grpcConnection[2] {
+		t.Errorf("splitConnections(0.95) = %v, want the v2 subset", got)
+	}
+	// The canary draining: all picks go to v1
+	atomic.StoreInt32(&p.grpcConnection[2].draining, 1)
+	if got := splitConnections("svc.ns:1000", p.grpcConnection, func() float64 { return 0.95 }); len(got) != 2 {
+		t.Errorf("splitConnections() with draining canary = %v, want the v1 subset", got)
+	}
+
+	// The split goes with the pool
+	cachePool(t, p)
+	if err := ClosePool("svc.ns:1000"); err != nil {
+		t.Fatal(err)
+	}
+	splitsMutex.RLock()
+	split := trafficSplits["svc.ns:1000"]
+	splitsMutex.RUnlock()
+	if split != nil {
+		t.Error("traffic split kept after the pool was closed")
+	}
+}
+
+func TestTrafficSplitShare(t *testing.T) {
+	p := labelPool(t, "v1", "v1", "v1", "v2")
+	if err := SetTrafficSplit("svc.ns:1000", "version", map[string]float64{"v1": 80, "v2": 20}); err != nil {
+		t.Fatal(err)
+	}
+	canary := 0
+	mutex.RLock()
+	for i := 0; i < 10000; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection).labels["version"] == "v2" {
+			canary++
+		}
+	}
+	mutex.RUnlock()
+	if canary < 1700 || canary > 2300 {
+		t.Errorf("canary picked %d of 10000 times, want about 2000", canary)
+	}
+}
@@ -0,0 +1,72 @@
+package kubegrpc
+
+import (
+	"log"
+	"time"
+)
+
+// defaultStaleAfter - Refresh intervals without a successful discovery after which a pool is stale
+const defaultStaleAfter = 3
+
+// WithStaleAfter - A pool whose discovery did not succeed for n refresh intervals (default 3), eg during an API
+// server outage or for lack of RBAC permissions, is stale: it keeps its last known endpoints, but pods started since
+// are missing and pods gone may still be dialed. Stale pools are logged, emit PoolStale (and PoolRefreshed once
+// discovered again) and report Stale in Stats; MetricDiscoveryAge reports the age of the discovery of every pool.
+func WithStaleAfter(n int) PoolOption {
+	return func(c *poolConfig) {
+		if n < 1 {
+			n = defaultStaleAfter
+		}
+		c.staleAfter = n
+	}
+}
+
+// recordDiscovery - Reports the duration of a discovery of the pool
+func recordDiscovery(serviceName string, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	getMetrics().Histogram(MetricDiscoverySeconds, map[string]string{"service": serviceName, "result": result},
+		d.Seconds())
+}
+
+// setDiscovered - Records the successful discovery which ended at end, a stale pool is fresh again. Caller must hold
+// mutex.
+func (c *connection) setDiscovered(serviceName string, end time.Time, d time.Duration) {
+	c.discovered, c.discoveryTime = end, d
+	if !c.stale {
+		return
+	}
+	c.stale = false
+	log.Printf("INFO: setDiscovered(): Pool %s discovered again", serviceName)
+	emit(PoolEvent{Type: PoolRefreshed, ServiceName: serviceName, Connections: len(c.grpcConnection),
+		Version: c.snapshotVersion()})
+}
+
+// discoveryAge - Time since the last successful discovery of the pool, or since its creation before the first one.
+// Caller must hold mutex.
+func (c *connection) discoveryAge(now time.Time) time.Duration {
+	if c.discovered.IsZero() {
+		return now.Sub(c.created)
+	}
+	return now.Sub(c.discovered)
+}
+
+// updateStale - Reports the age of the discovery of the pool and marks it stale once the age exceeds its
+// WithStaleAfter refresh intervals. Caller must hold mutex.
+func (c *connection) updateStale(serviceName string, now time.Time) {
+	age := c.discoveryAge(now)
+	getMetrics().Gauge(MetricDiscoveryAge, map[string]string{"service": serviceName}, age.Seconds())
+	staleAfter := c.config.staleAfter
+	if staleAfter < 1 {
+		staleAfter = defaultStaleAfter
+	}
+	if c.stale || age <= time.Duration(staleAfter)*c.refreshInterval()*maintenanceSlowdown() {
+		return
+	}
+	c.stale = true
+	log.Printf("WARNING: updateStale(): Pool %s is stale, not discovered for %v", serviceName, age.Round(time.Second))
+	emit(PoolEvent{Type: PoolStale, ServiceName: serviceName, Connections: len(c.grpcConnection),
+		Reason: "not discovered for " + age.Round(time.Second).String(), Version: c.snapshotVersion()})
+}
@@ -0,0 +1,66 @@
+package kubegrpc
+
+import (
+	"testing"
+	"time"
+)
+
+// nextPoolEvent - The next event of the subscription of the given type, fails the test after a second
+func nextPoolEvent(t *testing.T, events <-chan PoolEvent, want PoolEventType) PoolEvent {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == want {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %v event", want)
+		}
+	}
+}
+
+func TestWithStaleAfter(t *testing.T) {
+	p := testPool(t, 1, WithStaleAfter(3))
+	cachePool(t, p)
+	events := Subscribe("svc.ns:1000")
+	defer Unsubscribe("svc.ns:1000", events)
+
+	mutex.Lock()
+	p.created = time.Now().Add(-4 * defaultRefreshInterval)
+	p.updateStale("svc.ns:1000", time.Now())
+	mutex.Unlock()
+	if e := nextPoolEvent(t, events, PoolStale); e.Connections != 1 {
+		t.Errorf("PoolStale event = %+v, want the pool with its connection", e)
+	}
+	stats, err := Stats("svc.ns:1000")
+	if err != nil || !stats.Stale || stats.Staleness < 4*defaultRefreshInterval || !stats.LastDiscovery.IsZero() {
+		t.Errorf("Stats() = %+v, %v, want stale without discovery", stats, err)
+	}
+
+	discovered := time.Now()
+	mutex.Lock()
+	p.setDiscovered("svc.ns:1000", discovered, 20*time.Millisecond)
+	p.updateStale("svc.ns:1000", time.Now())
+	mutex.Unlock()
+	nextPoolEvent(t, events, PoolRefreshed)
+	stats, _ = Stats("svc.ns:1000")
+	if stats.Stale || !stats.LastDiscovery.Equal(discovered) || stats.DiscoveryTime != 20*time.Millisecond ||
+		stats.Staleness > time.Second {
+		t.Errorf("Stats() after the discovery = %+v, want fresh", stats)
+	}
+}
+
+func TestDiscoveryRecorded(t *testing.T) {
+	useFakeClientset(t, testService("fresh", "ns"), testPod("fresh-0", "ns", "fresh", "10.0.0.1"))
+	defer ClosePool("fresh.ns:1000")
+	before := time.Now()
+	if _, err := Connect("fresh.ns:1000", okBalancer{}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := Stats("fresh.ns:1000")
+	if err != nil || stats.Stale || stats.LastDiscovery.Before(before) || stats.DiscoveryTime <= 0 {
+		t.Errorf("Stats() = %+v, %v, want the discovery of Connect", stats, err)
+	}
+}
@@ -0,0 +1,129 @@
+package kubegrpc
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// cgroupCPUStatFiles - cpu.stat locations for cgroup v2 and v1, first existing file is used
+var cgroupCPUStatFiles = []string{
+	"/sys/fs/cgroup/cpu.stat",
+	"/sys/fs/cgroup/cpu/cpu.stat",
+	"/sys/fs/cgroup/cpu,cpuacct/cpu.stat",
+}
+
+const (
+	starvationSampleInterval = 10 * time.Second
+	// starvationSlowdown - Factor applied to the health check and refresh intervals while starved
+	starvationSlowdown = 5
+)
+
+// starved - 1 while the process is CPU throttled above the threshold (atomic)
+var starved int32
+
+// EnableCPUStarvationDetection - Starts sampling the cgroup CPU throttling statistics of the container. While the
+// fraction of throttled scheduling periods exceeds threshold (eg 0.25), the library sheds its own overhead: health checks
+// and pool refreshes run 5 times less often. The state is reported by MaintenanceDegraded and the
+// kubegrpc_maintenance_degraded metric. Has no effect when no cgroup cpu.stat is found.
+func EnableCPUStarvationDetection(threshold float64) {
+	file := ""
+	for _, f := range cgroupCPUStatFiles {
+		if _, err := os.Stat(f); err == nil {
+			file = f
+			break
+		}
+	}
+	if file == "" {
+		log.Printf("INFO: EnableCPUStarvationDetection(): No cgroup cpu.stat found, detection disabled")
+		return
+	}
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	if isShuttingDown() {
+		return
+	}
+	maintenance.Add(1)
+	go sampleStarvation(stopMaintenance, file, threshold)
+}
+
+// MaintenanceDegraded - True while health checks and refreshes are slowed down because of CPU starvation
+func MaintenanceDegraded() bool {
+	return atomic.LoadInt32(&starved) == 1
+}
+
+// maintenanceSlowdown - Factor to apply to the background maintenance intervals
+func maintenanceSlowdown() time.Duration {
+	if MaintenanceDegraded() {
+		return starvationSlowdown
+	}
+	return 1
+}
+
+func sampleStarvation(stop <-chan struct{}, file string, threshold float64) {
+	defer maintenance.Done()
+	prevPeriods, prevThrottled, err := readCPUStat(file)
+	if err != nil {
+		log.Printf("ERROR: sampleStarvation(): Can not read %s, detection disabled. Error %v", file, err)
+		return
+	}
+	for sleep(stop, starvationSampleInterval) {
+		periods, throttled, err := readCPUStat(file)
+		if err != nil {
+			continue
+		}
+		setStarved(throttledRatio(periods-prevPeriods, throttled-prevThrottled) > threshold)
+		prevPeriods, prevThrottled = periods, throttled
+	}
+}
+
+// setStarved - Updates the starvation state, logs transitions and reports the metric
+func setStarved(s bool) {
+	v := int32(0)
+	if s {
+		v = 1
+	}
+	if atomic.SwapInt32(&starved, v) != v {
+		log.Printf("INFO: setStarved(): CPU starvation %v, maintenance slowdown %dx", s, maintenanceSlowdown())
+	}
+	getMetrics().Gauge(MetricMaintenanceDegraded, nil, float64(v))
+}
+
+// throttledRatio - Fraction of the scheduling periods in which the container was throttled
+func throttledRatio(periods, throttled uint64) float64 {
+	if periods == 0 {
+		return 0
+	}
+	return float64(throttled) / float64(periods)
+}
+
+// readCPUStat - Reads nr_periods and nr_throttled from a cgroup cpu.stat file (same keys in v1 and v2)
+func readCPUStat(file string) (periods, throttled uint64, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "nr_periods":
+			periods = v
+		case "nr_throttled":
+			throttled = v
+		}
+	}
+	return periods, throttled, scanner.Err()
+}
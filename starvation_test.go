@@ -0,0 +1,37 @@
+package kubegrpc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCPUStat(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cpu.stat")
+	content := "usage_usec 1000\nnr_periods 200\nnr_throttled 50\nthrottled_usec 9000\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	periods, throttled, err := readCPUStat(file)
+	if err != nil || periods != 200 || throttled != 50 {
+		t.Errorf("readCPUStat() = %d, %d, %v, want 200, 50", periods, throttled, err)
+	}
+	if r := throttledRatio(periods, throttled); r != 0.25 {
+		t.Errorf("throttledRatio() = %v, want 0.25", r)
+	}
+	if r := throttledRatio(0, 0); r != 0 {
+		t.Errorf("throttledRatio() without periods = %v, want 0", r)
+	}
+}
+
+func TestMaintenanceSlowdown(t *testing.T) {
+	defer setStarved(false)
+	setStarved(true)
+	if !MaintenanceDegraded() || maintenanceSlowdown() != starvationSlowdown {
+		t.Errorf("slowdown = %v while starved, want %v", maintenanceSlowdown(), starvationSlowdown)
+	}
+	setStarved(false)
+	if MaintenanceDegraded() || maintenanceSlowdown() != 1 {
+		t.Errorf("slowdown = %v while not starved, want 1", maintenanceSlowdown())
+	}
+}
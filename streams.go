@@ -0,0 +1,112 @@
+package kubegrpc
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// StreamDrain - How a draining connection treats its open streams, see WithStreamDrain
+type StreamDrain struct {
+	// Timeout - Streams still open after the timeout are cancelled. 0 for the drain timeout of the pool
+	Timeout time.Duration
+	// Migrate - Called for every open stream when the drain starts, eg to open a replacement stream on another
+	// connection of the pool and then cancel the old one. nil: the streams are left to complete.
+	Migrate func(StreamInfo)
+}
+
+// StreamInfo - An open stream of a connection, handed to StreamDrain.Migrate and StreamRebalance.Move
+type StreamInfo struct {
+	Endpoint EndpointInfo
+	Method   string
+	Started  time.Time
+	Cancel   func() // Cancels the stream, it fails with codes.Canceled
+}
+
+// WithStreamDrain - Drains the long-lived streams of a connection to a removed pod as well: by default only the unary
+// RPCs are waited for and the open streams fail when the connection is closed. With the policy the drain waits for the
+// streams too, and cancels the streams still open after the Timeout of the policy. With Migrate the application is
+// asked to move every open stream to another connection when the drain starts, so it can reconnect before the stream
+// is cancelled. The open streams of a connection are shown in EndpointStats.Streams with or without the policy.
+func WithStreamDrain(policy StreamDrain) PoolOption {
+	return func(c *poolConfig) {
+		if policy.Timeout < 0 {
+			policy.Timeout = 0
+		}
+		c.streamDrain = &policy
+	}
+}
+
+// openStream - A stream established on a connection
+type openStream struct {
+	method  string
+	started time.Time
+	cancel  context.CancelFunc
+}
+
+// streamSet - The open streams of a connection
+type streamSet map[*openStream]struct{}
+
+// trackStream - Counts the stream as open until it ended
+func (c *GrpcConnection) trackStream(s grpc.ClientStream, method string, cancel context.CancelFunc) {
+	st := &openStream{method: method, started: time.Now(), cancel: cancel}
+	c.streamsMutex.Lock()
+	if c.openStreams == nil {
+		c.openStreams = make(streamSet)
+	}
+	c.openStreams[st] = struct{}{}
+	c.streamsMutex.Unlock()
+	atomic.AddInt64(&c.streams, 1)
+	// The context of a stream is done once it ended: completed, failed or cancelled by the application
+	go func() {
+		<-s.Context().Done()
+		c.streamsMutex.Lock()
+		delete(c.openStreams, st)
+		c.streamsMutex.Unlock()
+		atomic.AddInt64(&c.streams, -1)
+		cancel()
+	}()
+}
+
+// streamDrain - The stream drain policy of the pool of the connection, nil without
+func (c *GrpcConnection) streamDrain() *StreamDrain {
+	if c.pool == nil {
+		return nil
+	}
+	return c.pool.config.streamDrain
+}
+
+// openStreamInfos - The open streams of the connection, oldest first
+func (c *GrpcConnection) openStreamInfos() []StreamInfo {
+	c.streamsMutex.Lock()
+	defer c.streamsMutex.Unlock()
+	streams := make([]StreamInfo, 0, len(c.openStreams))
+	for st := range c.openStreams {
+		streams = append(streams, StreamInfo{Endpoint: c.Info(), Method: st.method, Started: st.started,
+			Cancel: st.cancel})
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].Started.Before(streams[j].Started) })
+	return streams
+}
+
+// drainStreams - Hands the open streams to the Migrate function of the policy
+func (c *GrpcConnection) drainStreams(policy *StreamDrain) {
+	if policy.Migrate == nil {
+		return
+	}
+	for _, s := range c.openStreamInfos() {
+		policy.Migrate(s)
+	}
+}
+
+// cancelStreams - Cancels the open streams, returns their number
+func (c *GrpcConnection) cancelStreams() int {
+	streams := c.openStreamInfos()
+	for _, s := range streams {
+		s.Cancel()
+	}
+	return len(streams)
+}
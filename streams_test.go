@@ -0,0 +1,151 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+)
+
+// fakeStream - Client stream ending with the context it was opened with
+type fakeStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+// openTestStream - Opens a stream through the interceptor of the connection, returns its cancel function
+func openTestStream(t *testing.T, gc *GrpcConnection) (context.Context, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	var stream context.Context
+	_, err := gc.streamInterceptor(ctx, &grpc.StreamDesc{}, gc.conn, "/pkg.Svc/Watch",
+		func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+			stream = ctx
+			return fakeStream{ctx: ctx}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream, cancel
+}
+
+// streams - Open streams of the connection, waits up to a second for want
+func streams(gc *GrpcConnection, want int64) int64 {
+	for i := 0; i < 100 && gc.Stats().Streams != want; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return gc.Stats().Streams
+}
+
+func TestStreamsTracked(t *testing.T) {
+	gc := testPool(t, 1).grpcConnection[0]
+	_, cancel := openTestStream(t, gc)
+	if n := streams(gc, 1); n != 1 {
+		t.Fatalf("open streams = %d, want 1", n)
+	}
+	cancel()
+	if n := streams(gc, 0); n != 0 {
+		t.Errorf("open streams = %d after the end of the stream, want 0", n)
+	}
+}
+
+func TestInternalStreamsNotTracked(t *testing.T) {
+	hs := health.NewServer()
+	NewLameduck(hs, 0)
+	port := healthServer(t, hs)
+	serviceName := "svc.ns:" + port
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithHealthWatch(""), WithLameduck()}))
+	mutex.Lock()
+	setPool(serviceName, c)
+	mutex.Unlock()
+	defer ClosePool(serviceName)
+	if err := updateConnectionPool(serviceName, c, true); err != nil {
+		t.Fatal(err)
+	}
+	gc := ListPool(serviceName)[0]
+	if !waitWatched(gc, true) {
+		t.Fatal("health Watch stream not established")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := gc.Stats().Streams; n != 0 {
+		t.Errorf("open streams = %d with the health and lameduck Watch streams only, want 0", n)
+	}
+	if infos := gc.openStreamInfos(); len(infos) != 0 {
+		t.Errorf("open streams %v, want none", infos)
+	}
+}
+
+func TestStreamDrain(t *testing.T) {
+	var mutex sync.Mutex
+	var migrated []StreamInfo
+	p := testPool(t, 2, WithStreamDrain(StreamDrain{Timeout: 300 * time.Millisecond, Migrate: func(s StreamInfo) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		migrated = append(migrated, s)
+	}}))
+	cachePool(t, p)
+	gc := p.grpcConnection[0]
+	stream, cancel := openTestStream(t, gc)
+	defer cancel()
+	go drain(gc, time.Minute)
+	time.Sleep(100 * time.Millisecond)
+	if n := poolSize(p, 2); n != 2 {
+		t.Fatalf("pool size = %d with an open stream, want 2", n)
+	}
+	mutex.Lock()
+	if len(migrated) != 1 || migrated[0].Method != "/pkg.Svc/Watch" || migrated[0].Endpoint.PodName != "svc-1" {
+		t.Errorf("migrated streams = %+v, want the open stream", migrated)
+	}
+	mutex.Unlock()
+	// Not migrated within the timeout: cancelled
+	select {
+	case <-stream.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream not cancelled after the stream drain timeout")
+	}
+	if n := poolSize(p, 1); n != 1 {
+		t.Errorf("pool size = %d after the stream drain, want 1", n)
+	}
+}
+
+func TestStreamRebalance(t *testing.T) {
+	p := testPool(t, 3)
+	loaded := p.grpcConnection[0]
+	for i := 0; i < 6; i++ {
+		_, cancel := openTestStream(t, loaded)
+		defer cancel()
+	}
+	_, cancel := openTestStream(t, p.grpcConnection[1])
+	defer cancel()
+	streams(loaded, 6)
+
+	mutex.RLock()
+	moves := planStreamMoves(p.grpcConnection, 1)
+	limited := planStreamMoves(p.grpcConnection, 0.1)
+	mutex.RUnlock()
+	// 6/1/0: two streams to the idle connection, one to the other, leaving 3/2/2
+	targets := map[string]int{}
+	for _, m := range moves {
+		if m.Stream.Endpoint.PodName != "svc-1" {
+			t.Errorf("moved a stream of %s, want of the loaded connection", m.Stream.Endpoint.PodName)
+		}
+		targets[m.Target.podName]++
+	}
+	if len(moves) != 3 || targets["svc-3"] != 2 || targets["svc-2"] != 1 {
+		t.Fatalf("moves to %v, want 2 to svc-3 and 1 to svc-2", targets)
+	}
+	if len(limited) != 1 {
+		t.Errorf("%d moves with fraction 0.1 of 7 streams, want 1", len(limited))
+	}
+	if moves[0].Stream.Started.After(moves[1].Stream.Started) {
+		t.Error("newer stream moved first, want the oldest")
+	}
+}
@@ -0,0 +1,65 @@
+package kubegrpc
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// WithDeterministicSubset - Connects each client to a subset of size pods chosen with the deterministic subsetting
+// algorithm of the Google SRE book: clients with consecutive IDs get disjoint subsets of a shuffled pod list, and every
+// round of clients a new shuffle, so with thousands of pods the connections per pod stay balanced across the fleet.
+// clientID identifies the client; a negative ID is taken from the hostname, the ordinal of a StatefulSet pod
+// (`name-3`) or else a hash, which only balances statistically. Pods outside of the subset are connected when subset
+// pods can not be. Takes precedence over the subset key of WithMaxConnections.
+func WithDeterministicSubset(size, clientID int) PoolOption {
+	return func(c *poolConfig) {
+		c.subsetSize = size
+		c.clientID = clientID
+	}
+}
+
+// subsetClientID - The client ID of the hostname: the trailing ordinal, or else a hash
+func subsetClientID() int {
+	hostname, _ := os.Hostname()
+	if i := strings.LastIndex(hostname, "-"); i >= 0 {
+		if ordinal, err := strconv.Atoi(hostname[i+1:]); err == nil && ordinal >= 0 {
+			return ordinal
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	return int(h.Sum32() & 0x7fffffff)
+}
+
+// subsetPods - Orders the pods with the subset of the client first, followed by the other pods as fallback
+func subsetPods(pods []corev1.Pod, size, clientID int) []corev1.Pod {
+	if clientID < 0 {
+		clientID = subsetClientID()
+	}
+	ordered := make([]corev1.Pod, len(pods))
+	copy(ordered, pods)
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Name != ordered[j].Name {
+			return ordered[i].Name < ordered[j].Name
+		}
+		return ordered[i].Status.PodIP < ordered[j].Status.PodIP
+	})
+	if size <= 0 || len(ordered) < size {
+		return ordered
+	}
+	subsetCount := len(ordered) / size
+	round := clientID / subsetCount
+	r := rand.New(rand.NewSource(int64(round)))
+	r.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	start := (clientID % subsetCount) * size
+	subset := make([]corev1.Pod, 0, len(ordered))
+	subset = append(subset, ordered[start:start+size]...)
+	subset = append(subset, ordered[:start]...)
+	return append(subset, ordered[start+size:]...)
+}
@@ -0,0 +1,65 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// subsetTestPods - n pods named svc-0..svc-n-1, in reverse order
+func subsetTestPods(n int) []corev1.Pod {
+	pods := make([]corev1.Pod, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		pods = append(pods, *testPod(fmt.Sprintf("svc-%d", i), "ns", "svc", fmt.Sprintf("10.0.%d.%d", i/256, i%256)))
+	}
+	return pods
+}
+
+func TestSubsetPodsBalanced(t *testing.T) {
+	pods := subsetTestPods(100)
+	connections := make(map[string]int)
+	for client := 0; client < 100; client++ {
+		ordered := subsetPods(pods, 10, client)
+		if len(ordered) != len(pods) {
+			t.Fatalf("client %d: %d pods, want all as fallback", client, len(ordered))
+		}
+		for _, pod := range ordered[:10] {
+			connections[pod.Name]++
+		}
+	}
+	for _, pod := range pods {
+		if n := connections[pod.Name]; n != 10 {
+			t.Errorf("%s in %d subsets, want 10", pod.Name, n)
+		}
+	}
+}
+
+func TestSubsetPodsDeterministic(t *testing.T) {
+	pods := subsetTestPods(30)
+	first := subsetPods(pods, 5, 7)
+	reversed := make([]corev1.Pod, len(pods))
+	for i := range pods {
+		reversed[len(pods)-1-i] = pods[i]
+	}
+	second := subsetPods(reversed, 5, 7)
+	for i := 0; i < 5; i++ {
+		if first[i].Name != second[i].Name {
+			t.Fatalf("subset depends on the order of the pods: %s != %s", first[i].Name, second[i].Name)
+		}
+	}
+	if other := subsetPods(pods, 5, 8); other[0].Name == first[0].Name {
+		t.Error("clients 7 and 8 share a subset")
+	}
+	if few := subsetPods(pods[:3], 5, 7); len(few) != 3 {
+		t.Errorf("%d pods for fewer pods than the subset size, want all 3", len(few))
+	}
+}
+
+func TestDeterministicSubsetLimit(t *testing.T) {
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithDeterministicSubset(3, 0),
+		WithConnectionsPerEndpoint(2)}))
+	if limit := c.maxConnections(); limit != 6 {
+		t.Errorf("maxConnections() = %d, want 6", limit)
+	}
+}
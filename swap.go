@@ -0,0 +1,131 @@
+package kubegrpc
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// poolSnapshot - Immutable endpoint set of a pool, published by every swap for the picks without locking
+type poolSnapshot struct {
+	conns   []*GrpcConnection
+	version uint64
+	closed  bool
+}
+
+// publishedPools - Copy of connectionCache (map[string]*connection) for the picks without locking, republished by
+// setPool and removePool
+var publishedPools atomic.Value
+
+// swapConnections - Replaces the endpoint set of the pool in one step and returns the new snapshot version. Endpoint
+// sets are never modified in place: slices handed out by Pool and ListPool stay consistent snapshots, and the set is
+// published for the picks without locking (see fastPick).
+// Caller must hold mutex.
+func (c *connection) swapConnections(next []*GrpcConnection) uint64 {
+	c.grpcConnection = next
+	c.nConnections = len(next)
+	version := atomic.AddUint64(&c.version, 1)
+	c.snapshot.Store(&poolSnapshot{conns: next, version: version, closed: c.closed})
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+	return version
+}
+
+// loadSnapshot - The published endpoint set of the pool, nil before the first swap
+func (c *connection) loadSnapshot() *poolSnapshot {
+	s, _ := c.snapshot.Load().(*poolSnapshot)
+	return s
+}
+
+// setPool - Adds the pool of the service to the cache. Caller must hold mutex.
+func setPool(serviceName string, c *connection) {
+	connectionCache[serviceName] = c
+	publishPools()
+}
+
+// removePool - Removes the pool of the service from the cache. Caller must hold mutex.
+func removePool(serviceName string) {
+	delete(connectionCache, serviceName)
+	publishPools()
+}
+
+// publishPools - Publishes a copy of the cache for the picks without locking. Caller must hold mutex.
+func publishPools() {
+	pools := make(map[string]*connection, len(connectionCache))
+	for serviceName, c := range connectionCache {
+		pools[serviceName] = c
+	}
+	publishedPools.Store(pools)
+}
+
+// publishedPool - The pool of the service as last published, without locking
+func publishedPool(serviceName string) *connection {
+	pools, _ := publishedPools.Load().(map[string]*connection)
+	return pools[serviceName]
+}
+
+// fastPick - Picks a connection of the published endpoint set of the pool without locking, so picks do not contend
+// with the health checks and refreshes holding mutex. Returns nil when the pick needs the locked path: no pool or no
+// connections, bypass, failover or no connection to the leader.
+func fastPick(serviceName string) ([]*GrpcConnection, *GrpcConnection) {
+	if bypassedFor(serviceName) {
+		return nil, nil
+	}
+	c := publishedPool(serviceName)
+	if c == nil || c.config.failoverService != "" {
+		return nil, nil
+	}
+	s := c.loadSnapshot()
+	if s == nil || s.closed || len(s.conns) == 0 || len(leaderConnections(c, s.conns)) == 0 {
+		return nil, nil
+	}
+	gc := pickConnection(serviceName, s.conns)
+	atomic.AddUint64(&gc.picks, 1)
+	return s.conns, gc
+}
+
+// snapshotVersion - Version of the endpoint set of the pool, incremented by every change. 0 for a nil pool.
+func (c *connection) snapshotVersion() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.version)
+}
+
+// validSnapshot - Drops nil and duplicate connections from a new endpoint set before it is swapped in
+func validSnapshot(conns []*GrpcConnection) []*GrpcConnection {
+	seen := make(map[*GrpcConnection]bool, len(conns))
+	valid := conns[:0:0]
+	for _, gc := range conns {
+		if gc == nil || seen[gc] {
+			log.Printf("WARNING: validSnapshot(): Dropped invalid entry %v from endpoint set", gc)
+			continue
+		}
+		seen[gc] = true
+		valid = append(valid, gc)
+	}
+	return valid
+}
+
+// withoutConnection - Copy of the endpoint set without the connection
+func withoutConnection(conns []*GrpcConnection, gc *GrpcConnection) []*GrpcConnection {
+	next := make([]*GrpcConnection, 0, len(conns))
+	for _, v := range conns {
+		if v != gc {
+			next = append(next, v)
+		}
+	}
+	return next
+}
+
+// startDrains - Marks the connections as draining and drains them in the background. Caller must hold mutex, so the
+// marks become visible together with the swap of the endpoint set.
+func startDrains(conns []*GrpcConnection, timeout time.Duration) {
+	for _, gc := range conns {
+		if startDrain(gc) {
+			go finishDrain(gc, timeout)
+		}
+	}
+}
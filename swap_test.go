@@ -0,0 +1,109 @@
+package kubegrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidSnapshot(t *testing.T) {
+	a, b := &GrpcConnection{podName: "a"}, &GrpcConnection{podName: "b"}
+	got := validSnapshot([]*GrpcConnection{a, nil, b, a})
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("validSnapshot() = %v, want a and b", got)
+	}
+}
+
+func TestRefreshSwapsSnapshot(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"),
+		testPod("svc-0", "ns", "svc", "10.0.0.1"), testPod("svc-1", "ns", "svc", "10.0.0.2"))
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithDrainTimeout(time.Minute)}))
+	cachePool(t, c)
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := Stats("svc.ns:1000")
+	if stats.Version != 1 || len(stats.Endpoints) != 2 {
+		t.Fatalf("Stats() = version %d with %d endpoints, want version 1 with 2", stats.Version, len(stats.Endpoints))
+	}
+	old := ListPool("svc.ns:1000")
+	first := old[0]
+	// Hold the drain of the replaced pod until the end of the test
+	atomic.AddInt64(&first.inFlight, 1)
+	defer atomic.AddInt64(&first.inFlight, -1)
+
+	k8s, _ := getClientset()
+	pods := k8s.CoreV1().Pods("ns")
+	pod, _ := pods.Get(context.Background(), first.podName, metav1.GetOptions{})
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+	pods.Update(context.Background(), pod, metav1.UpdateOptions{})
+	pods.Create(context.Background(), testPod("svc-2", "ns", "svc", "10.0.0.3"), metav1.CreateOptions{})
+	events := Subscribe("svc.ns:1000")
+	defer Unsubscribe("svc.ns:1000", events)
+	if err := updateConnectionPool("svc.ns:1000", c, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(old) != 2 || old[0] != first {
+		t.Errorf("previous snapshot modified: %v", old)
+	}
+	stats, _ = Stats("svc.ns:1000")
+	if stats.Version != 2 || len(stats.Endpoints) != 3 {
+		t.Errorf("Stats() = version %d with %d endpoints, want a single swap to version 2 with 3", stats.Version,
+			len(stats.Endpoints))
+	}
+	seen := map[PoolEventType]uint64{}
+	for len(seen) < 2 {
+		select {
+		case e := <-events:
+			seen[e.Type] = e.Version
+		case <-time.After(time.Second):
+			t.Fatalf("events = %v, want EndpointAdded and EndpointDraining", seen)
+		}
+	}
+	if seen[EndpointAdded] != 2 || seen[EndpointDraining] != 2 {
+		t.Errorf("event versions = %v, want 2", seen)
+	}
+}
+
+func TestPickWithoutLock(t *testing.T) {
+	p := testPool(t, 2)
+	cachePool(t, p)
+	mutex.Lock()
+	p.swapConnections(p.grpcConnection)
+	mutex.Unlock()
+
+	// A health check or refresh holding the lock does not block the picks
+	func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		picked := make(chan error, 2)
+		go func() {
+			_, err := PickConnection("svc.ns:1000")
+			picked <- err
+			_, _, err = PoolWithOptions("svc.ns:1000", okBalancer{})
+			picked <- err
+		}()
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-picked:
+				if err != nil {
+					t.Error(err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("pick blocked by the lock")
+			}
+		}
+	}()
+
+	mutex.Lock()
+	closePool("svc.ns:1000", p)
+	mutex.Unlock()
+	if _, err := PickConnection("svc.ns:1000"); err != ErrPoolNotFound {
+		t.Errorf("PickConnection() after close = %v, want ErrPoolNotFound", err)
+	}
+}
@@ -0,0 +1,112 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConnectPod - Connect to a single pod of the service rather than a random member, eg `es-data-2` of a StatefulSet.
+// service is the service name with an optional port and cluster (`es-data`, `es-data:9200` or `es-data:9200@dr`, see
+// AddCluster), an empty namespace is the namespace of the pod (see SetDefaultNamespace). The connection lives in its
+// own pool, keyed `service[.namespace][:port]/pod[@cluster]`, with the same health checks, backoff and events as
+// service pools; the pool is empty while the pod is down. The key can also be passed to Pool, Stats, ClosePool and the
+// other functions.
+func ConnectPod(service, namespace, podName string, f GrpcKubeBalancer, opts ...PoolOption) (interface{}, error) {
+	if podName == "" {
+		return nil, fmt.Errorf("%w: empty pod name", ErrInvalidServiceName)
+	}
+	return ConnectWithOptions(podKey(service, namespace, podName), f, opts...)
+}
+
+// ConnectOrdinal - ConnectPod to the pod with the ordinal of the StatefulSet behind the service. The StatefulSet is
+// found from the owner of the pods of the service; returns ErrNoHealthyEndpoints if the service has no StatefulSet pods
+// and ErrInvalidServiceName if they belong to more than one StatefulSet.
+func ConnectOrdinal(service, namespace string, ordinal int, f GrpcKubeBalancer, opts ...PoolOption) (interface{}, error) {
+	if ordinal < 0 {
+		return nil, fmt.Errorf("%w: negative ordinal %d", ErrInvalidServiceName, ordinal)
+	}
+	if namespace == "" {
+		namespace = defaultNamespace()
+	}
+	host, cluster := splitCluster(service)
+	serviceName := clusterServiceName(strings.SplitN(host, ":", 2)[0]+"."+namespace, cluster)
+	k8s, err := clientsetFor(serviceName)
+	if errors.Is(err, ErrUnknownCluster) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	svc, _, err := getService(serviceName, k8s.CoreV1())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := getPodsForSvc(svc, namespace, k8s.CoreV1())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesUnavailable, err)
+	}
+	statefulSet, err := statefulSetName(pods.Items)
+	if err != nil {
+		return nil, err
+	}
+	return ConnectPod(service, namespace, statefulSet+"-"+strconv.Itoa(ordinal), f, opts...)
+}
+
+// podKey - Pool key of a pod target
+func podKey(service, namespace, podName string) string {
+	service, cluster := splitCluster(service)
+	hostPort := strings.SplitN(service, ":", 2)
+	key := hostPort[0]
+	if namespace != "" {
+		key += "." + namespace
+	}
+	if len(hostPort) == 2 {
+		key += ":" + hostPort[1]
+	}
+	return clusterServiceName(key+"/"+podName, cluster)
+}
+
+// podTarget - The pod name of a pod target pool key, empty for service pools
+func podTarget(serviceName string) string {
+	serviceName, _ = splitSubset(serviceName)
+	serviceName, _ = splitCluster(serviceName)
+	if i := strings.Index(serviceName, "/"); i >= 0 {
+		return serviceName[i+1:]
+	}
+	return ""
+}
+
+// namedPods - The pods with the name (at most one)
+func namedPods(pods []corev1.Pod, name string) []corev1.Pod {
+	named := make([]corev1.Pod, 0, 1)
+	for _, pod := range pods {
+		if pod.Name == name {
+			named = append(named, pod)
+		}
+	}
+	return named
+}
+
+// statefulSetName - The StatefulSet owning the pods
+func statefulSetName(pods []corev1.Pod) (string, error) {
+	name := ""
+	for _, pod := range pods {
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind != "StatefulSet" {
+				continue
+			}
+			if name != "" && owner.Name != name {
+				return "", fmt.Errorf("%w: pods of StatefulSets %s and %s", ErrInvalidServiceName, name, owner.Name)
+			}
+			name = owner.Name
+		}
+	}
+	if name == "" {
+		return "", fmt.Errorf("%w: no StatefulSet pods", ErrNoHealthyEndpoints)
+	}
+	return name, nil
+}
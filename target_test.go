@@ -0,0 +1,86 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// statefulPod - Pod owned by the StatefulSet
+func statefulPod(statefulSet string, ordinal int, ip string) *corev1.Pod {
+	pod := testPod(fmt.Sprintf("%s-%d", statefulSet, ordinal), "ns", "es", ip)
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: statefulSet}}
+	return pod
+}
+
+func TestPodKey(t *testing.T) {
+	if key := podKey("es:9200", "ns", "es-data-2"); key != "es.ns:9200/es-data-2" {
+		t.Errorf("podKey() = %q", key)
+	}
+	if key := podKey("es:9200@dr", "ns", "es-data-2"); key != "es.ns:9200/es-data-2@dr" ||
+		podTarget(key) != "es-data-2" {
+		t.Errorf("podKey() of a remote cluster = %q", key)
+	}
+	name, namespace, port, err := parseServiceName("es.ns:9200/es-data-2")
+	if err != nil || name != "es" || namespace != "ns" || port != "9200" || podTarget("es.ns:9200/es-data-2") != "es-data-2" {
+		t.Errorf("parseServiceName() = %q, %q, %q, %v", name, namespace, port, err)
+	}
+	if _, _, _, err := parseServiceName("es.ns:9200/"); !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("parseServiceName() with empty pod error = %v, want ErrInvalidServiceName", err)
+	}
+}
+
+func TestConnectPod(t *testing.T) {
+	useFakeClientset(t, testService("es", "ns"), statefulPod("es-data", 0, "10.0.0.1"),
+		statefulPod("es-data", 1, "10.0.0.2"), statefulPod("es-data", 2, "10.0.0.3"))
+	const key = "es.ns:9200/es-data-2"
+	defer ClosePool(key)
+	if _, err := ConnectPod("es:9200", "ns", "es-data-2", okBalancer{}); err != nil {
+		t.Fatalf("ConnectPod() error = %v", err)
+	}
+	conns := Connections(key)
+	if len(conns) != 1 || conns[0].podName != "es-data-2" {
+		t.Errorf("pool = %v, want only es-data-2", conns)
+	}
+}
+
+func TestConnectOrdinal(t *testing.T) {
+	useFakeClientset(t, testService("es", "ns"), statefulPod("es-data", 0, "10.0.0.1"), statefulPod("es-data", 1, "10.0.0.2"))
+	const key = "es.ns:9200/es-data-1"
+	defer ClosePool(key)
+	if _, err := ConnectOrdinal("es:9200", "ns", 1, okBalancer{}); err != nil {
+		t.Fatalf("ConnectOrdinal() error = %v", err)
+	}
+	if conns := Connections(key); len(conns) != 1 || conns[0].connectionIP != "10.0.0.2" {
+		t.Errorf("pool = %v, want es-data-1", conns)
+	}
+}
+
+func TestConnectOrdinalCluster(t *testing.T) {
+	useFakeClientset(t, testService("es", "ns"), statefulPod("es-local", 1, "10.0.0.2"))
+	addFakeCluster(t, "dr", testService("es", "ns"), statefulPod("es-data", 1, "10.1.0.2"))
+	const key = "es.ns:9200/es-data-1@dr"
+	defer ClosePool(key)
+	if _, err := ConnectOrdinal("es:9200@dr", "ns", 1, okBalancer{}); err != nil {
+		t.Fatalf("ConnectOrdinal() error = %v", err)
+	}
+	if conns := Connections(key); len(conns) != 1 || conns[0].connectionIP != "10.1.0.2" {
+		t.Errorf("pool = %v, want es-data-1 of the remote cluster", conns)
+	}
+	if _, err := ConnectOrdinal("es:9200@gone", "ns", 1, okBalancer{}); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("ConnectOrdinal() error = %v, want ErrUnknownCluster", err)
+	}
+}
+
+func TestStatefulSetName(t *testing.T) {
+	if _, err := statefulSetName([]corev1.Pod{*testPod("web-abc", "ns", "web", "10.0.0.1")}); !errors.Is(err, ErrNoHealthyEndpoints) {
+		t.Errorf("statefulSetName() without StatefulSet error = %v, want ErrNoHealthyEndpoints", err)
+	}
+	pods := []corev1.Pod{*statefulPod("a", 0, "10.0.0.1"), *statefulPod("b", 0, "10.0.0.2")}
+	if _, err := statefulSetName(pods); !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("statefulSetName() with two StatefulSets error = %v, want ErrInvalidServiceName", err)
+	}
+}
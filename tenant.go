@@ -0,0 +1,71 @@
+package kubegrpc
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ConnectSubset - Connect to the pods of the service which have all the labels of the selector, eg
+// `{"tenant": "acme"}` for the pods of one tenant. Every selector gets its own pool, keyed
+// `service[.namespace][:port]?label=value[,label=value]` with the labels sorted, with its own connections, picks,
+// health checks and statistics. The subset pools of a service share its discoveries, so many tenants cost the k8s API
+// no more than one pool; they should therefore be created with the same discovery options. An empty namespace is the
+// namespace of the pod (see SetDefaultNamespace). The key can also be passed to Pool, Stats, ClosePool and the other
+// functions.
+func ConnectSubset(service, namespace string, selector map[string]string, f GrpcKubeBalancer,
+	opts ...PoolOption) (interface{}, error) {
+	key, err := subsetKey(service, namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	return ConnectWithOptions(key, f, opts...)
+}
+
+// subsetKey - Pool key of a subset pool
+func subsetKey(service, namespace string, selector map[string]string) (string, error) {
+	if len(selector) == 0 {
+		return "", fmt.Errorf("%w: empty subset selector", ErrInvalidServiceName)
+	}
+	for label, value := range selector {
+		if errs := validation.IsQualifiedName(label); len(errs) > 0 {
+			return "", fmt.Errorf("%w: subset label %q: %s", ErrInvalidServiceName, label, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return "", fmt.Errorf("%w: subset value %q: %s", ErrInvalidServiceName, value, strings.Join(errs, ", "))
+		}
+	}
+	hostPort := strings.SplitN(service, ":", 2)
+	key := hostPort[0]
+	if namespace != "" {
+		key += "." + namespace
+	}
+	if len(hostPort) == 2 {
+		key += ":" + hostPort[1]
+	}
+	return key + "?" + labels.Set(selector).String(), nil
+}
+
+// splitSubset - The service name without the selector of a subset pool, and the selector, empty for other pools
+func splitSubset(serviceName string) (string, string) {
+	serviceName, cluster := splitCluster(serviceName)
+	if i := strings.Index(serviceName, "?"); i >= 0 {
+		return clusterServiceName(serviceName[:i], cluster), serviceName[i+1:]
+	}
+	return clusterServiceName(serviceName, cluster), ""
+}
+
+// subsetSelector - The labels of a subset pool key, nil for other pools or an invalid selector
+func subsetSelector(serviceName string) map[string]string {
+	_, selector := splitSubset(serviceName)
+	if selector == "" {
+		return nil
+	}
+	set, err := labels.ConvertSelectorToLabelsMap(selector)
+	if err != nil {
+		return nil
+	}
+	return set
+}
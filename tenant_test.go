@@ -0,0 +1,63 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// tenantPod - Pod of the service es labeled with the tenant
+func tenantPod(name, tenant, ip string) *corev1.Pod {
+	pod := testPod(name, "ns", "es", ip)
+	pod.Labels["tenant"] = tenant
+	return pod
+}
+
+func TestSubsetKey(t *testing.T) {
+	key, err := subsetKey("es:9200", "ns", map[string]string{"zone": "a", "tenant": "acme"})
+	if err != nil || key != "es.ns:9200?tenant=acme,zone=a" {
+		t.Errorf("subsetKey() = %q, %v", key, err)
+	}
+	name, namespace, port, err := parseServiceName(key)
+	if err != nil || name != "es" || namespace != "ns" || port != "9200" || podTarget(key) != "" {
+		t.Errorf("parseServiceName() = %q, %q, %q, %v", name, namespace, port, err)
+	}
+	if selector := subsetSelector(key + "@east"); selector["tenant"] != "acme" || selector["zone"] != "a" {
+		t.Errorf("subsetSelector() = %v", selector)
+	}
+	for _, invalid := range []map[string]string{nil, {"tenant": "a,b"}, {"": "acme"}} {
+		if _, err := ConnectSubset("es:9200", "ns", invalid, okBalancer{}); !errors.Is(err, ErrInvalidServiceName) {
+			t.Errorf("ConnectSubset(%v) error = %v, want ErrInvalidServiceName", invalid, err)
+		}
+	}
+	if _, _, _, err := parseServiceName("es.ns:9200?"); !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("parseServiceName() with empty selector error = %v, want ErrInvalidServiceName", err)
+	}
+}
+
+func TestConnectSubset(t *testing.T) {
+	useFakeClientset(t, testService("es", "ns"), tenantPod("es-0", "acme", "10.0.0.1"),
+		tenantPod("es-1", "acme", "10.0.0.2"), tenantPod("es-2", "globex", "10.0.0.3"))
+	const acme, globex = "es.ns:9200?tenant=acme", "es.ns:9200?tenant=globex"
+	defer ClosePool(acme)
+	defer ClosePool(globex)
+	for _, tenant := range []string{"acme", "globex"} {
+		if _, err := ConnectSubset("es:9200", "ns", map[string]string{"tenant": tenant}, okBalancer{}); err != nil {
+			t.Fatalf("ConnectSubset(%s) error = %v", tenant, err)
+		}
+	}
+	if got := targets(Connections(acme)); len(got) != 2 || got[0] != "10.0.0.1:9200" || got[1] != "10.0.0.2:9200" {
+		t.Errorf("acme pool = %v, want es-0 and es-1", got)
+	}
+	if got := targets(Connections(globex)); len(got) != 1 || got[0] != "10.0.0.3:9200" {
+		t.Errorf("globex pool = %v, want es-2", got)
+	}
+	apiLimitMutex.Lock()
+	_, shared := discoveries["es.ns:9200"]
+	_, own := discoveries[acme]
+	apiLimitMutex.Unlock()
+	if !shared || own {
+		t.Errorf("discoveries of the subsets shared = %v, own = %v, want shared with the service", shared, own)
+	}
+}
@@ -0,0 +1,49 @@
+package kubegrpc
+
+import (
+	"strconv"
+
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// tlsAnnotation - Pod annotation stating whether the pod serves TLS ("true") or plaintext ("false"). As service
+// annotation, "true" dials all pods of the service with TLS, see parseServiceConfig.
+const tlsAnnotation = "kube-grpc/tls"
+
+// tlsPortNames - Container port names of TLS ports, in order of preference
+var tlsPortNames = []string{"grpc-tls", "grpcs"}
+
+// WithTLSMigration - Lets the pool hold a mix of plaintext and TLS endpoints during a backend TLS roll out, so clients
+// and servers do not need a flag day. Per pod, TLS (with creds) is used when the pod is annotated `kube-grpc/tls: "true"`,
+// or without annotation when the dialed port is a containerPort named `grpc-tls` or `grpcs`. Without a port in the
+// service name a TLS port is preferred over the `grpc` port. All other pods are dialed in plaintext.
+func WithTLSMigration(creds credentials.TransportCredentials) PoolOption {
+	return func(c *poolConfig) {
+		c.tlsCredentials = creds
+	}
+}
+
+// dialTarget - Returns the port to dial on the pod and whether to use TLS. Without migration everything is plaintext.
+func dialTarget(explicit string, pod *corev1.Pod, migration bool) (port string, useTLS bool, err error) {
+	if !migration {
+		port, err = podPort(explicit, pod)
+		return port, false, err
+	}
+	if v, annotated := pod.Annotations[tlsAnnotation]; annotated {
+		useTLS, _ = strconv.ParseBool(v)
+		if useTLS && explicit == "" {
+			if p, ok := namedContainerPort(pod, tlsPortNames...); ok {
+				return strconv.Itoa(int(p)), true, nil
+			}
+		}
+		port, err = podPort(explicit, pod)
+		return port, useTLS, err
+	}
+	tlsPort, hasTLSPort := namedContainerPort(pod, tlsPortNames...)
+	if explicit == "" && hasTLSPort {
+		return strconv.Itoa(int(tlsPort)), true, nil
+	}
+	port, err = podPort(explicit, pod)
+	return port, hasTLSPort && port == strconv.Itoa(int(tlsPort)), err
+}
@@ -0,0 +1,58 @@
+package kubegrpc
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func annotated(pod *corev1.Pod, value string) *corev1.Pod {
+	pod.Annotations = map[string]string{tlsAnnotation: value}
+	return pod
+}
+
+func TestDialTarget(t *testing.T) {
+	plain := corev1.ContainerPort{Name: "grpc", ContainerPort: 9000}
+	secure := corev1.ContainerPort{Name: "grpc-tls", ContainerPort: 9443}
+	for _, tc := range []struct {
+		name      string
+		explicit  string
+		pod       *corev1.Pod
+		migration bool
+		port      string
+		tls       bool
+	}{
+		{"no migration", "", podWithPorts(plain, secure), false, "9000", false},
+		{"tls port preferred", "", podWithPorts(plain, secure), true, "9443", true},
+		{"plaintext pod", "", podWithPorts(plain), true, "9000", false},
+		{"explicit tls port", "9443", podWithPorts(plain, secure), true, "9443", true},
+		{"explicit plain port", "9000", podWithPorts(plain, secure), true, "9000", false},
+		{"annotated tls on grpc port", "", annotated(podWithPorts(plain), "true"), true, "9000", true},
+		{"annotated plaintext", "", annotated(podWithPorts(plain, secure), "false"), true, "9000", false},
+		{"annotated tls explicit", "1000", annotated(podWithPorts(), "true"), true, "1000", true},
+	} {
+		port, useTLS, err := dialTarget(tc.explicit, tc.pod, tc.migration)
+		if err != nil || port != tc.port || useTLS != tc.tls {
+			t.Errorf("%s: dialTarget() = %q, %v, %v, want %q, %v", tc.name, port, useTLS, err, tc.port, tc.tls)
+		}
+	}
+}
+
+func TestTLSMigrationMixedPool(t *testing.T) {
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithTLSMigration(credentials.NewTLS(&tls.Config{}))}))
+	secure, err := newGrpcConnection("svc.ns:1000", p, annotated(testPod("svc-1", "ns", "svc", "10.0.0.1"), "true"), "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secure.conn.Close()
+	plain, err := newGrpcConnection("svc.ns:1000", p, testPod("svc-2", "ns", "svc", "10.0.0.2"), "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.conn.Close()
+	if !secure.Info().TLS || plain.Info().TLS {
+		t.Errorf("TLS = %v, %v, want true for the annotated pod only", secure.Info().TLS, plain.Info().TLS)
+	}
+}
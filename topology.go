@@ -0,0 +1,133 @@
+package kubegrpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// nodeZoneTTL - Zones of the nodes no pod was discovered on for this long are forgotten, eg of scaled down nodes
+const nodeZoneTTL = time.Hour
+
+// nodeZone - The zone of a node, "" for nodes without zone or which can not be read, and its last use
+type nodeZone struct {
+	zone string
+	used time.Time
+}
+
+var (
+	// nodeZones - Zone per cluster and node name. Nodes do not change their zone, so the entries are kept until they
+	// are no longer used, see nodeZoneTTL. Protected by nodeZonesMutex.
+	nodeZones      = make(map[string]nodeZone)
+	nodeZonesMutex = &sync.Mutex{}
+)
+
+// endpointZone - The zone of the topology labels, empty if unknown
+func endpointZone(labels map[string]string) string {
+	if zone := labels[corev1.LabelZoneFailureDomainStable]; zone != "" {
+		return zone
+	}
+	return labels[corev1.LabelZoneFailureDomain]
+}
+
+// nodeZoneKey - Key of the node of the pod in nodeZones
+func nodeZoneKey(serviceName string, pod *corev1.Pod) string {
+	_, cluster := splitCluster(serviceName)
+	return cluster + "/" + pod.Spec.NodeName
+}
+
+// resolveZones - Looks up the zones of the nodes of the pods without zone labels which are not known yet, within the
+// limits of the k8s API calls (see SetAPIRateLimit), and forgets the zones of the nodes no longer used. Makes API
+// calls, do not hold mutex; the connections read the zones with podZone.
+func resolveZones(serviceName string, pods []corev1.Pod) {
+	now := time.Now()
+	lookups := make(map[string]*corev1.Pod)
+	nodeZonesMutex.Lock()
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" || endpointZone(pod.Labels) != "" {
+			continue
+		}
+		key := nodeZoneKey(serviceName, pod)
+		if z, known := nodeZones[key]; known {
+			nodeZones[key] = nodeZone{zone: z.zone, used: now}
+		} else {
+			lookups[key] = pod
+		}
+	}
+	for key, z := range nodeZones {
+		if now.Sub(z.used) > nodeZoneTTL {
+			delete(nodeZones, key)
+		}
+	}
+	nodeZonesMutex.Unlock()
+	if len(lookups) == 0 {
+		return
+	}
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		return
+	}
+	for key, pod := range lookups {
+		zone, ok := nodeZoneOf(serviceName, k8s.CoreV1(), pod)
+		if !ok {
+			continue
+		}
+		nodeZonesMutex.Lock()
+		nodeZones[key] = nodeZone{zone: zone, used: now}
+		nodeZonesMutex.Unlock()
+	}
+}
+
+// nodeZoneOf - The zone of the node of the pod, false if it could not be read and should be looked up again
+func nodeZoneOf(serviceName string, k8s typev1.CoreV1Interface, pod *corev1.Pod) (string, bool) {
+	acceptAPICall()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPingTimeout)
+	defer cancel()
+	node, err := k8s.Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return endpointZone(node.Labels), true
+	case apierrors.IsForbidden(err):
+		log.Printf("WARNING: resolveZones(): Zone of the pods of %s unknown, the service account may not get nodes",
+			serviceName)
+		return "", true
+	case apierrors.IsNotFound(err):
+		return "", true
+	}
+	log.Printf("WARNING: resolveZones(): Can not get node %s of pod %s. Error: %v", pod.Spec.NodeName, pod.Name, err)
+	return "", false
+}
+
+// podZone - The zone of the pod: of its own topology labels, else of the node it runs on as resolved by
+// resolveZones. Empty if unknown, eg when the service account may not get nodes.
+func podZone(serviceName string, pod *corev1.Pod) string {
+	if zone := endpointZone(pod.Labels); zone != "" || pod.Spec.NodeName == "" {
+		return zone
+	}
+	nodeZonesMutex.Lock()
+	defer nodeZonesMutex.Unlock()
+	return nodeZones[nodeZoneKey(serviceName, pod)].zone
+}
+
+// describe - The endpoint for humans: pod name, ip and the node and zone if known. IPs alone mean little once the
+// pods were replaced.
+func (c *GrpcConnection) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s at ip %s", c.podName, c.connectionIP)
+	if c.nodeName != "" {
+		fmt.Fprintf(&b, " on %s", c.nodeName)
+	}
+	if c.zone != "" {
+		fmt.Fprintf(&b, " in %s", c.zone)
+	}
+	return b.String()
+}
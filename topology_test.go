@@ -0,0 +1,68 @@
+package kubegrpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodZone(t *testing.T) {
+	useFakeClientset(t, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-zoned",
+		Labels: map[string]string{corev1.LabelZoneFailureDomainStable: "zone-b"}}})
+	pod := testPod("svc-1", "ns", "svc", "10.0.0.1")
+	pod.Spec.NodeName = "node-zoned"
+	gone := testPod("svc-2", "ns", "svc", "10.0.0.2")
+	gone.Spec.NodeName = "node-gone"
+	if zone := podZone("svc.ns:1000", pod); zone != "" {
+		t.Errorf("podZone() before resolveZones() = %q, want unknown", zone)
+	}
+	resolveZones("svc.ns:1000", []corev1.Pod{*pod, *gone})
+	if zone := podZone("svc.ns:1000", pod); zone != "zone-b" {
+		t.Errorf("podZone() = %q, want the zone of the node", zone)
+	}
+	if zone := podZone("svc.ns:1000", gone); zone != "" {
+		t.Errorf("podZone() on a missing node = %q, want unknown", zone)
+	}
+	pod.Labels[corev1.LabelZoneFailureDomain] = "zone-c"
+	if zone := podZone("svc.ns:1000", pod); zone != "zone-c" {
+		t.Errorf("podZone() = %q, want the zone label of the pod", zone)
+	}
+
+	// The zones of the nodes no longer used are forgotten
+	key := nodeZoneKey("svc.ns:1000", gone)
+	nodeZonesMutex.Lock()
+	nodeZones[key] = nodeZone{zone: "zone-x", used: time.Now().Add(-2 * nodeZoneTTL)}
+	nodeZonesMutex.Unlock()
+	resolveZones("svc.ns:1000", nil)
+	nodeZonesMutex.Lock()
+	_, kept := nodeZones[key]
+	nodeZonesMutex.Unlock()
+	if kept {
+		t.Error("zone of an unused node not pruned")
+	}
+}
+
+func TestEndpointIdentity(t *testing.T) {
+	gc := testPool(t, 1).grpcConnection[0]
+	if got := gc.describe(); got != "svc-1 at ip 10.0.0.1" {
+		t.Errorf("describe() = %q", got)
+	}
+	gc.nodeName, gc.zone = "node-a", "zone-a"
+	if got := gc.describe(); got != "svc-1 at ip 10.0.0.1 on node-a in zone-a" {
+		t.Errorf("describe() = %q", got)
+	}
+
+	if got := gc.metricLabels(map[string]string{"service": "svc"}); !reflect.DeepEqual(got,
+		map[string]string{"service": "svc", "pod": "svc-1"}) {
+		t.Errorf("default metric labels = %v, want the pod", got)
+	}
+	SetEndpointMetricLabels(EndpointLabelZone, "unknown")
+	defer SetEndpointMetricLabels(EndpointLabelPod)
+	if got := gc.metricLabels(map[string]string{"service": "svc"}); !reflect.DeepEqual(got,
+		map[string]string{"service": "svc", "zone": "zone-a"}) {
+		t.Errorf("metric labels = %v, want the zone only", got)
+	}
+}
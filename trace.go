@@ -0,0 +1,113 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// ErrInvalidSamplingRate - The sampling rate is not within [0,1]
+var ErrInvalidSamplingRate = errors.New("kubegrpc: invalid sampling rate")
+
+// Tracer - Receives the sampled calls of the pools, eg to forward them to OpenTelemetry or Jaeger. StartSpan is called
+// before every sampled attempt on an endpoint (retries and hedges are separate attempts); the returned context is
+// passed to the call, so the tracer can propagate the span in the metadata, and finish is called with the result.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	StartSpan(ctx context.Context, method string, endpoint EndpointInfo) (spanCtx context.Context, finish func(err error))
+}
+
+// traceSampling - Tracer and sampling rates: default, per pool and per pod of a pool
+type traceSampling struct {
+	tracer      Tracer
+	defaultRate float64
+	pools       map[string]float64
+	endpoints   map[string]map[string]float64 // By service name, pod name
+}
+
+var (
+	sampling = traceSampling{
+		pools:     make(map[string]float64),
+		endpoints: make(map[string]map[string]float64),
+	}
+	samplingMutex = &sync.RWMutex{}
+)
+
+// validRate - True if the rate is a sampling probability
+func validRate(rate float64) bool {
+	return !math.IsNaN(rate) && rate >= 0 && rate <= 1
+}
+
+// SetTracer - Sets the tracer and the sampling rate (0-1) applying to all pools without an override. A nil tracer
+// disables tracing.
+func SetTracer(t Tracer, defaultRate float64) error {
+	if !validRate(defaultRate) {
+		return ErrInvalidSamplingRate
+	}
+	samplingMutex.Lock()
+	defer samplingMutex.Unlock()
+	sampling.tracer = t
+	sampling.defaultRate = defaultRate
+	return nil
+}
+
+// SetPoolTraceSampling - Overrides the sampling rate (0-1) of the pool of the service at runtime
+func SetPoolTraceSampling(serviceName string, rate float64) error {
+	if !validRate(rate) {
+		return ErrInvalidSamplingRate
+	}
+	samplingMutex.Lock()
+	defer samplingMutex.Unlock()
+	sampling.pools[serviceName] = rate
+	return nil
+}
+
+// SetEndpointTraceSampling - Overrides the sampling rate (0-1) of the calls to a single pod at runtime, eg 1 to trace
+// every call to a quarantined pod under investigation without raising the sampling of the pool
+func SetEndpointTraceSampling(serviceName, podName string, rate float64) error {
+	if !validRate(rate) {
+		return ErrInvalidSamplingRate
+	}
+	samplingMutex.Lock()
+	defer samplingMutex.Unlock()
+	if sampling.endpoints[serviceName] == nil {
+		sampling.endpoints[serviceName] = make(map[string]float64)
+	}
+	sampling.endpoints[serviceName][podName] = rate
+	return nil
+}
+
+// ClearTraceSampling - Removes the pool and endpoint sampling overrides of the service
+func ClearTraceSampling(serviceName string) {
+	samplingMutex.Lock()
+	defer samplingMutex.Unlock()
+	delete(sampling.pools, serviceName)
+	delete(sampling.endpoints, serviceName)
+}
+
+// samplingRate - The tracer and the rate for the connection: endpoint override, pool override or default
+func (c *GrpcConnection) samplingRate() (Tracer, float64) {
+	samplingMutex.RLock()
+	defer samplingMutex.RUnlock()
+	if sampling.tracer == nil {
+		return nil, 0
+	}
+	if rate, found := sampling.endpoints[c.serviceName][c.podName]; found {
+		return sampling.tracer, rate
+	}
+	if rate, found := sampling.pools[c.serviceName]; found {
+		return sampling.tracer, rate
+	}
+	return sampling.tracer, sampling.defaultRate
+}
+
+// startSpan - Starts a span for the call if it is sampled. finish is never nil.
+func (c *GrpcConnection) startSpan(ctx context.Context, method string) (context.Context, func(err error)) {
+	tracer, rate := c.samplingRate()
+	if tracer == nil || rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return ctx, func(error) {}
+	}
+	return tracer.StartSpan(ctx, method, c.Info())
+}
@@ -0,0 +1,119 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// spanKey - Context key the recordingTracer sets on the span context
+type spanKey struct{}
+
+// recordingTracer - Fake tracer recording the spans per pod
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans map[string]int
+	errs  []error
+}
+
+func (r *recordingTracer) StartSpan(ctx context.Context, method string, endpoint EndpointInfo) (context.Context,
+	func(err error)) {
+	r.mutex.Lock()
+	r.spans[endpoint.PodName]++
+	r.mutex.Unlock()
+	return context.WithValue(ctx, spanKey{}, method), func(err error) {
+		r.mutex.Lock()
+		r.errs = append(r.errs, err)
+		r.mutex.Unlock()
+	}
+}
+
+// useTracer - Installs a recording tracer for the test
+func useTracer(t *testing.T, defaultRate float64) *recordingTracer {
+	r := &recordingTracer{spans: make(map[string]int)}
+	if err := SetTracer(r, defaultRate); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		SetTracer(nil, 0)
+		ClearTraceSampling("svc.ns:1000")
+	})
+	return r
+}
+
+func TestTraceSamplingInvalid(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.1, math.NaN()} {
+		if err := SetTracer(nil, rate); !errors.Is(err, ErrInvalidSamplingRate) {
+			t.Errorf("SetTracer(%v) error = %v, want ErrInvalidSamplingRate", rate, err)
+		}
+		if err := SetPoolTraceSampling("svc.ns:1000", rate); !errors.Is(err, ErrInvalidSamplingRate) {
+			t.Errorf("SetPoolTraceSampling(%v) error = %v, want ErrInvalidSamplingRate", rate, err)
+		}
+		if err := SetEndpointTraceSampling("svc.ns:1000", "svc-1", rate); !errors.Is(err, ErrInvalidSamplingRate) {
+			t.Errorf("SetEndpointTraceSampling(%v) error = %v, want ErrInvalidSamplingRate", rate, err)
+		}
+	}
+}
+
+func TestTraceSamplingOverrides(t *testing.T) {
+	r := useTracer(t, 0)
+	p := testPool(t, 3)
+	inv := &recordingInvoker{answer: func(ctx context.Context, _ string, _ interface{}) error {
+		if ctx.Value(spanKey{}) == nil && r.spans["svc-1"] > 0 {
+			return status.Error(codes.Internal, "span context not passed")
+		}
+		return nil
+	}}
+	call := func() {
+		for _, gc := range p.grpcConnection {
+			gc.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, gc.conn, inv.invoke)
+		}
+	}
+	call()
+	if len(r.spans) != 0 {
+		t.Fatalf("spans with default rate 0 = %v, want none", r.spans)
+	}
+	if err := SetEndpointTraceSampling("svc.ns:1000", "svc-1", 1); err != nil {
+		t.Fatal(err)
+	}
+	call()
+	if r.spans["svc-1"] != 1 || len(r.spans) != 1 {
+		t.Errorf("spans with endpoint override = %v, want svc-1 only", r.spans)
+	}
+	for _, err := range r.errs {
+		if err != nil {
+			t.Errorf("span finished with %v", err)
+		}
+	}
+	if err := SetPoolTraceSampling("svc.ns:1000", 1); err != nil {
+		t.Fatal(err)
+	}
+	SetEndpointTraceSampling("svc.ns:1000", "svc-2", 0)
+	call()
+	if r.spans["svc-1"] != 2 || r.spans["svc-2"] != 0 || r.spans["svc-3"] != 1 {
+		t.Errorf("spans with pool override = %v, want svc-1:2 svc-3:1", r.spans)
+	}
+	ClearTraceSampling("svc.ns:1000")
+	call()
+	if r.spans["svc-1"] != 2 || r.spans["svc-3"] != 1 {
+		t.Errorf("spans after clear = %v, want unchanged", r.spans)
+	}
+}
+
+func TestTraceSamplingRate(t *testing.T) {
+	r := useTracer(t, 0.5)
+	p := testPool(t, 1)
+	gc := p.grpcConnection[0]
+	inv := &recordingInvoker{answer: func(context.Context, string, interface{}) error { return nil }}
+	for i := 0; i < 1000; i++ {
+		gc.unaryInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, gc.conn, inv.invoke)
+	}
+	if n := r.spans["svc-1"]; n < 400 || n > 600 {
+		t.Errorf("spans at rate 0.5 = %d of 1000", n)
+	}
+}
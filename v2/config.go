@@ -0,0 +1,392 @@
+package kubegrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"time"
+
+	v1 "github.com/norbertvannobelen/kube-grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/keepalive"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrInvalidConfig - The pool configuration can not be applied
+var ErrInvalidConfig = errors.New("kubegrpc: invalid config")
+
+// Balancing strategies of a PoolConfig
+const (
+	StrategyRandom        = "random"         // Built in selection, the default
+	StrategyLeastRequests = "least-requests" // Prefers the endpoints with the fewest RPCs in flight
+)
+
+// configPollInterval - Interval in which WatchConfigFile and WatchConfigMap check for changes
+var configPollInterval = 10 * time.Second
+
+// Config - Desired set of pools of a Manager, see ApplyConfig. Loaded from YAML or JSON with ParseConfig, eg:
+//
+//	pools:
+//	- service: orders
+//	  namespace: shop
+//	  port: "10000"
+//	  strategy: least-requests
+//	  refreshInterval: 10s
+//	  healthCheck:
+//	    pingTimeout: 2s
+type Config struct {
+	Pools []PoolConfig `json:"pools"`
+}
+
+// PoolConfig - Configuration of a single pool
+type PoolConfig struct {
+	Name            string            `json:"name,omitempty"` // Name of the pool in the manager, default service.namespace[:port]
+	Service         string            `json:"service"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Port            string            `json:"port,omitempty"`            // Port number or name, eg grpc-admin; default the grpc port
+	Strategy        string            `json:"strategy,omitempty"`        // StrategyRandom, StrategyLeastRequests or a registered picker
+	RefreshInterval Duration          `json:"refreshInterval,omitempty"` // Interval of the re-discovery of the pods, default 1m
+	TLS             *TLSConfig        `json:"tls,omitempty"`
+	HealthCheck     HealthCheckConfig `json:"healthCheck,omitempty"`
+	Keepalive       *KeepaliveConfig  `json:"keepalive,omitempty"`   // Default 5m/20s while RPCs are in progress
+	Compression     string            `json:"compression,omitempty"` // Compressor of the calls, eg gzip
+	Required        bool              `json:"required,omitempty"`    // Required for the readiness, see ReadinessReporter
+}
+
+// KeepaliveConfig - HTTP/2 keepalive of the connections of a pool, see WithKeepalive of the v1 package. A zero time
+// disables the keepalive.
+type KeepaliveConfig struct {
+	Time                Duration `json:"time"`
+	Timeout             Duration `json:"timeout,omitempty"`
+	PermitWithoutStream bool     `json:"permitWithoutStream,omitempty"`
+}
+
+// TLSConfig - TLS of a pool, applied per pod as described for WithTLSMigration of the v1 package
+type TLSConfig struct {
+	CAFile     string `json:"caFile,omitempty"`   // PEM CA bundle, default the system roots
+	CertFile   string `json:"certFile,omitempty"` // PEM client certificate and key, optional
+	KeyFile    string `json:"keyFile,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// HealthCheckConfig - Health check settings of a pool
+type HealthCheckConfig struct {
+	PingTimeout      Duration `json:"pingTimeout,omitempty"`
+	Watch            bool     `json:"watch,omitempty"` // grpc.health.v1 Watch streams instead of pings
+	WatchService     string   `json:"watchService,omitempty"`
+	MinHealthy       int      `json:"minHealthy,omitempty"`
+	OutlierDetection bool     `json:"outlierDetection,omitempty"` // Circuit breaker with the default settings
+}
+
+// Duration - time.Duration written as string in the configuration, eg "2s"
+type Duration time.Duration
+
+// UnmarshalJSON - Parses the duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration %s is not a string", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON - Writes the duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ParseConfig - Parses a YAML or JSON configuration
+func ParseConfig(data []byte) (Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return c, c.validate()
+}
+
+// LoadConfig - Reads and parses a YAML or JSON configuration file
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return ParseConfig(data)
+}
+
+// validate - Checks the pools for missing services, unknown strategies and compressors, and duplicate names
+func (c Config) validate() error {
+	names := make(map[string]bool, len(c.Pools))
+	for _, p := range c.Pools {
+		if p.Service == "" {
+			return fmt.Errorf("%w: pool without service", ErrInvalidConfig)
+		}
+		if p.Strategy != "" && v1.LookupPicker(p.Strategy) == nil {
+			return fmt.Errorf("%w: unknown strategy %q of pool %s", ErrInvalidConfig, p.Strategy, p.name())
+		}
+		if p.Compression != "" && encoding.GetCompressor(p.Compression) == nil {
+			return fmt.Errorf("%w: unknown compressor %q of pool %s", ErrInvalidConfig, p.Compression, p.name())
+		}
+		if names[p.name()] {
+			return fmt.Errorf("%w: duplicate pool %s", ErrInvalidConfig, p.name())
+		}
+		names[p.name()] = true
+	}
+	return nil
+}
+
+// name - Name of the pool in the manager
+func (p PoolConfig) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	name := p.Service
+	if p.Namespace != "" {
+		name += "." + p.Namespace
+	}
+	if p.Port != "" {
+		name += ":" + p.Port
+	}
+	return name
+}
+
+// options - Pool options of the configuration
+func (p PoolConfig) options() ([]Option, error) {
+	opts := make([]Option, 0)
+	if p.TLS != nil {
+		creds, err := p.TLS.credentials()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, v1.WithTLSMigration(creds))
+	}
+	if p.RefreshInterval > 0 {
+		opts = append(opts, v1.WithRefreshInterval(time.Duration(p.RefreshInterval)))
+	}
+	if p.Required {
+		opts = append(opts, v1.WithRequired())
+	}
+	if p.Strategy != "" && p.Strategy != StrategyRandom && p.Strategy != StrategyLeastRequests {
+		// Strategies other than the built in selection are pickers, see RegisterPicker of the v1 package
+		opts = append(opts, v1.WithPicker(p.Strategy))
+	}
+	if p.Compression != "" {
+		opts = append(opts, v1.WithCompression(p.Compression))
+	}
+	if k := p.Keepalive; k != nil {
+		opts = append(opts, v1.WithKeepalive(keepalive.ClientParameters{Time: time.Duration(k.Time),
+			Timeout: time.Duration(k.Timeout), PermitWithoutStream: k.PermitWithoutStream}))
+	}
+	h := p.HealthCheck
+	if h.PingTimeout > 0 {
+		opts = append(opts, v1.WithPingTimeout(time.Duration(h.PingTimeout)))
+	}
+	if h.Watch {
+		opts = append(opts, v1.WithHealthWatch(h.WatchService))
+	}
+	if h.MinHealthy > 0 {
+		opts = append(opts, v1.WithMinHealthy(h.MinHealthy))
+	}
+	if h.OutlierDetection {
+		opts = append(opts, v1.WithOutlierDetection(v1.OutlierDetection{}))
+	}
+	return opts, nil
+}
+
+// credentials - Transport credentials of the TLS configuration
+func (t *TLSConfig) credentials() (credentials.TransportCredentials, error) {
+	cfg := &tls.Config{ServerName: t.ServerName}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrInvalidConfig, t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// ApplyConfig - Reconciles the pools created by earlier ApplyConfig calls with the configuration: pools which are new
+// are created, pools which are gone are closed and pools whose configuration changed are closed and created again (pool
+// options only apply when a pool is created). Pools created with Pool are not touched. A pool without endpoints yet
+// counts as applied. Returns an error wrapping the first failure; the other pools are applied regardless.
+func (m *manager) ApplyConfig(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	desired := make(map[string]PoolConfig, len(cfg.Pools))
+	for _, p := range cfg.Pools {
+		desired[p.name()] = p
+	}
+	m.configMutex.Lock()
+	defer m.configMutex.Unlock()
+	for name, applied := range m.applied {
+		if p, ok := desired[name]; ok && reflect.DeepEqual(p, applied) {
+			continue
+		}
+		if err := m.Close(name); err != nil && !errors.Is(err, ErrPoolClosed) {
+			log.Printf("ERROR: ApplyConfig(): Can not close pool %s. Error %v", name, err)
+		}
+		delete(m.applied, name)
+	}
+	var first error
+	failed := 0
+	for _, p := range cfg.Pools {
+		name := p.name()
+		if _, ok := m.applied[name]; ok {
+			continue
+		}
+		err := m.applyPool(name, p)
+		if err == nil || errors.Is(err, ErrNoHealthyEndpoints) {
+			m.applied[name] = p
+		}
+		if err != nil {
+			log.Printf("ERROR: ApplyConfig(): Can not apply pool %s. Error %v", name, err)
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if first != nil {
+		return fmt.Errorf("%d of %d pools failed, first error: %w", failed, len(cfg.Pools), first)
+	}
+	return nil
+}
+
+// applyPool - Creates the pool of the configuration. Caller must hold configMutex.
+func (m *manager) applyPool(name string, p PoolConfig) error {
+	opts, err := p.options()
+	if err != nil {
+		return err
+	}
+	serviceName, err := m.resolve(name)
+	if err != nil {
+		return err
+	}
+	m.setStrategy(serviceName, p.Strategy)
+	_, err = m.Pool(name, opts...)
+	return err
+}
+
+// setStrategy - Sets the balancing strategy of the pool. The scorer implementing the strategies is registered once
+// per pool and reads the current strategy, since scorers can not be unregistered.
+func (m *manager) setStrategy(serviceName, strategy string) {
+	m.strategyMutex.Lock()
+	defer m.strategyMutex.Unlock()
+	if _, ok := m.strategies[serviceName]; !ok {
+		v1.RegisterScorer(serviceName, v1.ScorerFunc(m.score))
+	}
+	m.strategies[serviceName] = strategy
+}
+
+// score - Scorer of the configured strategies
+func (m *manager) score(ep EndpointInfo, stats EndpointStats) float64 {
+	m.strategyMutex.RLock()
+	strategy := m.strategies[ep.ServiceName]
+	m.strategyMutex.RUnlock()
+	if strategy == StrategyLeastRequests {
+		return 1 / float64(1+stats.InFlight)
+	}
+	return 1
+}
+
+// WatchConfigFile - Applies the configuration file to the manager, and again whenever its content changes (checked
+// every 10 seconds) until ctx is done. Returns the error of the initial load and apply; the file is not watched when it
+// can not be read or parsed. Later errors are logged and leave the pools unchanged.
+func WatchConfigFile(ctx context.Context, m ConfigApplier, path string) error {
+	return watchConfig(ctx, m, path, func() ([]byte, error) {
+		return ioutil.ReadFile(path)
+	})
+}
+
+// WatchConfigMap - Applies the configuration in the key of the ConfigMap to the manager, and again whenever it changes
+// (checked every 10 seconds) until ctx is done. Returns the error of the initial load and apply; the ConfigMap is not
+// watched when it can not be read or parsed. Later errors, including a deleted ConfigMap, are logged and leave the pools
+// unchanged.
+func WatchConfigMap(ctx context.Context, m ConfigApplier, namespace, name, key string) error {
+	source := namespace + "/" + name + "#" + key
+	return watchConfig(ctx, m, source, func() ([]byte, error) {
+		k8s, err := v1.Clientset()
+		if err != nil {
+			return nil, err
+		}
+		cm, err := k8s.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: ConfigMap %s/%s not found", ErrInvalidConfig, namespace, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, ok := cm.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: ConfigMap %s/%s has no key %s", ErrInvalidConfig, namespace, name, key)
+		}
+		return []byte(data), nil
+	})
+}
+
+// watchConfig - Applies the configuration read from the source now and on every change
+func watchConfig(ctx context.Context, m ConfigApplier, source string, read func() ([]byte, error)) error {
+	data, err := read()
+	if err != nil {
+		return err
+	}
+	c, err := ParseConfig(data)
+	if err != nil {
+		return err
+	}
+	applyErr := m.ApplyConfig(c)
+	interval := configPollInterval
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			next, err := read()
+			if err != nil {
+				log.Printf("ERROR: watchConfig(): Can not read the configuration %s. Error %v", source, err)
+				continue
+			}
+			if bytes.Equal(next, data) {
+				continue
+			}
+			data = next
+			log.Printf("INFO: watchConfig(): Configuration %s changed, applying", source)
+			c, err := ParseConfig(data)
+			if err == nil {
+				err = m.ApplyConfig(c)
+			}
+			if err != nil {
+				log.Printf("ERROR: watchConfig(): Can not apply the configuration %s. Error %v", source, err)
+			}
+		}
+	}()
+	return applyErr
+}
@@ -0,0 +1,212 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/norbertvannobelen/kube-grpc"
+	"github.com/norbertvannobelen/kube-grpc/kubegrpctest"
+)
+
+func TestParseConfig(t *testing.T) {
+	yamlConfig := `
+pools:
+- service: orders
+  namespace: shop
+  port: "10000"
+  strategy: least-requests
+  refreshInterval: 10s
+  healthCheck:
+    pingTimeout: 2s
+    minHealthy: 2
+  compression: gzip
+  keepalive:
+    time: 1m
+    permitWithoutStream: true
+- name: payments
+  service: payments
+`
+	c, err := ParseConfig([]byte(yamlConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	if len(c.Pools) != 2 || c.Pools[0].name() != "orders.shop:10000" || c.Pools[1].name() != "payments" {
+		t.Fatalf("ParseConfig() = %+v", c)
+	}
+	if p := c.Pools[0]; p.Strategy != StrategyLeastRequests || time.Duration(p.HealthCheck.PingTimeout) != 2*time.Second ||
+		p.HealthCheck.MinHealthy != 2 || time.Duration(p.RefreshInterval) != 10*time.Second || p.Compression != "gzip" {
+		t.Errorf("pool = %+v", p)
+	}
+	if k := c.Pools[0].Keepalive; k == nil || time.Duration(k.Time) != time.Minute || !k.PermitWithoutStream ||
+		c.Pools[1].Keepalive != nil {
+		t.Errorf("keepalive = %+v, %+v", k, c.Pools[1].Keepalive)
+	}
+	if c, err := ParseConfig([]byte(`{"pools": [{"service": "orders", "namespace": "shop"}]}`)); err != nil ||
+		c.Pools[0].name() != "orders.shop" {
+		t.Errorf("ParseConfig(json) = %+v, %v", c, err)
+	}
+	if c, err := ParseConfig([]byte("pools:\n- service: orders\n  strategy: round-robin\n")); err != nil ||
+		c.Pools[0].Strategy != v1.BalancerRoundRobin {
+		t.Errorf("ParseConfig(picker strategy) = %+v, %v", c, err)
+	}
+	for _, invalid := range []string{
+		"pools:\n- namespace: shop\n",
+		"pools:\n- service: orders\n  strategy: fastest\n",
+		"pools:\n- service: orders\n  compression: zstd\n",
+		"pools:\n- service: orders\n- service: orders\n",
+		"pools:\n- service: orders\n  healthCheck:\n    pingTimeout: soon\n",
+		"pools:\n- service: orders\n  unknown: true\n",
+	} {
+		if _, err := ParseConfig([]byte(invalid)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("ParseConfig(%q) error = %v, want ErrInvalidConfig", invalid, err)
+		}
+	}
+}
+
+// testCluster - Fake cluster with the services and one pod each
+func testCluster(t *testing.T, services ...string) {
+	t.Helper()
+	c := kubegrpctest.NewCluster()
+	t.Cleanup(c.Close)
+	for i, s := range services {
+		if err := c.AddService(s, "ns"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.AddPod(s, "ns", s+"-0", fmt.Sprintf("10.9.0.%d", i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	testCluster(t, "a", "b")
+	m := NewManager(nopBalancer{})
+	defer m.Close("a.ns:1000")
+	applier := m.(ConfigApplier)
+	if err := applier.ApplyConfig(Config{Pools: []PoolConfig{
+		{Service: "a", Namespace: "ns", Port: "1000"},
+		{Service: "b", Namespace: "ns", Port: "1000"},
+	}}); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	a := v1.Connections("a.ns:1000")
+	if len(a) != 1 || len(v1.Connections("b.ns:1000")) != 1 {
+		t.Fatal("pools of the config not created")
+	}
+
+	// Unchanged pools are kept, removed pools closed, failures reported without affecting the others
+	err := applier.ApplyConfig(Config{Pools: []PoolConfig{
+		{Service: "a", Namespace: "ns", Port: "1000"},
+		{Service: "missing", Namespace: "ns", Port: "1000"},
+	}})
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Errorf("ApplyConfig() error = %v, want ErrServiceNotFound of the missing service", err)
+	}
+	if got := v1.Connections("a.ns:1000"); len(got) != 1 || got[0] != a[0] {
+		t.Error("unchanged pool was recreated")
+	}
+	if _, err := v1.Stats("b.ns:1000"); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("removed pool: Stats() error = %v, want ErrPoolNotFound", err)
+	}
+
+	// Changed pools are recreated
+	if err := applier.ApplyConfig(Config{Pools: []PoolConfig{
+		{Service: "a", Namespace: "ns", Port: "1000", HealthCheck: HealthCheckConfig{MinHealthy: 1}},
+	}}); err != nil {
+		t.Fatalf("ApplyConfig() error = %v", err)
+	}
+	if got := v1.Connections("a.ns:1000"); len(got) != 1 || got[0] == a[0] {
+		t.Error("changed pool was not recreated")
+	}
+}
+
+func TestLeastRequestsStrategy(t *testing.T) {
+	m := NewManager(nopBalancer{}).(*manager)
+	m.setStrategy("a.ns:1000", StrategyLeastRequests)
+	ep := EndpointInfo{ServiceName: "a.ns:1000"}
+	if idle, busy := m.score(ep, EndpointStats{}), m.score(ep, EndpointStats{InFlight: 3}); idle <= busy {
+		t.Errorf("score idle = %v, busy = %v, want idle endpoints preferred", idle, busy)
+	}
+	m.setStrategy("a.ns:1000", StrategyRandom)
+	if s := m.score(ep, EndpointStats{InFlight: 3}); s != 1 {
+		t.Errorf("score with random strategy = %v, want 1", s)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	testCluster(t, "c", "d")
+	previous := configPollInterval
+	configPollInterval = 10 * time.Millisecond
+	defer func() { configPollInterval = previous }()
+	path := filepath.Join(t.TempDir(), "pools.yaml")
+	if err := ioutil.WriteFile(path, []byte("pools:\n- service: c\n  namespace: ns\n  port: \"1000\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(nopBalancer{})
+	defer m.Close("d.ns:1000")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := WatchConfigFile(ctx, m.(ConfigApplier), path); err != nil {
+		t.Fatalf("WatchConfigFile() error = %v", err)
+	}
+	if len(v1.Connections("c.ns:1000")) != 1 {
+		t.Fatal("pool of the initial config not created")
+	}
+	if err := ioutil.WriteFile(path, []byte("pools:\n- service: d\n  namespace: ns\n  port: \"1000\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200 && len(v1.Connections("d.ns:1000")) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(v1.Connections("d.ns:1000")) != 1 {
+		t.Error("pool of the changed config not created")
+	}
+	if _, err := v1.Stats("c.ns:1000"); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("pool removed from the config: Stats() error = %v, want ErrPoolNotFound", err)
+	}
+	if err := WatchConfigFile(ctx, m.(ConfigApplier), filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("WatchConfigFile() of a missing file: no error")
+	}
+}
+
+func TestManagerHealthy(t *testing.T) {
+	c := kubegrpctest.NewCluster()
+	t.Cleanup(c.Close)
+	if err := c.AddService("r", "ns"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddPod("r", "ns", "r-0", "10.9.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(nopBalancer{})
+	required := PoolConfig{Service: "r", Namespace: "ns", Port: "1000", Required: true}
+	if err := m.(ConfigApplier).ApplyConfig(Config{Pools: []PoolConfig{required}}); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close("r.ns:1000")
+	readiness := m.(ReadinessReporter)
+	if err := readiness.Healthy(); err != nil {
+		t.Fatalf("Healthy() = %v with a connected required pool", err)
+	}
+	if err := c.DeletePod("ns", "r-0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.(Refresher).Refresh(context.Background(), "r.ns:1000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := readiness.Healthy(); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Healthy() = %v with an empty required pool, want ErrNotReady", err)
+	}
+	w := httptest.NewRecorder()
+	readiness.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ReadinessHandler() = %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,367 @@
+// Package kubegrpc is the versioned API of kube-grpc: client side load balancing of grpc connections over the pods of
+// a kubernetes service.
+//
+// The API is built from small interfaces: a Manager hands out Pools, a Pool picks Endpoints, a Picker customizes the
+// selection and a Resolver maps the names used by the application to kubernetes services. The pools themselves are
+// the pools of the v1 package (github.com/norbertvannobelen/kube-grpc), so v1 functions like Stats, Subscribe or
+// SetWeightOverride keep working on pools created through this package, and both can be mixed while migrating.
+//
+// The package belongs to the github.com/norbertvannobelen/kube-grpc module, it is not a major version module of its
+// own: require that module (go get github.com/norbertvannobelen/kube-grpc) and import
+// github.com/norbertvannobelen/kube-grpc/v2. Both APIs come with the same version of the module.
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	v1 "github.com/norbertvannobelen/kube-grpc"
+	"k8s.io/client-go/informers"
+)
+
+// Types shared with the v1 package
+type (
+	Balancer      = v1.GrpcKubeBalancer
+	Option        = v1.PoolOption
+	EndpointInfo  = v1.EndpointInfo
+	EndpointStats = v1.EndpointStats
+	PoolStats     = v1.PoolStats
+	PoolEvent     = v1.PoolEvent
+	BackoffState  = v1.BackoffState
+)
+
+// Errors shared with the v1 package, see there
+var (
+	ErrInvalidServiceName = v1.ErrInvalidServiceName
+	ErrServiceNotFound    = v1.ErrServiceNotFound
+	ErrNoHealthyEndpoints = v1.ErrNoHealthyEndpoints
+	ErrPoolClosed         = v1.ErrPoolClosed
+	ErrPoolNotFound       = v1.ErrPoolNotFound
+	ErrShutdown           = v1.ErrShutdown
+	ErrNotReady           = v1.ErrNotReady
+)
+
+// ErrNoPick - The Picker returned no endpoint
+var ErrNoPick = errors.New("kubegrpc: picker returned no endpoint")
+
+// Endpoint - A connection to a single pod
+type Endpoint interface {
+	Info() EndpointInfo
+	Stats() EndpointStats
+	Client() interface{} // Client created by the Balancer
+}
+
+// Picker - Selects the endpoint for a call. endpoints is never empty and holds every connection of the pool, including
+// draining and ejected ones (see EndpointStats). Without a Picker the endpoint is selected by the built in selection
+// (circuit breaker, draining, scorers and weight overrides).
+type Picker interface {
+	Pick(serviceName string, endpoints []Endpoint) Endpoint
+}
+
+// PickerFunc - Adapter to use a function as Picker
+type PickerFunc func(serviceName string, endpoints []Endpoint) Endpoint
+
+// Pick - Calls f
+func (f PickerFunc) Pick(serviceName string, endpoints []Endpoint) Endpoint {
+	return f(serviceName, endpoints)
+}
+
+// Resolver - Maps a name used by the application to a kubernetes service name of the form
+// `service.namespace[.svc.cluster.local][:port]`
+type Resolver interface {
+	Resolve(name string) (serviceName string, err error)
+}
+
+// ResolverFunc - Adapter to use a function as Resolver
+type ResolverFunc func(name string) (string, error)
+
+// Resolve - Calls f
+func (f ResolverFunc) Resolve(name string) (string, error) {
+	return f(name)
+}
+
+// Pool - Connections to the pods of a single service
+type Pool interface {
+	ServiceName() string
+	Pick() (Endpoint, error)
+	Endpoints() []Endpoint
+	Stats() (PoolStats, error)
+	Subscribe() (events <-chan PoolEvent, cancel func())
+	Close() error
+}
+
+// Doer - Optional interface of a Pool scoping calls to its endpoints, implemented by the pools of NewManager
+type Doer interface {
+	// Do - Picks an endpoint like Pick and runs fn with its client, counting the call as in flight and retrying
+	// connection errors on other endpoints, see GrpcConnection.Do of the v1 package
+	Do(ctx context.Context, fn func(client interface{}) error) error
+}
+
+// DeadlineDoer - Optional interface of a Pool splitting the deadline of a call over its attempts, implemented by the
+// pools of NewManager
+type DeadlineDoer interface {
+	// DoWithDeadline - Do of Doer with a deadline per attempt: fn gets the context of its attempt, with its share of the
+	// deadline of ctx, and an attempt which runs out of it is retried, see DoWithDeadline of the v1 package
+	DoWithDeadline(ctx context.Context, fn func(ctx context.Context, client interface{}) error) error
+}
+
+// FailureReporter - Optional interface of a Pool excluding failing endpoints, implemented by the pools of NewManager
+type FailureReporter interface {
+	// ReportFailure - Reports an application level failure of the endpoint, eg a corrupt response, which excludes it
+	// from the picks for a while, see GrpcConnection.ReportFailure of the v1 package. Endpoints which are not
+	// connections of a pool are ignored.
+	ReportFailure(e Endpoint, err error)
+}
+
+// BalancerSetter - Optional interface of a Pool swapping its balancer, implemented by the pools of NewManager
+type BalancerSetter interface {
+	// SetBalancer - Replaces the balancer of the live pool, rebuilding the connections gradually with its clients, see
+	// SetBalancer of the v1 package
+	SetBalancer(b Balancer) error
+}
+
+// Manager - Creates and closes pools
+type Manager interface {
+	// Pool - Returns the pool for the name, creating it if needed. The options only apply when the pool is created.
+	Pool(name string, opts ...Option) (Pool, error)
+	// Close - Closes the pool for the name
+	Close(name string) error
+}
+
+// ConfigApplier - Optional interface of a Manager declaring its pools in a Config, implemented by the managers of
+// NewManager: m.(ConfigApplier).ApplyConfig(cfg)
+type ConfigApplier interface {
+	// ApplyConfig - Reconciles the pools created from configuration with the desired set, see Config
+	ApplyConfig(cfg Config) error
+}
+
+// Drainer - Optional interface of a Manager shutting the balancing down, implemented by the managers of NewManager
+type Drainer interface {
+	// Drain - Shuts the balancing of the process down, for SIGTERM handlers: stops handing out picks, waits for the in
+	// flight RPCs, closes all connections and stops the background maintenance. Affects all pools of the process, see
+	// Shutdown of the v1 package.
+	Drain(ctx context.Context) error
+	// Done - Closed once Drain completed, so the application can sequence its own shutdown
+	Done() <-chan struct{}
+}
+
+// Refresher - Optional interface of a Manager re-discovering pods on demand, implemented by the managers of NewManager
+type Refresher interface {
+	// Refresh - Re-discovers the pods of the pool for the name right away instead of at its refresh interval, see
+	// RefreshContext of the v1 package
+	Refresh(ctx context.Context, name string) error
+}
+
+// ReadinessReporter - Optional interface of a Manager reporting the readiness of the pod, implemented by the managers
+// of NewManager
+type ReadinessReporter interface {
+	// Healthy - Returns ErrNotReady if a pool marked as required (WithRequired of the v1 package, or `required` in the
+	// configuration) has no healthy endpoints, see Ready of the v1 package. Covers all pools of the process.
+	Healthy() error
+	// ReadinessHandler - HTTP handler for the readiness probe of the pod: 200 while Healthy returns nil, 503 otherwise
+	ReadinessHandler() http.Handler
+}
+
+// ManagerOption - Configures a Manager
+type ManagerOption func(*manager)
+
+// WithPicker - Replaces the built in endpoint selection of the pools of the manager
+func WithPicker(p Picker) ManagerOption {
+	return func(m *manager) {
+		m.picker = p
+	}
+}
+
+// WithResolver - Maps the names passed to the manager to kubernetes service names. Without a Resolver names are used
+// as service names.
+func WithResolver(r Resolver) ManagerOption {
+	return func(m *manager) {
+		m.resolver = r
+	}
+}
+
+// WithInformerFactory - Reuses the shared informers the application already runs for the discovery of the pools
+// instead of listing from the API server, see SetInformerFactory of the v1 package. Like the pools, the setting is
+// process wide.
+func WithInformerFactory(factory informers.SharedInformerFactory) ManagerOption {
+	return func(*manager) {
+		v1.SetInformerFactory(factory)
+	}
+}
+
+// WithRandomSource - Draws the random picks of the pools of the manager from the source, see WithRandomSource of the v1
+// package. Options passed to Pool take precedence.
+func WithRandomSource(src rand.Source) ManagerOption {
+	return func(m *manager) {
+		m.options = append(m.options, v1.WithRandomSource(src))
+	}
+}
+
+type manager struct {
+	balancer      Balancer
+	picker        Picker
+	resolver      Resolver
+	options       []Option // Applied to every pool before the options passed to Pool
+	configMutex   sync.Mutex
+	applied       map[string]PoolConfig // Pools created by ApplyConfig by name
+	strategyMutex sync.RWMutex
+	strategies    map[string]string // Balancing strategy by service name
+}
+
+// NewManager - Returns a Manager creating its pools with the balancer
+func NewManager(b Balancer, opts ...ManagerOption) Manager {
+	m := &manager{balancer: b, applied: make(map[string]PoolConfig), strategies: make(map[string]string)}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// resolve - Applies the resolver of the manager
+func (m *manager) resolve(name string) (string, error) {
+	if m.resolver == nil {
+		return name, nil
+	}
+	return m.resolver.Resolve(name)
+}
+
+func (m *manager) Pool(name string, opts ...Option) (Pool, error) {
+	serviceName, err := m.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.options) > 0 {
+		opts = append(m.options[:len(m.options):len(m.options)], opts...)
+	}
+	if _, _, err := v1.PoolWithOptions(serviceName, m.balancer, opts...); err != nil {
+		return nil, err
+	}
+	return &pool{serviceName: serviceName, manager: m}, nil
+}
+
+func (m *manager) Refresh(ctx context.Context, name string) error {
+	serviceName, err := m.resolve(name)
+	if err != nil {
+		return err
+	}
+	return v1.RefreshContext(ctx, serviceName)
+}
+
+func (m *manager) Drain(ctx context.Context) error {
+	return v1.Shutdown(ctx)
+}
+
+func (m *manager) Done() <-chan struct{} {
+	return v1.ShutdownDone()
+}
+
+func (m *manager) Healthy() error {
+	return v1.Ready()
+}
+
+func (m *manager) ReadinessHandler() http.Handler {
+	return v1.ReadinessHandler()
+}
+
+func (m *manager) Close(name string) error {
+	serviceName, err := m.resolve(name)
+	if err != nil {
+		return err
+	}
+	return v1.ClosePool(serviceName)
+}
+
+type pool struct {
+	serviceName string
+	manager     *manager
+}
+
+func (p *pool) ServiceName() string {
+	return p.serviceName
+}
+
+// Pick - Selects an endpoint with the Picker of the manager, or the built in selection. After the pool was closed
+// Pick returns ErrPoolNotFound.
+func (p *pool) Pick() (Endpoint, error) {
+	if p.manager.picker == nil || v1.Bypassed() {
+		gc, err := v1.PickConnection(p.serviceName)
+		if err != nil {
+			return nil, err
+		}
+		return gc, nil
+	}
+	endpoints := p.Endpoints()
+	if len(endpoints) == 0 {
+		if _, err := v1.Stats(p.serviceName); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoHealthyEndpoints
+	}
+	e := p.manager.picker.Pick(p.serviceName, endpoints)
+	if e == nil {
+		return nil, ErrNoPick
+	}
+	return e, nil
+}
+
+func (p *pool) Do(ctx context.Context, fn func(client interface{}) error) error {
+	e, err := p.Pick()
+	if err != nil {
+		return err
+	}
+	gc, ok := e.(*v1.GrpcConnection)
+	if !ok {
+		// Endpoints of a custom Picker which are not connections of the pool
+		return fn(e.Client())
+	}
+	return gc.Do(ctx, fn)
+}
+
+func (p *pool) DoWithDeadline(ctx context.Context, fn func(ctx context.Context, client interface{}) error) error {
+	e, err := p.Pick()
+	if err != nil {
+		return err
+	}
+	gc, ok := e.(*v1.GrpcConnection)
+	if !ok {
+		return fn(ctx, e.Client())
+	}
+	return gc.DoWithDeadline(ctx, fn)
+}
+
+func (p *pool) Endpoints() []Endpoint {
+	conns := v1.Connections(p.serviceName)
+	endpoints := make([]Endpoint, 0, len(conns))
+	for _, gc := range conns {
+		endpoints = append(endpoints, gc)
+	}
+	return endpoints
+}
+
+func (p *pool) ReportFailure(e Endpoint, err error) {
+	if gc, ok := e.(*v1.GrpcConnection); ok {
+		gc.ReportFailure(err)
+	}
+}
+
+func (p *pool) SetBalancer(b Balancer) error {
+	return v1.SetBalancer(p.serviceName, b)
+}
+
+func (p *pool) Stats() (PoolStats, error) {
+	return v1.Stats(p.serviceName)
+}
+
+func (p *pool) Subscribe() (<-chan PoolEvent, func()) {
+	ch := v1.Subscribe(p.serviceName)
+	return ch, func() {
+		v1.Unsubscribe(p.serviceName, ch)
+	}
+}
+
+func (p *pool) Close() error {
+	return v1.ClosePool(p.serviceName)
+}
@@ -0,0 +1,91 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+type nopBalancer struct{}
+
+func (nopBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) { return conn, nil }
+
+func (nopBalancer) Ping(grpcConnection interface{}) error { return nil }
+
+func TestManagerResolverError(t *testing.T) {
+	errUnknown := errors.New("unknown name")
+	m := NewManager(nopBalancer{}, WithResolver(ResolverFunc(func(name string) (string, error) {
+		return "", errUnknown
+	})))
+	if _, err := m.Pool("orders"); !errors.Is(err, errUnknown) {
+		t.Errorf("Pool() error = %v, want the resolver error", err)
+	}
+	if err := m.Close("orders"); !errors.Is(err, errUnknown) {
+		t.Errorf("Close() error = %v, want the resolver error", err)
+	}
+}
+
+func TestManagerResolvesNames(t *testing.T) {
+	var resolved string
+	m := NewManager(nopBalancer{}, WithResolver(ResolverFunc(func(name string) (string, error) {
+		resolved = name
+		return name + ":1000", nil
+	})))
+	if _, err := m.Pool("orders"); !errors.Is(err, ErrInvalidServiceName) {
+		t.Errorf("Pool() error = %v, want ErrInvalidServiceName", err)
+	}
+	if resolved != "orders" {
+		t.Errorf("resolver called with %q, want orders", resolved)
+	}
+}
+
+func TestManagerCloseUnknownPool(t *testing.T) {
+	if err := NewManager(nopBalancer{}).Close("unknown.ns:1000"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Close() error = %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestManagerOptionalInterfaces(t *testing.T) {
+	m := NewManager(nopBalancer{})
+	if _, ok := m.(Drainer); !ok {
+		t.Error("manager does not implement Drainer")
+	}
+	if _, ok := m.(Refresher); !ok {
+		t.Error("manager does not implement Refresher")
+	}
+	if _, ok := m.(ReadinessReporter); !ok {
+		t.Error("manager does not implement ReadinessReporter")
+	}
+	var p Pool = &pool{serviceName: "unknown.ns:1000", manager: &manager{}}
+	if _, ok := p.(Doer); !ok {
+		t.Error("pool does not implement Doer")
+	}
+	if _, ok := p.(DeadlineDoer); !ok {
+		t.Error("pool does not implement DeadlineDoer")
+	}
+	if _, ok := p.(FailureReporter); !ok {
+		t.Error("pool does not implement FailureReporter")
+	}
+	if _, ok := p.(BalancerSetter); !ok {
+		t.Error("pool does not implement BalancerSetter")
+	}
+}
+
+func TestPickUnknownPool(t *testing.T) {
+	p := &pool{serviceName: "unknown.ns:1000", manager: &manager{}}
+	if _, err := p.Pick(); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("Pick() error = %v, want ErrPoolNotFound", err)
+	}
+	if err := p.Do(context.Background(), nil); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("Do() error = %v, want ErrPoolNotFound", err)
+	}
+	if err := p.DoWithDeadline(context.Background(), nil); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("DoWithDeadline() error = %v, want ErrPoolNotFound", err)
+	}
+	p.manager.picker = PickerFunc(func(string, []Endpoint) Endpoint { return nil })
+	if _, err := p.Pick(); !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("Pick() with picker error = %v, want ErrPoolNotFound", err)
+	}
+}
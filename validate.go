@@ -0,0 +1,152 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ErrPolicyDenied - A registered DiscoveryValidator vetoed the pool
+var ErrPolicyDenied = errors.New("kubegrpc: denied by connectivity policy")
+
+// serviceAccountNamespaceFile - Namespace of the pod the library runs in, mounted by k8s
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// PoolInfo - Describes a pool for the validators
+type PoolInfo struct {
+	ServiceName     string // Service name as passed to Connect
+	Namespace       string // Namespace of the target service
+	ClientNamespace string // Namespace of the pod running this code, empty if unknown
+	Labels          map[string]string
+	Annotations     map[string]string
+}
+
+// DiscoveryValidator - Governance hook which can veto whole pools or individual endpoints before connections are made.
+// A non nil error vetoes; the error is reported in the audit event as the reason.
+// Validators are consulted on every pool refresh, so endpoints which are no longer allowed are evicted.
+type DiscoveryValidator interface {
+	ValidatePool(pool PoolInfo) error
+	ValidateEndpoint(pool PoolInfo, ep EndpointInfo) error
+}
+
+// AuditEvent - Emitted for every veto of a DiscoveryValidator
+type AuditEvent struct {
+	Time            time.Time
+	ServiceName     string
+	Namespace       string
+	ClientNamespace string
+	Pod             string // Empty when the whole pool was vetoed
+	IP              string
+	Reason          string
+}
+
+var (
+	validators      = make([]DiscoveryValidator, 0)
+	auditSink       func(AuditEvent)
+	validatorsMutex = &sync.RWMutex{}
+
+	clientNamespaceOnce  sync.Once
+	clientNamespaceValue string
+)
+
+// RegisterValidator - Adds a validator which applies to all pools
+func RegisterValidator(v DiscoveryValidator) {
+	validatorsMutex.Lock()
+	defer validatorsMutex.Unlock()
+	validators = append(validators, v)
+}
+
+// SetAuditSink - Sets the function receiving the audit events. Without a sink audit events are logged.
+// The sink is called synchronously from the pool refresh and should not block.
+func SetAuditSink(f func(AuditEvent)) {
+	validatorsMutex.Lock()
+	defer validatorsMutex.Unlock()
+	auditSink = f
+}
+
+// clientNamespace - Returns the namespace of the pod running this code from the service account mount, or the
+// POD_NAMESPACE environment variable (downward API) if set
+func clientNamespace() string {
+	clientNamespaceOnce.Do(func() {
+		if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+			clientNamespaceValue = ns
+			return
+		}
+		b, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+		if err == nil {
+			clientNamespaceValue = strings.TrimSpace(string(b))
+		}
+	})
+	return clientNamespaceValue
+}
+
+// validatePods - Runs the registered validators against the discovered pods. Returns the allowed pods, or ErrPolicyDenied
+// when the pool as a whole is vetoed
+func validatePods(serviceName string, svc *corev1.Service, pods []corev1.Pod) ([]corev1.Pod, error) {
+	validatorsMutex.RLock()
+	v := validators
+	sink := auditSink
+	validatorsMutex.RUnlock()
+	if len(v) == 0 {
+		return pods, nil
+	}
+	pool := PoolInfo{
+		ServiceName:     serviceName,
+		Namespace:       svc.Namespace,
+		ClientNamespace: clientNamespace(),
+		Labels:          svc.Labels,
+		Annotations:     svc.Annotations,
+	}
+	for _, validator := range v {
+		if err := validator.ValidatePool(pool); err != nil {
+			audit(sink, pool, "", "", err)
+			return nil, fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+		}
+	}
+	allowed := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		ep := EndpointInfo{
+			ServiceName: serviceName,
+			Namespace:   pod.Namespace,
+			PodName:     pod.Name,
+			IP:          pod.Status.PodIP,
+			Labels:      pod.Labels,
+		}
+		var denied error
+		for _, validator := range v {
+			if denied = validator.ValidateEndpoint(pool, ep); denied != nil {
+				break
+			}
+		}
+		if denied != nil {
+			audit(sink, pool, pod.Name, pod.Status.PodIP, denied)
+			continue
+		}
+		allowed = append(allowed, pod)
+	}
+	return allowed, nil
+}
+
+func audit(sink func(AuditEvent), pool PoolInfo, pod, ip string, reason error) {
+	e := AuditEvent{
+		Time:            time.Now(),
+		ServiceName:     pool.ServiceName,
+		Namespace:       pool.Namespace,
+		ClientNamespace: pool.ClientNamespace,
+		Pod:             pod,
+		IP:              ip,
+		Reason:          reason.Error(),
+	}
+	if sink == nil {
+		log.Printf("INFO: audit(): Connectivity policy denied %+v", e)
+		return
+	}
+	sink(e)
+}
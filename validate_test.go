@@ -0,0 +1,82 @@
+package kubegrpc
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// okBalancer - GrpcKubeBalancer handing out the raw connection, pings always succeed
+type okBalancer struct{}
+
+func (okBalancer) NewGrpcClient(conn *grpc.ClientConn) (interface{}, error) { return conn, nil }
+
+func (okBalancer) Ping(interface{}) error { return nil }
+
+// testValidator - Denies a pool by namespace and endpoints by pod name
+type testValidator struct {
+	deniedNamespace string
+	deniedPod       string
+}
+
+func (v testValidator) ValidatePool(pool PoolInfo) error {
+	if pool.Namespace == v.deniedNamespace {
+		return errors.New("namespace not allowed")
+	}
+	return nil
+}
+
+func (v testValidator) ValidateEndpoint(pool PoolInfo, ep EndpointInfo) error {
+	if ep.PodName == v.deniedPod {
+		return errors.New("pod not allowed")
+	}
+	return nil
+}
+
+// useValidator - Registers the validator and an audit sink collecting events for the duration of the test
+func useValidator(t *testing.T, v DiscoveryValidator) *[]AuditEvent {
+	t.Helper()
+	events := make([]AuditEvent, 0)
+	RegisterValidator(v)
+	SetAuditSink(func(e AuditEvent) { events = append(events, e) })
+	t.Cleanup(func() {
+		validatorsMutex.Lock()
+		validators = make([]DiscoveryValidator, 0)
+		auditSink = nil
+		validatorsMutex.Unlock()
+	})
+	return &events
+}
+
+func TestValidatorVetoesEndpoint(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"),
+		testPod("svc-0", "ns", "svc", "10.0.0.1"), testPod("svc-1", "ns", "svc", "10.0.0.2"))
+	events := useValidator(t, testValidator{deniedPod: "svc-1"})
+	c := &connection{functions: okBalancer{}}
+	if err := updateConnectionPool("svc.ns:1000", c, false); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if len(c.grpcConnection) != 1 || c.grpcConnection[0].podName != "svc-0" {
+		t.Errorf("pool = %+v, want only svc-0", c.grpcConnection)
+	}
+	if len(*events) != 1 || (*events)[0].Pod != "svc-1" || (*events)[0].Reason != "pod not allowed" {
+		t.Errorf("audit events = %+v, want one veto for svc-1", *events)
+	}
+}
+
+func TestValidatorVetoesPool(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	events := useValidator(t, testValidator{deniedNamespace: "ns"})
+	c := &connection{functions: okBalancer{}}
+	err := updateConnectionPool("svc.ns:1000", c, false)
+	if !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("updateConnectionPool() error = %v, want ErrPolicyDenied", err)
+	}
+	if len(c.grpcConnection) != 0 {
+		t.Errorf("pool = %+v, want no connections", c.grpcConnection)
+	}
+	if len(*events) != 1 || (*events)[0].Pod != "" || (*events)[0].Namespace != "ns" {
+		t.Errorf("audit events = %+v, want one pool veto", *events)
+	}
+}
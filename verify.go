@@ -0,0 +1,105 @@
+package kubegrpc
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// defaultVerifyInterval - Maximum age of an endpoint verification before the pod is looked up again
+const defaultVerifyInterval = 5 * time.Minute
+
+// WithVerificationInterval - Maximum time an endpoint stays in the pool without its pod being confirmed in k8s (same
+// UID, same IP, still matching the service selector), regardless of passing health checks. Every pool refresh confirms
+// the endpoints it finds; endpoints not confirmed within the interval are looked up individually and drained when the
+// pod is gone or changed. Defends against stale entries after missed updates. Defaults to 5 minutes, 0 disables.
+func WithVerificationInterval(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.verifyInterval = d
+	}
+}
+
+// markVerified - Records that the pod of the connection was confirmed at t
+func (c *GrpcConnection) markVerified(t time.Time) {
+	atomic.StoreInt64(&c.verified, t.UnixNano())
+}
+
+// verifiedAt - Last time the pod of the connection was confirmed
+func (c *GrpcConnection) verifiedAt() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.verified))
+}
+
+// staleConnections - Connections which were not verified within the interval. Caller must hold mutex.
+func staleConnections(conns []*GrpcConnection, interval time.Duration, now time.Time) []*GrpcConnection {
+	stale := make([]*GrpcConnection, 0)
+	for _, gc := range conns {
+		if !gc.isDraining() && !gc.addressOnly && now.Sub(gc.verifiedAt()) >= interval {
+			stale = append(stale, gc)
+		}
+	}
+	return stale
+}
+
+// podMismatch - Returns why the pod no longer backs the connection, empty if it still does. A nil selector is not checked.
+func podMismatch(c *GrpcConnection, pod *corev1.Pod, selector labels.Selector) string {
+	switch {
+	case c.podUID != "" && pod.UID != c.podUID:
+		return "pod replaced"
+	case !podHasIP(pod, c.connectionIP):
+		return "pod ip changed"
+	case selector != nil && !selector.Matches(labels.Set(pod.Labels)):
+		return "pod no longer matches the service selector"
+	case podTerminating(pod):
+		return "pod terminating"
+	}
+	return ""
+}
+
+// verifyPool - Looks up the pods of the connections which were not verified within the verification interval, and
+// drains the connections whose pod is gone or changed. Lookup errors leave the connections in place: an unavailable
+// API server must not empty the pools.
+func verifyPool(serviceName string, c *connection) {
+	now := time.Now()
+	mutex.RLock()
+	stale := staleConnections(c.grpcConnection, c.config.verifyInterval*maintenanceSlowdown(), now)
+	mutex.RUnlock()
+	if len(stale) == 0 {
+		return
+	}
+	k8s, err := clientsetFor(serviceName)
+	if err != nil {
+		return
+	}
+	svc, namespace, err := getService(serviceName, k8s.CoreV1())
+	if err != nil {
+		log.Printf("ERROR: verifyPool(): Can not verify endpoints of %s. Error %v", serviceName, err)
+		return
+	}
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+	for _, gc := range stale {
+		var reason string
+		pod, err := k8s.CoreV1().Pods(namespace).Get(context.Background(), gc.podName, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			reason = "pod no longer exists"
+		case err != nil:
+			log.Printf("ERROR: verifyPool(): Can not verify pod %s of %s. Error %v", gc.podName, serviceName, err)
+			continue
+		default:
+			reason = podMismatch(gc, pod, selector)
+		}
+		if reason == "" {
+			gc.markVerified(now)
+			continue
+		}
+		log.Printf("INFO: verifyPool(): Evicting %s for %s: %s", gc.describe(), serviceName, reason)
+		decideEviction(gc, "verification: "+reason)
+		go drain(gc, c.config.drainTimeout)
+	}
+}
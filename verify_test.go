@@ -0,0 +1,73 @@
+package kubegrpc
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPodMismatch(t *testing.T) {
+	gc := &GrpcConnection{connectionIP: "10.0.0.1", podUID: "uid-1"}
+	selector := labels.SelectorFromSet(labels.Set{"app": "svc"})
+	for name, tc := range map[string]struct {
+		uid, ip, app string
+		want         string
+	}{
+		"same":       {"uid-1", "10.0.0.1", "svc", ""},
+		"replaced":   {"uid-2", "10.0.0.1", "svc", "pod replaced"},
+		"ip changed": {"uid-1", "10.0.0.2", "svc", "pod ip changed"},
+		"relabeled":  {"uid-1", "10.0.0.1", "other", "pod no longer matches the service selector"},
+	} {
+		pod := testPod("svc-1", "ns", tc.app, tc.ip)
+		pod.UID = types.UID(tc.uid)
+		if got := podMismatch(gc, pod, selector); got != tc.want {
+			t.Errorf("%s: podMismatch() = %q, want %q", name, got, tc.want)
+		}
+	}
+}
+
+func TestStaleConnections(t *testing.T) {
+	start := time.Unix(1000, 0)
+	fresh, old := &GrpcConnection{}, &GrpcConnection{}
+	fresh.markVerified(start.Add(4 * time.Minute))
+	old.markVerified(start)
+	stale := staleConnections([]*GrpcConnection{fresh, old}, 5*time.Minute, start.Add(5*time.Minute))
+	if len(stale) != 1 || stale[0] != old {
+		t.Errorf("staleConnections() = %v, want only the old connection", stale)
+	}
+}
+
+func TestVerifyPoolEvictsDeletedPod(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-2", "ns", "svc", "10.0.0.2"))
+	p := testPool(t, 2, WithDrainTimeout(0), WithVerificationInterval(time.Minute))
+	cachePool(t, p)
+	for _, gc := range p.grpcConnection {
+		gc.markVerified(time.Now().Add(-time.Hour))
+	}
+	verifyPool("svc.ns:1000", p)
+	if n := poolSize(p, 1); n != 1 {
+		t.Fatalf("pool size = %d, want 1", n)
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if gc := p.grpcConnection[0]; gc.podName != "svc-2" || time.Since(gc.verifiedAt()) > time.Minute {
+		t.Errorf("pool kept %s verified at %v, want svc-2 verified now", gc.podName, gc.verifiedAt())
+	}
+}
+
+func TestRefreshEvictsReusedIP(t *testing.T) {
+	replacement := testPod("svc-1", "ns", "svc", "10.0.0.1")
+	replacement.UID = "uid-new"
+	useFakeClientset(t, testService("svc", "ns"), replacement)
+	p := testPool(t, 1, WithDrainTimeout(0))
+	p.grpcConnection[0].podUID = "uid-old"
+	cachePool(t, p)
+	if err := updateConnectionPool("svc.ns:1000", p, true); err != nil {
+		t.Fatalf("updateConnectionPool() error = %v", err)
+	}
+	if n := poolSize(p, 0); n != 0 {
+		t.Errorf("pool size = %d, want the stale connection evicted", n)
+	}
+}
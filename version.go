@@ -0,0 +1,265 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	// ErrInvalidVersionConstraint - The constraint of PickVersion can not be parsed
+	ErrInvalidVersionConstraint = errors.New("kubegrpc: invalid version constraint")
+	// ErrNoMatchingVersion - No connection of the pool advertises a version matching the constraint of PickVersion
+	ErrNoMatchingVersion = errors.New("kubegrpc: no endpoint with a matching version")
+)
+
+// VersionProbe - Queries the version advertised by the server on a new connection, eg with a custom RPC
+type VersionProbe func(ctx context.Context, conn *grpc.ClientConn) (string, error)
+
+// WithVersionProbe - Queries the version of each pod when it is dialed, so the pods of a rolling upgrade can be told
+// apart: the version is reported in EndpointStats.Version and PickVersion picks among the pods of matching versions.
+// The probe runs after the dial within the ping timeout, without blocking the picks, and the connection is admitted
+// once it answered; a failed probe is logged and leaves the version of the pod unknown. Pools with the probe are not
+// restored by RestorePools.
+func WithVersionProbe(probe VersionProbe) PoolOption {
+	return func(c *poolConfig) {
+		c.versionProbe = probe
+	}
+}
+
+// VersionHeader - VersionProbe reading the version from the response header key of a call to the standard health
+// service, for servers which send their version as metadata
+func VersionHeader(key string) VersionProbe {
+	return func(ctx context.Context, conn *grpc.ClientConn) (string, error) {
+		var header metadata.MD
+		_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+		if err != nil {
+			return "", err
+		}
+		if v := header.Get(key); len(v) > 0 {
+			return v[0], nil
+		}
+		return "", fmt.Errorf("no %s header", key)
+	}
+}
+
+// probeVersion - Queries the version of the server of the new connection within the ping timeout
+func (c *GrpcConnection) probeVersion(p *connection) {
+	timeout := p.config.pingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(p.poolContext(), timeout)
+	defer cancel()
+	version, err := p.config.versionProbe(ctx, c.conn)
+	if err != nil {
+		log.Printf("WARNING: probeVersion(): Version of pod %s unknown. Error: %v", c.describe(), err)
+		return
+	}
+	c.version.Store(version)
+}
+
+// advertisedVersion - Version reported by the pod, empty if unknown
+func (c *GrpcConnection) advertisedVersion() string {
+	version, _ := c.version.Load().(string)
+	return version
+}
+
+// PickVersion - Picks a connection of the existing pool of the service like PickConnection, among the pods advertising
+// a version (see WithVersionProbe) which satisfies the constraint: comparisons like ">=1.4", "<2", "=1.4.2" or "!=1.5.0",
+// separated by commas to require all of them, eg ">=1.4, <2". Returns ErrNoMatchingVersion if no pod matches. In
+// bypass mode the versions are not known and the bypass connection is returned.
+func PickVersion(serviceName, constraint string) (*GrpcConnection, error) {
+	match, err := parseVersionConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	if isShuttingDown() {
+		return nil, ErrShutdown
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	currentConnection := connectionCache[serviceName]
+	if currentConnection == nil {
+		return nil, ErrPoolNotFound
+	}
+	if bypassedFor(serviceName) {
+		return currentConnection.bypassConnection(serviceName)
+	}
+	if len(currentConnection.grpcConnection) == 0 {
+		return nil, ErrNoHealthyEndpoints
+	}
+	if currentConnection.noLeader() {
+		return nil, ErrNoLeader
+	}
+	matching := make([]*GrpcConnection, 0, len(currentConnection.grpcConnection))
+	for _, gc := range currentConnection.grpcConnection {
+		if match(gc.advertisedVersion()) {
+			matching = append(matching, gc)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoMatchingVersion, constraint)
+	}
+	gc := pickConnection(serviceName, matching)
+	atomic.AddUint64(&gc.picks, 1)
+	return gc, nil
+}
+
+// semver - Parsed version: numeric components and pre-release
+type semver struct {
+	parts      []int
+	prerelease string
+}
+
+// parseSemver - Parses versions like 1.4, v1.4.2 or 1.5.0-rc.1; build metadata (+...) is ignored
+func parseSemver(s string) (semver, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	var v semver
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.prerelease = s[:i], s[i+1:]
+	}
+	if s == "" {
+		return v, false
+	}
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.parts = append(v.parts, n)
+	}
+	return v, true
+}
+
+// compare - -1, 0 or 1 if v is lower than, equal to or higher than o. Missing components count as 0, a pre-release is
+// lower than the release.
+func (v semver) compare(o semver) int {
+	for i := 0; i < len(v.parts) || i < len(o.parts); i++ {
+		a, b := 0, 0
+		if i < len(v.parts) {
+			a = v.parts[i]
+		}
+		if i < len(o.parts) {
+			b = o.parts[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.prerelease == o.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case o.prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.prerelease, o.prerelease)
+}
+
+// comparePrerelease - -1, 0 or 1 if the pre-release a is lower than, equal to or higher than b, by their dot separated
+// identifiers as semver orders them: numeric identifiers numerically and lower than alphanumeric ones, which compare
+// as strings, and the shorter pre-release is lower when all identifiers of it are equal (rc.9 < rc.10 < rc.10.1)
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, xErr := strconv.Atoi(as[i])
+		y, yErr := strconv.Atoi(bs[i])
+		switch {
+		case xErr == nil && yErr == nil:
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		case xErr == nil:
+			return -1
+		case yErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// versionOperators - Comparison operators of the constraints, two character operators first
+var versionOperators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// parseVersionConstraint - Returns the function matching the versions which satisfy the constraint. Unknown or
+// unparsable versions never match.
+func parseVersionConstraint(constraint string) (func(version string) bool, error) {
+	type clause struct {
+		op      string
+		version semver
+	}
+	var clauses []clause
+	for _, c := range strings.Split(constraint, ",") {
+		c = strings.TrimSpace(c)
+		op := "="
+		for _, o := range versionOperators {
+			if strings.HasPrefix(c, o) {
+				op, c = o, c[len(o):]
+				break
+			}
+		}
+		v, ok := parseSemver(c)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVersionConstraint, constraint)
+		}
+		clauses = append(clauses, clause{op: op, version: v})
+	}
+	return func(version string) bool {
+		v, ok := parseSemver(version)
+		if !ok {
+			return false
+		}
+		for _, c := range clauses {
+			cmp := v.compare(c.version)
+			var ok bool
+			switch c.op {
+			case ">=":
+				ok = cmp >= 0
+			case "<=":
+				ok = cmp <= 0
+			case ">":
+				ok = cmp > 0
+			case "<":
+				ok = cmp < 0
+			case "!=":
+				ok = cmp != 0
+			default:
+				ok = cmp == 0
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,98 @@
+package kubegrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestVersionConstraint(t *testing.T) {
+	for _, tc := range []struct {
+		constraint, version string
+		want                bool
+	}{
+		{">=1.4", "1.4.0", true},
+		{">=1.4", "v1.10", true},
+		{">=1.4", "1.3.9", false},
+		{">=1.4, <2", "2.0.0", false},
+		{">=1.4, <2", "1.9.3+build.7", true},
+		{"1.4.2", "1.4.2", true},
+		{"!=1.5.0", "1.5", false},
+		{">=1.5.0", "1.5.0-rc.1", false},
+		{">1.5.0-rc.1", "1.5.0-rc.2", true},
+		{">1.5.0-rc.9", "1.5.0-rc.10", true},
+		{"<1.5.0-rc.10", "1.5.0-rc.10.1", false},
+		{">1.5.0-rc.1", "1.5.0-beta.2", false},
+		{"<1.5.0-alpha", "1.5.0-1", true},
+		{">=1.0", "", false},
+		{">=1.0", "latest", false},
+	} {
+		match, err := parseVersionConstraint(tc.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := match(tc.version); got != tc.want {
+			t.Errorf("%q matches %q: %v, want %v", tc.constraint, tc.version, got, tc.want)
+		}
+	}
+	for _, constraint := range []string{"", ">=", ">=1.x", ">=1.4,"} {
+		if _, err := parseVersionConstraint(constraint); !errors.Is(err, ErrInvalidVersionConstraint) {
+			t.Errorf("%q: error %v, want ErrInvalidVersionConstraint", constraint, err)
+		}
+	}
+}
+
+func TestPickVersion(t *testing.T) {
+	p := testPool(t, 3)
+	for i, version := range []string{"1.3.0", "1.4.1", ""} {
+		p.grpcConnection[i].version.Store(version)
+	}
+	cachePool(t, p)
+	for i := 0; i < 20; i++ {
+		gc, err := PickVersion("svc.ns:1000", ">=1.4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gc.podName != "svc-2" || gc.Stats().Version != "1.4.1" {
+			t.Fatalf("picked %s (%s), want svc-2 with 1.4.1", gc.podName, gc.Stats().Version)
+		}
+	}
+	if _, err := PickVersion("svc.ns:1000", ">=2"); !errors.Is(err, ErrNoMatchingVersion) {
+		t.Errorf("error %v, want ErrNoMatchingVersion", err)
+	}
+	if _, err := PickVersion("other.ns:1000", ">=1"); err != ErrPoolNotFound {
+		t.Errorf("error %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestVersionHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		grpc.SetHeader(ctx, metadata.Pairs("server-version", "1.4.2"))
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	p := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithVersionProbe(VersionHeader("server-version"))}))
+	gc, err := dialChecked(p, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.conn.Close()
+	if v := gc.Stats().Version; v != "1.4.2" {
+		t.Errorf("Version = %q, want the advertised 1.4.2", v)
+	}
+}
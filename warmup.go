@@ -0,0 +1,94 @@
+package kubegrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// ErrWarmupTimeout - Register gave up waiting for the connections of the pool to become ready, see WithWarmup
+var ErrWarmupTimeout = errors.New("kubegrpc: warm-up timed out")
+
+// warmupPollInterval - Interval in which Register checks the connections while warming up
+const warmupPollInterval = 20 * time.Millisecond
+
+// WithWarmup - Makes Register block until at least minReady connections of the pool are connected (grpc state
+// READY), or the timeout passed. Has no effect on Connect.
+func WithWarmup(minReady int, timeout time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.warmupMin = minReady
+		c.warmupTimeout = timeout
+	}
+}
+
+// Register - Builds the pool of the service at application startup, so the first Connect does not pay for the
+// discovery and dials. service may carry a port (`service:port`), an empty namespace defaults as described for
+// Connect. Later Connect calls for `service.namespace[:port]` use the pool; the options apply as if passed to the first
+// ConnectWithOptions. With WithWarmup, Register also waits for the connections to become ready and keeps refreshing
+// the pool while pods are missing; it then returns ErrWarmupTimeout if they were not ready in time.
+// Registering does not count as pick.
+func Register(service, namespace string, f GrpcKubeBalancer, opts ...PoolOption) error {
+	serviceName := registeredName(service, namespace)
+	if _, _, _, err := parseServiceName(serviceName); err != nil {
+		return err
+	}
+	mutex.Lock()
+	_, err := openPool(serviceName, f, opts)
+	c := connectionCache[serviceName]
+	mutex.Unlock()
+	cfg := newPoolConfig(opts)
+	if cfg.warmupMin <= 0 {
+		return err
+	}
+	if err != nil && !errors.Is(err, ErrNoHealthyEndpoints) {
+		return err
+	}
+	return warmup(serviceName, c, cfg.warmupMin, cfg.warmupTimeout)
+}
+
+// registeredName - Service name of the pool for the service (optionally with port) and namespace
+func registeredName(service, namespace string) string {
+	if namespace == "" {
+		return service
+	}
+	if i := strings.Index(service, ":"); i >= 0 {
+		return service[:i] + "." + namespace + service[i:]
+	}
+	return service + "." + namespace
+}
+
+// warmup - Waits until minReady connections of the pool are ready, refreshing the pool every second while it holds
+// fewer connections
+func warmup(serviceName string, c *connection, minReady int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	lastRefresh := time.Now()
+	for {
+		total, ready := readyConnections(c)
+		if ready >= minReady {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %d of %d connections ready for %s", ErrWarmupTimeout, ready, minReady, serviceName)
+		}
+		if total < minReady && time.Since(lastRefresh) >= time.Second {
+			lastRefresh = time.Now()
+			updateConnectionPool(serviceName, c, true)
+		}
+		time.Sleep(warmupPollInterval)
+	}
+}
+
+// readyConnections - Number of connections of the pool, and the number of them which are connected
+func readyConnections(c *connection) (total, ready int) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, gc := range c.grpcConnection {
+		if gc.state() == connectivity.Ready {
+			ready++
+		}
+	}
+	return len(c.grpcConnection), ready
+}
@@ -0,0 +1,62 @@
+package kubegrpc
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestRegisteredName(t *testing.T) {
+	for _, c := range []struct{ service, namespace, want string }{
+		{"svc", "ns", "svc.ns"},
+		{"svc:1000", "ns", "svc.ns:1000"},
+		{"svc:1000", "", "svc:1000"},
+	} {
+		if got := registeredName(c.service, c.namespace); got != c.want {
+			t.Errorf("registeredName(%q, %q) = %q, want %q", c.service, c.namespace, got, c.want)
+		}
+	}
+}
+
+func TestRegisterWarmup(t *testing.T) {
+	port := healthServer(t, nil)
+	serviceName := "svc.ns:" + port
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"))
+	defer ClosePool(serviceName)
+	if err := Register("svc:"+port, "ns", okBalancer{}, WithWarmup(1, 5*time.Second)); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	gc := ListPool(serviceName)[0]
+	if s := gc.Stats(); s.Connectivity != connectivity.Ready || s.Picks != 0 {
+		t.Errorf("after Register: state %v with %d picks, want READY without picks", s.Connectivity, s.Picks)
+	}
+}
+
+func TestRegisterWarmupTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close() // Dials are refused
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "127.0.0.1"))
+	defer ClosePool("svc.ns:" + port)
+	err = Register("svc:"+port, "ns", okBalancer{}, WithWarmup(1, 100*time.Millisecond))
+	if !errors.Is(err, ErrWarmupTimeout) {
+		t.Errorf("Register() error = %v, want ErrWarmupTimeout", err)
+	}
+}
+
+func TestRegisterWithoutWarmup(t *testing.T) {
+	useFakeClientset(t, testService("svc", "ns"), testPod("svc-0", "ns", "svc", "10.0.0.1"))
+	defer ClosePool("svc.ns:1000")
+	if err := Register("svc:1000", "ns", okBalancer{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if n := len(ListPool("svc.ns:1000")); n != 1 {
+		t.Errorf("pool size after Register = %d, want 1", n)
+	}
+}
@@ -0,0 +1,86 @@
+package kubegrpc
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// weightAnnotation - Pod annotation with the relative pick weight of the pod, see WithPodWeights
+const weightAnnotation = "kube-grpc/weight"
+
+// PodWeightSource - Source of the per pod pick weights
+type PodWeightSource int
+
+// Pod weight sources
+const (
+	NoPodWeights         PodWeightSource = iota // All pods are picked with the same weight
+	PodWeightAnnotation                         // The `kube-grpc/weight` annotation of the pod, 1 without annotation
+	PodWeightCPURequests                        // The annotation, or else the CPU requests of the pod in cores
+)
+
+// WithPodWeights - Picks the pods in proportion to their weight, so pods on larger nodes of heterogeneous node pools
+// receive a matching share of the traffic. The weights are read when a pod is connected and again on every refresh
+// of the pool, and combine with the circuit breaker, weight overrides and scorers. A weight of 0 takes the pod out of
+// the picks, unless all pods are at 0. With PodWeightCPURequests, pods without annotation and CPU requests weigh 1.
+func WithPodWeights(source PodWeightSource) PoolOption {
+	return func(c *poolConfig) {
+		c.podWeights = source
+	}
+}
+
+// podWeight - The weight of the pod from the source
+func podWeight(pod *corev1.Pod, source PodWeightSource) float64 {
+	if source == NoPodWeights {
+		return 1
+	}
+	if v, ok := pod.Annotations[weightAnnotation]; ok {
+		w, err := strconv.ParseFloat(v, 64)
+		if err == nil && w >= 0 && !math.IsInf(w, 0) {
+			return w
+		}
+		log.Printf("WARNING: podWeight(): Ignoring %s=%q of pod %s", weightAnnotation, v, pod.Name)
+	}
+	if source != PodWeightCPURequests {
+		return 1
+	}
+	var millis int64
+	for _, c := range pod.Spec.Containers {
+		if cpu, ok := c.Resources.Requests[corev1.ResourceCPU]; ok {
+			millis += cpu.MilliValue()
+		}
+	}
+	if millis == 0 {
+		return 1
+	}
+	return float64(millis) / 1000
+}
+
+// setPodWeight - Sets the weight of the pod of the connection
+func (c *GrpcConnection) setPodWeight(w float64) {
+	atomic.StoreUint64(&c.podWeightDelta, math.Float64bits(w-1))
+}
+
+// podWeight - The weight of the pod of the connection, 1 if not set
+func (c *GrpcConnection) podWeight() float64 {
+	return 1 + math.Float64frombits(atomic.LoadUint64(&c.podWeightDelta))
+}
+
+// refreshPodWeights - Updates the weights of the connections from their pods
+func refreshPodWeights(conns []*GrpcConnection, pods []corev1.Pod, source PodWeightSource) {
+	if source == NoPodWeights {
+		return
+	}
+	byIP := make(map[string]*corev1.Pod, len(pods))
+	for i := range pods {
+		byIP[pods[i].Status.PodIP] = &pods[i]
+	}
+	for _, gc := range conns {
+		if pod := byIP[gc.connectionIP]; pod != nil {
+			gc.setPodWeight(podWeight(pod, source))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package kubegrpc
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// podWithCPU - Test pod with the CPU requests of its containers
+func podWithCPU(name, ip string, cpus ...string) *corev1.Pod {
+	pod := testPod(name, "ns", "svc", ip)
+	for _, cpu := range cpus {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}})
+	}
+	return pod
+}
+
+func TestPodWeight(t *testing.T) {
+	annotated := podWithCPU("a", "10.0.0.1", "2")
+	annotated.Annotations = map[string]string{weightAnnotation: "0.5"}
+	invalid := podWithCPU("b", "10.0.0.2", "1500m", "500m")
+	invalid.Annotations = map[string]string{weightAnnotation: "-1"}
+	tests := []struct {
+		name   string
+		pod    *corev1.Pod
+		source PodWeightSource
+		want   float64
+	}{
+		{"no pod weights", annotated, NoPodWeights, 1},
+		{"annotation", annotated, PodWeightAnnotation, 0.5},
+		{"annotation before cpu", annotated, PodWeightCPURequests, 0.5},
+		{"invalid annotation", invalid, PodWeightAnnotation, 1},
+		{"cpu of all containers", invalid, PodWeightCPURequests, 2},
+		{"no cpu requests", testPod("c", "ns", "svc", "10.0.0.3"), PodWeightCPURequests, 1},
+	}
+	for _, tt := range tests {
+		if got := podWeight(tt.pod, tt.source); got != tt.want {
+			t.Errorf("%s: podWeight() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPodWeightPicks(t *testing.T) {
+	p := testPool(t, 2, WithPodWeights(PodWeightCPURequests))
+	if w := p.grpcConnection[0].podWeight(); w != 1 {
+		t.Fatalf("default pod weight = %v, want 1", w)
+	}
+	pods := []corev1.Pod{*podWithCPU("svc-1", "10.0.0.1", "3"), *podWithCPU("svc-2", "10.0.0.2", "1")}
+	refreshPodWeights(p.grpcConnection, pods, PodWeightCPURequests)
+	if s := p.grpcConnection[0].Stats(); s.PodWeight != 3 {
+		t.Fatalf("PodWeight = %v after the refresh, want 3", s.PodWeight)
+	}
+	mutex.RLock()
+	picks := 0
+	for i := 0; i < 4000; i++ {
+		if pickConnection("svc.ns:1000", p.grpcConnection) == p.grpcConnection[0] {
+			picks++
+		}
+	}
+	mutex.RUnlock()
+	if picks < 2800 || picks > 3200 {
+		t.Errorf("%d of 4000 picks on the pod with 3 cores, want about 3000", picks)
+	}
+
+	p.grpcConnection[1].setPodWeight(0)
+	if w := p.grpcConnection[1].podWeight(); w != 0 {
+		t.Errorf("pod weight = %v, want 0", w)
+	}
+}
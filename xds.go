@@ -0,0 +1,282 @@
+package kubegrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc/resolver"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// edsTypeURL - Type of the EDS resources served by EDSHandler
+	edsTypeURL = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+	// xdsScheme - Scheme of the grpc resolver the pools of WithXDS defer to
+	xdsScheme = "xds"
+	// xdsTargetAnnotation - Set on the pod standing in for a service balanced by xDS, holds the dial target
+	xdsTargetAnnotation = "kube-grpc/xds-target"
+	// edsWeightScale - Load balancing weight of an endpoint with full weight, EDS weights are integers
+	edsWeightScale = 100
+)
+
+// xdsBootstrapEnv - Environment variables pointing grpc to its xDS bootstrap, see WithXDS
+var xdsBootstrapEnv = []string{"GRPC_XDS_BOOTSTRAP", "GRPC_XDS_BOOTSTRAP_CONFIG"}
+
+// lookupResolver - The grpc resolver registered for a scheme, replaced in tests
+var lookupResolver = resolver.Get
+
+// WithXDS - Proxyless service mesh interop: when an xDS bootstrap is present (GRPC_XDS_BOOTSTRAP or
+// GRPC_XDS_BOOTSTRAP_CONFIG) and an `xds` resolver is registered with grpc, the pool defers the balancing to the xDS
+// control plane. Like WithPassthrough, the pool then holds a single connection, dialed `xds:///listener`, whose
+// endpoints and policies come from the control plane, with the health checks, statistics and metrics of the pool on
+// top. An empty listener is `name.namespace.svc:port` of the service. Without bootstrap or resolver the pool balances
+// the pods itself. Ignored for pod targets, subset pools, static pools and other clusters.
+func WithXDS(listener string) PoolOption {
+	if !xdsAvailable() {
+		log.Printf("INFO: WithXDS(): No xDS bootstrap or resolver, the pools balance the pods themselves")
+	}
+	return func(c *poolConfig) {
+		c.xds = true
+		c.xdsListener = listener
+	}
+}
+
+// xdsAvailable - True if grpc can resolve xds targets: an xDS bootstrap is configured and the resolver registered
+func xdsAvailable() bool {
+	if lookupResolver(xdsScheme) == nil {
+		return false
+	}
+	for _, env := range xdsBootstrapEnv {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// xdsDeferred - True if the pool of the service defers its balancing to the xDS control plane, see WithXDS
+func xdsDeferred(serviceName string, c *connection) bool {
+	if !c.config.xds || !xdsAvailable() {
+		return false
+	}
+	_, cluster := splitCluster(serviceName)
+	return cluster == "" && podTarget(serviceName) == "" && subsetSelector(serviceName) == nil
+}
+
+// xdsPods - The passthrough pod standing in for the service, dialed with the xds target of the listener
+func xdsPods(svc *corev1.Service, explicit, listener string) (*corev1.PodList, error) {
+	pods, err := passthroughPods(svc, explicit)
+	if err != nil {
+		return nil, err
+	}
+	if listener == "" {
+		port, _ := servicePort(explicit, svc)
+		listener = net.JoinHostPort(svc.Name+"."+svc.Namespace+".svc", port)
+	}
+	pods.Items[0].Annotations[xdsTargetAnnotation] = xdsScheme + ":///" + listener
+	return pods, nil
+}
+
+// grpcTarget - The grpc target of the pod: the xds target of the stand-in of WithXDS, else its address
+func grpcTarget(pod *corev1.Pod, port string) string {
+	if target := pod.Annotations[xdsTargetAnnotation]; target != "" {
+		return target
+	}
+	return net.JoinHostPort(pod.Status.PodIP, port)
+}
+
+// edsAddress - JSON of envoy.config.core.v3.Address
+type edsAddress struct {
+	SocketAddress struct {
+		Address   string `json:"address"`
+		PortValue uint32 `json:"portValue"`
+	} `json:"socketAddress"`
+}
+
+// edsLbEndpoint - JSON of envoy.config.endpoint.v3.LbEndpoint
+type edsLbEndpoint struct {
+	Endpoint struct {
+		Address  edsAddress `json:"address"`
+		Hostname string     `json:"hostname,omitempty"`
+	} `json:"endpoint"`
+	HealthStatus        string `json:"healthStatus"`
+	LoadBalancingWeight uint32 `json:"loadBalancingWeight"`
+}
+
+// edsLocality - JSON of envoy.config.endpoint.v3.LocalityLbEndpoints
+type edsLocality struct {
+	Locality struct {
+		Region string `json:"region,omitempty"`
+		Zone   string `json:"zone,omitempty"`
+	} `json:"locality"`
+	LbEndpoints []edsLbEndpoint `json:"lbEndpoints"`
+}
+
+// edsCluster - JSON of envoy.config.endpoint.v3.ClusterLoadAssignment
+type edsCluster struct {
+	Type        string        `json:"@type"`
+	ClusterName string        `json:"clusterName"`
+	Endpoints   []edsLocality `json:"endpoints"`
+}
+
+// edsResponse - JSON of envoy.service.discovery.v3.DiscoveryResponse
+type edsResponse struct {
+	VersionInfo string       `json:"versionInfo"`
+	Resources   []edsCluster `json:"resources"`
+	TypeURL     string       `json:"typeUrl"`
+}
+
+// EDSHandler - xDS endpoint discovery service (EDS) over the pools, in the REST-JSON variant of xDS, so envoy or a
+// control plane can take the endpoints discovered and health checked by kube-grpc, e.g.
+// mux.Handle("/v3/discovery:endpoints", kubegrpc.EDSHandler()). A POSTed DiscoveryRequest gets a DiscoveryResponse
+// with a ClusterLoadAssignment per pool named in `resource_names` (the service names of the pools, all pools if
+// empty), or 304 Not Modified while `version_info` is the current version. Endpoints are grouped by the zone of their
+// pod; ejected endpoints are UNHEALTHY and draining ones DRAINING. The handler exposes pod IPs, so it belongs on an
+// internal port.
+func EDSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var request map[string]json.RawMessage
+		if err := json.Unmarshal(body, &request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid DiscoveryRequest: %v", err), http.StatusBadRequest)
+			return
+		}
+		var version, typeURL string
+		var names []string
+		for _, f := range []struct {
+			v     interface{}
+			names []string
+		}{
+			{&version, []string{"version_info", "versionInfo"}},
+			{&typeURL, []string{"type_url", "typeUrl"}},
+			{&names, []string{"resource_names", "resourceNames"}},
+		} {
+			if err := jsonField(request, f.v, f.names...); err != nil {
+				http.Error(w, fmt.Sprintf("invalid DiscoveryRequest: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if typeURL != "" && typeURL != edsTypeURL {
+			http.Error(w, fmt.Sprintf("unsupported type %s, only %s", typeURL, edsTypeURL), http.StatusBadRequest)
+			return
+		}
+		response := edsResponse{Resources: edsClusters(names), TypeURL: edsTypeURL}
+		response.VersionInfo = edsVersion(response.Resources)
+		if version == response.VersionInfo {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("ERROR: EDSHandler(): Unable to write the endpoints: %v", err)
+		}
+	})
+}
+
+// jsonField - Decodes the first present of the names (the proto and the JSON name of a field) into v
+func jsonField(object map[string]json.RawMessage, v interface{}, names ...string) error {
+	for _, name := range names {
+		if raw, found := object[name]; found {
+			return json.Unmarshal(raw, v)
+		}
+	}
+	return nil
+}
+
+// edsClusters - The ClusterLoadAssignments of the pools, ordered by service name
+func edsClusters(filter []string) []edsCluster {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	clusters := make([]edsCluster, 0, len(connectionCache))
+	for _, serviceName := range snapshotPools(filter) {
+		c := connectionCache[serviceName]
+		if c == nil {
+			continue
+		}
+		localities := make(map[[2]string]*edsLocality)
+		for _, gc := range c.grpcConnection {
+			port, err := strconv.ParseUint(gc.port, 10, 32)
+			if err != nil || net.ParseIP(gc.connectionIP) == nil {
+				// Stand-ins for a service (passthrough, xDS) have no endpoint address
+				continue
+			}
+			var e edsLbEndpoint
+			e.Endpoint.Address.SocketAddress.Address = gc.connectionIP
+			e.Endpoint.Address.SocketAddress.PortValue = uint32(port)
+			e.Endpoint.Hostname = gc.podName
+			stats := gc.Stats()
+			e.HealthStatus, e.LoadBalancingWeight = edsHealth(stats)
+			key := [2]string{gc.labels[corev1.LabelZoneRegionStable], gc.zone}
+			l := localities[key]
+			if l == nil {
+				l = &edsLocality{}
+				l.Locality.Region, l.Locality.Zone = key[0], key[1]
+				localities[key] = l
+			}
+			l.LbEndpoints = append(l.LbEndpoints, e)
+		}
+		cluster := edsCluster{Type: edsTypeURL, ClusterName: serviceName, Endpoints: make([]edsLocality, 0, len(localities))}
+		for _, l := range localities {
+			sort.Slice(l.LbEndpoints, func(i, j int) bool {
+				a, b := l.LbEndpoints[i].Endpoint, l.LbEndpoints[j].Endpoint
+				if a.Hostname != b.Hostname {
+					return a.Hostname < b.Hostname
+				}
+				return a.Address.SocketAddress.Address < b.Address.SocketAddress.Address
+			})
+			cluster.Endpoints = append(cluster.Endpoints, *l)
+		}
+		sort.Slice(cluster.Endpoints, func(i, j int) bool {
+			a, b := cluster.Endpoints[i].Locality, cluster.Endpoints[j].Locality
+			if a.Region != b.Region {
+				return a.Region < b.Region
+			}
+			return a.Zone < b.Zone
+		})
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].ClusterName < clusters[j].ClusterName })
+	return clusters
+}
+
+// edsHealth - The EDS health status and load balancing weight of the endpoint
+func edsHealth(stats EndpointStats) (string, uint32) {
+	weight := uint32(math.Round(stats.Weight * stats.PodWeight * stats.Override * edsWeightScale))
+	if weight < 1 {
+		weight = 1
+	}
+	switch stats.State() {
+	case Draining:
+		return "DRAINING", weight
+	case Ejected:
+		return "UNHEALTHY", weight
+	}
+	return "HEALTHY", weight
+}
+
+// edsVersion - Version of the resources: a hash of their content, so unchanged endpoints keep their version
+func edsVersion(clusters []edsCluster) string {
+	h := fnv.New64a()
+	if err := json.NewEncoder(h).Encode(clusters); err != nil {
+		log.Printf("ERROR: edsVersion(): Unable to hash the endpoints: %v", err)
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
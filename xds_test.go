@@ -0,0 +1,111 @@
+package kubegrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// postEDS - Sends the DiscoveryRequest to EDSHandler
+func postEDS(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	EDSHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v3/discovery:endpoints", strings.NewReader(body)))
+	return w
+}
+
+func TestEDSHandler(t *testing.T) {
+	p := testPool(t, 2)
+	cachePool(t, p)
+	w := postEDS(t, `{"resource_names": ["svc.ns:1000", "unknown.ns:1"], "type_url": "`+edsTypeURL+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("EDSHandler() = %d %s, want 200", w.Code, w.Body)
+	}
+	var response edsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Resources) != 1 || response.Resources[0].ClusterName != "svc.ns:1000" ||
+		len(response.Resources[0].Endpoints) != 1 {
+		t.Fatalf("resources = %+v, want svc.ns:1000 in one locality", response.Resources)
+	}
+	endpoints := response.Resources[0].Endpoints[0].LbEndpoints
+	if len(endpoints) != 2 || endpoints[0].Endpoint.Address.SocketAddress.Address != "10.0.0.1" ||
+		endpoints[0].Endpoint.Address.SocketAddress.PortValue != 1000 || endpoints[0].HealthStatus != "HEALTHY" ||
+		endpoints[0].LoadBalancingWeight != edsWeightScale {
+		t.Errorf("endpoints = %+v, want svc-1 and svc-2 healthy on port 1000", endpoints)
+	}
+	unchanged := postEDS(t, `{"versionInfo": "`+response.VersionInfo+`", "resourceNames": ["svc.ns:1000"]}`)
+	if unchanged.Code != http.StatusNotModified {
+		t.Errorf("EDSHandler() with the current version = %d, want 304", unchanged.Code)
+	}
+	if w := postEDS(t, `{"type_url": "type.googleapis.com/envoy.config.cluster.v3.Cluster"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("EDSHandler() for clusters = %d, want 400", w.Code)
+	}
+	get := httptest.NewRecorder()
+	EDSHandler().ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/v3/discovery:endpoints", nil))
+	if get.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want 405", get.Code)
+	}
+}
+
+func TestEDSHealth(t *testing.T) {
+	for _, tc := range []struct {
+		stats  EndpointStats
+		status string
+		weight uint32
+	}{
+		{EndpointStats{Weight: 1, PodWeight: 2, Override: 1}, "HEALTHY", 200},
+		{EndpointStats{Weight: 0.5, PodWeight: 1, Override: 1}, "HEALTHY", 50},
+		{EndpointStats{Weight: 0, PodWeight: 1, Override: 1}, "UNHEALTHY", 1},
+		{EndpointStats{Weight: 1, PodWeight: 1, Override: 1, Draining: true}, "DRAINING", 100},
+	} {
+		if status, weight := edsHealth(tc.stats); status != tc.status || weight != tc.weight {
+			t.Errorf("edsHealth(%+v) = %s %d, want %s %d", tc.stats, status, weight, tc.status, tc.weight)
+		}
+	}
+}
+
+func TestWithXDS(t *testing.T) {
+	c := newConnection(okBalancer{}, newPoolConfig([]PoolOption{WithXDS("")}))
+	t.Setenv(xdsBootstrapEnv[0], "/etc/xds/bootstrap.json")
+	if xdsDeferred("svc.ns:1000", c) {
+		t.Error("pool deferred to xDS without resolver")
+	}
+	t.Setenv(xdsBootstrapEnv[0], "")
+	previous := lookupResolver
+	t.Cleanup(func() { lookupResolver = previous })
+	lookupResolver = func(scheme string) resolver.Builder {
+		if scheme == xdsScheme {
+			return manual.NewBuilderWithScheme(xdsScheme)
+		}
+		return previous(scheme)
+	}
+	if xdsDeferred("svc.ns:1000", c) {
+		t.Error("pool deferred to xDS without bootstrap")
+	}
+	t.Setenv(xdsBootstrapEnv[0], "/etc/xds/bootstrap.json")
+	if !xdsDeferred("svc.ns:1000", c) || xdsDeferred("svc.ns:1000/svc-1", c) || xdsDeferred("svc.ns:1000?tenant=a", c) {
+		t.Error("xdsDeferred() does not defer exactly the service pool")
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"},
+		Spec: corev1.ServiceSpec{ClusterIP: "10.96.0.1", Ports: []corev1.ServicePort{{Port: 1000}}}}
+	pods, err := xdsPods(svc, "", "")
+	if err != nil || len(pods.Items) != 1 || !passthroughPod(&pods.Items[0]) {
+		t.Fatalf("xdsPods() = %v, %v, want the passthrough stand-in", pods, err)
+	}
+	if target := grpcTarget(&pods.Items[0], "1000"); target != "xds:///svc.ns.svc:1000" {
+		t.Errorf("grpcTarget() = %s, want xds:///svc.ns.svc:1000", target)
+	}
+	pods, _ = xdsPods(svc, "", "orders-listener")
+	if target := grpcTarget(&pods.Items[0], "1000"); target != "xds:///orders-listener" {
+		t.Errorf("grpcTarget() with listener = %s", target)
+	}
+}